@@ -0,0 +1,93 @@
+package backup
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"log/slog"
+	"path"
+	"path/filepath"
+
+	"github.com/minamijoyo/tfmigrate/storage"
+)
+
+// Backup saves and loads remote states pulled before pushing new states for
+// a migration file. Each backup is stored at a key derived from the migration
+// file name, a working directory and a workspace as follows:
+// <migration file>/<dir>/<workspace>.tfstate
+type Backup struct {
+	// config is a storage config which stores multiple objects.
+	config storage.KeyedConfig
+	// migrationFile is a base name of migration file.
+	migrationFile string
+}
+
+// New returns a new Backup instance for a given migration file.
+func New(config *Config, migrationFile string) (*Backup, error) {
+	keyed, ok := config.Storage.(storage.KeyedConfig)
+	if !ok {
+		return nil, fmt.Errorf("the storage doesn't support backups: %T", config.Storage)
+	}
+
+	b := &Backup{
+		config:        keyed,
+		migrationFile: filepath.Base(migrationFile),
+	}
+	return b, nil
+}
+
+// Key returns a key of backup for a given working dir and workspace.
+func (b *Backup) Key(dir string, workspace string) string {
+	d := storage.EscapeKeySegment(filepath.ToSlash(filepath.Clean(dir)))
+	w := storage.EscapeKeySegment(workspace)
+	return path.Join(b.migrationFile, d, w+".tfstate")
+}
+
+// noStateMarker is stored in place of an empty state, which means that no
+// state existed when the backup was taken, so that it's distinguished from a
+// backup not found.
+var noStateMarker = []byte(`{"tfmigrate_no_state":true}`)
+
+// Save saves a given state of a working dir and workspace.
+// An empty state means that no state exists.
+func (b *Backup) Save(ctx context.Context, dir string, workspace string, state []byte) error {
+	key := b.Key(dir, workspace)
+	s, err := b.config.NewKeyedStorage(key)
+	if err != nil {
+		return err
+	}
+
+	if len(state) == 0 {
+		state = noStateMarker
+	}
+
+	slog.DebugContext(ctx, "write a backup", "component", "backup", "key", key)
+	if err := s.Write(ctx, state); err != nil {
+		return fmt.Errorf("failed to save a backup of state: %s, err: %s", key, err)
+	}
+	return nil
+}
+
+// Load loads a state of a working dir and workspace.
+// It returns an error if the backup is not found, and an empty state if no
+// state existed when the backup was taken.
+func (b *Backup) Load(ctx context.Context, dir string, workspace string) ([]byte, error) {
+	key := b.Key(dir, workspace)
+	s, err := b.config.NewKeyedStorage(key)
+	if err != nil {
+		return nil, err
+	}
+
+	slog.DebugContext(ctx, "read a backup", "component", "backup", "key", key)
+	state, err := s.Read(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load a backup of state: %s, err: %s", key, err)
+	}
+	if len(state) == 0 {
+		return nil, fmt.Errorf("backup not found: %s", key)
+	}
+	if bytes.Equal(state, noStateMarker) {
+		return []byte{}, nil
+	}
+	return state, nil
+}
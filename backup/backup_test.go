@@ -0,0 +1,101 @@
+package backup
+
+import (
+	"context"
+	"testing"
+
+	"github.com/minamijoyo/tfmigrate/storage/mock"
+)
+
+func TestBackupKey(t *testing.T) {
+	cases := []struct {
+		desc          string
+		migrationFile string
+		dir           string
+		workspace     string
+		want          string
+	}{
+		{
+			desc:          "simple",
+			migrationFile: "20201012010101_foo.hcl",
+			dir:           "dir1",
+			workspace:     "default",
+			want:          "20201012010101_foo.hcl/dir1/default.tfstate",
+		},
+		{
+			desc:          "relative paths",
+			migrationFile: "tfmigrate/20201012010101_foo.hcl",
+			dir:           "../dir1/",
+			workspace:     "work",
+			want:          "20201012010101_foo.hcl/%2E%2E%2Fdir1/work.tfstate",
+		},
+		{
+			desc:          "current dir",
+			migrationFile: "20201012010101_foo.hcl",
+			dir:           ".",
+			workspace:     "default",
+			want:          "20201012010101_foo.hcl/%2E/default.tfstate",
+		},
+		{
+			desc:          "workspace with special characters",
+			migrationFile: "20201012010101_foo.hcl",
+			dir:           "dir1",
+			workspace:     "a.b/c",
+			want:          "20201012010101_foo.hcl/dir1/a%2Eb%2Fc.tfstate",
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.desc, func(t *testing.T) {
+			b, err := New(&Config{Storage: &mock.Config{}}, tc.migrationFile)
+			if err != nil {
+				t.Fatalf("unexpected err: %s", err)
+			}
+			got := b.Key(tc.dir, tc.workspace)
+			if got != tc.want {
+				t.Errorf("got: %s, want: %s", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestBackupSaveAndLoad(t *testing.T) {
+	config := &mock.Config{}
+	b, err := New(&Config{Storage: config}, "20201012010101_foo.hcl")
+	if err != nil {
+		t.Fatalf("unexpected err: %s", err)
+	}
+	ctx := context.Background()
+
+	if _, err := b.Load(ctx, "dir1", "default"); err == nil {
+		t.Fatalf("expected to return an error for a missing backup, but no error")
+	}
+
+	if err := b.Save(ctx, "dir1", "default", []byte("foo")); err != nil {
+		t.Fatalf("failed to save: %s", err)
+	}
+
+	got, err := b.Load(ctx, "dir1", "default")
+	if err != nil {
+		t.Fatalf("failed to load: %s", err)
+	}
+	if string(got) != "foo" {
+		t.Errorf("got: %s, want: foo", string(got))
+	}
+
+	if data := config.KeyedStorage("20201012010101_foo.hcl/dir1/default.tfstate").Data(); data != "foo" {
+		t.Errorf("unexpected data in storage: %s", data)
+	}
+
+	// an empty state means that no state existed.
+	if err := b.Save(ctx, "dir2", "default", []byte{}); err != nil {
+		t.Fatalf("failed to save: %s", err)
+	}
+	got, err = b.Load(ctx, "dir2", "default")
+	if err != nil {
+		t.Fatalf("failed to load: %s", err)
+	}
+	if len(got) != 0 {
+		t.Errorf("got: %s, want an empty state", string(got))
+	}
+}
@@ -0,0 +1,13 @@
+package backup
+
+import (
+	"github.com/minamijoyo/tfmigrate/storage"
+)
+
+// Config is a set of configurations for state backups.
+type Config struct {
+	// Storage is an interface of factory method for Storage.
+	// The path of the storage is used as a prefix of backups, so the storage
+	// must implement storage.KeyedConfig.
+	Storage storage.Config
+}
@@ -3,7 +3,7 @@ package command
 import (
 	"context"
 	"fmt"
-	"log"
+	"log/slog"
 	"strings"
 
 	flag "github.com/spf13/pflag"
@@ -13,13 +13,23 @@ import (
 type ApplyCommand struct {
 	Meta
 	backendConfig []string
+	down          bool
+	rerun         int
+	isolated      bool
+	atomic        bool
 }
 
 // Run runs the procedure of this command.
 func (c *ApplyCommand) Run(args []string) int {
 	cmdFlags := flag.NewFlagSet("apply", flag.ContinueOnError)
 	cmdFlags.StringVar(&c.configFile, "config", defaultConfigFile, "A path to tfmigrate config file")
+	cmdFlags.StringArrayVar(&c.timeouts, "timeout", nil, "A timeout in CLASS=DURATION format")
+	cmdFlags.BoolVar(&c.streamOutput, "stream-output", false, "Stream output of terraform commands in real time")
 	cmdFlags.StringArrayVar(&c.backendConfig, "backend-config", nil, "A backend configuration for remote state")
+	cmdFlags.BoolVar(&c.down, "down", false, "Roll back a migration")
+	cmdFlags.IntVar(&c.rerun, "rerun-on-state-change", 0, "Re-run a migration up to N times if the remote state changed during migration")
+	cmdFlags.BoolVar(&c.isolated, "isolated", false, "Run terraform commands in an isolated work dir")
+	cmdFlags.BoolVar(&c.atomic, "atomic", false, "Push new states only after all unapplied migrations are planned")
 
 	if err := cmdFlags.Parse(args); err != nil {
 		c.UI.Error(fmt.Sprintf("failed to parse arguments: %s", err))
@@ -31,13 +41,31 @@ func (c *ApplyCommand) Run(args []string) int {
 		c.UI.Error(fmt.Sprintf("failed to load config file: %s", err))
 		return 1
 	}
-	log.Printf("[DEBUG] [command] config: %#v\n", c.config)
+	if err = setTimeouts(c.config, c.timeouts); err != nil {
+		c.UI.Error(fmt.Sprintf("failed to parse timeouts: %s", err))
+		return 1
+	}
+	slog.Debug("config", "component", "command", "config", fmt.Sprintf("%#v", c.config))
 
-	c.Option = newOption()
+	c.Option = newOption(c.config)
+	if c.streamOutput {
+		c.Option.StreamOutput = true
+	}
 	c.Option.BackendConfig = c.backendConfig
+	c.Option.RerunOnRemoteStateChange = c.rerun
+	c.Option.Isolated = c.isolated
 	// The option may contain sensitive values such as environment variables.
 	// So logging the option set log level to DEBUG instead of INFO.
-	log.Printf("[DEBUG] [command] option: %#v\n", c.Option)
+	slog.Debug("option", "component", "command", "option", fmt.Sprintf("%#v", c.Option))
+
+	// cancel the migration gracefully on signals.
+	ctx, stop := newSignalContext()
+	defer stop()
+
+	if c.atomic && (c.config.History == nil || c.down || len(cmdFlags.Args()) != 0) {
+		c.UI.Error("The --atomic option is only available to apply all unapplied migrations in history-mode")
+		return 1
+	}
 
 	if c.config.History == nil {
 		// non-history mode
@@ -48,7 +76,7 @@ func (c *ApplyCommand) Run(args []string) int {
 		}
 
 		migrationFile := cmdFlags.Arg(0)
-		if err = c.applyWithoutHistory(migrationFile); err != nil {
+		if err = c.applyWithoutHistory(ctx, migrationFile); err != nil {
 			c.UI.Error(err.Error())
 			return 1
 		}
@@ -70,7 +98,7 @@ func (c *ApplyCommand) Run(args []string) int {
 	}
 
 	// Apply all unapplied pending migrations and save them to history.
-	if err = c.applyWithHistory(migrationFile); err != nil {
+	if err = c.applyWithHistory(ctx, migrationFile); err != nil {
 		c.UI.Error(err.Error())
 		return 1
 	}
@@ -79,23 +107,30 @@ func (c *ApplyCommand) Run(args []string) int {
 }
 
 // applyWithoutHistory is a helper function which applies a given migration file without history.
-func (c *ApplyCommand) applyWithoutHistory(filename string) error {
-	fr, err := NewFileRunner(filename, c.config, c.Option)
+func (c *ApplyCommand) applyWithoutHistory(ctx context.Context, filename string) error {
+	newRunner := NewFileRunner
+	if c.down {
+		newRunner = NewRollbackFileRunner
+	}
+	fr, err := newRunner(filename, c.config, c.Option)
 	if err != nil {
 		return err
 	}
 
-	return fr.Apply(context.Background())
+	return fr.Apply(ctx)
 }
 
 // applyWithHistory is a helper function which applies all unapplied pending migrations and saves them to history.
-func (c *ApplyCommand) applyWithHistory(filename string) error {
-	ctx := context.Background()
+func (c *ApplyCommand) applyWithHistory(ctx context.Context, filename string) error {
 	hr, err := NewHistoryRunner(ctx, filename, c.config, c.Option)
 	if err != nil {
 		return err
 	}
 
+	if c.down {
+		return hr.Rollback(ctx)
+	}
+	hr.SetAtomic(c.atomic)
 	return hr.Apply(ctx)
 }
 
@@ -106,16 +141,49 @@ Usage: tfmigrate apply [PATH]
 
 Apply computes a new state and pushes it to remote state.
 It will fail if terraform plan detects any diffs with the new state.
+Before pushing, it pulls the remote state again and aborts if the lineage or
+serial has been changed since the migration started.
 
 Arguments
   PATH                     A path of migration file
                            Required in non-history mode. Optional in history-mode.
+                           If not set with --down in history-mode, the last
+                           applied migration in order of file names is used.
 
 Options:
   --config                 A path to tfmigrate config file
+  --timeout=CLASS=DURATION
+                           A timeout such as init=10m, which overrides the timeouts
+                           block in the config file. Valid classes are init, plan,
+                           state, push and migration. Can be specified multiple times.
+  --stream-output          Stream output of terraform commands to the console in real
+                           time with a [dir] prefix, instead of showing it only on errors.
+                           It can also be enabled by setting TFMIGRATE_STREAM=1.
   --backend-config=path    A backend configuration, a path to backend configuration file or
                            key=value format backend configuraion.
                            This option is passed to terraform init when switching backend to remote.
+  --down                   Roll back a migration instead of applying it.
+                           The actions are taken from the down block, or computed
+                           from inverses of the actions if not defined.
+                           In history-mode, the migration must have been applied,
+                           and the rollback is recorded in history.
+  --rerun-on-state-change=N
+                           Re-run a migration against the fresh remote state up to
+                           N times if the remote state has been changed by someone
+                           else during the migration. Default to 0, which means to
+                           abort with an error.
+  --isolated               Run terraform commands in a temporary directory which
+                           overlays the root module instead of the root module itself.
+                           The .terraform.lock.hcl is copied and TF_PLUGIN_CACHE_DIR is
+                           shared, so the original directory is never touched even if
+                           the migration is interrupted.
+  --atomic                 Apply all unapplied migrations atomically in history-mode.
+                           It plans all of them cumulatively and pushes the new states
+                           only if all plans succeed. If pushing a state fails, the states
+                           already pushed are restored to the ones before the first migration.
+                           With a backup block, the states before the first migration are
+                           backed up for every migration, so any of them can be restored.
+                           The locks of all the states are held until the end.
 `
 	return strings.TrimSpace(helpText)
 }
@@ -0,0 +1,174 @@
+package command
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"strings"
+
+	"github.com/minamijoyo/tfmigrate/history"
+	"github.com/minamijoyo/tfmigrate/tfmigrate"
+	flag "github.com/spf13/pflag"
+)
+
+// CleanupCommand is a command which removes artifacts left by a migration
+// which has been killed.
+type CleanupCommand struct {
+	Meta
+	backendConfig []string
+	all           bool
+	force         bool
+}
+
+// Run runs the procedure of this command.
+func (c *CleanupCommand) Run(args []string) int {
+	cmdFlags := flag.NewFlagSet("cleanup", flag.ContinueOnError)
+	cmdFlags.StringVar(&c.configFile, "config", defaultConfigFile, "A path to tfmigrate config file")
+	cmdFlags.StringArrayVar(&c.timeouts, "timeout", nil, "A timeout in CLASS=DURATION format")
+	cmdFlags.BoolVar(&c.streamOutput, "stream-output", false, "Stream output of terraform commands in real time")
+	cmdFlags.StringArrayVar(&c.backendConfig, "backend-config", nil, "A backend configuration for remote state")
+	cmdFlags.BoolVar(&c.all, "all", false, "Clean up all directories referenced by migration files")
+	cmdFlags.BoolVar(&c.force, "force", false, "Discard local states even if they are newer than remote")
+
+	if err := cmdFlags.Parse(args); err != nil {
+		c.UI.Error(fmt.Sprintf("failed to parse arguments: %s", err))
+		return 1
+	}
+
+	if c.all == (len(cmdFlags.Args()) > 0) {
+		c.UI.Error("The command expects either DIR arguments or --all")
+		c.UI.Error(c.Help())
+		return 1
+	}
+
+	var err error
+	if c.config, err = newConfig(c.configFile); err != nil {
+		c.UI.Error(fmt.Sprintf("failed to load config file: %s", err))
+		return 1
+	}
+	if err = setTimeouts(c.config, c.timeouts); err != nil {
+		c.UI.Error(fmt.Sprintf("failed to parse timeouts: %s", err))
+		return 1
+	}
+	slog.Debug("config", "component", "command", "config", fmt.Sprintf("%#v", c.config))
+
+	c.Option = newOption(c.config)
+	if c.streamOutput {
+		c.Option.StreamOutput = true
+	}
+	c.Option.BackendConfig = c.backendConfig
+	c.Option.IsBackendTerraformCloud = c.config.IsBackendTerraformCloud
+	// The option may contain sensitive values such as environment variables.
+	// So logging the option set log level to DEBUG instead of INFO.
+	slog.Debug("option", "component", "command", "option", fmt.Sprintf("%#v", c.Option))
+
+	dirs := cmdFlags.Args()
+	if c.all {
+		dirs, err = migrationDirs(c.config.MigrationDir)
+		if err != nil {
+			c.UI.Error(err.Error())
+			return 1
+		}
+	}
+
+	// cancel the cleanup gracefully on signals.
+	ctx, stop := newSignalContext()
+	defer stop()
+
+	failed := 0
+	for _, dir := range dirs {
+		cleaned, err := c.cleanup(ctx, dir)
+		if err != nil {
+			c.UI.Error(fmt.Sprintf("failed to clean up %s: %s", dir, err))
+			failed++
+			continue
+		}
+		if cleaned {
+			c.UI.Output(fmt.Sprintf("cleaned up: %s", dir))
+		} else {
+			c.UI.Output(fmt.Sprintf("nothing to clean up: %s", dir))
+		}
+	}
+
+	if failed > 0 {
+		return 1
+	}
+	return 0
+}
+
+// cleanup is a helper function which cleans up a given working directory
+// within the migration timeout.
+func (c *CleanupCommand) cleanup(ctx context.Context, dir string) (bool, error) {
+	ctx, cancel := withMigrationTimeout(ctx, c.config.MigrationTimeout, "cleanup "+dir)
+	defer cancel()
+	return tfmigrate.CleanupWorkDir(ctx, dir, c.Option, c.force)
+}
+
+// migrationDirs returns a list of unique working directories referenced by
+// migration files in a given migration dir in order of appearance.
+func migrationDirs(migrationDir string) ([]string, error) {
+	filenames, err := history.LoadMigrationFileNames(migrationDir)
+	if err != nil {
+		return nil, err
+	}
+
+	dirs := []string{}
+	seen := make(map[string]bool)
+	for _, filename := range filenames {
+		mc, err := loadMigrationFile(resolveMigrationFile(migrationDir, filename))
+		if err != nil {
+			return nil, err
+		}
+		mdirs, err := tfmigrate.MigrationDirs(mc)
+		if err != nil {
+			return nil, err
+		}
+		for _, dir := range mdirs {
+			if seen[dir] {
+				continue
+			}
+			seen[dir] = true
+			dirs = append(dirs, dir)
+		}
+	}
+	return dirs, nil
+}
+
+// Help returns long-form help text.
+func (c *CleanupCommand) Help() string {
+	helpText := `
+Usage: tfmigrate cleanup [options] [DIR...]
+
+Cleanup removes artifacts left in working directories by a migration which
+has been killed, that is, the _tfmigrate_override.tf file and the local
+terraform.tfstate.d folders, and re-runs terraform init -reconfigure to
+switch the backend back to remote.
+It refuses to remove a local state which is newer than the remote state or
+has a different lineage, because it may have been written by the migration.
+
+Arguments:
+  DIR                      A working directory to clean up
+
+Options:
+  --config                 A path to tfmigrate config file
+  --timeout=CLASS=DURATION
+                           A timeout such as init=10m, which overrides the timeouts
+                           block in the config file. Valid classes are init, plan,
+                           state, push and migration. Can be specified multiple times.
+  --stream-output          Stream output of terraform commands to the console in real
+                           time with a [dir] prefix, instead of showing it only on errors.
+                           It can also be enabled by setting TFMIGRATE_STREAM=1.
+  --backend-config=path    A backend configuration, a path to backend configuration file or
+                           key=value format backend configuraion.
+                           This option is passed to terraform init when switching backend to remote.
+  --all                    Clean up all directories referenced by migration files
+                           in the migration_dir instead of given directories.
+  --force                  Discard local states even if they are newer than remote.
+`
+	return strings.TrimSpace(helpText)
+}
+
+// Synopsis returns one-line help text.
+func (c *CleanupCommand) Synopsis() string {
+	return "Clean up a working directory left by a killed migration"
+}
@@ -0,0 +1,47 @@
+package command
+
+import (
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestMigrationDirs(t *testing.T) {
+	migrations := map[string]string{
+		"20201109000001_test1.hcl": `
+migration "state" "test1" {
+	dir = "dir1"
+	actions = [
+		"mv null_resource.foo null_resource.foo2",
+	]
+}
+`,
+		"20201109000002_test2.hcl": `
+migration "multi_state" "test2" {
+	from_dir = "dir2"
+	to_dir   = "dir1"
+	actions = [
+		"mv null_resource.foo null_resource.foo2",
+	]
+}
+`,
+		"20201109000003_test3.hcl": `
+migration "state" "test3" {
+	actions = [
+		"rm null_resource.bar",
+	]
+}
+`,
+	}
+	migrationDir := setupMigrationDir(t, migrations)
+
+	got, err := migrationDirs(migrationDir)
+	if err != nil {
+		t.Fatalf("unexpected err: %s", err)
+	}
+
+	want := []string{"dir1", "dir2", "."}
+	if diff := cmp.Diff(got, want); diff != "" {
+		t.Errorf("got: %v, want: %v, diff: %s", got, want, diff)
+	}
+}
@@ -0,0 +1,120 @@
+package command
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"os"
+	"strings"
+
+	"github.com/minamijoyo/tfmigrate/tfmigrate"
+	flag "github.com/spf13/pflag"
+)
+
+// ExportCommand is a command which translates a migration into Terraform
+// configuration blocks.
+type ExportCommand struct {
+	Meta
+	format string
+	out    string
+}
+
+// Run runs the procedure of this command.
+func (c *ExportCommand) Run(args []string) int {
+	cmdFlags := flag.NewFlagSet("export", flag.ContinueOnError)
+	cmdFlags.StringVar(&c.configFile, "config", defaultConfigFile, "A path to tfmigrate config file")
+	cmdFlags.StringVar(&c.format, "format", "hcl", "An output format")
+	cmdFlags.StringVar(&c.out, "out", "", "Write the exported configuration to the given path")
+
+	if err := cmdFlags.Parse(args); err != nil {
+		c.UI.Error(fmt.Sprintf("failed to parse arguments: %s", err))
+		return 1
+	}
+
+	if len(cmdFlags.Args()) != 1 {
+		c.UI.Error(fmt.Sprintf("The command expects 1 argument, but got %d", len(cmdFlags.Args())))
+		c.UI.Error(c.Help())
+		return 1
+	}
+
+	if c.format != "hcl" {
+		c.UI.Error(fmt.Sprintf("unsupported format: %s", c.format))
+		return 1
+	}
+
+	var err error
+	if c.config, err = newConfig(c.configFile); err != nil {
+		c.UI.Error(fmt.Sprintf("failed to load config file: %s", err))
+		return 1
+	}
+	slog.Debug("config", "component", "command", "config", fmt.Sprintf("%#v", c.config))
+
+	c.Option = newOption(c.config)
+	slog.Debug("option", "component", "command", "option", fmt.Sprintf("%#v", c.Option))
+
+	path := resolveMigrationFile(c.config.MigrationDir, cmdFlags.Arg(0))
+	slog.Info("load migration file", "component", "command", "path", path)
+	mc, err := loadMigrationFile(path)
+	if err != nil {
+		c.UI.Error(err.Error())
+		return 1
+	}
+
+	exported, err := tfmigrate.ExportMigration(context.Background(), mc, c.Option)
+	if err != nil {
+		c.UI.Error(err.Error())
+		return 1
+	}
+
+	for _, msg := range exported.Unsupported {
+		c.UI.Warn(fmt.Sprintf("unsupported action: %s", msg))
+	}
+
+	if len(c.out) == 0 {
+		c.UI.Output(strings.TrimSuffix(string(exported.Source), "\n"))
+		return 0
+	}
+
+	slog.Info("write exported configuration", "component", "command", "path", c.out)
+	if err := os.WriteFile(c.out, exported.Source, 0644); err != nil {
+		c.UI.Error(fmt.Sprintf("failed to write exported configuration: %s", err))
+		return 1
+	}
+	c.UI.Output(fmt.Sprintf("The exported configuration should be placed in %s", exported.Dir))
+	return 0
+}
+
+// Help returns long-form help text.
+func (c *ExportCommand) Help() string {
+	helpText := `
+Usage: tfmigrate export [options] PATH
+
+Export translates a migration into Terraform configuration blocks.
+The mv and xmv actions are translated into moved blocks (Terraform v1.1+),
+the import actions into import blocks (Terraform v1.5+) and the rm actions into
+removed blocks (Terraform v1.7+). Wildcards of xmv actions are expanded against
+the current remote state, so it runs terraform init and terraform state list
+only if the migration contains xmv actions.
+
+Actions which cannot be expressed in configuration, such as moves across
+states in a multi_state migration and replace-provider, are written as
+comments and reported as warnings.
+
+Arguments:
+  PATH                     A path of migration file
+
+Options:
+  --config                 A path to tfmigrate config file
+  --format                 An output format
+                           Valid values are as follows:
+                             - hcl (default)
+  --out=path               Write the exported configuration to the given path.
+                           If not set, it is written to stdout.
+`
+	return strings.TrimSpace(helpText)
+}
+
+// Synopsis returns one-line help text.
+func (c *ExportCommand) Synopsis() string {
+	return "Export a migration as Terraform configuration blocks"
+}
@@ -2,12 +2,18 @@ package command
 
 import (
 	"context"
-	"log"
+	"fmt"
+	"log/slog"
 	"os"
 	"path/filepath"
 
+	"github.com/minamijoyo/tfmigrate/backup"
 	"github.com/minamijoyo/tfmigrate/config"
+	"github.com/minamijoyo/tfmigrate/lock"
+	"github.com/minamijoyo/tfmigrate/logging"
 	"github.com/minamijoyo/tfmigrate/tfmigrate"
+	"github.com/minamijoyo/tfmigrate/tracing"
+	"go.opentelemetry.io/otel/trace"
 )
 
 // FileRunner is a runner for a single migration file.
@@ -24,22 +30,56 @@ type FileRunner struct {
 
 // NewFileRunner returns a new FileRunner instance.
 func NewFileRunner(filename string, config *config.TfmigrateConfig, option *tfmigrate.MigratorOption) (*FileRunner, error) {
+	return newFileRunner(filename, config, option, false)
+}
+
+// NewRollbackFileRunner returns a new FileRunner instance which rolls back a
+// given migration instead of applying it.
+func NewRollbackFileRunner(filename string, config *config.TfmigrateConfig, option *tfmigrate.MigratorOption) (*FileRunner, error) {
+	return newFileRunner(filename, config, option, true)
+}
+
+// newFileRunner is a helper function which returns a new FileRunner instance.
+// If rollback is true, it builds a migrator which rolls back the migration.
+func newFileRunner(filename string, config *config.TfmigrateConfig, option *tfmigrate.MigratorOption, rollback bool) (*FileRunner, error) {
 	path := resolveMigrationFile(config.MigrationDir, filename)
-	log.Printf("[INFO] [runner] load migration file: %s\n", path)
+	slog.Info("load migration file", "component", "runner", "path", path)
 	mc, err := loadMigrationFile(path)
 	if err != nil {
 		return nil, err
 	}
 
 	if option != nil {
-		option.IsBackendTerraformCloud = config.IsBackendTerraformCloud
+		// copy the option not to modify the shared one, because it may be
+		// used concurrently by other runners.
+		o := *option
+		o.IsBackendTerraformCloud = config.IsBackendTerraformCloud
+		option = &o
 	} else {
 		option = &tfmigrate.MigratorOption{
 			IsBackendTerraformCloud: false,
 		}
 	}
 
-	m, err := mc.Migrator.NewMigrator(option)
+	option, err = withLock(option, config, filename)
+	if err != nil {
+		return nil, err
+	}
+
+	var m tfmigrate.Migrator
+	if rollback {
+		rc, ok := mc.Migrator.(tfmigrate.RollbackMigratorConfig)
+		if !ok {
+			return nil, fmt.Errorf("rollback is not supported for migration type: %s", mc.Type)
+		}
+		m, err = rc.NewRollbackMigrator(option)
+	} else {
+		option, err = withBackup(option, config, filename)
+		if err != nil {
+			return nil, err
+		}
+		m, err = mc.Migrator.NewMigrator(option)
+	}
 
 	if err != nil {
 		return nil, err
@@ -55,6 +95,42 @@ func NewFileRunner(filename string, config *config.TfmigrateConfig, option *tfmi
 	return r, nil
 }
 
+// withBackup is a helper function which returns a copy of a given option with
+// a backup store for a given migration file if backup is configured.
+// The option is copied because it is shared across migration files.
+func withBackup(option *tfmigrate.MigratorOption, config *config.TfmigrateConfig, filename string) (*tfmigrate.MigratorOption, error) {
+	if config.Backup == nil {
+		return option, nil
+	}
+
+	b, err := backup.New(config.Backup, filename)
+	if err != nil {
+		return nil, err
+	}
+
+	o := *option
+	o.Backup = b
+	return &o, nil
+}
+
+// withLock is a helper function which returns a copy of a given option with
+// a locker for a given migration file if lock is configured.
+// The option is copied because it is shared across migration files.
+func withLock(option *tfmigrate.MigratorOption, config *config.TfmigrateConfig, filename string) (*tfmigrate.MigratorOption, error) {
+	if config.Lock == nil {
+		return option, nil
+	}
+
+	l, err := lock.New(config.Lock, "tfmigrate "+filepath.Base(filename))
+	if err != nil {
+		return nil, err
+	}
+
+	o := *option
+	o.Lock = l
+	return &o, nil
+}
+
 // loadMigrationFile is a helper function which reads and parses a migration file.
 func loadMigrationFile(filename string) (*tfmigrate.MigrationConfig, error) {
 	source, err := os.ReadFile(filename)
@@ -71,13 +147,46 @@ func loadMigrationFile(filename string) (*tfmigrate.MigrationConfig, error) {
 }
 
 // Plan plans a single migration.
-func (r *FileRunner) Plan(ctx context.Context) error {
-	return r.m.Plan(ctx)
+func (r *FileRunner) Plan(ctx context.Context) (err error) {
+	ctx, span := r.startSpan(ctx)
+	defer func() { tracing.End(span, err) }()
+
+	ctx, cancel := r.withTimeout(ctx)
+	defer cancel()
+
+	return r.m.Plan(r.logContext(ctx))
 }
 
 // Apply applies a single migration.
-func (r *FileRunner) Apply(ctx context.Context) error {
-	return r.m.Apply(ctx)
+func (r *FileRunner) Apply(ctx context.Context) (err error) {
+	ctx, span := r.startSpan(ctx)
+	defer func() { tracing.End(span, err) }()
+
+	ctx, cancel := r.withTimeout(ctx)
+	defer cancel()
+
+	return r.m.Apply(r.logContext(ctx))
+}
+
+// withTimeout returns a context which is canceled when the migration timeout
+// is exceeded. The timeout is applied to each migration, so that it doesn't
+// depend on how many migrations are run in a command.
+func (r *FileRunner) withTimeout(ctx context.Context) (context.Context, context.CancelFunc) {
+	return withMigrationTimeout(ctx, r.config.MigrationTimeout, "migration "+r.filename)
+}
+
+// startSpan starts a span for the migration.
+func (r *FileRunner) startSpan(ctx context.Context) (context.Context, trace.Span) {
+	return tracing.Start(ctx, "migration",
+		tracing.AttrMigration.String(r.filename),
+		tracing.AttrType.String(r.mc.Type),
+	)
+}
+
+// logContext returns a context which adds the migration file and its type to
+// log records.
+func (r *FileRunner) logContext(ctx context.Context) context.Context {
+	return logging.With(ctx, "migration", r.filename, "type", r.mc.Type)
 }
 
 // MigrationConfig returns an instance of migration.
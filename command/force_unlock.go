@@ -0,0 +1,93 @@
+package command
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"strings"
+
+	"github.com/minamijoyo/tfmigrate/lock"
+	flag "github.com/spf13/pflag"
+)
+
+// ForceUnlockCommand is a command which releases a lock of a remote state
+// left by a killed process.
+type ForceUnlockCommand struct {
+	Meta
+	workspace string
+}
+
+// Run runs the procedure of this command.
+func (c *ForceUnlockCommand) Run(args []string) int {
+	cmdFlags := flag.NewFlagSet("force-unlock", flag.ContinueOnError)
+	cmdFlags.StringVar(&c.configFile, "config", defaultConfigFile, "A path to tfmigrate config file")
+	cmdFlags.StringVar(&c.workspace, "workspace", "default", "A terraform workspace")
+
+	if err := cmdFlags.Parse(args); err != nil {
+		c.UI.Error(fmt.Sprintf("failed to parse arguments: %s", err))
+		return 1
+	}
+
+	if len(cmdFlags.Args()) != 2 {
+		c.UI.Error(fmt.Sprintf("The command expects 2 arguments, but got %d", len(cmdFlags.Args())))
+		c.UI.Error(c.Help())
+		return 1
+	}
+
+	var err error
+	if c.config, err = newConfig(c.configFile); err != nil {
+		c.UI.Error(fmt.Sprintf("failed to load config file: %s", err))
+		return 1
+	}
+	slog.Debug("config", "component", "command", "config", fmt.Sprintf("%#v", c.config))
+
+	if c.config.Lock == nil {
+		c.UI.Error("no lock setting")
+		return 1
+	}
+
+	l, err := lock.New(c.config.Lock, "tfmigrate force-unlock")
+	if err != nil {
+		c.UI.Error(err.Error())
+		return 1
+	}
+
+	dir := cmdFlags.Arg(0)
+	id := cmdFlags.Arg(1)
+	if err := l.ForceUnlock(context.Background(), dir, c.workspace, id); err != nil {
+		c.UI.Error(err.Error())
+		return 1
+	}
+
+	c.UI.Output(fmt.Sprintf("released the lock of state in %s (workspace: %s)", dir, c.workspace))
+	return 0
+}
+
+// Help returns long-form help text.
+func (c *ForceUnlockCommand) Help() string {
+	helpText := `
+Usage: tfmigrate force-unlock [options] DIR LOCK_ID
+
+Force-unlock releases a lock of a remote state left by a killed process.
+The lock ID is shown in the error message when failing to acquire the lock.
+It requires the lock block in the tfmigrate config file.
+
+Be very careful with this command. If the lock is still held by a running
+migration, releasing it may corrupt the remote state.
+
+Arguments:
+  DIR                      A working directory of the locked state
+  LOCK_ID                  An ID of the lock to release
+
+Options:
+  --config                 A path to tfmigrate config file
+  --workspace              A terraform workspace of the locked state
+                           (default: default)
+`
+	return strings.TrimSpace(helpText)
+}
+
+// Synopsis returns one-line help text.
+func (c *ForceUnlockCommand) Synopsis() string {
+	return "Release a lock of a remote state left by a killed process"
+}
@@ -2,12 +2,17 @@ package command
 
 import (
 	"context"
+	"errors"
 	"fmt"
-	"log"
+	"log/slog"
+	"path/filepath"
+	"sync"
 
 	"github.com/minamijoyo/tfmigrate/config"
 	"github.com/minamijoyo/tfmigrate/history"
+	"github.com/minamijoyo/tfmigrate/logging"
 	"github.com/minamijoyo/tfmigrate/tfmigrate"
+	"github.com/minamijoyo/tfmigrate/tracing"
 )
 
 // HistoryRunner is a history-aware runner.
@@ -23,6 +28,14 @@ type HistoryRunner struct {
 	option *tfmigrate.MigratorOption
 	// A controller which manages history.
 	hc *history.Controller
+	// A list of migrations recorded to history in this run.
+	recorded []*tfmigrate.MigrationConfig
+	// The maximum number of migrations planned concurrently in directory mode.
+	parallelism int
+	// Run a terraform plan check after every migration in directory mode.
+	checkEveryStep bool
+	// Push new states only after all migrations are planned in directory mode.
+	atomic bool
 }
 
 // NewHistoryRunner returns a new HistoryRunner instance.
@@ -33,37 +46,63 @@ func NewHistoryRunner(ctx context.Context, filename string, config *config.Tfmig
 	}
 
 	r := &HistoryRunner{
-		filename: filename,
-		config:   config,
-		option:   option,
-		hc:       hc,
+		filename:    filename,
+		config:      config,
+		option:      option,
+		hc:          hc,
+		parallelism: 1,
 	}
 
 	return r, nil
 }
 
+// SetParallelism sets the maximum number of migrations planned concurrently
+// in directory mode. Migrations which share a working directory are always
+// planned sequentially. Default to 1.
+func (r *HistoryRunner) SetParallelism(n int) {
+	r.parallelism = n
+}
+
+// SetCheckEveryStep sets whether to run a terraform plan check after every
+// migration in directory mode. By default, the check runs only after the last
+// migration for each state, because an intermediate state usually has diffs.
+func (r *HistoryRunner) SetCheckEveryStep(b bool) {
+	r.checkEveryStep = b
+}
+
+// SetAtomic sets whether to apply all unapplied migrations atomically in
+// directory mode. If true, all migrations are planned before pushing any
+// state, and the new states are pushed only if all of them succeed.
+func (r *HistoryRunner) SetAtomic(b bool) {
+	r.atomic = b
+}
+
 // Plan plans migrations with history-aware mode.
 // If a filename is set, run a single migration.
 // If not set, run all unapplied migrations.
-func (r *HistoryRunner) Plan(ctx context.Context) error {
+func (r *HistoryRunner) Plan(ctx context.Context) (err error) {
+	ctx = logging.With(ctx, "component", "runner")
+	ctx, span := tracing.Start(ctx, "tfmigrate plan")
+	defer func() { tracing.End(span, err) }()
+
 	if len(r.filename) != 0 {
 		// file mode
-		return r.planFile(ctx, r.filename)
+		return r.planFile(ctx, r.filename, r.option)
 	}
 
 	// directory mode
 	return r.planDir(ctx)
 }
 
-// planFile plans a single migration.
-func (r *HistoryRunner) planFile(ctx context.Context, filename string) error {
+// planFile plans a single migration with a given option.
+func (r *HistoryRunner) planFile(ctx context.Context, filename string, option *tfmigrate.MigratorOption) error {
 	if r.hc.AlreadyApplied(filename) {
 		return fmt.Errorf("a migration has already been applied: %s", filename)
 	}
 
-	fr, err := NewFileRunner(filename, r.config, r.option)
+	fr, err := NewFileRunner(filename, r.config, option)
 	if err != nil {
-		log.Printf("[ERROR] [runner] failed to plan: %s\n", filename)
+		slog.ErrorContext(ctx, "failed to plan", "migration", filename)
 		return err
 	}
 
@@ -71,17 +110,36 @@ func (r *HistoryRunner) planFile(ctx context.Context, filename string) error {
 }
 
 // planDir plans all unapplied migrations.
+// Each migration is planned against the states computed by the previous
+// migrations for the same dir and workspace, as it would be applied.
 func (r *HistoryRunner) planDir(ctx context.Context) error {
 	unapplied := r.hc.UnappliedMigrations()
 
 	if len(unapplied) == 0 {
-		log.Printf("[INFO] [runner] no unapplied migrations\n")
+		slog.InfoContext(ctx, "no unapplied migrations")
 		return nil
 	}
-	log.Printf("[INFO] [runner] unapplied migration files: %v\n", unapplied)
+	slog.InfoContext(ctx, "unapplied migration files", "migrations", unapplied)
+
+	mcs, err := r.loadMigrations(unapplied)
+	if err != nil {
+		return err
+	}
+
+	option, err := r.planChainOption(mcs)
+	if err != nil {
+		return err
+	}
+
+	if r.parallelism > 1 {
+		return r.planDirParallel(ctx, unapplied, mcs, option)
+	}
 
 	for _, filename := range unapplied {
-		err := r.planFile(ctx, filename)
+		if ctx.Err() != nil {
+			return fmt.Errorf("canceled before planning %s: %w", filename, context.Cause(ctx))
+		}
+		err := r.planFile(ctx, filename, option)
 		if err != nil {
 			return err
 		}
@@ -90,31 +148,197 @@ func (r *HistoryRunner) planDir(ctx context.Context) error {
 	return nil
 }
 
+// planChainOption returns a copy of the option with a new plan chain for given
+// migrations.
+func (r *HistoryRunner) planChainOption(mcs []*tfmigrate.MigrationConfig) (*tfmigrate.MigratorOption, error) {
+	chain := tfmigrate.NewPlanChain(r.checkEveryStep)
+	for _, mc := range mcs {
+		if err := chain.AddMigration(mc); err != nil {
+			return nil, err
+		}
+	}
+	option := &tfmigrate.MigratorOption{}
+	if r.option != nil {
+		// copy the option not to leak the plan chain.
+		*option = *r.option
+	}
+	option.PlanChain = chain
+	return option, nil
+}
+
+// planDirParallel plans given migrations concurrently up to the parallelism.
+// Migrations are grouped by working directories they touch, and migrations in
+// a group are planned sequentially in order of file names, because they share
+// the override file and the local workspace folders. Output of each group is
+// buffered and flushed when the group finishes, so that it's not interleaved
+// with other groups. Unlike planDir, a failure doesn't stop other groups, and
+// all errors are returned in order of file names.
+func (r *HistoryRunner) planDirParallel(ctx context.Context, filenames []string, mcs []*tfmigrate.MigrationConfig, option *tfmigrate.MigratorOption) error {
+	groups, err := groupMigrationsByDirs(mcs)
+	if err != nil {
+		return err
+	}
+	slog.InfoContext(ctx, "plan groups of migrations in parallel", "groups", len(groups), "parallelism", r.parallelism)
+
+	errs := make([]error, len(filenames))
+	sem := make(chan struct{}, r.parallelism)
+	var wg sync.WaitGroup
+	for _, group := range groups {
+		wg.Add(1)
+		go func(group []int) {
+			defer wg.Done()
+			sem <- struct{}{}
+			defer func() { <-sem }()
+
+			ctx, buf := logging.WithBuffer(ctx)
+			defer buf.Flush()
+			for _, i := range group {
+				filename := filenames[i]
+				if ctx.Err() != nil {
+					errs[i] = fmt.Errorf("canceled before planning %s: %w", filename, context.Cause(ctx))
+					return
+				}
+				if err := r.planFile(ctx, filename, option); err != nil {
+					slog.ErrorContext(ctx, "failed to plan", "migration", filename)
+					errs[i] = fmt.Errorf("failed to plan %s: %w", filename, err)
+					// Later migrations in the group depend on this one.
+					return
+				}
+				slog.InfoContext(ctx, "planned", "migration", filename)
+			}
+		}(group)
+	}
+	wg.Wait()
+
+	return errors.Join(errs...)
+}
+
+// loadMigrations loads given migration files.
+func (r *HistoryRunner) loadMigrations(filenames []string) ([]*tfmigrate.MigrationConfig, error) {
+	mcs := make([]*tfmigrate.MigrationConfig, len(filenames))
+	for i, filename := range filenames {
+		mc, err := loadMigrationFile(resolveMigrationFile(r.config.MigrationDir, filename))
+		if err != nil {
+			return nil, err
+		}
+		mcs[i] = mc
+	}
+	return mcs, nil
+}
+
+// groupMigrationsByDirs groups given migrations into sets of migrations which
+// share working directories directly or transitively. It returns indexes of
+// the migrations for each group in order of file names.
+func groupMigrationsByDirs(mcs []*tfmigrate.MigrationConfig) ([][]int, error) {
+	dirs := make([][]string, len(mcs))
+	for i, mc := range mcs {
+		var err error
+		dirs[i], err = tfmigrate.MigrationDirs(mc)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return groupByDirs(dirs), nil
+}
+
+// groupByDirs is a union-find over given lists of directories. Lists which
+// share a directory directly or transitively are put into the same group.
+// It returns indexes of the lists for each group. The groups are ordered by
+// their first index, and indexes in each group are sorted.
+func groupByDirs(dirs [][]string) [][]int {
+	parent := make([]int, len(dirs))
+	for i := range parent {
+		parent[i] = i
+	}
+	var find func(i int) int
+	find = func(i int) int {
+		if parent[i] != i {
+			parent[i] = find(parent[i])
+		}
+		return parent[i]
+	}
+
+	owners := make(map[string]int)
+	for i, ds := range dirs {
+		for _, dir := range ds {
+			dir = canonicalDir(dir)
+			owner, ok := owners[dir]
+			if !ok {
+				owners[dir] = i
+				continue
+			}
+			// attach to the root with the smaller index to keep the order.
+			a, b := find(owner), find(i)
+			if a > b {
+				a, b = b, a
+			}
+			parent[b] = a
+		}
+	}
+
+	groups := [][]int{}
+	index := make(map[int]int)
+	for i := range dirs {
+		root := find(i)
+		g, ok := index[root]
+		if !ok {
+			g = len(groups)
+			index[root] = g
+			groups = append(groups, []int{})
+		}
+		groups[g] = append(groups[g], i)
+	}
+	return groups
+}
+
+// canonicalDir returns a canonical path of a given dir, so that different
+// paths to the same dir such as `./foo`, `foo/../foo` and an absolute path
+// are grouped together. Symbolic links are resolved if the dir exists.
+func canonicalDir(dir string) string {
+	abs, err := filepath.Abs(dir)
+	if err != nil {
+		return filepath.Clean(dir)
+	}
+	if resolved, err := filepath.EvalSymlinks(abs); err == nil {
+		return resolved
+	}
+	return abs
+}
+
 // Apply applies migrations and save them to history.
 // If a filename is set, run a single migration.
 // If not set, run all unapplied migrations.
 func (r *HistoryRunner) Apply(ctx context.Context) (err error) {
+	ctx = logging.With(ctx, "component", "runner")
+	ctx, span := tracing.Start(ctx, "tfmigrate apply")
+	// end the span after saving history.
+	defer func() { tracing.End(span, err) }()
+
 	// save history on exit
 	beforeLen := r.hc.HistoryLength()
 	defer func() {
 		// if the number of records in history doesn't change,
 		// we don't want to update a timestamp of history file.
 		afterLen := r.hc.HistoryLength()
-		log.Printf("[DEBUG] [runner] length of history records: beforeLen = %d, afterLen = %d\n", beforeLen, afterLen)
+		slog.DebugContext(ctx, "length of history records", "before_len", beforeLen, "after_len", afterLen)
 		if beforeLen == afterLen {
 			return
 		}
 
 		// be sure not to overwrite an original error generated by outside of defer
-		log.Print("[INFO] [runner] save history\n")
-		serr := r.hc.Save(ctx)
+		// Applied migrations must be saved even if canceled.
+		slog.InfoContext(ctx, "save history")
+		serr := r.hc.Save(context.WithoutCancel(ctx))
 		if serr == nil {
-			log.Print("[INFO] [runner] history saved\n")
+			slog.InfoContext(ctx, "history saved")
+			if cerr := r.cleanupMovedBlocks(context.WithoutCancel(ctx)); cerr != nil {
+				err = errors.Join(err, fmt.Errorf("history saved, but failed to remove moved blocks: %v", cerr))
+			}
 			return
 		}
 
 		// return a named error from defer
-		log.Printf("[ERROR] [runner] failed to save history. The history may be inconsistent\n")
+		slog.ErrorContext(ctx, "failed to save history. The history may be inconsistent")
 		if err == nil {
 			err = fmt.Errorf("apply succeed, but failed to save history: %v", serr)
 			return
@@ -146,28 +370,50 @@ func (r *HistoryRunner) applyFile(ctx context.Context, filename string) error {
 
 	err = fr.Apply(ctx)
 	if err != nil {
-		log.Printf("[ERROR] [runner] failed to apply: %s\n", filename)
+		slog.ErrorContext(ctx, "failed to apply", "migration", filename)
 		return err
 	}
 
 	mc := fr.MigrationConfig()
-	log.Printf("[INFO] [runner] add a record to history: %s\n", filename)
+	slog.InfoContext(ctx, "add a record to history", "migration", filename)
 	r.hc.AddRecord(filename, mc.Type, mc.Name, nil)
+	r.recorded = append(r.recorded, mc)
 
 	return nil
 }
 
+// cleanupMovedBlocks removes moved blocks equivalent to migrations recorded
+// to history in this run if they opt in to it.
+// It must be called after the history is saved.
+func (r *HistoryRunner) cleanupMovedBlocks(ctx context.Context) error {
+	for _, mc := range r.recorded {
+		if c, ok := mc.Migrator.(*tfmigrate.StateMigratorConfig); ok {
+			if err := c.CleanupMovedBlocks(ctx); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
 // applyDir applies all unapplied migrations.
 func (r *HistoryRunner) applyDir(ctx context.Context) (err error) {
 	unapplied := r.hc.UnappliedMigrations()
 
 	if len(unapplied) == 0 {
-		log.Printf("[INFO] [runner] no unapplied migrations\n")
+		slog.InfoContext(ctx, "no unapplied migrations")
 		return nil
 	}
-	log.Printf("[INFO] [runner] unapplied migration files: %v\n", unapplied)
+	slog.InfoContext(ctx, "unapplied migration files", "migrations", unapplied)
+
+	if r.atomic {
+		return r.applyDirAtomic(ctx, unapplied)
+	}
 
 	for _, filename := range unapplied {
+		if ctx.Err() != nil {
+			return fmt.Errorf("canceled before applying %s: %w", filename, context.Cause(ctx))
+		}
 		err := r.applyFile(ctx, filename)
 		if err != nil {
 			return err
@@ -176,3 +422,144 @@ func (r *HistoryRunner) applyDir(ctx context.Context) (err error) {
 
 	return nil
 }
+
+// applyDirAtomic applies given migrations atomically.
+// It holds locks of all the remote states, plans all the migrations
+// cumulatively in memory, and then pushes the new states only if all of them
+// succeed. If pushing a state fails, the states already pushed are restored
+// on a best-effort basis and no migration is recorded to history.
+func (r *HistoryRunner) applyDirAtomic(ctx context.Context, filenames []string) (err error) {
+	mcs, err := r.loadMigrations(filenames)
+	if err != nil {
+		return err
+	}
+
+	option, err := r.planChainOption(mcs)
+	if err != nil {
+		return err
+	}
+	option.IsBackendTerraformCloud = r.config.IsBackendTerraformCloud
+	option, err = withLock(option, r.config, filenames[0])
+	if err != nil {
+		return err
+	}
+
+	unlock, err := option.PlanChain.Lock(ctx, option)
+	if err != nil {
+		return err
+	}
+	// release the locks on exit even if canceled.
+	defer func() {
+		err = errors.Join(err, unlock(context.WithoutCancel(ctx)))
+	}()
+
+	slog.InfoContext(ctx, "plan all unapplied migrations before pushing any state")
+	for _, filename := range filenames {
+		if ctx.Err() != nil {
+			return fmt.Errorf("canceled before planning %s: %w", filename, context.Cause(ctx))
+		}
+		if err := r.planFile(ctx, filename, option); err != nil {
+			slog.ErrorContext(ctx, "failed to plan", "migration", filename)
+			return fmt.Errorf("failed to plan %s, no state has been pushed: %w", filename, err)
+		}
+	}
+
+	slog.InfoContext(ctx, "push the new states of all unapplied migrations")
+	if err := option.PlanChain.Push(ctx, option); err != nil {
+		return err
+	}
+
+	for i, filename := range filenames {
+		slog.InfoContext(ctx, "add a record to history", "migration", filename)
+		r.hc.AddRecord(filename, mcs[i].Type, mcs[i].Name, nil)
+		r.recorded = append(r.recorded, mcs[i])
+	}
+	return nil
+}
+
+// PlanRollback plans to roll back a migration.
+// If a filename is set, plan to roll back a given migration.
+// If not set, plan to roll back the last applied migration in order of file names.
+func (r *HistoryRunner) PlanRollback(ctx context.Context) (err error) {
+	ctx = logging.With(ctx, "component", "runner")
+	ctx, span := tracing.Start(ctx, "tfmigrate plan rollback")
+	defer func() { tracing.End(span, err) }()
+
+	filename, err := r.rollbackTarget()
+	if err != nil {
+		return err
+	}
+
+	fr, err := NewRollbackFileRunner(filename, r.config, r.option)
+	if err != nil {
+		slog.ErrorContext(ctx, "failed to plan rollback", "migration", filename)
+		return err
+	}
+
+	return fr.Plan(ctx)
+}
+
+// Rollback rolls back a migration and records the rollback in history.
+// If a filename is set, roll back a given migration.
+// If not set, roll back the last applied migration in order of file names.
+func (r *HistoryRunner) Rollback(ctx context.Context) (err error) {
+	ctx = logging.With(ctx, "component", "runner")
+	ctx, span := tracing.Start(ctx, "tfmigrate rollback")
+	defer func() { tracing.End(span, err) }()
+
+	filename, err := r.rollbackTarget()
+	if err != nil {
+		return err
+	}
+
+	fr, err := NewRollbackFileRunner(filename, r.config, r.option)
+	if err != nil {
+		return err
+	}
+
+	err = fr.Apply(ctx)
+	if err != nil {
+		slog.ErrorContext(ctx, "failed to roll back", "migration", filename)
+		return err
+	}
+
+	slog.InfoContext(ctx, "record a rollback in history", "migration", filename)
+	r.hc.RollbackRecord(filename, nil)
+
+	slog.InfoContext(ctx, "save history")
+	if err := r.hc.Save(context.WithoutCancel(ctx)); err != nil {
+		slog.ErrorContext(ctx, "failed to save history. The history may be inconsistent")
+		return fmt.Errorf("rollback succeed, but failed to save history: %v", err)
+	}
+	slog.InfoContext(ctx, "history saved")
+	return nil
+}
+
+// rollbackTarget returns a migration file to be rolled back.
+// It returns an error if the migration has not been applied yet.
+func (r *HistoryRunner) rollbackTarget() (string, error) {
+	filename := r.filename
+	if len(filename) == 0 {
+		filename = r.lastAppliedMigration()
+		if len(filename) == 0 {
+			return "", fmt.Errorf("no applied migrations")
+		}
+	}
+
+	if !r.hc.AlreadyApplied(filename) {
+		return "", fmt.Errorf("a migration has not been applied yet: %s", filename)
+	}
+	return filename, nil
+}
+
+// lastAppliedMigration returns the last applied migration in order of file
+// names. It returns an empty string if no migrations have been applied.
+func (r *HistoryRunner) lastAppliedMigration() string {
+	migrations := r.hc.Migrations()
+	for i := len(migrations) - 1; i >= 0; i-- {
+		if r.hc.AlreadyApplied(migrations[i]) {
+			return migrations[i]
+		}
+	}
+	return ""
+}
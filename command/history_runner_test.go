@@ -2,7 +2,12 @@ package command
 
 import (
 	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/google/go-cmp/cmp"
 	"github.com/google/go-cmp/cmp/cmpopts"
@@ -380,6 +385,58 @@ migration "mock" "test2" {
             "applied_at": "2020-11-10T00:00:02Z"
         }
     }
+}`,
+			ok: true,
+		},
+		{
+			desc: "a migration rolled back is applied again",
+			migrations: map[string]string{
+				"20201109000001_test1.hcl": `
+migration "mock" "test1" {
+	plan_error  = false
+	apply_error = false
+}
+`,
+				"20201109000002_test2.hcl": `
+migration "mock" "test2" {
+	plan_error  = false
+	apply_error = false
+}
+`,
+			},
+			historyFile: `{
+    "version": 2,
+    "records": {
+        "20201109000001_test1.hcl": {
+            "type": "mock",
+            "name": "test1",
+            "applied_at": "2020-11-10T00:00:01Z"
+        },
+        "20201109000002_test2.hcl": {
+            "type": "mock",
+            "name": "test2",
+            "applied_at": "2020-11-10T00:00:02Z",
+            "rolled_back_at": "2020-11-11T00:00:02Z"
+        }
+    }
+}`,
+			filename:   "",
+			writeError: false,
+			readError:  false,
+			want: `{
+    "version": 1,
+    "records": {
+        "20201109000001_test1.hcl": {
+            "type": "mock",
+            "name": "test1",
+            "applied_at": "2020-11-10T00:00:01Z"
+        },
+        "20201109000002_test2.hcl": {
+            "type": "mock",
+            "name": "test2",
+            "applied_at": "2020-11-12T00:00:02Z"
+        }
+    }
 }`,
 			ok: true,
 		},
@@ -752,3 +809,491 @@ migration "mock" "test4" {
 		})
 	}
 }
+
+func TestHistoryRunnerRollback(t *testing.T) {
+	migrations := map[string]string{
+		"20201109000001_test1.hcl": `
+migration "mock" "test1" {
+	plan_error  = false
+	apply_error = false
+}
+`,
+		"20201109000002_test2.hcl": `
+migration "mock" "test2" {
+	plan_error  = false
+	apply_error = false
+}
+`,
+		"20201109000003_test3.hcl": `
+migration "mock" "test3" {
+	plan_error  = false
+	apply_error = true
+}
+`,
+		"20201109000004_test4.hcl": `
+migration "mock" "test4" {
+	plan_error  = false
+	apply_error = false
+}
+`,
+	}
+	historyFile := `{
+    "version": 1,
+    "records": {
+        "20201109000001_test1.hcl": {
+            "type": "mock",
+            "name": "test1",
+            "applied_at": "2020-11-10T00:00:01Z"
+        },
+        "20201109000002_test2.hcl": {
+            "type": "mock",
+            "name": "test2",
+            "applied_at": "2020-11-10T00:00:02Z"
+        },
+        "20201109000003_test3.hcl": {
+            "type": "mock",
+            "name": "test3",
+            "applied_at": "2020-11-10T00:00:03Z"
+        }
+    }
+}`
+
+	cases := []struct {
+		desc        string
+		migrations  map[string]string
+		historyFile string
+		filename    string
+		want        string
+		ok          bool
+	}{
+		{
+			desc:        "with filename",
+			migrations:  migrations,
+			historyFile: historyFile,
+			filename:    "20201109000001_test1.hcl",
+			want: `{
+    "version": 2,
+    "records": {
+        "20201109000001_test1.hcl": {
+            "type": "mock",
+            "name": "test1",
+            "applied_at": "2020-11-10T00:00:01Z",
+            "rolled_back_at": "2020-11-11T00:00:01Z"
+        },
+        "20201109000002_test2.hcl": {
+            "type": "mock",
+            "name": "test2",
+            "applied_at": "2020-11-10T00:00:02Z"
+        },
+        "20201109000003_test3.hcl": {
+            "type": "mock",
+            "name": "test3",
+            "applied_at": "2020-11-10T00:00:03Z"
+        }
+    }
+}`,
+			ok: true,
+		},
+		{
+			desc: "no args",
+			migrations: map[string]string{
+				"20201109000001_test1.hcl": migrations["20201109000001_test1.hcl"],
+				"20201109000002_test2.hcl": migrations["20201109000002_test2.hcl"],
+				"20201109000004_test4.hcl": migrations["20201109000004_test4.hcl"],
+			},
+			historyFile: `{
+    "version": 1,
+    "records": {
+        "20201109000001_test1.hcl": {
+            "type": "mock",
+            "name": "test1",
+            "applied_at": "2020-11-10T00:00:01Z"
+        },
+        "20201109000002_test2.hcl": {
+            "type": "mock",
+            "name": "test2",
+            "applied_at": "2020-11-10T00:00:02Z"
+        }
+    }
+}`,
+			filename: "",
+			want: `{
+    "version": 2,
+    "records": {
+        "20201109000001_test1.hcl": {
+            "type": "mock",
+            "name": "test1",
+            "applied_at": "2020-11-10T00:00:01Z"
+        },
+        "20201109000002_test2.hcl": {
+            "type": "mock",
+            "name": "test2",
+            "applied_at": "2020-11-10T00:00:02Z",
+            "rolled_back_at": "2020-11-11T00:00:02Z"
+        }
+    }
+}`,
+			ok: true,
+		},
+		{
+			desc:        "unapplied",
+			migrations:  migrations,
+			historyFile: historyFile,
+			filename:    "20201109000004_test4.hcl",
+			want:        historyFile,
+			ok:          false,
+		},
+		{
+			desc:        "apply error",
+			migrations:  migrations,
+			historyFile: historyFile,
+			filename:    "20201109000003_test3.hcl",
+			want:        historyFile,
+			ok:          false,
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.desc, func(t *testing.T) {
+			migrationDir := setupMigrationDir(t, tc.migrations)
+			mockConfig := &mock.Config{
+				Data:       tc.historyFile,
+				WriteError: false,
+				ReadError:  false,
+			}
+			config := &config.TfmigrateConfig{
+				MigrationDir: migrationDir,
+				History: &history.Config{
+					Storage: mockConfig,
+				},
+			}
+			r, err := NewHistoryRunner(context.Background(), tc.filename, config, nil)
+			if err != nil {
+				t.Fatalf("failed to new history runner: %s", err)
+			}
+
+			err = r.Rollback(context.Background())
+			if tc.ok && err != nil {
+				t.Fatalf("unexpected err: %s", err)
+			}
+			if !tc.ok && err == nil {
+				t.Fatal("expected to return an error, but no error")
+			}
+			want, err := history.ParseHistoryFile([]byte(tc.want))
+			if err != nil {
+				t.Fatalf("failed to parse history file (want): %s", err)
+			}
+			data := mockConfig.Storage().Data()
+			got, err := history.ParseHistoryFile([]byte(data))
+			if err != nil {
+				t.Fatalf("failed to parse history file (got): %s", err)
+			}
+			recordObj := history.Record{}
+			// compare only whether the migration has been rolled back, because
+			// the timestamp of the rollback is set to the current time.
+			rolledBack := cmp.Comparer(func(x, y *time.Time) bool { return (x == nil) == (y == nil) })
+			if diff := cmp.Diff(*got, *want, cmp.AllowUnexported(*got), cmpopts.IgnoreFields(recordObj, "AppliedAt"), rolledBack); diff != "" {
+				t.Errorf("got = %#v, want = %#v, diff = %s", got, want, diff)
+			}
+		})
+	}
+}
+
+func TestHistoryRunnerPlanRollback(t *testing.T) {
+	migrations := map[string]string{
+		"20201109000001_test1.hcl": `
+migration "mock" "test1" {
+	plan_error  = false
+	apply_error = false
+}
+`,
+		"20201109000002_test2.hcl": `
+migration "mock" "test2" {
+	plan_error  = true
+	apply_error = false
+}
+`,
+		"20201109000003_test3.hcl": `
+migration "mock" "test3" {
+	plan_error  = false
+	apply_error = false
+}
+`,
+	}
+	historyFile := `{
+    "version": 1,
+    "records": {
+        "20201109000001_test1.hcl": {
+            "type": "mock",
+            "name": "test1",
+            "applied_at": "2020-11-10T00:00:01Z"
+        },
+        "20201109000002_test2.hcl": {
+            "type": "mock",
+            "name": "test2",
+            "applied_at": "2020-11-10T00:00:02Z"
+        }
+    }
+}`
+
+	cases := []struct {
+		desc     string
+		filename string
+		ok       bool
+	}{
+		{
+			desc:     "applied",
+			filename: "20201109000001_test1.hcl",
+			ok:       true,
+		},
+		{
+			desc:     "unapplied",
+			filename: "20201109000003_test3.hcl",
+			ok:       false,
+		},
+		{
+			desc:     "no args (plan error)",
+			filename: "",
+			ok:       false,
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.desc, func(t *testing.T) {
+			migrationDir := setupMigrationDir(t, migrations)
+			mockConfig := &mock.Config{
+				Data:       historyFile,
+				WriteError: false,
+				ReadError:  false,
+			}
+			config := &config.TfmigrateConfig{
+				MigrationDir: migrationDir,
+				History: &history.Config{
+					Storage: mockConfig,
+				},
+			}
+			r, err := NewHistoryRunner(context.Background(), tc.filename, config, nil)
+			if err != nil {
+				t.Fatalf("failed to new history runner: %s", err)
+			}
+
+			err = r.PlanRollback(context.Background())
+			if tc.ok && err != nil {
+				t.Fatalf("unexpected err: %s", err)
+			}
+			if !tc.ok && err == nil {
+				t.Fatal("expected to return an error, but no error")
+			}
+			if got := mockConfig.Storage().Data(); got != historyFile {
+				t.Errorf("expected not to change history, got: %s", got)
+			}
+		})
+	}
+}
+
+func TestGroupByDirs(t *testing.T) {
+	abs, err := filepath.Abs("dir1")
+	if err != nil {
+		t.Fatalf("unexpected err: %s", err)
+	}
+	tmp := t.TempDir()
+	real := filepath.Join(tmp, "real")
+	if err := os.Mkdir(real, 0755); err != nil {
+		t.Fatalf("failed to create dir: %s", err)
+	}
+	link := filepath.Join(tmp, "link")
+	if err := os.Symlink(real, link); err != nil {
+		t.Skipf("failed to create a symlink: %s", err)
+	}
+
+	cases := []struct {
+		desc string
+		dirs [][]string
+		want [][]int
+	}{
+		{
+			desc: "disjoint",
+			dirs: [][]string{{"dir1"}, {"dir2"}, {"dir3"}},
+			want: [][]int{{0}, {1}, {2}},
+		},
+		{
+			desc: "shared",
+			dirs: [][]string{{"dir1"}, {"dir2"}, {"./dir1"}},
+			want: [][]int{{0, 2}, {1}},
+		},
+		{
+			desc: "different paths to the same dir",
+			dirs: [][]string{{"dir1"}, {"dir2/../dir1"}, {abs}, {"dir2"}},
+			want: [][]int{{0, 1, 2}, {3}},
+		},
+		{
+			desc: "symlink",
+			dirs: [][]string{{real}, {"dir1"}, {link}},
+			want: [][]int{{0, 2}, {1}},
+		},
+		{
+			desc: "transitive",
+			dirs: [][]string{{"dir1"}, {"dir2"}, {"dir3"}, {"dir3", "dir2"}, {"dir1", "dir3"}},
+			want: [][]int{{0, 1, 2, 3, 4}},
+		},
+		{
+			desc: "no dirs",
+			dirs: [][]string{{}, {"dir1"}, {}},
+			want: [][]int{{0}, {1}, {2}},
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.desc, func(t *testing.T) {
+			got := groupByDirs(tc.dirs)
+			if diff := cmp.Diff(got, tc.want); diff != "" {
+				t.Errorf("got: %v, want: %v, diff: %s", got, tc.want, diff)
+			}
+		})
+	}
+}
+
+func TestHistoryRunnerPlanParallel(t *testing.T) {
+	migrations := map[string]string{
+		"20201109000001_test1.hcl": `
+migration "mock" "test1" {
+	plan_error  = false
+	apply_error = false
+}
+`,
+		"20201109000002_test2.hcl": `
+migration "mock" "test2" {
+	plan_error  = true
+	apply_error = false
+}
+`,
+		"20201109000003_test3.hcl": `
+migration "mock" "test3" {
+	plan_error  = false
+	apply_error = false
+}
+`,
+		"20201109000004_test4.hcl": `
+migration "mock" "test4" {
+	plan_error  = true
+	apply_error = false
+}
+`,
+	}
+	migrationDir := setupMigrationDir(t, migrations)
+	config := &config.TfmigrateConfig{
+		MigrationDir: migrationDir,
+		History: &history.Config{
+			Storage: &mock.Config{Data: ""},
+		},
+	}
+	r, err := NewHistoryRunner(context.Background(), "", config, nil)
+	if err != nil {
+		t.Fatalf("failed to new history runner: %s", err)
+	}
+	r.SetParallelism(2)
+
+	err = r.Plan(context.Background())
+	if err == nil {
+		t.Fatal("expected to return an error, but no error")
+	}
+
+	// all failures are reported in order of file names.
+	got := err.Error()
+	i2 := strings.Index(got, "20201109000002_test2.hcl")
+	i4 := strings.Index(got, "20201109000004_test4.hcl")
+	if i2 < 0 || i4 < 0 || i2 > i4 {
+		t.Errorf("expected errors of test2 and test4 in order, got: %s", got)
+	}
+	if strings.Contains(got, "test1.hcl") || strings.Contains(got, "test3.hcl") {
+		t.Errorf("unexpected errors of succeeded migrations: %s", got)
+	}
+}
+
+func TestHistoryRunnerApplyAtomic(t *testing.T) {
+	cases := []struct {
+		desc       string
+		planError  bool
+		wantLength int
+		ok         bool
+	}{
+		{
+			desc:       "all planned",
+			planError:  false,
+			wantLength: 3,
+			ok:         true,
+		},
+		{
+			desc:       "plan error",
+			planError:  true,
+			wantLength: 1,
+			ok:         false,
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.desc, func(t *testing.T) {
+			migrations := map[string]string{
+				"20201109000001_test1.hcl": `
+migration "mock" "test1" {
+	plan_error  = false
+	apply_error = false
+}
+`,
+				"20201109000002_test2.hcl": `
+migration "mock" "test2" {
+	plan_error  = false
+	apply_error = true
+}
+`,
+				"20201109000003_test3.hcl": fmt.Sprintf(`
+migration "mock" "test3" {
+	plan_error  = %t
+	apply_error = true
+}
+`, tc.planError),
+			}
+			migrationDir := setupMigrationDir(t, migrations)
+			mockConfig := &mock.Config{
+				Data: `{
+    "version": 1,
+    "records": {
+        "20201109000001_test1.hcl": {
+            "type": "mock",
+            "name": "test1",
+            "applied_at": "2020-11-10T00:00:01Z"
+        }
+    }
+}`,
+			}
+			config := &config.TfmigrateConfig{
+				MigrationDir: migrationDir,
+				History: &history.Config{
+					Storage: mockConfig,
+				},
+			}
+			r, err := NewHistoryRunner(context.Background(), "", config, nil)
+			if err != nil {
+				t.Fatalf("failed to new history runner: %s", err)
+			}
+			r.SetAtomic(true)
+
+			// The migrations are only planned, so apply errors are never raised.
+			err = r.Apply(context.Background())
+			if tc.ok && err != nil {
+				t.Fatalf("unexpected err: %s", err)
+			}
+			if !tc.ok && err == nil {
+				t.Fatal("expected to return an error, but no error")
+			}
+
+			got, err := history.ParseHistoryFile([]byte(mockConfig.Storage().Data()))
+			if err != nil {
+				t.Fatalf("failed to parse history file: %s", err)
+			}
+			if got.Length() != tc.wantLength {
+				t.Errorf("got %d records, want = %d", got.Length(), tc.wantLength)
+			}
+		})
+	}
+}
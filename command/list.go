@@ -3,7 +3,7 @@ package command
 import (
 	"context"
 	"fmt"
-	"log"
+	"log/slog"
 	"strings"
 
 	"github.com/minamijoyo/tfmigrate/config"
@@ -33,12 +33,12 @@ func (c *ListCommand) Run(args []string) int {
 		c.UI.Error(fmt.Sprintf("failed to load config file: %s", err))
 		return 1
 	}
-	log.Printf("[DEBUG] [command] config: %#v\n", c.config)
+	slog.Debug("config", "component", "command", "config", fmt.Sprintf("%#v", c.config))
 
-	c.Option = newOption()
+	c.Option = newOption(c.config)
 	// The option may contains sensitive values such as environment variables.
 	// So logging the option set log level to DEBUG instead of INFO.
-	log.Printf("[DEBUG] [command] option: %#v\n", c.Option)
+	slog.Debug("option", "component", "command", "option", fmt.Sprintf("%#v", c.Option))
 
 	if c.config.History == nil {
 		// non-history mode
@@ -1,10 +1,18 @@
 package command
 
 import (
-	"log"
+	"context"
+	"fmt"
+	"log/slog"
 	"os"
+	"os/signal"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
 
 	"github.com/minamijoyo/tfmigrate/config"
+	"github.com/minamijoyo/tfmigrate/tfexec"
 	"github.com/minamijoyo/tfmigrate/tfmigrate"
 	"github.com/mitchellh/cli"
 )
@@ -20,6 +28,12 @@ type Meta struct {
 	// A path to tfmigrate config file.
 	configFile string
 
+	// A list of timeouts in CLASS=DURATION format to override the config.
+	timeouts []string
+
+	// Stream output of terraform commands in real time.
+	streamOutput bool
+
 	// a global configuration for tfmigrate.
 	config *config.TfmigrateConfig
 
@@ -49,12 +63,99 @@ func newConfig(filename string) (*config.TfmigrateConfig, error) {
 	}
 
 	// #nosec G706: Log injection via taint analysis
-	log.Printf("[DEBUG] [command] load configuration file: %s\n", pathToLoad)
+	slog.Debug("load configuration file", "component", "command", "path", pathToLoad)
 	return config.LoadConfigurationFile(pathToLoad)
 }
 
-func newOption() *tfmigrate.MigratorOption {
+// newOption returns a new MigratorOption with settings from environment
+// variables and a given configuration.
+func newOption(config *config.TfmigrateConfig) *tfmigrate.MigratorOption {
 	return &tfmigrate.MigratorOption{
-		ExecPath: os.Getenv("TFMIGRATE_EXEC_PATH"),
+		ExecPath:     os.Getenv("TFMIGRATE_EXEC_PATH"),
+		Retry:        config.Retry,
+		Timeouts:     config.Timeouts,
+		StreamOutput: envBool("TFMIGRATE_STREAM"),
+		Terragrunt:   config.Terragrunt,
+	}
+}
+
+// envBool returns true if a given environment variable is set to a true value
+// such as 1 or true.
+func envBool(key string) bool {
+	b, err := strconv.ParseBool(os.Getenv(key))
+	return err == nil && b
+}
+
+// setTimeouts overrides timeouts in a given config with a list of timeouts in
+// CLASS=DURATION format.
+func setTimeouts(config *config.TfmigrateConfig, timeouts []string) error {
+	for _, t := range timeouts {
+		class, value, ok := strings.Cut(t, "=")
+		if !ok {
+			return fmt.Errorf("invalid timeout format, expected CLASS=DURATION: %s", t)
+		}
+		if err := config.SetTimeout(class, value); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// newSignalContext returns a context which is canceled when the first SIGINT
+// or SIGTERM is received. The signal is set as a cause of the cancellation and
+// forwarded to a running terraform command, so that the migration can clean up
+// the work dir gracefully. The second signal terminates the process
+// immediately after forwarding it to running terraform commands, because they
+// run in their own process groups and would otherwise be left running.
+// The returned function must be called to release resources.
+func newSignalContext() (context.Context, func()) {
+	ctx, cancel := context.WithCancelCause(context.Background())
+	sigCh := make(chan os.Signal, 1)
+	signal.Notify(sigCh, os.Interrupt, syscall.SIGTERM)
+
+	done := make(chan struct{})
+	go func() {
+		select {
+		case sig := <-sigCh:
+			slog.Warn("received a signal, cancel the migration and clean up. Send it again to terminate immediately, but the work dir may be left broken", "component", "command", "signal", sig.String())
+			cancel(&tfexec.SignalError{Signal: sig})
+		case <-done:
+			return
+		}
+
+		select {
+		case sig := <-sigCh:
+			slog.Warn("received a signal again, terminate immediately", "component", "command", "signal", sig.String())
+			tfexec.SignalRunningCommands(sig)
+			os.Exit(signalExitCode(sig))
+		case <-done:
+		}
+	}()
+
+	return ctx, func() {
+		signal.Stop(sigCh)
+		close(done)
+		cancel(context.Canceled)
+	}
+}
+
+// withMigrationTimeout returns a context which is canceled with a
+// TimeoutError for a given target when a given timeout is exceeded, so that a
+// running migration is canceled in the same way as a signal. If the timeout
+// is zero, it returns a context without a timeout.
+// The returned function must be called to release resources.
+func withMigrationTimeout(ctx context.Context, timeout time.Duration, target string) (context.Context, context.CancelFunc) {
+	if timeout <= 0 {
+		return context.WithCancel(ctx)
+	}
+	return context.WithTimeoutCause(ctx, timeout, &tfexec.TimeoutError{Target: target, Timeout: timeout})
+}
+
+// signalExitCode returns an exit code for termination by a given signal in the
+// shell convention, that is, 128 plus the signal number.
+func signalExitCode(sig os.Signal) int {
+	if s, ok := sig.(syscall.Signal); ok {
+		return 128 + int(s)
 	}
+	return 1
 }
@@ -1,8 +1,14 @@
 package command
 
 import (
+	"context"
+	"errors"
 	"os"
 	"testing"
+	"time"
+
+	"github.com/minamijoyo/tfmigrate/config"
+	"github.com/minamijoyo/tfmigrate/tfexec"
 )
 
 func TestNewConfig(t *testing.T) {
@@ -125,3 +131,95 @@ tfmigrate {
 		})
 	}
 }
+
+func TestSetTimeouts(t *testing.T) {
+	cases := []struct {
+		desc     string
+		timeouts []string
+		want     tfexec.Timeouts
+		ok       bool
+	}{
+		{
+			desc:     "override",
+			timeouts: []string{"init=1m", "push=30s"},
+			want:     tfexec.Timeouts{Init: 1 * time.Minute, Plan: 10 * time.Minute, Push: 30 * time.Second},
+			ok:       true,
+		},
+		{
+			desc:     "invalid format",
+			timeouts: []string{"init"},
+			ok:       false,
+		},
+		{
+			desc:     "unknown class",
+			timeouts: []string{"foo=1m"},
+			ok:       false,
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.desc, func(t *testing.T) {
+			c := config.NewDefaultConfig()
+			c.Timeouts.Plan = 10 * time.Minute
+			err := setTimeouts(c, tc.timeouts)
+			if tc.ok && err != nil {
+				t.Fatalf("unexpected err: %s", err)
+			}
+			if !tc.ok && err == nil {
+				t.Fatal("expected to return an error, but no error")
+			}
+			if tc.ok && c.Timeouts != tc.want {
+				t.Errorf("got: %#v, want: %#v", c.Timeouts, tc.want)
+			}
+		})
+	}
+}
+
+func TestWithMigrationTimeout(t *testing.T) {
+	cases := []struct {
+		desc    string
+		timeout time.Duration
+		want    string
+	}{
+		{
+			desc:    "timeout",
+			timeout: 10 * time.Millisecond,
+			want:    "migration foo.hcl timed out after 10ms",
+		},
+		{
+			desc:    "no timeout",
+			timeout: 0,
+			want:    "",
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.desc, func(t *testing.T) {
+			// Each migration has its own timeout, so an expired one doesn't
+			// affect the parent context shared by the following migrations.
+			parent, cancelParent := context.WithCancel(context.Background())
+			defer cancelParent()
+			ctx, cancel := withMigrationTimeout(parent, tc.timeout, "migration foo.hcl")
+			defer cancel()
+
+			if tc.want == "" {
+				if _, ok := ctx.Deadline(); ok {
+					t.Fatalf("expected no deadline, but got one")
+				}
+				return
+			}
+
+			<-ctx.Done()
+			var timeoutErr *tfexec.TimeoutError
+			if err := context.Cause(ctx); !errors.As(err, &timeoutErr) {
+				t.Fatalf("expected a TimeoutError, got: %v", err)
+			}
+			if got := context.Cause(ctx).Error(); got != tc.want {
+				t.Errorf("got: %s, want: %s", got, tc.want)
+			}
+			if parent.Err() != nil {
+				t.Errorf("expected the parent context not to be canceled, got: %s", parent.Err())
+			}
+		})
+	}
+}
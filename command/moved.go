@@ -0,0 +1,119 @@
+package command
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"strings"
+	"time"
+
+	"github.com/minamijoyo/tfmigrate/tfmigrate"
+	flag "github.com/spf13/pflag"
+)
+
+// MovedCommand is a command which creates a state migration from moved blocks.
+type MovedCommand struct {
+	Meta
+	dir               string
+	workspace         string
+	removeMovedBlocks bool
+}
+
+// Run runs the procedure of this command.
+func (c *MovedCommand) Run(args []string) int {
+	cmdFlags := flag.NewFlagSet("moved", flag.ContinueOnError)
+	cmdFlags.StringVar(&c.configFile, "config", defaultConfigFile, "A path to tfmigrate config file")
+	cmdFlags.StringVar(&c.dir, "dir", ".", "A root module directory which contains moved blocks")
+	cmdFlags.StringVar(&c.workspace, "workspace", "default", "A terraform workspace for the migration")
+	cmdFlags.BoolVar(&c.removeMovedBlocks, "remove-moved-blocks", false, "Remove the moved blocks after the migration is recorded in history")
+
+	if err := cmdFlags.Parse(args); err != nil {
+		c.UI.Error(fmt.Sprintf("failed to parse arguments: %s", err))
+		return 1
+	}
+
+	if len(cmdFlags.Args()) != 1 {
+		c.UI.Error(fmt.Sprintf("The command expects 1 argument, but got %d", len(cmdFlags.Args())))
+		c.UI.Error(c.Help())
+		return 1
+	}
+
+	name := cmdFlags.Arg(0)
+	if !migrationNameRe.MatchString(name) {
+		c.UI.Error(fmt.Sprintf("invalid migration name: %q, it must consist of alphanumeric characters, underscores and hyphens", name))
+		return 1
+	}
+
+	var err error
+	if c.config, err = newConfig(c.configFile); err != nil {
+		c.UI.Error(fmt.Sprintf("failed to load config file: %s", err))
+		return 1
+	}
+	slog.Debug("config", "component", "command", "config", fmt.Sprintf("%#v", c.config))
+
+	if c.removeMovedBlocks && c.config.History == nil {
+		c.UI.Error("--remove-moved-blocks requires history mode")
+		return 1
+	}
+
+	blocks, err := tfmigrate.LoadMovedBlocks(context.Background(), c.dir)
+	if err != nil {
+		c.UI.Error(err.Error())
+		return 1
+	}
+	if len(blocks) == 0 {
+		c.UI.Error(fmt.Sprintf("no moved blocks found in %s", c.dir))
+		return 1
+	}
+
+	source, err := tfmigrate.NewStateMigrationFromMovedBlocks(blocks, c.dir, c.workspace, name, c.removeMovedBlocks)
+	if err != nil {
+		c.UI.Error(err.Error())
+		return 1
+	}
+
+	filename := time.Now().UTC().Format(migrationTimestampFormat) + "_" + name + ".hcl"
+	path, err := writeMigrationFile(c.config.MigrationDir, filename, source)
+	if err != nil {
+		c.UI.Error(err.Error())
+		return 1
+	}
+
+	c.UI.Output(path)
+	return 0
+}
+
+// Help returns long-form help text.
+func (c *MovedCommand) Help() string {
+	helpText := `
+Usage: tfmigrate moved [options] NAME
+
+Moved reads moved blocks from .tf files in a root module directory and
+creates a state migration file with the equivalent mv actions in the
+migration_dir. Chained moved blocks are ordered so that they are applied in
+sequence. Note that mv actions fail if a source address doesn't exist in the
+state, so please remove actions for moved blocks which have already been
+applied.
+
+Arguments:
+  NAME                     A name of migration.
+                           It must consist of alphanumeric characters, underscores and hyphens.
+
+Options:
+  --config                 A path to tfmigrate config file
+  --dir                    A root module directory which contains moved blocks.
+                           Default to . (current directory)
+  --workspace              A terraform workspace for the migration.
+                           Default to default
+  --remove-moved-blocks    Set remove_moved_blocks = true to the migration,
+                           which removes the moved blocks from .tf files after
+                           the migration is recorded in history.
+                           Only valid in history mode.
+`
+	return strings.TrimSpace(helpText)
+}
+
+// Synopsis returns one-line help text.
+func (c *MovedCommand) Synopsis() string {
+	return "Create a state migration from moved blocks"
+}
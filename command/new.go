@@ -0,0 +1,236 @@
+package command
+
+import (
+	"bytes"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/hashicorp/hcl/v2/hclwrite"
+	"github.com/minamijoyo/tfmigrate/config"
+	flag "github.com/spf13/pflag"
+	"github.com/zclconf/go-cty/cty"
+)
+
+// NewCommand is a command which creates a new migration file from a template.
+type NewCommand struct {
+	Meta
+	migrationType string
+	dir           string
+	fromDir       string
+	toDir         string
+}
+
+// Run runs the procedure of this command.
+func (c *NewCommand) Run(args []string) int {
+	cmdFlags := flag.NewFlagSet("new", flag.ContinueOnError)
+	cmdFlags.StringVar(&c.configFile, "config", defaultConfigFile, "A path to tfmigrate config file")
+	cmdFlags.StringVar(&c.migrationType, "type", "state", "A type of migration")
+	cmdFlags.StringVar(&c.dir, "dir", "", "A working directory for state migration")
+	cmdFlags.StringVar(&c.fromDir, "from-dir", "", "A working directory where states of resources move from")
+	cmdFlags.StringVar(&c.toDir, "to-dir", "", "A working directory where states of resources move to")
+
+	if err := cmdFlags.Parse(args); err != nil {
+		c.UI.Error(fmt.Sprintf("failed to parse arguments: %s", err))
+		return 1
+	}
+
+	if len(cmdFlags.Args()) != 1 {
+		c.UI.Error(fmt.Sprintf("The command expects 1 argument, but got %d", len(cmdFlags.Args())))
+		c.UI.Error(c.Help())
+		return 1
+	}
+
+	var err error
+	if c.config, err = newConfig(c.configFile); err != nil {
+		c.UI.Error(fmt.Sprintf("failed to load config file: %s", err))
+		return 1
+	}
+	slog.Debug("config", "component", "command", "config", fmt.Sprintf("%#v", c.config))
+
+	data := &migrationTemplateData{
+		Name:    cmdFlags.Arg(0),
+		Type:    c.migrationType,
+		Dir:     c.dir,
+		FromDir: c.fromDir,
+		ToDir:   c.toDir,
+	}
+	path, err := newMigrationFile(c.config, data, time.Now())
+	if err != nil {
+		c.UI.Error(err.Error())
+		return 1
+	}
+
+	c.UI.Output(path)
+	return 0
+}
+
+// migrationTemplateData is a set of values passed to a migration template.
+type migrationTemplateData struct {
+	// Name is an arbitrary name for migration.
+	Name string
+	// Type is a type for migration.
+	// Valid values are `state` and `multi_state`.
+	Type string
+	// Dir is a working directory for a state migration.
+	Dir string
+	// FromDir is a working directory where states of resources move from.
+	FromDir string
+	// ToDir is a working directory where states of resources move to.
+	ToDir string
+	// Timestamp is a prefix of the migration file name.
+	Timestamp string
+}
+
+// migrationTimestampFormat is a layout of a timestamp prefix for migration file names.
+// The migration files are applied in the order of the file name, so the
+// timestamp must be sortable as a string.
+const migrationTimestampFormat = "20060102150405"
+
+// migrationNameRe is a pattern for valid migration names.
+// The name is used as a part of the file name and a label of the migration block.
+var migrationNameRe = regexp.MustCompile(`^[a-zA-Z0-9_-]+$`)
+
+// defaultMigrationTemplates is a set of built-in migration templates.
+// A key is a migration type.
+var defaultMigrationTemplates = map[string]string{
+	"state": `migration "state" "{{ .Name }}" {
+  dir = {{ hcl .Dir }}
+  actions = [
+  ]
+}
+`,
+	"multi_state": `migration "multi_state" "{{ .Name }}" {
+  from_dir = {{ hcl .FromDir }}
+  to_dir   = {{ hcl .ToDir }}
+  actions = [
+  ]
+}
+`,
+}
+
+// migrationTemplateFuncs is a set of functions available in a migration
+// template. The hcl function renders a given string as a quoted HCL string,
+// so that a value containing `"`, `\` or `${` never breaks the migration file.
+var migrationTemplateFuncs = template.FuncMap{
+	"hcl": hclString,
+}
+
+// hclString returns a given string as a quoted and escaped HCL string.
+func hclString(s string) string {
+	return string(hclwrite.TokensForValue(cty.StringVal(s)).Bytes())
+}
+
+// newMigrationFile renders a migration template and writes it to a new file
+// in the migration dir. It returns a path of the created file.
+func newMigrationFile(config *config.TfmigrateConfig, data *migrationTemplateData, now time.Time) (string, error) {
+	if !migrationNameRe.MatchString(data.Name) {
+		return "", fmt.Errorf("invalid migration name: %q, it must consist of alphanumeric characters, underscores and hyphens", data.Name)
+	}
+
+	switch data.Type {
+	case "state":
+		if len(data.FromDir) != 0 || len(data.ToDir) != 0 {
+			return "", fmt.Errorf("--from-dir and --to-dir are not valid for a state migration")
+		}
+		if len(data.Dir) == 0 {
+			data.Dir = "."
+		}
+
+	case "multi_state":
+		if len(data.Dir) != 0 {
+			return "", fmt.Errorf("--dir is not valid for a multi_state migration")
+		}
+		if len(data.FromDir) == 0 || len(data.ToDir) == 0 {
+			return "", fmt.Errorf("--from-dir and --to-dir are required for a multi_state migration")
+		}
+
+	default:
+		return "", fmt.Errorf("unknown migration type: %s", data.Type)
+	}
+
+	source := defaultMigrationTemplates[data.Type]
+	if t, ok := config.Templates[data.Type]; ok {
+		var err error
+		source, err = t.Load()
+		if err != nil {
+			return "", err
+		}
+	}
+
+	tmpl, err := template.New(data.Type).Funcs(migrationTemplateFuncs).Option("missingkey=error").Parse(source)
+	if err != nil {
+		return "", fmt.Errorf("failed to parse migration template: %s", err)
+	}
+
+	data.Timestamp = now.UTC().Format(migrationTimestampFormat)
+	var b bytes.Buffer
+	if err := tmpl.Execute(&b, data); err != nil {
+		return "", fmt.Errorf("failed to render migration template: %s", err)
+	}
+
+	filename := data.Timestamp + "_" + data.Name + ".hcl"
+	return writeMigrationFile(config.MigrationDir, filename, b.Bytes())
+}
+
+// writeMigrationFile writes a given source to a new file in the migration dir.
+// It returns a path of the created file.
+func writeMigrationFile(migrationDir string, filename string, source []byte) (string, error) {
+	if err := os.MkdirAll(migrationDir, 0755); err != nil {
+		return "", fmt.Errorf("failed to create migration dir: %s", err)
+	}
+
+	path := filepath.Join(migrationDir, filename)
+	slog.Info("create a migration file", "component", "command", "path", path)
+	// Never overwrite an existing migration file.
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
+	if err != nil {
+		return "", fmt.Errorf("failed to create migration file: %s", err)
+	}
+	defer f.Close()
+
+	if _, err := f.Write(source); err != nil {
+		return "", fmt.Errorf("failed to write migration file: %s", err)
+	}
+
+	return path, nil
+}
+
+// Help returns long-form help text.
+func (c *NewCommand) Help() string {
+	helpText := `
+Usage: tfmigrate new [options] NAME
+
+New creates a new migration file in the migration_dir from a template.
+The file name is prefixed with the current timestamp in UTC so that
+migrations are applied in the order of creation.
+
+Arguments:
+  NAME                     A name of migration.
+                           It must consist of alphanumeric characters, underscores and hyphens.
+
+Options:
+  --config                 A path to tfmigrate config file
+  --type                   A type of migration
+                           Valid values are as follows:
+                             - state (default)
+                             - multi_state
+  --dir                    A working directory for a state migration.
+                           Default to . (current directory)
+  --from-dir               A working directory where states of resources move from.
+                           Required for a multi_state migration.
+  --to-dir                 A working directory where states of resources move to.
+                           Required for a multi_state migration.
+`
+	return strings.TrimSpace(helpText)
+}
+
+// Synopsis returns one-line help text.
+func (c *NewCommand) Synopsis() string {
+	return "Create a new migration file"
+}
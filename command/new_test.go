@@ -0,0 +1,235 @@
+package command
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/minamijoyo/tfmigrate/config"
+)
+
+func TestNewMigrationFile(t *testing.T) {
+	now := time.Date(2020, 11, 14, 1, 2, 3, 0, time.UTC)
+
+	cases := []struct {
+		desc      string
+		templates map[string]*config.MigrationTemplate
+		data      *migrationTemplateData
+		existing  []string
+		wantFile  string
+		want      string
+		ok        bool
+	}{
+		{
+			desc: "state",
+			data: &migrationTemplateData{
+				Name: "foo",
+				Type: "state",
+				Dir:  "dir1",
+			},
+			wantFile: "20201114010203_foo.hcl",
+			want: `migration "state" "foo" {
+  dir = "dir1"
+  actions = [
+  ]
+}
+`,
+			ok: true,
+		},
+		{
+			desc: "state with default dir",
+			data: &migrationTemplateData{
+				Name: "foo",
+				Type: "state",
+			},
+			wantFile: "20201114010203_foo.hcl",
+			want: `migration "state" "foo" {
+  dir = "."
+  actions = [
+  ]
+}
+`,
+			ok: true,
+		},
+		{
+			desc: "multi_state",
+			data: &migrationTemplateData{
+				Name:    "foo",
+				Type:    "multi_state",
+				FromDir: "dir1",
+				ToDir:   "dir2",
+			},
+			wantFile: "20201114010203_foo.hcl",
+			want: `migration "multi_state" "foo" {
+  from_dir = "dir1"
+  to_dir   = "dir2"
+  actions = [
+  ]
+}
+`,
+			ok: true,
+		},
+		{
+			desc: "state with a dir which needs escaping",
+			data: &migrationTemplateData{
+				Name: "foo",
+				Type: "state",
+				Dir:  `a"b\c${d}%{e}`,
+			},
+			wantFile: "20201114010203_foo.hcl",
+			want: `migration "state" "foo" {
+  dir = "a\"b\\c$${d}%%{e}"
+  actions = [
+  ]
+}
+`,
+			ok: true,
+		},
+		{
+			desc: "multi_state with dirs which need escaping",
+			data: &migrationTemplateData{
+				Name:    "foo",
+				Type:    "multi_state",
+				FromDir: `dir1"`,
+				ToDir:   `${dir2}`,
+			},
+			wantFile: "20201114010203_foo.hcl",
+			want: `migration "multi_state" "foo" {
+  from_dir = "dir1\""
+  to_dir   = "$${dir2}"
+  actions = [
+  ]
+}
+`,
+			ok: true,
+		},
+		{
+			desc: "user-defined template",
+			templates: map[string]*config.MigrationTemplate{
+				"state": {
+					Source: `# {{ .Timestamp }}
+migration "{{ .Type }}" "{{ .Name }}" {
+  dir       = {{ hcl .Dir }}
+  workspace = "default"
+  actions   = []
+}
+`,
+				},
+			},
+			data: &migrationTemplateData{
+				Name: "foo",
+				Type: "state",
+				Dir:  "dir1",
+			},
+			wantFile: "20201114010203_foo.hcl",
+			want: `# 20201114010203
+migration "state" "foo" {
+  dir       = "dir1"
+  workspace = "default"
+  actions   = []
+}
+`,
+			ok: true,
+		},
+		{
+			desc: "invalid template",
+			templates: map[string]*config.MigrationTemplate{
+				"state": {
+					Source: `{{ .Unknown }}`,
+				},
+			},
+			data: &migrationTemplateData{
+				Name: "foo",
+				Type: "state",
+			},
+			ok: false,
+		},
+		{
+			desc: "invalid name",
+			data: &migrationTemplateData{
+				Name: "foo bar",
+				Type: "state",
+			},
+			ok: false,
+		},
+		{
+			desc: "unknown type",
+			data: &migrationTemplateData{
+				Name: "foo",
+				Type: "foo",
+			},
+			ok: false,
+		},
+		{
+			desc: "state with from_dir",
+			data: &migrationTemplateData{
+				Name:    "foo",
+				Type:    "state",
+				FromDir: "dir1",
+			},
+			ok: false,
+		},
+		{
+			desc: "multi_state without to_dir",
+			data: &migrationTemplateData{
+				Name:    "foo",
+				Type:    "multi_state",
+				FromDir: "dir1",
+			},
+			ok: false,
+		},
+		{
+			desc: "file already exists",
+			data: &migrationTemplateData{
+				Name: "foo",
+				Type: "state",
+			},
+			existing: []string{"20201114010203_foo.hcl"},
+			ok:       false,
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.desc, func(t *testing.T) {
+			migrationDir := filepath.Join(t.TempDir(), "tfmigrate")
+			for _, f := range tc.existing {
+				if err := os.MkdirAll(migrationDir, 0755); err != nil {
+					t.Fatalf("failed to create migration dir: %s", err)
+				}
+				if err := os.WriteFile(filepath.Join(migrationDir, f), []byte{}, 0600); err != nil {
+					t.Fatalf("failed to write migration file: %s", err)
+				}
+			}
+			c := &config.TfmigrateConfig{
+				MigrationDir: migrationDir,
+				Templates:    tc.templates,
+			}
+
+			got, err := newMigrationFile(c, tc.data, now)
+			if tc.ok && err != nil {
+				t.Fatalf("unexpected err: %s", err)
+			}
+			if !tc.ok && err == nil {
+				t.Fatalf("expected to return an error, but no error, got: %s", got)
+			}
+			if tc.ok {
+				wantPath := filepath.Join(migrationDir, tc.wantFile)
+				if got != wantPath {
+					t.Errorf("got: %s, want: %s", got, wantPath)
+				}
+				b, err := os.ReadFile(got)
+				if err != nil {
+					t.Fatalf("failed to read migration file: %s", err)
+				}
+				if string(b) != tc.want {
+					t.Errorf("got:\n%s\nwant:\n%s", string(b), tc.want)
+				}
+				// the generated file should be a valid migration file.
+				if _, err := config.ParseMigrationFile(got, b); err != nil {
+					t.Errorf("failed to parse generated file: %s", err)
+				}
+			}
+		})
+	}
+}
@@ -3,7 +3,7 @@ package command
 import (
 	"context"
 	"fmt"
-	"log"
+	"log/slog"
 	"strings"
 
 	flag "github.com/spf13/pflag"
@@ -13,35 +13,62 @@ import (
 // migration operations to a temporary state.
 type PlanCommand struct {
 	Meta
-	backendConfig []string
-	out           string
+	backendConfig  []string
+	out            string
+	down           bool
+	isolated       bool
+	parallelism    int
+	checkEveryStep bool
 }
 
 // Run runs the procedure of this command.
 func (c *PlanCommand) Run(args []string) int {
 	cmdFlags := flag.NewFlagSet("plan", flag.ContinueOnError)
 	cmdFlags.StringVar(&c.configFile, "config", defaultConfigFile, "A path to tfmigrate config file")
+	cmdFlags.StringArrayVar(&c.timeouts, "timeout", nil, "A timeout in CLASS=DURATION format")
+	cmdFlags.BoolVar(&c.streamOutput, "stream-output", false, "Stream output of terraform commands in real time")
 	cmdFlags.StringArrayVar(&c.backendConfig, "backend-config", nil, "A backend configuration for remote state")
 	cmdFlags.StringVar(&c.out, "out", "", "Save a plan file after dry-run migration to the given path")
+	cmdFlags.BoolVar(&c.down, "down", false, "Plan to roll back a migration")
+	cmdFlags.BoolVar(&c.isolated, "isolated", false, "Run terraform commands in an isolated work dir")
+	cmdFlags.IntVar(&c.parallelism, "parallelism", 1, "Plan up to N migrations on disjoint directories concurrently in history mode")
+	cmdFlags.BoolVar(&c.checkEveryStep, "check-every-step", false, "Run terraform plan after every unapplied migration in history mode")
 
 	if err := cmdFlags.Parse(args); err != nil {
 		c.UI.Error(fmt.Sprintf("failed to parse arguments: %s", err))
 		return 1
 	}
 
+	if c.parallelism < 1 {
+		c.UI.Error(fmt.Sprintf("--parallelism must be greater than 0, but got %d", c.parallelism))
+		return 1
+	}
+
 	var err error
 	if c.config, err = newConfig(c.configFile); err != nil {
 		c.UI.Error(fmt.Sprintf("failed to load config file: %s", err))
 		return 1
 	}
-	log.Printf("[DEBUG] [command] config: %#v\n", c.config)
+	if err = setTimeouts(c.config, c.timeouts); err != nil {
+		c.UI.Error(fmt.Sprintf("failed to parse timeouts: %s", err))
+		return 1
+	}
+	slog.Debug("config", "component", "command", "config", fmt.Sprintf("%#v", c.config))
 
-	c.Option = newOption()
+	c.Option = newOption(c.config)
+	if c.streamOutput {
+		c.Option.StreamOutput = true
+	}
 	c.Option.PlanOut = c.out
 	c.Option.BackendConfig = c.backendConfig
+	c.Option.Isolated = c.isolated
 	// The option may contains sensitive values such as environment variables.
 	// So logging the option set log level to DEBUG instead of INFO.
-	log.Printf("[DEBUG] [command] option: %#v\n", c.Option)
+	slog.Debug("option", "component", "command", "option", fmt.Sprintf("%#v", c.Option))
+
+	// cancel the migration gracefully on signals.
+	ctx, stop := newSignalContext()
+	defer stop()
 
 	if c.config.History == nil {
 		// non-history mode
@@ -52,7 +79,7 @@ func (c *PlanCommand) Run(args []string) int {
 		}
 
 		migrationFile := cmdFlags.Arg(0)
-		if err = c.planWithoutHistory(migrationFile); err != nil {
+		if err = c.planWithoutHistory(ctx, migrationFile); err != nil {
 			c.UI.Error(err.Error())
 			return 1
 		}
@@ -74,7 +101,7 @@ func (c *PlanCommand) Run(args []string) int {
 	}
 
 	// Plan all unapplied pending migrations.
-	if err = c.planWithHistory(migrationFile); err != nil {
+	if err = c.planWithHistory(ctx, migrationFile); err != nil {
 		c.UI.Error(err.Error())
 		return 1
 	}
@@ -83,23 +110,31 @@ func (c *PlanCommand) Run(args []string) int {
 }
 
 // planWithoutHistory is a helper function which plans a given migration file without history.
-func (c *PlanCommand) planWithoutHistory(filename string) error {
-	fr, err := NewFileRunner(filename, c.config, c.Option)
+func (c *PlanCommand) planWithoutHistory(ctx context.Context, filename string) error {
+	newRunner := NewFileRunner
+	if c.down {
+		newRunner = NewRollbackFileRunner
+	}
+	fr, err := newRunner(filename, c.config, c.Option)
 	if err != nil {
 		return err
 	}
 
-	return fr.Plan(context.Background())
+	return fr.Plan(ctx)
 }
 
 // planWithHistory is a helper function which plans all unapplied pending migrations.
-func (c *PlanCommand) planWithHistory(filename string) error {
-	ctx := context.Background()
+func (c *PlanCommand) planWithHistory(ctx context.Context, filename string) error {
 	hr, err := NewHistoryRunner(ctx, filename, c.config, c.Option)
 	if err != nil {
 		return err
 	}
 
+	if c.down {
+		return hr.PlanRollback(ctx)
+	}
+	hr.SetParallelism(c.parallelism)
+	hr.SetCheckEveryStep(c.checkEveryStep)
 	return hr.Plan(ctx)
 }
 
@@ -110,13 +145,25 @@ Usage: tfmigrate plan [PATH]
 
 Plan computes a new state by applying state migration operations to a temporary state.
 It will fail if terraform plan detects any diffs with the new state.
+In history-mode, unapplied migrations are planned cumulatively. Each migration
+starts from the state computed by the previous ones for the same dir and
+workspace, and terraform plan runs only after the last one for each state.
 
 Arguments:
   PATH                     A path of migration file
                            Required in non-history mode. Optional in history-mode.
+                           If not set with --down in history-mode, the last
+                           applied migration in order of file names is used.
 
 Options:
   --config                 A path to tfmigrate config file
+  --timeout=CLASS=DURATION
+                           A timeout such as init=10m, which overrides the timeouts
+                           block in the config file. Valid classes are init, plan,
+                           state, push and migration. Can be specified multiple times.
+  --stream-output          Stream output of terraform commands to the console in real
+                           time with a [dir] prefix, instead of showing it only on errors.
+                           It can also be enabled by setting TFMIGRATE_STREAM=1.
   --backend-config=path    A backend configuration, a path to backend configuration file or
                            key=value format backend configuraion.
                            This option is passed to terraform init when switching backend to remote.
@@ -124,6 +171,29 @@ Options:
   --out=path               Save a plan file after dry-run migration to the given path.
                            Note that the saved plan file is not applicable in Terraform 1.1+.
                            It's intended to use only for static analysis.
+
+  --down                   Plan to roll back a migration instead of applying it.
+                           The actions are taken from the down block, or computed
+                           from inverses of the actions if not defined.
+                           In history-mode, the migration must have been applied.
+
+  --isolated               Run terraform commands in a temporary directory which
+                           overlays the root module instead of the root module itself.
+                           The .terraform.lock.hcl is copied and TF_PLUGIN_CACHE_DIR is
+                           shared, so the original directory is never touched even if
+                           the migration is interrupted.
+
+  --parallelism=N          Plan up to N unapplied migrations concurrently in history-mode.
+                           Migrations which touch disjoint directories are planned
+                           concurrently, and ones which share a directory are planned
+                           in order of file names. Output of each group of migrations
+                           is buffered and shown when the group finishes. terraform
+                           init is run one at a time, because the plugin cache
+                           directory is not safe for concurrent use. Default to 1.
+
+  --check-every-step       Run terraform plan after every unapplied migration in
+                           history-mode, instead of only after the last one for each state.
+                           This requires intermediate states to match the configuration.
 `
 	return strings.TrimSpace(helpText)
 }
@@ -0,0 +1,163 @@
+package command
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"strings"
+
+	"github.com/minamijoyo/tfmigrate/history"
+	"github.com/minamijoyo/tfmigrate/logging"
+	"github.com/minamijoyo/tfmigrate/tfmigrate"
+	flag "github.com/spf13/pflag"
+)
+
+// RestoreCommand is a command which pushes backups of remote states taken
+// before applying a migration back to remote.
+type RestoreCommand struct {
+	Meta
+	force bool
+}
+
+// Run runs the procedure of this command.
+func (c *RestoreCommand) Run(args []string) int {
+	cmdFlags := flag.NewFlagSet("restore", flag.ContinueOnError)
+	cmdFlags.StringVar(&c.configFile, "config", defaultConfigFile, "A path to tfmigrate config file")
+	cmdFlags.StringArrayVar(&c.timeouts, "timeout", nil, "A timeout in CLASS=DURATION format")
+	cmdFlags.BoolVar(&c.streamOutput, "stream-output", false, "Stream output of terraform commands in real time")
+	cmdFlags.BoolVar(&c.force, "force", false, "Restore backups even if the lineage doesn't match the remote state")
+
+	if err := cmdFlags.Parse(args); err != nil {
+		c.UI.Error(fmt.Sprintf("failed to parse arguments: %s", err))
+		return 1
+	}
+
+	if len(cmdFlags.Args()) != 1 {
+		c.UI.Error(fmt.Sprintf("The command expects 1 argument, but got %d", len(cmdFlags.Args())))
+		c.UI.Error(c.Help())
+		return 1
+	}
+
+	var err error
+	if c.config, err = newConfig(c.configFile); err != nil {
+		c.UI.Error(fmt.Sprintf("failed to load config file: %s", err))
+		return 1
+	}
+	if err = setTimeouts(c.config, c.timeouts); err != nil {
+		c.UI.Error(fmt.Sprintf("failed to parse timeouts: %s", err))
+		return 1
+	}
+	slog.Debug("config", "component", "command", "config", fmt.Sprintf("%#v", c.config))
+
+	if c.config.Backup == nil {
+		c.UI.Error("no backup setting")
+		return 1
+	}
+
+	c.Option = newOption(c.config)
+	if c.streamOutput {
+		c.Option.StreamOutput = true
+	}
+	// The option may contain sensitive values such as environment variables.
+	// So logging the option set log level to DEBUG instead of INFO.
+	slog.Debug("option", "component", "command", "option", fmt.Sprintf("%#v", c.Option))
+
+	// cancel the restore gracefully on signals.
+	ctx, stop := newSignalContext()
+	defer stop()
+
+	migrationFile := cmdFlags.Arg(0)
+	if err := c.restore(ctx, migrationFile); err != nil {
+		c.UI.Error(err.Error())
+		return 1
+	}
+
+	return 0
+}
+
+// restore is a helper function which restores backups of a given migration
+// file and removes the record from history in history mode.
+func (c *RestoreCommand) restore(ctx context.Context, filename string) error {
+	ctx = logging.With(ctx, "component", "command", "migration", filename)
+	path := resolveMigrationFile(c.config.MigrationDir, filename)
+	slog.InfoContext(ctx, "load migration file", "path", path)
+	mc, err := loadMigrationFile(path)
+	if err != nil {
+		return err
+	}
+	ctx = logging.With(ctx, "type", mc.Type)
+
+	option, err := withBackup(c.Option, c.config, filename)
+	if err != nil {
+		return err
+	}
+	option, err = withLock(option, c.config, filename)
+	if err != nil {
+		return err
+	}
+
+	var hc *history.Controller
+	if c.config.History != nil {
+		hc, err = history.NewController(ctx, c.config.MigrationDir, c.config.History)
+		if err != nil {
+			return err
+		}
+		if !hc.AlreadyApplied(filename) {
+			return fmt.Errorf("a migration has not been applied yet: %s", filename)
+		}
+	}
+
+	restoreCtx, cancel := withMigrationTimeout(ctx, c.config.MigrationTimeout, "restore "+filename)
+	defer cancel()
+	if err := tfmigrate.RestoreMigration(restoreCtx, mc, option, c.force); err != nil {
+		return err
+	}
+
+	if hc == nil {
+		return nil
+	}
+
+	slog.InfoContext(ctx, "remove a record from history")
+	hc.DeleteRecord(filename)
+	// The backups have been restored, so save history even if canceled.
+	return hc.Save(context.WithoutCancel(ctx))
+}
+
+// Help returns long-form help text.
+func (c *RestoreCommand) Help() string {
+	helpText := `
+Usage: tfmigrate restore [options] PATH
+
+Restore pushes backups of remote states taken before applying a given
+migration back to remote, and removes the migration from history in history
+mode. It requires the backup block in the tfmigrate config file.
+
+For a multi_state migration, both backups are verified before pushing any of
+them. If pushing the second one fails, the first one is reverted, so that no
+resource is managed in both states.
+
+Note that any changes made to the remote states after the migration was
+applied will be lost.
+
+Arguments:
+  PATH                     A path of migration file
+
+Options:
+  --config                 A path to tfmigrate config file
+  --timeout=CLASS=DURATION
+                           A timeout such as init=10m, which overrides the timeouts
+                           block in the config file. Valid classes are init, plan,
+                           state, push and migration. Can be specified multiple times.
+  --stream-output          Stream output of terraform commands to the console in real
+                           time with a [dir] prefix, instead of showing it only on errors.
+                           It can also be enabled by setting TFMIGRATE_STREAM=1.
+  --force                  Restore backups even if the lineage of a backup
+                           doesn't match the current remote state.
+`
+	return strings.TrimSpace(helpText)
+}
+
+// Synopsis returns one-line help text.
+func (c *RestoreCommand) Synopsis() string {
+	return "Restore remote states from backups"
+}
@@ -0,0 +1,136 @@
+package command
+
+import (
+	"fmt"
+	"log/slog"
+	"strings"
+
+	flag "github.com/spf13/pflag"
+)
+
+// RollbackCommand is a command which rolls back a migration and removes it
+// from history.
+type RollbackCommand struct {
+	Meta
+	backendConfig []string
+	isolated      bool
+}
+
+// Run runs the procedure of this command.
+func (c *RollbackCommand) Run(args []string) int {
+	cmdFlags := flag.NewFlagSet("rollback", flag.ContinueOnError)
+	cmdFlags.StringVar(&c.configFile, "config", defaultConfigFile, "A path to tfmigrate config file")
+	cmdFlags.StringArrayVar(&c.timeouts, "timeout", nil, "A timeout in CLASS=DURATION format")
+	cmdFlags.BoolVar(&c.streamOutput, "stream-output", false, "Stream output of terraform commands in real time")
+	cmdFlags.StringArrayVar(&c.backendConfig, "backend-config", nil, "A backend configuration for remote state")
+	cmdFlags.BoolVar(&c.isolated, "isolated", false, "Run terraform commands in an isolated work dir")
+
+	if err := cmdFlags.Parse(args); err != nil {
+		c.UI.Error(fmt.Sprintf("failed to parse arguments: %s", err))
+		return 1
+	}
+
+	if len(cmdFlags.Args()) > 1 {
+		c.UI.Error(fmt.Sprintf("The command expects 0 or 1 argument, but got %d", len(cmdFlags.Args())))
+		c.UI.Error(c.Help())
+		return 1
+	}
+
+	var err error
+	if c.config, err = newConfig(c.configFile); err != nil {
+		c.UI.Error(fmt.Sprintf("failed to load config file: %s", err))
+		return 1
+	}
+	if err = setTimeouts(c.config, c.timeouts); err != nil {
+		c.UI.Error(fmt.Sprintf("failed to parse timeouts: %s", err))
+		return 1
+	}
+	slog.Debug("config", "component", "command", "config", fmt.Sprintf("%#v", c.config))
+
+	c.Option = newOption(c.config)
+	if c.streamOutput {
+		c.Option.StreamOutput = true
+	}
+	c.Option.BackendConfig = c.backendConfig
+	c.Option.Isolated = c.isolated
+	// The option may contain sensitive values such as environment variables.
+	// So logging the option set log level to DEBUG instead of INFO.
+	slog.Debug("option", "component", "command", "option", fmt.Sprintf("%#v", c.Option))
+
+	if c.config.History == nil {
+		// non-history mode
+		c.UI.Error("no history setting")
+		return 1
+	}
+
+	// history mode
+	migrationFile := ""
+	if len(cmdFlags.Args()) == 1 {
+		migrationFile = cmdFlags.Arg(0)
+	}
+
+	// cancel the migration gracefully on signals.
+	ctx, stop := newSignalContext()
+	defer stop()
+
+	hr, err := NewHistoryRunner(ctx, migrationFile, c.config, c.Option)
+	if err != nil {
+		c.UI.Error(err.Error())
+		return 1
+	}
+
+	if err := hr.Rollback(ctx); err != nil {
+		c.UI.Error(err.Error())
+		return 1
+	}
+
+	return 0
+}
+
+// Help returns long-form help text.
+func (c *RollbackCommand) Help() string {
+	helpText := `
+Usage: tfmigrate rollback [PATH]
+
+Rollback computes a new state by reverting a migration against the current
+state, pushes it to remote state and records the rollback in history.
+The migration rolled back is treated as unapplied, so it is applied again by
+the next apply.
+It will fail if terraform plan detects any diffs with the new state, so please
+revert the Terraform configuration before running it.
+
+The actions to roll back are computed from inverses of the actions in reverse
+order. A mv action is inverted to the reverse mv. Since other actions such as
+rm and import cannot be inverted, define actions to roll back in a down block
+of the migration file. This command is only available in history mode.
+
+Arguments
+  PATH                     A path of migration file
+                           If not set, the last applied migration in order of
+                           file names is rolled back.
+
+Options:
+  --config                 A path to tfmigrate config file
+  --timeout=CLASS=DURATION
+                           A timeout such as init=10m, which overrides the timeouts
+                           block in the config file. Valid classes are init, plan,
+                           state, push and migration. Can be specified multiple times.
+  --stream-output          Stream output of terraform commands to the console in real
+                           time with a [dir] prefix, instead of showing it only on errors.
+                           It can also be enabled by setting TFMIGRATE_STREAM=1.
+  --backend-config=path    A backend configuration, a path to backend configuration file or
+                           key=value format backend configuraion.
+                           This option is passed to terraform init when switching backend to remote.
+  --isolated               Run terraform commands in a temporary directory which
+                           overlays the root module instead of the root module itself.
+                           The .terraform.lock.hcl is copied and TF_PLUGIN_CACHE_DIR is
+                           shared, so the original directory is never touched even if
+                           the migration is interrupted.
+`
+	return strings.TrimSpace(helpText)
+}
+
+// Synopsis returns one-line help text.
+func (c *RollbackCommand) Synopsis() string {
+	return "Roll back a migration and record it in history"
+}
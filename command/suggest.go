@@ -0,0 +1,162 @@
+package command
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"strings"
+	"time"
+
+	"github.com/minamijoyo/tfmigrate/tfmigrate"
+	flag "github.com/spf13/pflag"
+)
+
+// SuggestCommand is a command which suggests a state migration from a plan.
+type SuggestCommand struct {
+	Meta
+	dir           string
+	workspace     string
+	fromDir       string
+	toDir         string
+	fromWorkspace string
+	toWorkspace   string
+}
+
+// Run runs the procedure of this command.
+func (c *SuggestCommand) Run(args []string) int {
+	cmdFlags := flag.NewFlagSet("suggest", flag.ContinueOnError)
+	cmdFlags.StringVar(&c.configFile, "config", defaultConfigFile, "A path to tfmigrate config file")
+	cmdFlags.StringArrayVar(&c.timeouts, "timeout", nil, "A timeout in CLASS=DURATION format")
+	cmdFlags.BoolVar(&c.streamOutput, "stream-output", false, "Stream output of terraform commands in real time")
+	cmdFlags.StringVar(&c.dir, "dir", "", "A working directory to plan for a state migration")
+	cmdFlags.StringVar(&c.workspace, "workspace", "default", "A terraform workspace to plan for a state migration")
+	cmdFlags.StringVar(&c.fromDir, "from-dir", "", "A working directory where states of resources move from")
+	cmdFlags.StringVar(&c.toDir, "to-dir", "", "A working directory where states of resources move to")
+	cmdFlags.StringVar(&c.fromWorkspace, "from-workspace", "default", "A terraform workspace of the from-dir")
+	cmdFlags.StringVar(&c.toWorkspace, "to-workspace", "default", "A terraform workspace of the to-dir")
+
+	if err := cmdFlags.Parse(args); err != nil {
+		c.UI.Error(fmt.Sprintf("failed to parse arguments: %s", err))
+		return 1
+	}
+
+	if len(cmdFlags.Args()) != 1 {
+		c.UI.Error(fmt.Sprintf("The command expects 1 argument, but got %d", len(cmdFlags.Args())))
+		c.UI.Error(c.Help())
+		return 1
+	}
+
+	name := cmdFlags.Arg(0)
+	if !migrationNameRe.MatchString(name) {
+		c.UI.Error(fmt.Sprintf("invalid migration name: %q, it must consist of alphanumeric characters, underscores and hyphens", name))
+		return 1
+	}
+
+	var err error
+	if c.config, err = newConfig(c.configFile); err != nil {
+		c.UI.Error(fmt.Sprintf("failed to load config file: %s", err))
+		return 1
+	}
+	if err = setTimeouts(c.config, c.timeouts); err != nil {
+		c.UI.Error(fmt.Sprintf("failed to parse timeouts: %s", err))
+		return 1
+	}
+	slog.Debug("config", "component", "command", "config", fmt.Sprintf("%#v", c.config))
+
+	c.Option = newOption(c.config)
+	if c.streamOutput {
+		c.Option.StreamOutput = true
+	}
+	slog.Debug("option", "component", "command", "option", fmt.Sprintf("%#v", c.Option))
+
+	// cancel terraform plan gracefully on signals.
+	ctx, stop := newSignalContext()
+	defer stop()
+
+	source, err := c.suggest(ctx, name)
+	if err != nil {
+		c.UI.Error(err.Error())
+		return 1
+	}
+
+	filename := time.Now().UTC().Format(migrationTimestampFormat) + "_" + name + ".hcl"
+	path, err := writeMigrationFile(c.config.MigrationDir, filename, source)
+	if err != nil {
+		c.UI.Error(err.Error())
+		return 1
+	}
+
+	c.UI.Output(path)
+	return 0
+}
+
+// suggest is a helper function which plans working directories and returns a
+// draft migration file. If --from-dir or --to-dir is set, it suggests a
+// multi_state migration. Otherwise, it suggests a state migration.
+func (c *SuggestCommand) suggest(ctx context.Context, name string) ([]byte, error) {
+	if len(c.fromDir) == 0 && len(c.toDir) == 0 {
+		dir := c.dir
+		if len(dir) == 0 {
+			dir = "."
+		}
+		return tfmigrate.SuggestStateMigration(ctx, c.Option, dir, c.workspace, name)
+	}
+
+	if len(c.dir) != 0 {
+		return nil, fmt.Errorf("--dir is not valid with --from-dir and --to-dir")
+	}
+	if len(c.fromDir) == 0 || len(c.toDir) == 0 {
+		return nil, fmt.Errorf("both --from-dir and --to-dir are required for a multi_state migration")
+	}
+	return tfmigrate.SuggestMultiStateMigration(ctx, c.Option, c.fromDir, c.toDir, c.fromWorkspace, c.toWorkspace, name)
+}
+
+// Help returns long-form help text.
+func (c *SuggestCommand) Help() string {
+	helpText := `
+Usage: tfmigrate suggest [options] NAME
+
+Suggest runs terraform plan and writes a draft state migration file to the
+migration_dir. It pairs resources planned to be destroyed with resources
+planned to be created of the same type, and suggests mv actions for them.
+Candidates are scored by identifying attributes such as id and name, equality
+of other attributes and similarity of addresses. Ambiguous or unmatched
+resources are written as comments. The suggestion is a heuristic, so please
+review the draft and run tfmigrate plan before applying it.
+
+If --from-dir and --to-dir are set, it plans both directories and suggests a
+multi_state migration which moves resources destroyed in the from-dir to
+resources created in the to-dir. Resources in a module which move together
+are collapsed into an xmv action.
+
+Arguments:
+  NAME                     A name of migration.
+                           It must consist of alphanumeric characters, underscores and hyphens.
+
+Options:
+  --config                 A path to tfmigrate config file
+  --timeout=CLASS=DURATION
+                           A timeout such as init=10m, which overrides the timeouts
+                           block in the config file. Valid classes are init, plan,
+                           state, push and migration. Can be specified multiple times.
+  --stream-output          Stream output of terraform commands to the console in real
+                           time with a [dir] prefix, instead of showing it only on errors.
+                           It can also be enabled by setting TFMIGRATE_STREAM=1.
+  --dir                    A working directory to plan for a state migration.
+                           Default to . (current directory)
+  --workspace              A terraform workspace to plan for a state migration.
+                           Default to default
+  --from-dir               A working directory where states of resources move from.
+  --to-dir                 A working directory where states of resources move to.
+  --from-workspace         A terraform workspace of the from-dir.
+                           Default to default
+  --to-workspace           A terraform workspace of the to-dir.
+                           Default to default
+`
+	return strings.TrimSpace(helpText)
+}
+
+// Synopsis returns one-line help text.
+func (c *SuggestCommand) Synopsis() string {
+	return "Suggest a state migration from a plan"
+}
@@ -0,0 +1,103 @@
+package command
+
+import (
+	"fmt"
+	"log/slog"
+	"os"
+	"strings"
+
+	"github.com/hashicorp/hcl/v2"
+	"github.com/minamijoyo/tfmigrate/config"
+	"github.com/minamijoyo/tfmigrate/history"
+	flag "github.com/spf13/pflag"
+)
+
+// ValidateCommand is a command which checks migration files statically.
+type ValidateCommand struct {
+	Meta
+}
+
+// Run runs the procedure of this command.
+func (c *ValidateCommand) Run(args []string) int {
+	cmdFlags := flag.NewFlagSet("validate", flag.ContinueOnError)
+	cmdFlags.StringVar(&c.configFile, "config", defaultConfigFile, "A path to tfmigrate config file")
+
+	if err := cmdFlags.Parse(args); err != nil {
+		c.UI.Error(fmt.Sprintf("failed to parse arguments: %s", err))
+		return 1
+	}
+
+	var err error
+	if c.config, err = newConfig(c.configFile); err != nil {
+		c.UI.Error(fmt.Sprintf("failed to load config file: %s", err))
+		return 1
+	}
+	slog.Debug("config", "component", "command", "config", fmt.Sprintf("%#v", c.config))
+
+	filenames := cmdFlags.Args()
+	if len(filenames) == 0 {
+		// validate all migration files in the migration dir.
+		filenames, err = history.LoadMigrationFileNames(c.config.MigrationDir)
+		if err != nil {
+			c.UI.Error(err.Error())
+			return 1
+		}
+	}
+
+	diags := validateMigrations(c.config.MigrationDir, filenames)
+	for _, d := range diags {
+		c.UI.Error(d.Error())
+	}
+	if diags.HasErrors() {
+		c.UI.Error(fmt.Sprintf("%d problem(s) found in %d migration file(s)", len(diags.Errs()), len(filenames)))
+		return 1
+	}
+
+	c.UI.Output(fmt.Sprintf("%d migration file(s) are valid", len(filenames)))
+	return 0
+}
+
+// validateMigrations checks given migration files statically and returns all
+// problems found.
+func validateMigrations(migrationDir string, filenames []string) hcl.Diagnostics {
+	var diags hcl.Diagnostics
+	for _, filename := range filenames {
+		path := resolveMigrationFile(migrationDir, filename)
+		slog.Info("validate migration file", "component", "command", "path", path)
+		source, err := os.ReadFile(path)
+		if err != nil {
+			diags = diags.Append(&hcl.Diagnostic{
+				Severity: hcl.DiagError,
+				Summary:  "Failed to read migration file",
+				Detail:   err.Error(),
+			})
+			continue
+		}
+		diags = diags.Extend(config.ValidateMigrationFile(path, source))
+	}
+	return diags
+}
+
+// Help returns long-form help text.
+func (c *ValidateCommand) Help() string {
+	helpText := `
+Usage: tfmigrate validate [PATH...]
+
+Validate checks migration files statically without running terraform.
+It reports all problems found, such as syntax errors, invalid actions,
+invalid resource addresses and missing working directories.
+
+Arguments:
+  PATH                     A path of migration file
+                           If not set, validate all migration files in the migration_dir.
+
+Options:
+  --config                 A path to tfmigrate config file
+`
+	return strings.TrimSpace(helpText)
+}
+
+// Synopsis returns one-line help text.
+func (c *ValidateCommand) Synopsis() string {
+	return "Validate migration files"
+}
@@ -0,0 +1,83 @@
+package command
+
+import (
+	"testing"
+)
+
+func TestValidateMigrations(t *testing.T) {
+	cases := []struct {
+		desc       string
+		migrations map[string]string
+		filenames  []string
+		want       int
+	}{
+		{
+			desc: "all valid",
+			migrations: map[string]string{
+				"20201109000001_test1.hcl": `
+migration "mock" "test1" {
+	plan_error  = false
+	apply_error = false
+}
+`,
+				"20201109000002_test2.hcl": `
+migration "state" "test2" {
+	actions = [
+		"mv null_resource.foo null_resource.foo2",
+	]
+}
+`,
+			},
+			filenames: []string{"20201109000001_test1.hcl", "20201109000002_test2.hcl"},
+			want:      0,
+		},
+		{
+			desc: "report all problems across files",
+			migrations: map[string]string{
+				"20201109000001_test1.hcl": `
+migration "state" "test1" {
+	actions = [
+		"mv null_resource.foo",
+		"rm",
+	]
+}
+`,
+				"20201109000002_test2.hcl": `
+migration "state" "test2" {
+	actions = [
+		"mv null_resource.foo null_resource.foo2",
+	]
+}
+`,
+				"20201109000003_test3.hcl": `
+migration "multi_state" "test3" {
+	from_dir = "not_exist"
+	to_dir   = "."
+	actions = [
+		"mv null_resource.foo null_resource.foo2",
+	]
+}
+`,
+			},
+			filenames: []string{"20201109000001_test1.hcl", "20201109000002_test2.hcl", "20201109000003_test3.hcl"},
+			want:      3,
+		},
+		{
+			desc:       "file not found",
+			migrations: map[string]string{},
+			filenames:  []string{"20201109000001_test1.hcl"},
+			want:       1,
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.desc, func(t *testing.T) {
+			migrationDir := setupMigrationDir(t, tc.migrations)
+			diags := validateMigrations(migrationDir, tc.filenames)
+			got := len(diags.Errs())
+			if got != tc.want {
+				t.Errorf("got: %d, want: %d, diags: %s", got, tc.want, diags)
+			}
+		})
+	}
+}
@@ -0,0 +1,33 @@
+package config
+
+import (
+	"fmt"
+
+	"github.com/hashicorp/hcl/v2"
+	"github.com/minamijoyo/tfmigrate/backup"
+	"github.com/minamijoyo/tfmigrate/storage"
+)
+
+// BackupBlock represents a block for state backups in HCL.
+type BackupBlock struct {
+	// Storage is a block for backup data store.
+	Storage StorageBlock `hcl:"storage,block"`
+}
+
+// parseBackupBlock parses a backup block and returns a *backup.Config.
+func parseBackupBlock(b BackupBlock, ctx *hcl.EvalContext) (*backup.Config, error) {
+	s, err := parseStorageBlock(b.Storage, ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	if _, ok := s.(storage.KeyedConfig); !ok {
+		return nil, fmt.Errorf("the storage type doesn't support backups: %s", b.Storage.Type)
+	}
+
+	backup := &backup.Config{
+		Storage: s,
+	}
+
+	return backup, nil
+}
@@ -0,0 +1,78 @@
+package config
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/minamijoyo/tfmigrate/backup"
+	"github.com/minamijoyo/tfmigrate/storage/local"
+)
+
+func TestParseBackupBlock(t *testing.T) {
+	cases := []struct {
+		desc   string
+		source string
+		want   *backup.Config
+		ok     bool
+	}{
+		{
+			desc: "valid",
+			source: `
+tfmigrate {
+  migration_dir = "tfmigrate"
+  backup {
+    storage "local" {
+      path = "tmp/backup"
+    }
+  }
+}
+`,
+			want: &backup.Config{
+				Storage: &local.Config{
+					Path: "tmp/backup",
+				},
+			},
+			ok: true,
+		},
+		{
+			desc: "missing block (storage)",
+			source: `
+tfmigrate {
+  migration_dir = "tfmigrate"
+  backup {
+  }
+}
+`,
+			want: nil,
+			ok:   false,
+		},
+		{
+			desc: "not configured",
+			source: `
+tfmigrate {
+  migration_dir = "tfmigrate"
+}
+`,
+			want: nil,
+			ok:   true,
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.desc, func(t *testing.T) {
+			config, err := ParseConfigurationFile("test.hcl", []byte(tc.source))
+			if tc.ok && err != nil {
+				t.Fatalf("unexpected err: %s", err)
+			}
+			if !tc.ok && err == nil {
+				t.Fatalf("expected to return an error, but no error, got: %#v", config)
+			}
+			if tc.ok {
+				got := config.Backup
+				if !reflect.DeepEqual(got, tc.want) {
+					t.Errorf("got: %#v, want: %#v", got, tc.want)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,58 @@
+package config
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/hashicorp/hcl/v2"
+	"github.com/minamijoyo/tfmigrate/lock"
+	"github.com/minamijoyo/tfmigrate/storage"
+)
+
+// LockBlock represents a block for advisory locks of remote states in HCL.
+type LockBlock struct {
+	// Timeout is a duration to retry acquiring a lock held by someone else.
+	// It's a string parsed by time.ParseDuration such as "5m".
+	Timeout string `hcl:"timeout,optional"`
+	// TTL is a duration after which a lock is considered stale.
+	// It's a string parsed by time.ParseDuration such as "1h".
+	TTL string `hcl:"ttl,optional"`
+	// Storage is a block for lock data store.
+	Storage StorageBlock `hcl:"storage,block"`
+}
+
+// parseLockBlock parses a lock block and returns a *lock.Config.
+func parseLockBlock(b LockBlock, ctx *hcl.EvalContext) (*lock.Config, error) {
+	s, err := parseStorageBlock(b.Storage, ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	if _, ok := s.(storage.KeyedConfig); !ok {
+		return nil, fmt.Errorf("the storage type doesn't support locks: %s", b.Storage.Type)
+	}
+
+	var timeout time.Duration
+	if len(b.Timeout) > 0 {
+		timeout, err = time.ParseDuration(b.Timeout)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse timeout of lock block: %s", err)
+		}
+	}
+
+	var ttl time.Duration
+	if len(b.TTL) > 0 {
+		ttl, err = time.ParseDuration(b.TTL)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse ttl of lock block: %s", err)
+		}
+	}
+
+	lock := &lock.Config{
+		Storage: s,
+		Timeout: timeout,
+		TTL:     ttl,
+	}
+
+	return lock, nil
+}
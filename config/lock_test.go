@@ -0,0 +1,115 @@
+package config
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/minamijoyo/tfmigrate/lock"
+	"github.com/minamijoyo/tfmigrate/storage/local"
+)
+
+func TestParseLockBlock(t *testing.T) {
+	cases := []struct {
+		desc   string
+		source string
+		want   *lock.Config
+		ok     bool
+	}{
+		{
+			desc: "valid",
+			source: `
+tfmigrate {
+  migration_dir = "tfmigrate"
+  lock {
+    timeout = "5m"
+    ttl     = "2h"
+    storage "local" {
+      path = "tmp/lock"
+    }
+  }
+}
+`,
+			want: &lock.Config{
+				Storage: &local.Config{
+					Path: "tmp/lock",
+				},
+				Timeout: 5 * time.Minute,
+				TTL:     2 * time.Hour,
+			},
+			ok: true,
+		},
+		{
+			desc: "missing block (storage)",
+			source: `
+tfmigrate {
+  migration_dir = "tfmigrate"
+  lock {
+  }
+}
+`,
+			want: nil,
+			ok:   false,
+		},
+		{
+			desc: "invalid timeout",
+			source: `
+tfmigrate {
+  migration_dir = "tfmigrate"
+  lock {
+    timeout = "foo"
+    storage "local" {
+      path = "tmp/lock"
+    }
+  }
+}
+`,
+			want: nil,
+			ok:   false,
+		},
+		{
+			desc: "invalid ttl",
+			source: `
+tfmigrate {
+  migration_dir = "tfmigrate"
+  lock {
+    ttl = "foo"
+    storage "local" {
+      path = "tmp/lock"
+    }
+  }
+}
+`,
+			want: nil,
+			ok:   false,
+		},
+		{
+			desc: "not configured",
+			source: `
+tfmigrate {
+  migration_dir = "tfmigrate"
+}
+`,
+			want: nil,
+			ok:   true,
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.desc, func(t *testing.T) {
+			config, err := ParseConfigurationFile("test.hcl", []byte(tc.source))
+			if tc.ok && err != nil {
+				t.Fatalf("unexpected err: %s", err)
+			}
+			if !tc.ok && err == nil {
+				t.Fatalf("expected to return an error, but no error, got: %#v", config)
+			}
+			if tc.ok {
+				got := config.Lock
+				if !reflect.DeepEqual(got, tc.want) {
+					t.Errorf("got: %#v, want: %#v", got, tc.want)
+				}
+			}
+		})
+	}
+}
@@ -2,10 +2,12 @@ package config
 
 import (
 	"fmt"
+	"path/filepath"
 
 	"github.com/hashicorp/hcl/v2"
 	"github.com/hashicorp/hcl/v2/gohcl"
-	"github.com/hashicorp/hcl/v2/hclsimple"
+	"github.com/hashicorp/hcl/v2/hclsyntax"
+	"github.com/hashicorp/hcl/v2/json"
 	"github.com/zclconf/go-cty/cty"
 
 	"github.com/minamijoyo/tfmigrate/tfmigrate"
@@ -36,18 +38,9 @@ type MigrationBlock struct {
 // Note that this method does not read a file and you should pass source of config in bytes.
 // The filename is used for error message and selecting HCL syntax (.hcl and .json).
 func ParseMigrationFile(filename string, source []byte) (*tfmigrate.MigrationConfig, error) {
-	// Decode migration block header.
-	var f MigrationFile
-
-	ctx := &hcl.EvalContext{
-		Variables: map[string]cty.Value{
-			"env": envVarMap(),
-		},
-	}
-
-	err := hclsimple.Decode(filename, source, ctx, &f)
-	if err != nil {
-		return nil, fmt.Errorf("failed to decode migration file: %s, err: %s", filename, err)
+	f, ctx, diags := decodeMigrationFile(filename, source)
+	if diags.HasErrors() {
+		return nil, fmt.Errorf("failed to decode migration file: %s, err: %s", filename, diags)
 	}
 
 	migrator, err := parseMigrationBlock(f.Migration, ctx)
@@ -64,6 +57,42 @@ func ParseMigrationFile(filename string, source []byte) (*tfmigrate.MigrationCon
 	return config, nil
 }
 
+// decodeMigrationFile parses a given source of migration file and decodes a
+// header of the migration block. It's shared by ParseMigrationFile and
+// ValidateMigrationFile. It also returns an evaluation context to decode the
+// rest of the migration block. Note that the returned file may be partially
+// decoded even if the diagnostics have errors.
+func decodeMigrationFile(filename string, source []byte) (*MigrationFile, *hcl.EvalContext, hcl.Diagnostics) {
+	var file *hcl.File
+	var diags hcl.Diagnostics
+	switch ext := filepath.Ext(filename); ext {
+	case ".hcl":
+		file, diags = hclsyntax.ParseConfig(source, filename, hcl.Pos{Line: 1, Column: 1})
+	case ".json":
+		file, diags = json.Parse(source, filename)
+	default:
+		return nil, nil, hcl.Diagnostics{{
+			Severity: hcl.DiagError,
+			Summary:  "Unsupported file format",
+			Detail:   fmt.Sprintf("Cannot read from %s: unrecognized file extension %q.", filename, ext),
+		}}
+	}
+	if diags.HasErrors() {
+		return nil, nil, diags
+	}
+
+	ctx := &hcl.EvalContext{
+		Variables: map[string]cty.Value{
+			"env": envVarMap(),
+		},
+	}
+
+	// Decode migration block header.
+	var f MigrationFile
+	diags = diags.Extend(gohcl.DecodeBody(file.Body, ctx, &f))
+	return &f, ctx, diags
+}
+
 // parseMigrationBlock parses a migration block and returns a tfmigrate.MigratorConfig.
 func parseMigrationBlock(b MigrationBlock, ctx *hcl.EvalContext) (tfmigrate.MigratorConfig, error) {
 	switch b.Type {
@@ -100,6 +129,12 @@ func parseStateMigrationBlock(b MigrationBlock, ctx *hcl.EvalContext) (tfmigrate
 		return nil, diags
 	}
 
+	actions, err := resolveUpActions(config.Actions, config.Up)
+	if err != nil {
+		return nil, err
+	}
+	config.Actions = actions
+
 	return &config, nil
 }
 
@@ -112,5 +147,27 @@ func parseMultiStateMigrationBlock(b MigrationBlock, ctx *hcl.EvalContext) (tfmi
 		return nil, diags
 	}
 
+	actions, err := resolveUpActions(config.Actions, config.Up)
+	if err != nil {
+		return nil, err
+	}
+	config.Actions = actions
+
 	return &config, nil
 }
+
+// resolveUpActions returns actions of a migration defined by either the
+// actions attribute or the up block.
+func resolveUpActions(actions []string, up *tfmigrate.UpConfig) ([]string, error) {
+	if up == nil {
+		if actions == nil {
+			return nil, fmt.Errorf("either actions or up block is required")
+		}
+		return actions, nil
+	}
+
+	if actions != nil {
+		return nil, fmt.Errorf("actions and up block are mutually exclusive")
+	}
+	return up.Actions, nil
+}
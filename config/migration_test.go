@@ -309,6 +309,129 @@ migration "multi_state" "mv_dir1_dir2" {
 			},
 			ok: true,
 		},
+		{
+			desc: "state with down block",
+			source: `
+migration "state" "test" {
+	dir = "dir1"
+	actions = [
+		"rm time_static.baz",
+	]
+	down {
+		actions = [
+			"import time_static.baz 2006-01-02T15:04:05Z",
+		]
+	}
+}
+`,
+			want: &tfmigrate.MigrationConfig{
+				Type: "state",
+				Name: "test",
+				Migrator: &tfmigrate.StateMigratorConfig{
+					Dir: "dir1",
+					Actions: []string{
+						"rm time_static.baz",
+					},
+					Down: &tfmigrate.DownConfig{
+						Actions: []string{
+							"import time_static.baz 2006-01-02T15:04:05Z",
+						},
+					},
+				},
+			},
+			ok: true,
+		},
+		{
+			desc: "state with up and down blocks",
+			source: `
+migration "state" "test" {
+	dir = "dir1"
+	up {
+		actions = [
+			"rm time_static.baz",
+		]
+	}
+	down {
+		actions = [
+			"import time_static.baz 2006-01-02T15:04:05Z",
+		]
+	}
+}
+`,
+			want: &tfmigrate.MigrationConfig{
+				Type: "state",
+				Name: "test",
+				Migrator: &tfmigrate.StateMigratorConfig{
+					Dir: "dir1",
+					Actions: []string{
+						"rm time_static.baz",
+					},
+					Up: &tfmigrate.UpConfig{
+						Actions: []string{
+							"rm time_static.baz",
+						},
+					},
+					Down: &tfmigrate.DownConfig{
+						Actions: []string{
+							"import time_static.baz 2006-01-02T15:04:05Z",
+						},
+					},
+				},
+			},
+			ok: true,
+		},
+		{
+			desc: "state with both actions and up block",
+			source: `
+migration "state" "test" {
+	dir = "dir1"
+	actions = [
+		"rm time_static.baz",
+	]
+	up {
+		actions = [
+			"rm time_static.baz",
+		]
+	}
+}
+`,
+			want: nil,
+			ok:   false,
+		},
+		{
+			desc: "multi state with down block",
+			source: `
+migration "multi_state" "mv_dir1_dir2" {
+	from_dir = "dir1"
+	to_dir   = "dir2"
+	actions = [
+		"mv null_resource.foo null_resource.foo2",
+	]
+	down {
+		actions = [
+			"mv null_resource.foo2 null_resource.foo",
+		]
+	}
+}
+`,
+			want: &tfmigrate.MigrationConfig{
+				Type: "multi_state",
+				Name: "mv_dir1_dir2",
+				Migrator: &tfmigrate.MultiStateMigratorConfig{
+					FromDir: "dir1",
+					ToDir:   "dir2",
+					Actions: []string{
+						"mv null_resource.foo null_resource.foo2",
+					},
+					Down: &tfmigrate.DownConfig{
+						Actions: []string{
+							"mv null_resource.foo2 null_resource.foo",
+						},
+					},
+				},
+			},
+			ok: true,
+		},
 		{
 			desc: "unknown migration type",
 			source: `
@@ -0,0 +1,72 @@
+package config
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/minamijoyo/tfmigrate/tfexec"
+)
+
+const (
+	// defaultRetryMaxAttempts is a default value of max_attempts.
+	defaultRetryMaxAttempts = 3
+	// defaultRetryBackoff is a default value of backoff.
+	defaultRetryBackoff = 1 * time.Second
+	// defaultRetryMaxBackoff is a default value of max_backoff.
+	defaultRetryMaxBackoff = 30 * time.Second
+)
+
+// RetryBlock represents a block for retrying terraform commands which failed
+// with transient errors in HCL.
+type RetryBlock struct {
+	// MaxAttempts is the maximum number of attempts including the first one.
+	// Default to 3.
+	MaxAttempts *int `hcl:"max_attempts,optional"`
+	// Backoff is an interval before the first retry, which is doubled for
+	// each retry. It's a string parsed by time.ParseDuration such as "1s".
+	// Default to 1s.
+	Backoff string `hcl:"backoff,optional"`
+	// MaxBackoff is the maximum interval between retries.
+	// Default to 30s.
+	MaxBackoff string `hcl:"max_backoff,optional"`
+	// Patterns is a list of regular expressions for stderr of retryable
+	// errors. Default to tfexec.DefaultRetryPatterns.
+	Patterns []string `hcl:"patterns,optional"`
+}
+
+// parseRetryBlock parses a retry block and returns a *tfexec.RetryPolicy.
+func parseRetryBlock(b RetryBlock) (*tfexec.RetryPolicy, error) {
+	maxAttempts := defaultRetryMaxAttempts
+	if b.MaxAttempts != nil {
+		maxAttempts = *b.MaxAttempts
+	}
+
+	backoff := defaultRetryBackoff
+	if len(b.Backoff) > 0 {
+		var err error
+		backoff, err = time.ParseDuration(b.Backoff)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse backoff of retry block: %s", err)
+		}
+	}
+
+	maxBackoff := defaultRetryMaxBackoff
+	if len(b.MaxBackoff) > 0 {
+		var err error
+		maxBackoff, err = time.ParseDuration(b.MaxBackoff)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse max_backoff of retry block: %s", err)
+		}
+	}
+
+	patterns := b.Patterns
+	if patterns == nil {
+		patterns = tfexec.DefaultRetryPatterns
+	}
+
+	retry, err := tfexec.NewRetryPolicy(maxAttempts, backoff, maxBackoff, patterns)
+	if err != nil {
+		return nil, fmt.Errorf("invalid retry block: %s", err)
+	}
+	return retry, nil
+}
@@ -0,0 +1,119 @@
+package config
+
+import (
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/go-cmp/cmp/cmpopts"
+	"github.com/minamijoyo/tfmigrate/tfexec"
+)
+
+func TestParseRetryBlock(t *testing.T) {
+	cases := []struct {
+		desc   string
+		source string
+		want   *tfexec.RetryPolicy
+		ok     bool
+	}{
+		{
+			desc: "valid",
+			source: `
+tfmigrate {
+  retry {
+    max_attempts = 5
+    backoff      = "2s"
+    max_backoff  = "1m"
+    patterns     = ["Throttling", "503"]
+  }
+}
+`,
+			want: &tfexec.RetryPolicy{
+				MaxAttempts: 5,
+				Backoff:     2 * time.Second,
+				MaxBackoff:  1 * time.Minute,
+				Patterns:    []string{"Throttling", "503"},
+			},
+			ok: true,
+		},
+		{
+			desc: "default values",
+			source: `
+tfmigrate {
+  retry {}
+}
+`,
+			want: &tfexec.RetryPolicy{
+				MaxAttempts: 3,
+				Backoff:     1 * time.Second,
+				MaxBackoff:  30 * time.Second,
+				Patterns:    tfexec.DefaultRetryPatterns,
+			},
+			ok: true,
+		},
+		{
+			desc: "invalid backoff",
+			source: `
+tfmigrate {
+  retry {
+    backoff = "foo"
+  }
+}
+`,
+			want: nil,
+			ok:   false,
+		},
+		{
+			desc: "invalid max_attempts",
+			source: `
+tfmigrate {
+  retry {
+    max_attempts = 0
+  }
+}
+`,
+			want: nil,
+			ok:   false,
+		},
+		{
+			desc: "invalid pattern",
+			source: `
+tfmigrate {
+  retry {
+    patterns = ["("]
+  }
+}
+`,
+			want: nil,
+			ok:   false,
+		},
+		{
+			desc: "not configured",
+			source: `
+tfmigrate {
+  migration_dir = "tfmigrate"
+}
+`,
+			want: nil,
+			ok:   true,
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.desc, func(t *testing.T) {
+			config, err := ParseConfigurationFile("test.hcl", []byte(tc.source))
+			if tc.ok && err != nil {
+				t.Fatalf("unexpected err: %s", err)
+			}
+			if !tc.ok && err == nil {
+				t.Fatalf("expected to return an error, but no error, got: %#v", config)
+			}
+			if tc.ok {
+				got := config.Retry
+				if diff := cmp.Diff(got, tc.want, cmpopts.IgnoreUnexported(tfexec.RetryPolicy{})); diff != "" {
+					t.Errorf("got: %#v, want: %#v, diff: %s", got, tc.want, diff)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,66 @@
+package config
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/hashicorp/hcl/v2"
+	"github.com/hashicorp/hcl/v2/gohcl"
+)
+
+// TemplateBlock represents a block for a user-defined migration template in HCL.
+type TemplateBlock struct {
+	// Type is a type for migration which the template is used for.
+	// Valid values are `state` and `multi_state`.
+	Type string `hcl:"type,label"`
+	// Remain is a body of template block.
+	// We first decode only a block header and then decode its attributes.
+	Remain hcl.Body `hcl:",remain"`
+}
+
+// MigrationTemplate is a user-defined template for generating a migration file.
+// Either Source or Path must be set.
+type MigrationTemplate struct {
+	// Source is an inline template written in the Go text/template syntax.
+	Source string `hcl:"source,optional"`
+	// Path is a path to a template file. Relative to the current working directory.
+	Path string `hcl:"path,optional"`
+}
+
+// Load returns contents of the template.
+// If the Path is set, it reads the template file.
+func (t *MigrationTemplate) Load() (string, error) {
+	if len(t.Path) == 0 {
+		return t.Source, nil
+	}
+
+	b, err := os.ReadFile(t.Path)
+	if err != nil {
+		return "", fmt.Errorf("failed to read template file: %s", err)
+	}
+	return string(b), nil
+}
+
+// parseTemplateBlock parses a template block and returns a *MigrationTemplate.
+func parseTemplateBlock(b TemplateBlock, ctx *hcl.EvalContext) (*MigrationTemplate, error) {
+	switch b.Type {
+	case "state", "multi_state":
+	default:
+		return nil, fmt.Errorf("unknown migration type for template: %s", b.Type)
+	}
+
+	var t MigrationTemplate
+	diags := gohcl.DecodeBody(b.Remain, ctx, &t)
+	if diags.HasErrors() {
+		return nil, diags
+	}
+
+	if len(t.Source) == 0 && len(t.Path) == 0 {
+		return nil, fmt.Errorf("template %q requires either source or path", b.Type)
+	}
+	if len(t.Source) != 0 && len(t.Path) != 0 {
+		return nil, fmt.Errorf("template %q cannot set both source and path", b.Type)
+	}
+
+	return &t, nil
+}
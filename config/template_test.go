@@ -0,0 +1,172 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestParseTemplateBlock(t *testing.T) {
+	cases := []struct {
+		desc   string
+		source string
+		want   map[string]*MigrationTemplate
+		ok     bool
+	}{
+		{
+			desc: "valid",
+			source: `
+tfmigrate {
+  template "state" {
+    source = <<-EOT
+    migration "state" "{{ .Name }}" {
+      dir     = "{{ .Dir }}"
+      actions = []
+    }
+    EOT
+  }
+  template "multi_state" {
+    path = "tmp/multi_state.hcl.tmpl"
+  }
+}
+`,
+			want: map[string]*MigrationTemplate{
+				"state": {
+					Source: "migration \"state\" \"{{ .Name }}\" {\n  dir     = \"{{ .Dir }}\"\n  actions = []\n}\n",
+				},
+				"multi_state": {
+					Path: "tmp/multi_state.hcl.tmpl",
+				},
+			},
+			ok: true,
+		},
+		{
+			desc: "no template",
+			source: `
+tfmigrate {
+}
+`,
+			want: nil,
+			ok:   true,
+		},
+		{
+			desc: "unknown type",
+			source: `
+tfmigrate {
+  template "foo" {
+    source = "bar"
+  }
+}
+`,
+			want: nil,
+			ok:   false,
+		},
+		{
+			desc: "duplicate type",
+			source: `
+tfmigrate {
+  template "state" {
+    source = "foo"
+  }
+  template "state" {
+    source = "bar"
+  }
+}
+`,
+			want: nil,
+			ok:   false,
+		},
+		{
+			desc: "missing source and path",
+			source: `
+tfmigrate {
+  template "state" {
+  }
+}
+`,
+			want: nil,
+			ok:   false,
+		},
+		{
+			desc: "both source and path",
+			source: `
+tfmigrate {
+  template "state" {
+    source = "foo"
+    path   = "bar"
+  }
+}
+`,
+			want: nil,
+			ok:   false,
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.desc, func(t *testing.T) {
+			config, err := ParseConfigurationFile("test.hcl", []byte(tc.source))
+			if tc.ok && err != nil {
+				t.Fatalf("unexpected err: %s", err)
+			}
+			if !tc.ok && err == nil {
+				t.Fatalf("expected to return an error, but no error, got: %#v", config)
+			}
+			if tc.ok {
+				got := config.Templates
+				if !reflect.DeepEqual(got, tc.want) {
+					t.Errorf("got: %#v, want: %#v", got, tc.want)
+				}
+			}
+		})
+	}
+}
+
+func TestMigrationTemplateLoad(t *testing.T) {
+	templateDir := t.TempDir()
+	path := filepath.Join(templateDir, "state.hcl.tmpl")
+	if err := os.WriteFile(path, []byte("from file"), 0600); err != nil {
+		t.Fatalf("failed to write template file: %s", err)
+	}
+
+	cases := []struct {
+		desc     string
+		template *MigrationTemplate
+		want     string
+		ok       bool
+	}{
+		{
+			desc:     "source",
+			template: &MigrationTemplate{Source: "inline"},
+			want:     "inline",
+			ok:       true,
+		},
+		{
+			desc:     "path",
+			template: &MigrationTemplate{Path: path},
+			want:     "from file",
+			ok:       true,
+		},
+		{
+			desc:     "file not found",
+			template: &MigrationTemplate{Path: filepath.Join(templateDir, "not_exist.tmpl")},
+			want:     "",
+			ok:       false,
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.desc, func(t *testing.T) {
+			got, err := tc.template.Load()
+			if tc.ok && err != nil {
+				t.Fatalf("unexpected err: %s", err)
+			}
+			if !tc.ok && err == nil {
+				t.Fatalf("expected to return an error, but no error, got: %s", got)
+			}
+			if tc.ok && got != tc.want {
+				t.Errorf("got: %s, want: %s", got, tc.want)
+			}
+		})
+	}
+}
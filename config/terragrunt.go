@@ -0,0 +1,27 @@
+package config
+
+import (
+	"github.com/minamijoyo/tfmigrate/tfexec"
+)
+
+// TerragruntBlock represents a block for running terraform commands via
+// Terragrunt in HCL.
+type TerragruntBlock struct {
+	// ExecPath is a string how terragrunt command is executed, which is
+	// followed by arguments of terraform command.
+	// Default to `terragrunt run --`. For Terragrunt < v0.73.0, set it to
+	// `terragrunt`.
+	ExecPath string `hcl:"exec_path,optional"`
+	// CacheDir is a directory where Terragrunt downloads a terraform
+	// configuration. A relative path is resolved against each working dir.
+	// Default to `.terragrunt-cache`.
+	CacheDir string `hcl:"cache_dir,optional"`
+	// ConfigFile is a name of the Terragrunt configuration file, which must
+	// exist in each working dir. Default to `terragrunt.hcl`.
+	ConfigFile string `hcl:"config_file,optional"`
+}
+
+// parseTerragruntBlock parses a terragrunt block and returns a *tfexec.Terragrunt.
+func parseTerragruntBlock(b TerragruntBlock) *tfexec.Terragrunt {
+	return tfexec.NewTerragrunt(b.ExecPath, b.CacheDir, b.ConfigFile)
+}
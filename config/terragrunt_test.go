@@ -0,0 +1,90 @@
+package config
+
+import (
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/minamijoyo/tfmigrate/tfexec"
+)
+
+func TestParseTerragruntBlock(t *testing.T) {
+	cases := []struct {
+		desc   string
+		source string
+		want   *tfexec.Terragrunt
+		ok     bool
+	}{
+		{
+			desc: "valid",
+			source: `
+tfmigrate {
+  terragrunt {
+    exec_path   = "terragrunt"
+    cache_dir   = "/tmp/terragrunt-cache"
+    config_file = "root.hcl"
+  }
+}
+`,
+			want: &tfexec.Terragrunt{
+				ExecPath:   "terragrunt",
+				CacheDir:   "/tmp/terragrunt-cache",
+				ConfigFile: "root.hcl",
+			},
+			ok: true,
+		},
+		{
+			desc: "default values",
+			source: `
+tfmigrate {
+  terragrunt {}
+}
+`,
+			want: &tfexec.Terragrunt{
+				ExecPath:   "terragrunt run --",
+				CacheDir:   ".terragrunt-cache",
+				ConfigFile: "terragrunt.hcl",
+			},
+			ok: true,
+		},
+		{
+			desc: "unknown attribute",
+			source: `
+tfmigrate {
+  terragrunt {
+    foo = "bar"
+  }
+}
+`,
+			want: nil,
+			ok:   false,
+		},
+		{
+			desc: "not configured",
+			source: `
+tfmigrate {
+  migration_dir = "tfmigrate"
+}
+`,
+			want: nil,
+			ok:   true,
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.desc, func(t *testing.T) {
+			config, err := ParseConfigurationFile("test.hcl", []byte(tc.source))
+			if tc.ok && err != nil {
+				t.Fatalf("unexpected err: %s", err)
+			}
+			if !tc.ok && err == nil {
+				t.Fatalf("expected to return an error, but no error, got: %#v", config)
+			}
+			if tc.ok {
+				got := config.Terragrunt
+				if diff := cmp.Diff(got, tc.want); diff != "" {
+					t.Errorf("got: %#v, want: %#v, diff: %s", got, tc.want, diff)
+				}
+			}
+		})
+	}
+}
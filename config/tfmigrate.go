@@ -4,12 +4,16 @@ import (
 	"fmt"
 	"os"
 	"strings"
+	"time"
 
 	"github.com/hashicorp/hcl/v2"
 	"github.com/hashicorp/hcl/v2/hclsimple"
 	"github.com/zclconf/go-cty/cty"
 
+	"github.com/minamijoyo/tfmigrate/backup"
 	"github.com/minamijoyo/tfmigrate/history"
+	"github.com/minamijoyo/tfmigrate/lock"
+	"github.com/minamijoyo/tfmigrate/tfexec"
 )
 
 // ConfigurationFile represents a file for CLI settings in HCL.
@@ -29,6 +33,18 @@ type TfmigrateBlock struct {
 	IsBackendTerraformCloud bool `hcl:"is_backend_terraform_cloud,optional"`
 	// History is a block for migration history management.
 	History *HistoryBlock `hcl:"history,block"`
+	// Backup is a block for backups of remote states before pushing new states.
+	Backup *BackupBlock `hcl:"backup,block"`
+	// Lock is a block for advisory locks of remote states during migrations.
+	Lock *LockBlock `hcl:"lock,block"`
+	// Retry is a block for retrying terraform commands on transient errors.
+	Retry *RetryBlock `hcl:"retry,block"`
+	// Timeouts is a block for timeouts of terraform commands and migrations.
+	Timeouts *TimeoutsBlock `hcl:"timeouts,block"`
+	// Terragrunt is a block for running terraform commands via Terragrunt.
+	Terragrunt *TerragruntBlock `hcl:"terragrunt,block"`
+	// Templates is a list of blocks for user-defined migration templates.
+	Templates []TemplateBlock `hcl:"template,block"`
 }
 
 // TfmigrateConfig is a config for top-level CLI settings.
@@ -43,6 +59,28 @@ type TfmigrateConfig struct {
 	IsBackendTerraformCloud bool
 	// History is a config for migration history management.
 	History *history.Config
+	// Backup is a config for backups of remote states before pushing new states.
+	// If nil, no backup is taken.
+	Backup *backup.Config
+	// Lock is a config for advisory locks of remote states during migrations.
+	// If nil, no lock is acquired.
+	Lock *lock.Config
+	// Retry is a policy to retry idempotent terraform commands which failed
+	// with transient errors. If nil, no command is retried.
+	Retry *tfexec.RetryPolicy
+	// Timeouts is a set of timeouts for classes of terraform commands.
+	// A zero value means no timeout.
+	Timeouts tfexec.Timeouts
+	// MigrationTimeout is a timeout for each migration. In history mode, it's
+	// applied to each pending migration, not to all of them together.
+	// A zero value means no timeout.
+	MigrationTimeout time.Duration
+	// Terragrunt is a config to run terraform commands via Terragrunt.
+	// If nil, terraform commands are run directly.
+	Terragrunt *tfexec.Terragrunt
+	// Templates is a set of user-defined migration templates.
+	// A key is a migration type.
+	Templates map[string]*MigrationTemplate
 }
 
 // LoadConfigurationFile is a helper function which reads and parses a given configuration file.
@@ -98,6 +136,54 @@ func ParseConfigurationFile(filename string, source []byte) (*TfmigrateConfig, e
 		config.History = history
 	}
 
+	if f.Tfmigrate.Backup != nil {
+		backup, err := parseBackupBlock(*f.Tfmigrate.Backup, ctx)
+		if err != nil {
+			return nil, err
+		}
+		config.Backup = backup
+	}
+
+	if f.Tfmigrate.Lock != nil {
+		lock, err := parseLockBlock(*f.Tfmigrate.Lock, ctx)
+		if err != nil {
+			return nil, err
+		}
+		config.Lock = lock
+	}
+
+	if f.Tfmigrate.Retry != nil {
+		retry, err := parseRetryBlock(*f.Tfmigrate.Retry)
+		if err != nil {
+			return nil, err
+		}
+		config.Retry = retry
+	}
+
+	if f.Tfmigrate.Timeouts != nil {
+		if err := parseTimeoutsBlock(*f.Tfmigrate.Timeouts, config); err != nil {
+			return nil, err
+		}
+	}
+
+	if f.Tfmigrate.Terragrunt != nil {
+		config.Terragrunt = parseTerragruntBlock(*f.Tfmigrate.Terragrunt)
+	}
+
+	for _, b := range f.Tfmigrate.Templates {
+		if _, ok := config.Templates[b.Type]; ok {
+			return nil, fmt.Errorf("duplicate template for migration type: %s", b.Type)
+		}
+		t, err := parseTemplateBlock(b, ctx)
+		if err != nil {
+			return nil, err
+		}
+		if config.Templates == nil {
+			config.Templates = make(map[string]*MigrationTemplate)
+		}
+		config.Templates[b.Type] = t
+	}
+
 	return config, nil
 }
 
@@ -0,0 +1,72 @@
+package config
+
+import (
+	"fmt"
+	"time"
+)
+
+// TimeoutsBlock represents a block for timeouts of terraform commands and
+// migrations in HCL. Each value is a string parsed by time.ParseDuration
+// such as "10m". If not set, no timeout is applied.
+type TimeoutsBlock struct {
+	// Init is a timeout for terraform init.
+	Init string `hcl:"init,optional"`
+	// Plan is a timeout for terraform plan.
+	Plan string `hcl:"plan,optional"`
+	// State is a timeout for state operations except for state push.
+	State string `hcl:"state,optional"`
+	// Push is a timeout for terraform state push.
+	Push string `hcl:"push,optional"`
+	// Migration is a timeout for each migration.
+	Migration string `hcl:"migration,optional"`
+}
+
+// parseTimeoutsBlock parses a timeouts block and sets the timeouts to a
+// given config.
+func parseTimeoutsBlock(b TimeoutsBlock, config *TfmigrateConfig) error {
+	timeouts := map[string]string{
+		"init":      b.Init,
+		"plan":      b.Plan,
+		"state":     b.State,
+		"push":      b.Push,
+		"migration": b.Migration,
+	}
+	for class, value := range timeouts {
+		if len(value) == 0 {
+			continue
+		}
+		if err := config.SetTimeout(class, value); err != nil {
+			return fmt.Errorf("failed to parse timeouts block: %s", err)
+		}
+	}
+	return nil
+}
+
+// SetTimeout sets a timeout for a given class, which is one of init, plan,
+// state, push and migration. The value is a string parsed by
+// time.ParseDuration such as "10m". A zero value means no timeout.
+func (c *TfmigrateConfig) SetTimeout(class string, value string) error {
+	d, err := time.ParseDuration(value)
+	if err != nil {
+		return fmt.Errorf("invalid timeout for %s: %s", class, err)
+	}
+	if d < 0 {
+		return fmt.Errorf("invalid timeout for %s: must not be negative: %s", class, value)
+	}
+
+	switch class {
+	case "init":
+		c.Timeouts.Init = d
+	case "plan":
+		c.Timeouts.Plan = d
+	case "state":
+		c.Timeouts.State = d
+	case "push":
+		c.Timeouts.Push = d
+	case "migration":
+		c.MigrationTimeout = d
+	default:
+		return fmt.Errorf("unknown timeout class: %s", class)
+	}
+	return nil
+}
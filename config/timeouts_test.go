@@ -0,0 +1,132 @@
+package config
+
+import (
+	"testing"
+	"time"
+
+	"github.com/minamijoyo/tfmigrate/tfexec"
+)
+
+func TestParseTimeoutsBlock(t *testing.T) {
+	cases := []struct {
+		desc          string
+		source        string
+		want          tfexec.Timeouts
+		wantMigration time.Duration
+		ok            bool
+	}{
+		{
+			desc: "valid",
+			source: `
+tfmigrate {
+  timeouts {
+    init      = "10m"
+    plan      = "30m"
+    state     = "5m"
+    push      = "1m"
+    migration = "2h"
+  }
+}
+`,
+			want: tfexec.Timeouts{
+				Init:  10 * time.Minute,
+				Plan:  30 * time.Minute,
+				State: 5 * time.Minute,
+				Push:  1 * time.Minute,
+			},
+			wantMigration: 2 * time.Hour,
+			ok:            true,
+		},
+		{
+			desc: "partial",
+			source: `
+tfmigrate {
+  timeouts {
+    init = "10m"
+  }
+}
+`,
+			want: tfexec.Timeouts{
+				Init: 10 * time.Minute,
+			},
+			wantMigration: 0,
+			ok:            true,
+		},
+		{
+			desc: "invalid duration",
+			source: `
+tfmigrate {
+  timeouts {
+    plan = "foo"
+  }
+}
+`,
+			ok: false,
+		},
+		{
+			desc: "negative duration",
+			source: `
+tfmigrate {
+  timeouts {
+    push = "-1m"
+  }
+}
+`,
+			ok: false,
+		},
+		{
+			desc: "not configured",
+			source: `
+tfmigrate {
+  migration_dir = "tfmigrate"
+}
+`,
+			want:          tfexec.Timeouts{},
+			wantMigration: 0,
+			ok:            true,
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.desc, func(t *testing.T) {
+			config, err := ParseConfigurationFile("test.hcl", []byte(tc.source))
+			if tc.ok && err != nil {
+				t.Fatalf("unexpected err: %s", err)
+			}
+			if !tc.ok && err == nil {
+				t.Fatalf("expected to return an error, but no error, got: %#v", config)
+			}
+			if tc.ok {
+				if config.Timeouts != tc.want {
+					t.Errorf("got: %#v, want: %#v", config.Timeouts, tc.want)
+				}
+				if config.MigrationTimeout != tc.wantMigration {
+					t.Errorf("got migration timeout: %s, want: %s", config.MigrationTimeout, tc.wantMigration)
+				}
+			}
+		})
+	}
+}
+
+func TestTfmigrateConfigSetTimeout(t *testing.T) {
+	cases := []struct {
+		class string
+		value string
+		ok    bool
+	}{
+		{class: "init", value: "1m", ok: true},
+		{class: "migration", value: "1h", ok: true},
+		{class: "foo", value: "1m", ok: false},
+		{class: "plan", value: "1", ok: false},
+	}
+
+	for _, tc := range cases {
+		err := NewDefaultConfig().SetTimeout(tc.class, tc.value)
+		if tc.ok && err != nil {
+			t.Errorf("SetTimeout(%s, %s) unexpected err: %s", tc.class, tc.value, err)
+		}
+		if !tc.ok && err == nil {
+			t.Errorf("SetTimeout(%s, %s) expected to return an error, but no error", tc.class, tc.value)
+		}
+	}
+}
@@ -0,0 +1,150 @@
+package config
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/hashicorp/hcl/v2"
+	"github.com/hashicorp/hcl/v2/gohcl"
+
+	"github.com/minamijoyo/tfmigrate/tfmigrate"
+)
+
+// ValidateMigrationFile checks a given source of migration file statically
+// without running terraform. Unlike ParseMigrationFile, it doesn't stop at the
+// first error and returns all problems found as diagnostics with source ranges.
+// Note that this method does not read a file and you should pass source of config in bytes.
+// The filename is used for error message and selecting HCL syntax (.hcl and .json).
+// Relative paths of working directories are resolved from the current working directory.
+func ValidateMigrationFile(filename string, source []byte) hcl.Diagnostics {
+	f, ctx, diags := decodeMigrationFile(filename, source)
+	if f == nil || f.Migration.Remain == nil {
+		// There is no migration block to check any further.
+		return diags
+	}
+
+	b := f.Migration
+	migrator, err := parseMigrationBlock(b, ctx)
+	if err != nil {
+		if d, ok := err.(hcl.Diagnostics); ok {
+			diags = diags.Extend(d)
+		} else {
+			diags = diags.Append(&hcl.Diagnostic{
+				Severity: hcl.DiagError,
+				Summary:  "Invalid migration block",
+				Detail:   err.Error(),
+				Subject:  b.Remain.MissingItemRange().Ptr(),
+			})
+		}
+	}
+
+	// Keep checking attributes even if the block has errors to report all
+	// problems at once. JustAttributes returns attributes it can find even if
+	// the body also has nested blocks.
+	attrs, _ := b.Remain.JustAttributes()
+
+	switch b.Type {
+	case "state":
+		diags = diags.Extend(validateActions(attrs, ctx, tfmigrate.ValidateStateAction))
+		diags = diags.Extend(validateBlockActions(b.Remain, ctx, tfmigrate.ValidateStateAction))
+		diags = diags.Extend(validateDirAttr(attrs, "dir", ctx))
+
+	case "multi_state":
+		diags = diags.Extend(validateActions(attrs, ctx, tfmigrate.ValidateMultiStateAction))
+		diags = diags.Extend(validateBlockActions(b.Remain, ctx, tfmigrate.ValidateMultiStateAction))
+		diags = diags.Extend(validateDirAttr(attrs, "from_dir", ctx))
+		diags = diags.Extend(validateDirAttr(attrs, "to_dir", ctx))
+	}
+
+	if diags.HasErrors() {
+		return diags
+	}
+
+	// Build a migrator to check remaining constraints which are not covered
+	// above. It doesn't run any terraform command.
+	if _, err := migrator.NewMigrator(&tfmigrate.MigratorOption{}); err != nil {
+		diags = diags.Append(&hcl.Diagnostic{
+			Severity: hcl.DiagError,
+			Summary:  "Invalid migration",
+			Detail:   err.Error(),
+			Subject:  b.Remain.MissingItemRange().Ptr(),
+		})
+	}
+
+	return diags
+}
+
+// validateActions checks each element of an actions attribute with a given validate function.
+// An element which cannot be decoded as a string is skipped, because it has
+// already been reported by decoding the migration block.
+func validateActions(attrs hcl.Attributes, ctx *hcl.EvalContext, validate func(string) error) hcl.Diagnostics {
+	var diags hcl.Diagnostics
+	attr, ok := attrs["actions"]
+	if !ok {
+		return diags
+	}
+
+	exprs, ds := hcl.ExprList(attr.Expr)
+	if ds.HasErrors() {
+		return diags
+	}
+
+	for _, expr := range exprs {
+		var cmdStr string
+		if ds := gohcl.DecodeExpression(expr, ctx, &cmdStr); ds.HasErrors() {
+			continue
+		}
+		if err := validate(cmdStr); err != nil {
+			diags = diags.Append(&hcl.Diagnostic{
+				Severity: hcl.DiagError,
+				Summary:  "Invalid action",
+				Detail:   err.Error(),
+				Subject:  expr.Range().Ptr(),
+			})
+		}
+	}
+	return diags
+}
+
+// validateBlockActions checks each element of actions in up and down blocks
+// with a given validate function.
+func validateBlockActions(body hcl.Body, ctx *hcl.EvalContext, validate func(string) error) hcl.Diagnostics {
+	content, _, _ := body.PartialContent(&hcl.BodySchema{
+		Blocks: []hcl.BlockHeaderSchema{{Type: "up"}, {Type: "down"}},
+	})
+
+	var diags hcl.Diagnostics
+	for _, block := range content.Blocks {
+		attrs, _ := block.Body.JustAttributes()
+		diags = diags.Extend(validateActions(attrs, ctx, validate))
+	}
+	return diags
+}
+
+// validateDirAttr checks that a directory specified by a given attribute exists.
+// If the attribute is not set, it defaults to the current directory and there
+// is nothing to check.
+func validateDirAttr(attrs hcl.Attributes, name string, ctx *hcl.EvalContext) hcl.Diagnostics {
+	var diags hcl.Diagnostics
+	attr, ok := attrs[name]
+	if !ok {
+		return diags
+	}
+
+	// An invalid value has already been reported by decoding the migration block.
+	var dir string
+	if ds := gohcl.DecodeExpression(attr.Expr, ctx, &dir); ds.HasErrors() {
+		return diags
+	}
+
+	fi, err := os.Stat(dir)
+	if err != nil || !fi.IsDir() {
+		diags = diags.Append(&hcl.Diagnostic{
+			Severity: hcl.DiagError,
+			Summary:  "Directory not found",
+			Detail:   fmt.Sprintf("The %s %q does not exist or is not a directory.", name, dir),
+			Subject:  attr.Expr.Range().Ptr(),
+		})
+	}
+	return diags
+}
@@ -0,0 +1,238 @@
+package config
+
+import (
+	"fmt"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestValidateMigrationFile(t *testing.T) {
+	dir1 := t.TempDir()
+	dir2 := t.TempDir()
+	notExist := filepath.Join(dir1, "not_exist")
+
+	cases := []struct {
+		desc     string
+		filename string
+		source   string
+		// want is a list of positions of errors in the form of line:column.
+		want []string
+	}{
+		{
+			desc:     "valid state",
+			filename: "test.hcl",
+			source: fmt.Sprintf(`
+migration "state" "test" {
+	dir = "%s"
+	actions = [
+		"mv null_resource.foo null_resource.foo2",
+		"xmv null_resource.* null_resource.$1_new",
+		"rm time_static.baz",
+		"import time_static.qux 2006-01-02T15:04:05Z",
+	]
+}
+`, dir1),
+			want: nil,
+		},
+		{
+			desc:     "valid multi_state",
+			filename: "test.hcl",
+			source: fmt.Sprintf(`
+migration "multi_state" "test" {
+	from_dir = "%s"
+	to_dir   = "%s"
+	actions = [
+		"mv null_resource.foo null_resource.foo2",
+	]
+}
+`, dir1, dir2),
+			want: nil,
+		},
+		{
+			desc:     "valid mock",
+			filename: "test.hcl",
+			source: `
+migration "mock" "test" {
+	plan_error  = false
+	apply_error = false
+}
+`,
+			want: nil,
+		},
+		{
+			desc:     "multiple errors in state",
+			filename: "test.hcl",
+			source: fmt.Sprintf(`
+migration "state" "test" {
+	dir = "%s"
+	actions = [
+		"mv null_resource.foo",
+		"mv null_resource.bar null_resource.bar2",
+		"foo null_resource.baz",
+		"mv null_resource.qux 'null_resource.qux2",
+		"import module.foo id",
+	]
+}
+`, notExist),
+			want: []string{"5:3", "7:3", "8:3", "9:3", "3:8"},
+		},
+		{
+			desc:     "block errors and action errors",
+			filename: "test.hcl",
+			source: fmt.Sprintf(`
+migration "state" "test" {
+	dir = "%s"
+	foo = "bar"
+	actions = [
+		"mv null_resource.foo",
+	]
+}
+`, notExist),
+			want: []string{"4:2", "6:3", "3:8"},
+		},
+		{
+			desc:     "invalid type of actions",
+			filename: "test.hcl",
+			source: fmt.Sprintf(`
+migration "state" "test" {
+	dir     = "%s"
+	actions = "mv null_resource.foo null_resource.bar"
+}
+`, notExist),
+			want: []string{"4:13", "3:12"},
+		},
+		{
+			desc:     "multiple errors in multi_state",
+			filename: "test.hcl",
+			source: fmt.Sprintf(`
+migration "multi_state" "test" {
+	from_dir = "%s"
+	to_dir   = "%s"
+	actions = [
+		"rm null_resource.foo",
+		"mv null_resource.bar null_resource.bar2",
+	]
+}
+`, dir1, notExist),
+			want: []string{"6:3", "4:13"},
+		},
+		{
+			desc:     "errors in down block",
+			filename: "test.hcl",
+			source: fmt.Sprintf(`
+migration "state" "test" {
+	dir = "%s"
+	actions = [
+		"rm null_resource.foo",
+	]
+	down {
+		actions = [
+			"import null_resource.foo",
+		]
+	}
+}
+`, dir1),
+			want: []string{"9:4"},
+		},
+		{
+			desc:     "errors in up block",
+			filename: "test.hcl",
+			source: fmt.Sprintf(`
+migration "state" "test" {
+	dir = "%s"
+	up {
+		actions = [
+			"rm",
+		]
+	}
+	down {
+		actions = [
+			"import null_resource.foo 1234",
+		]
+	}
+}
+`, dir1),
+			want: []string{"6:4"},
+		},
+		{
+			desc:     "no actions",
+			filename: "test.hcl",
+			source: fmt.Sprintf(`
+migration "state" "test" {
+	dir     = "%s"
+	actions = []
+}
+`, dir1),
+			want: []string{"2:26"},
+		},
+		{
+			desc:     "syntax error",
+			filename: "test.hcl",
+			source: `
+migration "state" "test" {
+	actions = [
+}
+`,
+			want: []string{"4:1"},
+		},
+		{
+			desc:     "missing required attribute",
+			filename: "test.hcl",
+			source: `
+migration "state" "test" {
+}
+`,
+			want: []string{"2:26"},
+		},
+		{
+			desc:     "unknown migration type",
+			filename: "test.hcl",
+			source: `
+migration "foo" "test" {
+}
+`,
+			want: []string{"2:24"},
+		},
+		{
+			desc:     "json",
+			filename: "test.json",
+			source: `{
+  "migration": {
+    "state": {
+      "test": {
+        "actions": [
+          "mv null_resource.foo null_resource.foo2",
+          "mv null_resource.bar"
+        ]
+      }
+    }
+  }
+}`,
+			want: []string{"7:11"},
+		},
+		{
+			desc:     "unknown extension",
+			filename: "test.txt",
+			source:   ``,
+			want:     []string{"0:0"},
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.desc, func(t *testing.T) {
+			diags := ValidateMigrationFile(tc.filename, []byte(tc.source))
+			var got []string
+			for _, d := range diags {
+				pos := "0:0"
+				if d.Subject != nil {
+					pos = fmt.Sprintf("%d:%d", d.Subject.Start.Line, d.Subject.Start.Column)
+				}
+				got = append(got, pos)
+			}
+			if !reflect.DeepEqual(got, tc.want) {
+				t.Errorf("got: %v, want: %v, diags: %s", got, tc.want, diags)
+			}
+		})
+	}
+}
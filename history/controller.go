@@ -2,13 +2,15 @@ package history
 
 import (
 	"context"
-	"log"
+	"fmt"
+	"log/slog"
 	"os"
 	"path/filepath"
 	"sort"
 	"strings"
 	"time"
 
+	"github.com/minamijoyo/tfmigrate/logging"
 	"github.com/minamijoyo/tfmigrate/storage"
 )
 
@@ -30,13 +32,14 @@ type Controller struct {
 
 // NewController returns a new Controller instance.
 func NewController(ctx context.Context, migrationDir string, config *Config) (*Controller, error) {
-	log.Printf("[DEBUG] [history] load migration dir: %s\n", migrationDir)
-	migrations, err := loadMigrationFileNames(migrationDir)
+	ctx = logging.With(ctx, "component", "history")
+	slog.DebugContext(ctx, "load migration dir", "migration_dir", migrationDir)
+	migrations, err := LoadMigrationFileNames(migrationDir)
 	if err != nil {
 		return nil, err
 	}
 
-	log.Print("[DEBUG] [history] load history\n")
+	slog.DebugContext(ctx, "load history")
 	h, err := loadHistory(ctx, config.Storage)
 	if err != nil {
 		return nil, err
@@ -52,9 +55,9 @@ func NewController(ctx context.Context, migrationDir string, config *Config) (*C
 	return c, nil
 }
 
-// loadMigrationDir loads a migration directory and lists migration files from local.
+// LoadMigrationFileNames loads a migration directory and lists migration files from local.
 // The returned slice is sorted alphabetically.
-func loadMigrationFileNames(dir string) ([]string, error) {
+func LoadMigrationFileNames(dir string) ([]string, error) {
 	migrations := []string{}
 
 	files, err := os.ReadDir(dir)
@@ -89,17 +92,17 @@ func loadHistory(ctx context.Context, c storage.Config) (*History, error) {
 		return nil, err
 	}
 
-	log.Printf("[DEBUG] [history] read storage %#v\n", s)
+	slog.DebugContext(ctx, "read storage", "storage", fmt.Sprintf("%#v", s))
 	b, err := s.Read(ctx)
 	if err != nil {
 		return nil, err
 	}
-	log.Printf("[TRACE] [history] read history file: %#v\n", b)
+	slog.Log(ctx, logging.LevelTrace, "read history file", "content", string(b))
 
 	// If a given history is not found, s.Read returns empty bytes with no error.
 	// In this case, we assume that it's the first use and create a new history.
 	if len(b) == 0 {
-		log.Print("[DEBUG] [history] new empty history\n")
+		slog.DebugContext(ctx, "new empty history")
 		return newEmptyHistory(), nil
 	}
 
@@ -118,14 +121,19 @@ func (c *Controller) Save(ctx context.Context) error {
 		return err
 	}
 
-	f := newFileV1(c.history)
-	b, err := f.Serialize()
+	var b []byte
+	if c.history.hasRollback() {
+		b, err = newFileV2(c.history).Serialize()
+	} else {
+		b, err = newFileV1(c.history).Serialize()
+	}
 	if err != nil {
 		return err
 	}
 
-	log.Printf("[DEBUG] [history] write storage: %#v\n", s)
-	log.Printf("[TRACE] [history] write history file: %#v\n", b)
+	ctx = logging.With(ctx, "component", "history")
+	slog.DebugContext(ctx, "write storage", "storage", fmt.Sprintf("%#v", s))
+	slog.Log(ctx, logging.LevelTrace, "write history file", "content", string(b))
 	return s.Write(ctx, b)
 }
 
@@ -147,12 +155,14 @@ func (c *Controller) UnappliedMigrations() []string {
 	return unapplied
 }
 
-// HistoryLength returns a number of records in history.
+// HistoryLength returns a number of applied migrations in history, which
+// doesn't include migrations rolled back.
 func (c *Controller) HistoryLength() int {
 	return c.history.Length()
 }
 
-// AlreadyApplied returns true if a given migration file has already been applied.
+// AlreadyApplied returns true if a given migration file has already been
+// applied and has not been rolled back.
 func (c *Controller) AlreadyApplied(filename string) bool {
 	return c.history.Contains(filename)
 }
@@ -174,3 +184,22 @@ func (c *Controller) AddRecord(filename string, migrationType string, name strin
 
 	c.history.Add(filename, r)
 }
+
+// RollbackRecord records that a given migration has been rolled back.
+// The record is kept as an audit trail, and the migration is treated as
+// unapplied. This method doesn't persist history. Call Save() to save the
+// history. If rolledBackAt is nil, a timestamp is automatically set to
+// time.Now().
+func (c *Controller) RollbackRecord(filename string, rolledBackAt *time.Time) {
+	timestamp := time.Now()
+	if rolledBackAt != nil {
+		timestamp = *rolledBackAt
+	}
+	c.history.Rollback(filename, timestamp)
+}
+
+// DeleteRecord deletes a record from history.
+// This method doesn't persist history. Call Save() to save the history.
+func (c *Controller) DeleteRecord(filename string) {
+	c.history.Delete(filename)
+}
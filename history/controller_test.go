@@ -94,7 +94,7 @@ func TestLoadMigrationFileNames(t *testing.T) {
 				}
 			}
 
-			got, err := loadMigrationFileNames(migrationDir)
+			got, err := LoadMigrationFileNames(migrationDir)
 
 			if tc.ok && err != nil {
 				t.Fatalf("unexpected err: %#v", err)
@@ -555,3 +555,47 @@ func TestControllerAddRecord(t *testing.T) {
 		})
 	}
 }
+
+func TestControllerDeleteRecord(t *testing.T) {
+	migrations := []string{
+		"20201012010101_foo.hcl",
+		"20201012020202_foo.hcl",
+	}
+	history := History{
+		records: map[string]Record{
+			"20201012010101_foo.hcl": Record{
+				Type:      "state",
+				Name:      "foo",
+				AppliedAt: time.Date(2020, 10, 13, 1, 2, 3, 0, time.UTC),
+			},
+			"20201012020202_foo.hcl": Record{
+				Type:      "state",
+				Name:      "bar",
+				AppliedAt: time.Date(2020, 10, 13, 4, 5, 6, 0, time.UTC),
+			},
+		},
+	}
+
+	c := &Controller{
+		migrations: migrations,
+		history:    history,
+	}
+
+	c.DeleteRecord("20201012020202_foo.hcl")
+	got := c.history
+	want := History{
+		records: map[string]Record{
+			"20201012010101_foo.hcl": Record{
+				Type:      "state",
+				Name:      "foo",
+				AppliedAt: time.Date(2020, 10, 13, 1, 2, 3, 0, time.UTC),
+			},
+		},
+	}
+	if diff := cmp.Diff(got, want, cmp.AllowUnexported(got)); diff != "" {
+		t.Errorf("got = %#v, want = %#v, diff = %s", got, want, diff)
+	}
+	if c.AlreadyApplied("20201012020202_foo.hcl") {
+		t.Errorf("expected the record to be deleted, but still applied")
+	}
+}
@@ -47,6 +47,41 @@ func TestParseHistoryFile(t *testing.T) {
 			},
 			ok: true,
 		},
+		{
+			desc: "v2",
+			b: []byte(`{
+    "version": 2,
+    "records": {
+        "20201012010101_foo.hcl": {
+            "type": "state",
+            "name": "foo",
+            "applied_at": "2020-10-13T01:02:03Z",
+            "rolled_back_at": "2020-10-14T01:02:03Z"
+        },
+        "20201012020202_foo.hcl": {
+            "type": "state",
+            "name": "bar",
+            "applied_at": "2020-10-13T04:05:06Z"
+        }
+    }
+}`),
+			want: &History{
+				records: map[string]Record{
+					"20201012010101_foo.hcl": Record{
+						Type:         "state",
+						Name:         "foo",
+						AppliedAt:    time.Date(2020, 10, 13, 1, 2, 3, 0, time.UTC),
+						RolledBackAt: timePtr(time.Date(2020, 10, 14, 1, 2, 3, 0, time.UTC)),
+					},
+					"20201012020202_foo.hcl": Record{
+						Type:      "state",
+						Name:      "bar",
+						AppliedAt: time.Date(2020, 10, 13, 4, 5, 6, 0, time.UTC),
+					},
+				},
+			},
+			ok: true,
+		},
 		{
 			desc: "unknown version",
 			b: []byte(`{
@@ -75,3 +110,8 @@ func TestParseHistoryFile(t *testing.T) {
 		})
 	}
 }
+
+// timePtr returns a pointer to a given time for test data.
+func timePtr(t time.Time) *time.Time {
+	return &t
+}
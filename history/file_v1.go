@@ -45,8 +45,14 @@ func newFileV1(h History) *FileV1 {
 }
 
 // newRecordV1 converts a Record to a RecordV1 instance.
+// The format v1 can't represent a rollback, so use FileV2 for history which
+// contains a migration rolled back.
 func newRecordV1(r Record) RecordV1 {
-	return RecordV1(r)
+	return RecordV1{
+		Type:      r.Type,
+		Name:      r.Name,
+		AppliedAt: r.AppliedAt,
+	}
 }
 
 // Serialize encodes a FileV1 instance to bytes.
@@ -82,5 +88,9 @@ func (f *FileV1) toHistory() History {
 
 // toRecord converts a RecordV1 to a Record instance.
 func (r RecordV1) toRecord() Record {
-	return Record(r)
+	return Record{
+		Type:      r.Type,
+		Name:      r.Name,
+		AppliedAt: r.AppliedAt,
+	}
 }
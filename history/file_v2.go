@@ -0,0 +1,71 @@
+package history
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// FileV2 represents a data structure for history file format v2.
+// It adds a timestamp of rollback to each record. A history file is written
+// in v2 only if it contains a migration rolled back, so that an older version
+// of tfmigrate which doesn't know rollbacks refuses to read it instead of
+// treating the migration as applied.
+type FileV2 struct {
+	// Version is a file format version. It is always set to 2.
+	Version int `json:"version"`
+	// Records is a set of applied migration log.
+	// Only success migrations are recorded.
+	// A key is migration file name.
+	// We record only the file name not to invalidate history when the migration
+	// directory is moved.
+	Records map[string]RecordV2 `json:"records"`
+}
+
+// RecordV2 represents an applied migration log.
+type RecordV2 struct {
+	// Type is a migration type.
+	Type string `json:"type"`
+	// Name is a migration name.
+	Name string `json:"name"`
+	// AppliedAt is a timestamp when the migration was applied.
+	// Note that we only record it when the migration was succeed.
+	AppliedAt time.Time `json:"applied_at"`
+	// RolledBackAt is a timestamp when the migration was rolled back.
+	// It's omitted if the migration has not been rolled back.
+	RolledBackAt *time.Time `json:"rolled_back_at,omitempty"`
+}
+
+// newFileV2 converts a History to a FileV2 instance.
+func newFileV2(h History) *FileV2 {
+	m := make(map[string]RecordV2)
+	for k, v := range h.records {
+		m[k] = RecordV2(v)
+	}
+
+	return &FileV2{
+		Version: 2,
+		Records: m,
+	}
+}
+
+// Serialize encodes a FileV2 instance to bytes.
+func (f *FileV2) Serialize() ([]byte, error) {
+	return json.MarshalIndent(f, "", "    ")
+}
+
+// parseHistoryFileV2 parses bytes and returns a History instance.
+func parseHistoryFileV2(b []byte) (*History, error) {
+	var f FileV2
+
+	err := json.Unmarshal(b, &f)
+	if err != nil {
+		return nil, err
+	}
+
+	m := make(map[string]Record)
+	for k, v := range f.Records {
+		m[k] = Record(v)
+	}
+
+	return &History{records: m}, nil
+}
@@ -5,7 +5,8 @@ import "time"
 // History records applied migration logs.
 type History struct {
 	// records is a set of applied migration log.
-	// Only success migrations are recorded.
+	// Only success migrations are recorded. A migration rolled back is kept
+	// with a timestamp of the rollback as an audit trail.
 	// A key is migration file name.
 	// We record only the file name not to invalidate history when the migration
 	// directory is moved.
@@ -21,6 +22,15 @@ type Record struct {
 	// AppliedAt is a timestamp when the migration was applied.
 	// Note that we only record it when the migration was succeed.
 	AppliedAt time.Time
+	// RolledBackAt is a timestamp when the migration was rolled back after it
+	// was applied. If nil, the migration has not been rolled back.
+	RolledBackAt *time.Time
+}
+
+// Applied returns true if the migration is applied, that is, it has not been
+// rolled back.
+func (r Record) Applied() bool {
+	return r.RolledBackAt == nil
 }
 
 // newEmptyHistory initializes a new History.
@@ -37,10 +47,32 @@ func (h *History) Add(filename string, r Record) {
 	h.records[filename] = r
 }
 
-// Contains returns true if a given migration has been applied.
+// Contains returns true if a given migration has been applied and has not
+// been rolled back.
 func (h *History) Contains(filename string) bool {
-	_, ok := h.records[filename]
-	return ok
+	r, ok := h.records[filename]
+	return ok && r.Applied()
+}
+
+// Rollback records that a given migration has been rolled back at a given
+// timestamp. If a given filename doesn't exist, no-op.
+func (h *History) Rollback(filename string, rolledBackAt time.Time) {
+	r, ok := h.records[filename]
+	if !ok {
+		return
+	}
+	r.RolledBackAt = &rolledBackAt
+	h.records[filename] = r
+}
+
+// hasRollback returns true if history contains a migration rolled back.
+func (h *History) hasRollback() bool {
+	for _, r := range h.records {
+		if !r.Applied() {
+			return true
+		}
+	}
+	return false
 }
 
 // Delete deletes a record from history.
@@ -54,7 +86,14 @@ func (h *History) Clear() {
 	h.records = make(map[string]Record)
 }
 
-// Length returns a number of records in history.
+// Length returns a number of applied migrations in history, which doesn't
+// include migrations rolled back.
 func (h *History) Length() int {
-	return len(h.records)
+	n := 0
+	for _, r := range h.records {
+		if r.Applied() {
+			n++
+		}
+	}
+	return n
 }
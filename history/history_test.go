@@ -264,6 +264,25 @@ func TestHistoryLength(t *testing.T) {
 			},
 			want: 2,
 		},
+		{
+			desc: "migrations rolled back are not counted",
+			h: History{
+				records: map[string]Record{
+					"20201012010101_foo.hcl": Record{
+						Type:         "state",
+						Name:         "foo",
+						AppliedAt:    time.Date(2020, 10, 13, 1, 2, 3, 0, time.UTC),
+						RolledBackAt: timePtr(time.Date(2020, 10, 14, 1, 2, 3, 0, time.UTC)),
+					},
+					"20201012020202_foo.hcl": Record{
+						Type:      "state",
+						Name:      "bar",
+						AppliedAt: time.Date(2020, 10, 13, 4, 5, 6, 0, time.UTC),
+					},
+				},
+			},
+			want: 1,
+		},
 	}
 
 	for _, tc := range cases {
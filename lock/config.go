@@ -0,0 +1,21 @@
+package lock
+
+import (
+	"time"
+
+	"github.com/minamijoyo/tfmigrate/storage"
+)
+
+// Config is a set of configurations for advisory locks of remote states.
+type Config struct {
+	// Storage is an interface of factory method for Storage.
+	// The path of the storage is used as a prefix of lock objects, so the
+	// storage must implement storage.KeyedConfig.
+	Storage storage.Config
+	// Timeout is a duration to retry acquiring a lock held by someone else.
+	// Default to 0, which means to fail immediately.
+	Timeout time.Duration
+	// TTL is a duration after which a lock is considered stale and can be
+	// taken over. Default to 0, which means a lock never expires.
+	TTL time.Duration
+}
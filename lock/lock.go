@@ -0,0 +1,283 @@
+package lock
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"os/user"
+	"path"
+	"path/filepath"
+	"time"
+
+	"github.com/minamijoyo/tfmigrate/logging"
+	"github.com/minamijoyo/tfmigrate/storage"
+)
+
+// defaultRetryInterval is an interval to retry acquiring a lock.
+const defaultRetryInterval = 5 * time.Second
+
+// Info is information of a lock holder stored in a lock object.
+type Info struct {
+	// ID is a unique ID of the lock.
+	ID string `json:"id"`
+	// Who is a user and host name of the lock holder.
+	Who string `json:"who"`
+	// Operation is a description of the operation holding the lock.
+	Operation string `json:"operation"`
+	// Created is a timestamp when the lock was acquired.
+	Created time.Time `json:"created"`
+}
+
+// String returns a human readable description of the lock holder.
+func (i *Info) String() string {
+	return fmt.Sprintf("%s (id: %s, operation: %s, created: %s)", i.Who, i.ID, i.Operation, i.Created.Format(time.RFC3339))
+}
+
+// Locker acquires advisory locks of remote states.
+// Each lock is stored as an object at a key derived from a working directory
+// and a workspace as follows:
+// <dir>/<workspace>.tflock
+// A lock is acquired by creating the object only if it doesn't exist, and
+// released by deleting it only if it has not been changed, so the storage
+// must support conditional writes. Since the lock is managed by tfmigrate, it
+// only excludes other tfmigrate processes which share the same lock storage.
+type Locker struct {
+	// config is a storage config which stores multiple objects.
+	config storage.KeyedConfig
+	// timeout is a duration to retry acquiring a lock held by someone else.
+	timeout time.Duration
+	// ttl is a duration after which a lock is considered stale and can be
+	// taken over. If 0, a lock never expires.
+	ttl time.Duration
+	// retryInterval is an interval to retry acquiring a lock.
+	retryInterval time.Duration
+	// operation is a description of the operation holding locks.
+	operation string
+}
+
+// New returns a new Locker instance for a given operation.
+func New(config *Config, operation string) (*Locker, error) {
+	keyed, ok := config.Storage.(storage.KeyedConfig)
+	if !ok {
+		return nil, fmt.Errorf("the storage doesn't support locks: %T", config.Storage)
+	}
+
+	l := &Locker{
+		config:        keyed,
+		timeout:       config.Timeout,
+		ttl:           config.TTL,
+		retryInterval: defaultRetryInterval,
+		operation:     operation,
+	}
+	return l, nil
+}
+
+// Key returns a key of lock for a given working dir and workspace.
+func (l *Locker) Key(dir string, workspace string) string {
+	d := storage.EscapeKeySegment(filepath.ToSlash(filepath.Clean(dir)))
+	w := storage.EscapeKeySegment(workspace)
+	return path.Join(d, w+".tflock")
+}
+
+// newLockStorage returns a storage for a lock object at a given key.
+func (l *Locker) newLockStorage(key string) (storage.LockStorage, error) {
+	s, err := l.config.NewKeyedStorage(key)
+	if err != nil {
+		return nil, err
+	}
+	ls, ok := s.(storage.LockStorage)
+	if !ok {
+		return nil, fmt.Errorf("the storage doesn't support conditional writes required for locks: %T", s)
+	}
+	return ls, nil
+}
+
+// Lock acquires a lock for a given working dir and workspace, and returns a
+// function to release it. If the lock is held by someone else, it retries
+// until the timeout and returns an error naming the lock holder.
+func (l *Locker) Lock(ctx context.Context, dir string, workspace string) (func(context.Context) error, error) {
+	key := l.Key(dir, workspace)
+	ctx = logContext(ctx, dir, workspace, key)
+	s, err := l.newLockStorage(key)
+	if err != nil {
+		return nil, err
+	}
+
+	info, err := newInfo(l.operation)
+	if err != nil {
+		return nil, err
+	}
+
+	deadline := time.Now().Add(l.timeout)
+	for {
+		holder, err := l.tryLock(ctx, s, key, info)
+		if err != nil {
+			return nil, fmt.Errorf("failed to acquire a lock: %s, err: %s", key, err)
+		}
+		if holder == nil {
+			slog.InfoContext(ctx, "acquired a lock")
+			unlock := func(ctx context.Context) error {
+				return l.unlock(logContext(ctx, dir, workspace, key), s, key, info)
+			}
+			return unlock, nil
+		}
+
+		if !time.Now().Before(deadline) {
+			return nil, fmt.Errorf("state in %s (workspace: %s) is locked by %s. If you are sure that no one holds the lock, release it with: tfmigrate force-unlock --workspace=%s %s %s", dir, workspace, holder, workspace, dir, holder.ID)
+		}
+
+		slog.InfoContext(ctx, "waiting for a lock", "holder", holder.String())
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(l.retryInterval):
+		}
+	}
+}
+
+// logContext returns a context which adds a given dir, workspace and key of
+// lock to log records.
+func logContext(ctx context.Context, dir string, workspace string, key string) context.Context {
+	return logging.With(ctx, "component", "lock", "dir", dir, "workspace", workspace, "key", key)
+}
+
+// tryLock tries to acquire a lock. If the lock is held by someone else, it
+// returns the lock holder. A stale lock is taken over.
+func (l *Locker) tryLock(ctx context.Context, s storage.LockStorage, key string, info *Info) (*Info, error) {
+	b, err := json.Marshal(info)
+	if err != nil {
+		return nil, err
+	}
+
+	for {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+
+		err := s.Create(ctx, b)
+		if err == nil {
+			return nil, nil
+		}
+		if !errors.Is(err, storage.ErrPreconditionFailed) {
+			return nil, err
+		}
+
+		holder, version, err := readInfo(ctx, s)
+		if err != nil {
+			return nil, err
+		}
+		if len(version) == 0 {
+			// The lock has been released since we tried to create it.
+			continue
+		}
+		if !l.isStale(holder) {
+			return holder, nil
+		}
+
+		// Delete a stale lock only if it has not been changed since we read it,
+		// so that we never delete a lock acquired by someone else in the meantime.
+		slog.WarnContext(ctx, "take over a stale lock", "holder", holder.String())
+		if err := s.Delete(ctx, version); err != nil && !errors.Is(err, storage.ErrPreconditionFailed) {
+			return nil, err
+		}
+	}
+}
+
+// isStale returns true if a given lock has been held longer than the TTL.
+func (l *Locker) isStale(holder *Info) bool {
+	return l.ttl > 0 && time.Since(holder.Created) > l.ttl
+}
+
+// unlock releases a lock if it is held by a given lock info.
+func (l *Locker) unlock(ctx context.Context, s storage.LockStorage, key string, info *Info) error {
+	holder, version, err := readInfo(ctx, s)
+	if err != nil {
+		return fmt.Errorf("failed to release a lock: %s, err: %s", key, err)
+	}
+	if holder == nil || holder.ID != info.ID {
+		return fmt.Errorf("failed to release a lock: %s, the lock is not held by us, but %v", key, holder)
+	}
+
+	if err := s.Delete(ctx, version); err != nil {
+		return fmt.Errorf("failed to release a lock: %s, err: %s", key, err)
+	}
+	slog.InfoContext(ctx, "released a lock")
+	return nil
+}
+
+// ForceUnlock releases a lock for a given working dir and workspace held by
+// someone else. The lock is released only if its ID matches a given one to
+// avoid releasing a lock acquired after the ID was checked.
+func (l *Locker) ForceUnlock(ctx context.Context, dir string, workspace string, id string) error {
+	key := l.Key(dir, workspace)
+	ctx = logContext(ctx, dir, workspace, key)
+	s, err := l.newLockStorage(key)
+	if err != nil {
+		return err
+	}
+
+	holder, version, err := readInfo(ctx, s)
+	if err != nil {
+		return fmt.Errorf("failed to read a lock: %s, err: %s", key, err)
+	}
+	if holder == nil {
+		return fmt.Errorf("state in %s (workspace: %s) is not locked", dir, workspace)
+	}
+	if holder.ID != id {
+		return fmt.Errorf("the lock ID doesn't match: %s, the lock is held by %s", id, holder)
+	}
+
+	if err := s.Delete(ctx, version); err != nil {
+		return fmt.Errorf("failed to release a lock: %s, err: %s", key, err)
+	}
+	slog.InfoContext(ctx, "force released a lock", "holder", holder.String())
+	return nil
+}
+
+// readInfo reads a lock object and its version. It returns nil and an empty
+// version if the lock is not held, that is, the object doesn't exist. It
+// returns an error if the object can't be parsed.
+func readInfo(ctx context.Context, s storage.LockStorage) (*Info, string, error) {
+	b, version, err := s.ReadVersion(ctx)
+	if err != nil {
+		return nil, "", err
+	}
+	if len(version) == 0 {
+		return nil, "", nil
+	}
+
+	var info Info
+	if err := json.Unmarshal(b, &info); err != nil {
+		return nil, "", fmt.Errorf("failed to parse a lock object: %s", err)
+	}
+	return &info, version, nil
+}
+
+// newInfo returns a new lock info for the current process.
+func newInfo(operation string) (*Info, error) {
+	buf := make([]byte, 16)
+	if _, err := rand.Read(buf); err != nil {
+		return nil, err
+	}
+
+	who := "unknown"
+	if u, err := user.Current(); err == nil {
+		who = u.Username
+	}
+	if host, err := os.Hostname(); err == nil {
+		who = who + "@" + host
+	}
+
+	info := &Info{
+		ID:        hex.EncodeToString(buf),
+		Who:       who,
+		Operation: operation,
+		Created:   time.Now().UTC(),
+	}
+	return info, nil
+}
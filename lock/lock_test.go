@@ -0,0 +1,296 @@
+package lock
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/minamijoyo/tfmigrate/storage/local"
+	"github.com/minamijoyo/tfmigrate/storage/mock"
+)
+
+func TestLockerKey(t *testing.T) {
+	cases := []struct {
+		desc      string
+		dir       string
+		workspace string
+		want      string
+	}{
+		{
+			desc:      "simple",
+			dir:       "dir1",
+			workspace: "default",
+			want:      "dir1/default.tflock",
+		},
+		{
+			desc:      "relative paths",
+			dir:       "../dir1/",
+			workspace: "work",
+			want:      "%2E%2E%2Fdir1/work.tflock",
+		},
+		{
+			desc:      "current dir",
+			dir:       ".",
+			workspace: "default",
+			want:      "%2E/default.tflock",
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.desc, func(t *testing.T) {
+			l, err := New(&Config{Storage: &mock.Config{}}, "test")
+			if err != nil {
+				t.Fatalf("unexpected err: %s", err)
+			}
+			got := l.Key(tc.dir, tc.workspace)
+			if got != tc.want {
+				t.Errorf("got: %s, want: %s", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestLockerLockAndUnlock(t *testing.T) {
+	ctx := context.Background()
+	config := &Config{Storage: &mock.Config{}}
+	l1, err := New(config, "operation1")
+	if err != nil {
+		t.Fatalf("unexpected err: %s", err)
+	}
+	l2, err := New(config, "operation2")
+	if err != nil {
+		t.Fatalf("unexpected err: %s", err)
+	}
+
+	unlock, err := l1.Lock(ctx, "dir1", "default")
+	if err != nil {
+		t.Fatalf("failed to lock: %s", err)
+	}
+
+	// another workspace can be locked independently.
+	unlockOther, err := l2.Lock(ctx, "dir1", "work1")
+	if err != nil {
+		t.Fatalf("failed to lock another workspace: %s", err)
+	}
+	if err := unlockOther(ctx); err != nil {
+		t.Fatalf("failed to unlock another workspace: %s", err)
+	}
+
+	_, err = l2.Lock(ctx, "dir1", "default")
+	if err == nil {
+		t.Fatalf("expected to return an error, but no error")
+	}
+	if !strings.Contains(err.Error(), "operation1") {
+		t.Errorf("expected an error message to name the lock holder, got: %s", err)
+	}
+
+	if err := unlock(ctx); err != nil {
+		t.Fatalf("failed to unlock: %s", err)
+	}
+
+	unlock2, err := l2.Lock(ctx, "dir1", "default")
+	if err != nil {
+		t.Fatalf("failed to lock after unlock: %s", err)
+	}
+
+	// cannot release a lock held by someone else.
+	if err := unlock(ctx); err == nil {
+		t.Fatalf("expected to return an error, but no error")
+	}
+
+	if err := unlock2(ctx); err != nil {
+		t.Fatalf("failed to unlock: %s", err)
+	}
+}
+
+func TestLockerLockWithTimeout(t *testing.T) {
+	ctx := context.Background()
+	config := &Config{Storage: &mock.Config{}, Timeout: 50 * time.Millisecond}
+	l1, err := New(config, "operation1")
+	if err != nil {
+		t.Fatalf("unexpected err: %s", err)
+	}
+	l2, err := New(config, "operation2")
+	if err != nil {
+		t.Fatalf("unexpected err: %s", err)
+	}
+	l2.retryInterval = 10 * time.Millisecond
+
+	unlock, err := l1.Lock(ctx, "dir1", "default")
+	if err != nil {
+		t.Fatalf("failed to lock: %s", err)
+	}
+
+	start := time.Now()
+	_, err = l2.Lock(ctx, "dir1", "default")
+	if err == nil {
+		t.Fatalf("expected to return an error, but no error")
+	}
+	if elapsed := time.Since(start); elapsed < config.Timeout {
+		t.Errorf("expected to retry until timeout, but returned in %s", elapsed)
+	}
+
+	if err := unlock(ctx); err != nil {
+		t.Fatalf("failed to unlock: %s", err)
+	}
+}
+
+func TestLockerLockIsMutuallyExclusive(t *testing.T) {
+	ctx := context.Background()
+	config := &Config{Storage: &local.Config{Path: t.TempDir()}}
+
+	const n = 10
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	acquired := 0
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			l, err := New(config, "operation")
+			if err != nil {
+				t.Errorf("unexpected err: %s", err)
+				return
+			}
+			if _, err := l.Lock(ctx, "dir1", "default"); err == nil {
+				mu.Lock()
+				acquired++
+				mu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+
+	if acquired != 1 {
+		t.Errorf("expected exactly one process to acquire the lock, but got %d", acquired)
+	}
+}
+
+func TestLockerLockStale(t *testing.T) {
+	ctx := context.Background()
+	config := &Config{Storage: &mock.Config{}, TTL: time.Hour}
+	l1, err := New(config, "operation1")
+	if err != nil {
+		t.Fatalf("unexpected err: %s", err)
+	}
+	l2, err := New(config, "operation2")
+	if err != nil {
+		t.Fatalf("unexpected err: %s", err)
+	}
+
+	unlock, err := l1.Lock(ctx, "dir1", "default")
+	if err != nil {
+		t.Fatalf("failed to lock: %s", err)
+	}
+	if _, err := l2.Lock(ctx, "dir1", "default"); err == nil {
+		t.Fatalf("expected a lock within the TTL not to be taken over")
+	}
+
+	// make the lock stale.
+	s := config.Storage.(*mock.Config).KeyedStorage(l1.Key("dir1", "default"))
+	stale := &Info{ID: "stale", Who: "someone", Operation: "operation1", Created: time.Now().Add(-2 * time.Hour)}
+	b, err := json.Marshal(stale)
+	if err != nil {
+		t.Fatalf("unexpected err: %s", err)
+	}
+	if err := s.Write(ctx, b); err != nil {
+		t.Fatalf("failed to write: %s", err)
+	}
+
+	unlock2, err := l2.Lock(ctx, "dir1", "default")
+	if err != nil {
+		t.Fatalf("failed to take over a stale lock: %s", err)
+	}
+	if err := unlock(ctx); err == nil {
+		t.Fatalf("expected the original holder not to release a lock taken over")
+	}
+	if err := unlock2(ctx); err != nil {
+		t.Fatalf("failed to unlock: %s", err)
+	}
+}
+
+func TestLockerLockInvalidObject(t *testing.T) {
+	cases := []struct {
+		desc    string
+		content []byte
+	}{
+		{
+			desc:    "empty",
+			content: []byte{},
+		},
+		{
+			desc:    "not json",
+			content: []byte("foo"),
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.desc, func(t *testing.T) {
+			ctx := context.Background()
+			config := &Config{Storage: &local.Config{Path: t.TempDir()}}
+			l, err := New(config, "operation")
+			if err != nil {
+				t.Fatalf("unexpected err: %s", err)
+			}
+
+			s, err := config.Storage.(*local.Config).NewKeyedStorage(l.Key("dir1", "default"))
+			if err != nil {
+				t.Fatalf("unexpected err: %s", err)
+			}
+			if err := s.Write(ctx, tc.content); err != nil {
+				t.Fatalf("failed to write: %s", err)
+			}
+
+			// A lock object which can't be parsed is never deleted silently.
+			if _, err := l.Lock(ctx, "dir1", "default"); err == nil {
+				t.Fatalf("expected to return an error, but no error")
+			}
+			got, err := s.Read(ctx)
+			if err != nil {
+				t.Fatalf("failed to read: %s", err)
+			}
+			if string(got) != string(tc.content) {
+				t.Errorf("expected the lock object to be kept, got: %s", string(got))
+			}
+		})
+	}
+}
+
+func TestLockerForceUnlock(t *testing.T) {
+	ctx := context.Background()
+	config := &Config{Storage: &mock.Config{}}
+	l1, err := New(config, "operation1")
+	if err != nil {
+		t.Fatalf("unexpected err: %s", err)
+	}
+	l2, err := New(config, "operation2")
+	if err != nil {
+		t.Fatalf("unexpected err: %s", err)
+	}
+
+	if err := l2.ForceUnlock(ctx, "dir1", "default", "foo"); err == nil {
+		t.Fatalf("expected to return an error for a lock not held, but no error")
+	}
+
+	if _, err := l1.Lock(ctx, "dir1", "default"); err != nil {
+		t.Fatalf("failed to lock: %s", err)
+	}
+	_, err = l2.Lock(ctx, "dir1", "default")
+	if err == nil {
+		t.Fatalf("expected to return an error, but no error")
+	}
+	id := err.Error()[strings.LastIndex(err.Error(), " ")+1:]
+
+	if err := l2.ForceUnlock(ctx, "dir1", "default", "foo"); err == nil {
+		t.Fatalf("expected to return an error for a wrong lock ID, but no error")
+	}
+	if err := l2.ForceUnlock(ctx, "dir1", "default", id); err != nil {
+		t.Fatalf("failed to force unlock: %s", err)
+	}
+	if _, err := l2.Lock(ctx, "dir1", "default"); err != nil {
+		t.Fatalf("failed to lock after force unlock: %s", err)
+	}
+}
@@ -0,0 +1,104 @@
+package logging
+
+import (
+	"context"
+	"io"
+	"sync"
+)
+
+// flushMu serializes flushes of buffers so that output of a buffer is not
+// mixed up with another one.
+var flushMu sync.Mutex
+
+// Buffer holds output written in a context until it's flushed, so that
+// output of tasks running concurrently is not interleaved. It keeps the
+// destination of each write, such as stdout or stderr, and the order of
+// writes across destinations.
+type Buffer struct {
+	// mu protects chunks.
+	mu sync.Mutex
+	// chunks is a list of buffered writes in order.
+	chunks []chunk
+}
+
+// chunk is a buffered write to a destination.
+type chunk struct {
+	// dst is a writer to which the data is written on flush.
+	dst io.Writer
+	// data is buffered bytes.
+	data []byte
+}
+
+// bufferKey is a context key for a Buffer.
+type bufferKey struct{}
+
+// WithBuffer returns a context which buffers log records and streamed output
+// of terraform commands run with it, and the buffer. The caller must flush
+// the buffer when the task finishes.
+func WithBuffer(ctx context.Context) (context.Context, *Buffer) {
+	b := &Buffer{}
+	return context.WithValue(ctx, bufferKey{}, b), b
+}
+
+// Writer returns a writer which writes to a buffer in a given context on
+// behalf of a given writer. If the context has no buffer, it returns the
+// given writer as it is.
+func Writer(ctx context.Context, w io.Writer) io.Writer {
+	b, ok := bufferFromContext(ctx)
+	if !ok {
+		return w
+	}
+	return &bufferWriter{buffer: b, dst: w}
+}
+
+// bufferFromContext returns a Buffer in a given context if any.
+func bufferFromContext(ctx context.Context) (*Buffer, bool) {
+	if ctx == nil {
+		return nil, false
+	}
+	b, ok := ctx.Value(bufferKey{}).(*Buffer)
+	return b, ok
+}
+
+// Flush writes buffered output to their destinations in order and clears the
+// buffer. Errors of the destinations are ignored, because the output is a
+// best-effort display for humans.
+func (b *Buffer) Flush() {
+	b.mu.Lock()
+	chunks := b.chunks
+	b.chunks = nil
+	b.mu.Unlock()
+
+	flushMu.Lock()
+	defer flushMu.Unlock()
+	for _, c := range chunks {
+		_, _ = c.dst.Write(c.data)
+	}
+}
+
+// write appends a copy of given bytes for a given destination.
+// Consecutive writes to the same destination are merged.
+func (b *Buffer) write(dst io.Writer, p []byte) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if n := len(b.chunks); n > 0 && b.chunks[n-1].dst == dst {
+		b.chunks[n-1].data = append(b.chunks[n-1].data, p...)
+		return
+	}
+	b.chunks = append(b.chunks, chunk{dst: dst, data: append([]byte{}, p...)})
+}
+
+// bufferWriter is an io.Writer which writes to a Buffer on behalf of a
+// destination writer.
+type bufferWriter struct {
+	buffer *Buffer
+	dst    io.Writer
+}
+
+var _ io.Writer = (*bufferWriter)(nil)
+
+// Write writes given bytes to the buffer.
+func (w *bufferWriter) Write(p []byte) (int, error) {
+	w.buffer.write(w.dst, p)
+	return len(p), nil
+}
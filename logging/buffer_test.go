@@ -0,0 +1,58 @@
+package logging
+
+import (
+	"bytes"
+	"context"
+	"log/slog"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestBuffer(t *testing.T) {
+	var stderr, stdout bytes.Buffer
+	h, err := NewHandler(&stderr, Config{Format: "json"})
+	if err != nil {
+		t.Fatalf("failed to create a handler: %s", err)
+	}
+	logger := slog.New(h).With("component", "test")
+
+	ctx := With(context.Background(), "migration", "mig1.hcl")
+	ctx, buf := WithBuffer(ctx)
+
+	logger.InfoContext(ctx, "foo")
+	if _, err := Writer(ctx, &stdout).Write([]byte("[dir1] out\n")); err != nil {
+		t.Fatalf("failed to write: %s", err)
+	}
+	logger.InfoContext(ctx, "bar")
+	// output without the buffer is written immediately.
+	logger.InfoContext(context.Background(), "baz")
+	if _, err := Writer(context.Background(), &stdout).Write([]byte("[dir2] out\n")); err != nil {
+		t.Fatalf("failed to write: %s", err)
+	}
+
+	got := decodeJSONLines(t, stderr.Bytes())
+	want := []map[string]any{
+		{"level": "INFO", "msg": "baz", "component": "test"},
+	}
+	if diff := cmp.Diff(got, want); diff != "" {
+		t.Errorf("got: %v, want: %v, diff: %s", got, want, diff)
+	}
+	if got := stdout.String(); got != "[dir2] out\n" {
+		t.Errorf("got stdout: %q, want: %q", got, "[dir2] out\n")
+	}
+
+	buf.Flush()
+	got = decodeJSONLines(t, stderr.Bytes())
+	want = []map[string]any{
+		{"level": "INFO", "msg": "baz", "component": "test"},
+		{"level": "INFO", "msg": "foo", "component": "test", "migration": "mig1.hcl"},
+		{"level": "INFO", "msg": "bar", "component": "test", "migration": "mig1.hcl"},
+	}
+	if diff := cmp.Diff(got, want); diff != "" {
+		t.Errorf("got: %v, want: %v, diff: %s", got, want, diff)
+	}
+	if got := stdout.String(); got != "[dir2] out\n[dir1] out\n" {
+		t.Errorf("got stdout: %q, want: %q", got, "[dir2] out\n[dir1] out\n")
+	}
+}
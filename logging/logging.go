@@ -0,0 +1,244 @@
+// Package logging provides structured and leveled logging for tfmigrate
+// based on log/slog. Log records have fields such as a migration file, a type,
+// a working directory, a workspace and a phase, which are carried by a
+// context, so that logs can be filtered by migration.
+package logging
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"strings"
+)
+
+// LevelTrace is a log level more verbose than slog.LevelDebug.
+const LevelTrace = slog.Level(-8)
+
+// Config is a config for logging.
+type Config struct {
+	// Level is a minimum log level. Valid values are TRACE, DEBUG, INFO, WARN
+	// and ERROR. Default to INFO.
+	Level string
+	// Format is a log format. Valid values are text and json.
+	// Default to text.
+	Format string
+	// File is a path to a file which logs are appended to in addition to
+	// stderr. If empty, logs are written to stderr only.
+	File string
+}
+
+// NewConfigFromEnv returns a new Config from environment variables.
+func NewConfigFromEnv() Config {
+	return Config{
+		Level:  os.Getenv("TFMIGRATE_LOG"),
+		Format: os.Getenv("TFMIGRATE_LOG_FORMAT"),
+		File:   os.Getenv("TFMIGRATE_LOG_FILE"),
+	}
+}
+
+// ParseArgs parses global logging flags such as --log-level=DEBUG at the
+// beginning of given command line arguments, and overrides the config with
+// them. It returns the remaining arguments.
+func (c *Config) ParseArgs(args []string) ([]string, error) {
+	flags := map[string]*string{
+		"--log-level":  &c.Level,
+		"--log-format": &c.Format,
+		"--log-file":   &c.File,
+	}
+
+	for len(args) > 0 {
+		name, value, ok := strings.Cut(args[0], "=")
+		p, known := flags[name]
+		if !known {
+			break
+		}
+		if !ok {
+			if len(args) < 2 {
+				return nil, fmt.Errorf("flag needs an argument: %s", name)
+			}
+			value = args[1]
+			args = args[1:]
+		}
+		*p = value
+		args = args[1:]
+	}
+	return args, nil
+}
+
+// ParseLevel parses a given log level. An empty string means INFO.
+func ParseLevel(s string) (slog.Level, error) {
+	switch strings.ToUpper(s) {
+	case "TRACE":
+		return LevelTrace, nil
+	case "DEBUG":
+		return slog.LevelDebug, nil
+	case "", "INFO":
+		return slog.LevelInfo, nil
+	case "WARN":
+		return slog.LevelWarn, nil
+	case "ERROR":
+		return slog.LevelError, nil
+	default:
+		return 0, fmt.Errorf("invalid log level: %s", s)
+	}
+}
+
+// NewHandler returns a new slog.Handler which writes logs to a given writer
+// in a given config. The handler adds fields carried by a context.
+func NewHandler(w io.Writer, c Config) (slog.Handler, error) {
+	level, err := ParseLevel(c.Level)
+	if err != nil {
+		return nil, err
+	}
+
+	opts := &slog.HandlerOptions{
+		Level: level,
+		ReplaceAttr: func(_ []string, a slog.Attr) slog.Attr {
+			// show the custom level as TRACE instead of DEBUG-4.
+			if a.Key == slog.LevelKey {
+				if l, ok := a.Value.Any().(slog.Level); ok && l == LevelTrace {
+					a.Value = slog.StringValue("TRACE")
+				}
+			}
+			return a
+		},
+	}
+
+	var newHandler func(w io.Writer) slog.Handler
+	switch c.Format {
+	case "", "text":
+		newHandler = func(w io.Writer) slog.Handler { return slog.NewTextHandler(w, opts) }
+	case "json":
+		newHandler = func(w io.Writer) slog.Handler { return slog.NewJSONHandler(w, opts) }
+	default:
+		return nil, fmt.Errorf("invalid log format: %s", c.Format)
+	}
+	return &contextHandler{Handler: newHandler(w), w: w, newHandler: newHandler}, nil
+}
+
+// Setup sets up the default slog logger with a given config. It returns a
+// function to close the log file.
+func Setup(c Config, stderr io.Writer) (func() error, error) {
+	w := stderr
+	closer := func() error { return nil }
+	if len(c.File) > 0 {
+		f, err := os.OpenFile(c.File, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0600)
+		if err != nil {
+			return nil, fmt.Errorf("failed to open log file: %s", err)
+		}
+		w = io.MultiWriter(stderr, f)
+		closer = f.Close
+	}
+
+	h, err := NewHandler(w, c)
+	if err != nil {
+		closer()
+		return nil, err
+	}
+
+	slog.SetDefault(slog.New(h))
+	return closer, nil
+}
+
+// attrsKey is a context key for attributes added to log records.
+type attrsKey struct{}
+
+// With returns a context which carries given attributes for log records in
+// addition to ones in a given context. The arguments are alternating keys
+// and values or slog.Attr, same as slog.Logger.With. An attribute with the
+// same key as an existing one replaces it.
+func With(ctx context.Context, args ...any) context.Context {
+	// use a record to convert arguments to attributes in the same way as slog.
+	var r slog.Record
+	r.Add(args...)
+	added := make([]slog.Attr, 0, r.NumAttrs())
+	keys := make(map[string]bool)
+	r.Attrs(func(a slog.Attr) bool {
+		added = append(added, a)
+		keys[a.Key] = true
+		return true
+	})
+
+	attrs := []slog.Attr{}
+	for _, a := range attrsFromContext(ctx) {
+		if !keys[a.Key] {
+			attrs = append(attrs, a)
+		}
+	}
+	attrs = append(attrs, added...)
+	return context.WithValue(ctx, attrsKey{}, attrs)
+}
+
+// attrsFromContext returns attributes carried by a given context.
+func attrsFromContext(ctx context.Context) []slog.Attr {
+	if ctx == nil {
+		return nil
+	}
+	attrs, _ := ctx.Value(attrsKey{}).([]slog.Attr)
+	return attrs
+}
+
+// contextHandler is a slog.Handler which adds attributes carried by a context
+// to each record. If the context has a Buffer, records are written to it.
+type contextHandler struct {
+	slog.Handler
+	// w is a writer of the underlying handler.
+	w io.Writer
+	// newHandler returns a new underlying handler which writes to a given
+	// writer. It's used to write records to a buffer in a context.
+	newHandler func(w io.Writer) slog.Handler
+	// derive is a list of functions to derive the underlying handler with
+	// attributes and groups, which are replayed for a buffered handler.
+	derive []func(slog.Handler) slog.Handler
+}
+
+var _ slog.Handler = (*contextHandler)(nil)
+
+// Handle adds attributes in a given context to a given record and handles it.
+// An attribute of the record takes precedence over one with the same key in
+// the context.
+func (h *contextHandler) Handle(ctx context.Context, r slog.Record) error {
+	handler := h.Handler
+	if _, ok := bufferFromContext(ctx); ok {
+		handler = h.newHandler(Writer(ctx, h.w))
+		for _, f := range h.derive {
+			handler = f(handler)
+		}
+	}
+
+	attrs := attrsFromContext(ctx)
+	if len(attrs) == 0 {
+		return handler.Handle(ctx, r)
+	}
+
+	keys := make(map[string]bool, r.NumAttrs())
+	r.Attrs(func(a slog.Attr) bool {
+		keys[a.Key] = true
+		return true
+	})
+	r = r.Clone()
+	for _, a := range attrs {
+		if !keys[a.Key] {
+			r.AddAttrs(a)
+		}
+	}
+	return handler.Handle(ctx, r)
+}
+
+// WithAttrs returns a new handler with given attributes.
+func (h *contextHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return h.with(func(handler slog.Handler) slog.Handler { return handler.WithAttrs(attrs) })
+}
+
+// WithGroup returns a new handler with a given group.
+func (h *contextHandler) WithGroup(name string) slog.Handler {
+	return h.with(func(handler slog.Handler) slog.Handler { return handler.WithGroup(name) })
+}
+
+// with returns a new handler derived by a given function.
+func (h *contextHandler) with(f func(slog.Handler) slog.Handler) slog.Handler {
+	derive := append(append([]func(slog.Handler) slog.Handler{}, h.derive...), f)
+	return &contextHandler{Handler: f(h.Handler), w: h.w, newHandler: h.newHandler, derive: derive}
+}
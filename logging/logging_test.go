@@ -0,0 +1,171 @@
+package logging
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"log/slog"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestConfigParseArgs(t *testing.T) {
+	cases := []struct {
+		desc   string
+		config Config
+		args   []string
+		want   Config
+		rest   []string
+		ok     bool
+	}{
+		{
+			desc:   "no flags",
+			config: Config{Level: "DEBUG"},
+			args:   []string{"plan", "--config=foo.hcl"},
+			want:   Config{Level: "DEBUG"},
+			rest:   []string{"plan", "--config=foo.hcl"},
+			ok:     true,
+		},
+		{
+			desc:   "override env",
+			config: Config{Level: "DEBUG", Format: "text"},
+			args:   []string{"--log-level=WARN", "--log-format", "json", "--log-file=tfmigrate.log", "apply", "--log-level=ERROR"},
+			want:   Config{Level: "WARN", Format: "json", File: "tfmigrate.log"},
+			rest:   []string{"apply", "--log-level=ERROR"},
+			ok:     true,
+		},
+		{
+			desc:   "missing value",
+			config: Config{},
+			args:   []string{"--log-format"},
+			want:   Config{},
+			rest:   nil,
+			ok:     false,
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.desc, func(t *testing.T) {
+			c := tc.config
+			rest, err := c.ParseArgs(tc.args)
+			if tc.ok && err != nil {
+				t.Fatalf("unexpected err: %s", err)
+			}
+			if !tc.ok && err == nil {
+				t.Fatalf("expected to return an error, but no error, got: %#v", c)
+			}
+			if !tc.ok {
+				return
+			}
+			if diff := cmp.Diff(c, tc.want); diff != "" {
+				t.Errorf("got: %#v, want: %#v, diff: %s", c, tc.want, diff)
+			}
+			if diff := cmp.Diff(rest, tc.rest); diff != "" {
+				t.Errorf("got: %#v, want: %#v, diff: %s", rest, tc.rest, diff)
+			}
+		})
+	}
+}
+
+func TestParseLevel(t *testing.T) {
+	cases := []struct {
+		s    string
+		want slog.Level
+		ok   bool
+	}{
+		{s: "", want: slog.LevelInfo, ok: true},
+		{s: "TRACE", want: LevelTrace, ok: true},
+		{s: "debug", want: slog.LevelDebug, ok: true},
+		{s: "INFO", want: slog.LevelInfo, ok: true},
+		{s: "WARN", want: slog.LevelWarn, ok: true},
+		{s: "ERROR", want: slog.LevelError, ok: true},
+		{s: "FATAL", ok: false},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.s, func(t *testing.T) {
+			got, err := ParseLevel(tc.s)
+			if tc.ok && err != nil {
+				t.Fatalf("unexpected err: %s", err)
+			}
+			if !tc.ok && err == nil {
+				t.Fatalf("expected to return an error, but no error, got: %s", got)
+			}
+			if tc.ok && got != tc.want {
+				t.Errorf("got = %s, want = %s", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestNewHandler(t *testing.T) {
+	cases := []struct {
+		desc   string
+		config Config
+		ok     bool
+	}{
+		{desc: "default", config: Config{}, ok: true},
+		{desc: "text", config: Config{Format: "text"}, ok: true},
+		{desc: "json", config: Config{Format: "json"}, ok: true},
+		{desc: "invalid format", config: Config{Format: "xml"}, ok: false},
+		{desc: "invalid level", config: Config{Level: "FATAL"}, ok: false},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.desc, func(t *testing.T) {
+			_, err := NewHandler(&bytes.Buffer{}, tc.config)
+			if tc.ok && err != nil {
+				t.Fatalf("unexpected err: %s", err)
+			}
+			if !tc.ok && err == nil {
+				t.Fatal("expected to return an error, but no error")
+			}
+		})
+	}
+}
+
+// decodeJSONLines is a test helper which decodes JSON log records.
+func decodeJSONLines(t *testing.T, b []byte) []map[string]any {
+	t.Helper()
+	var records []map[string]any
+	dec := json.NewDecoder(bytes.NewReader(b))
+	for dec.More() {
+		var r map[string]any
+		if err := dec.Decode(&r); err != nil {
+			t.Fatalf("failed to decode a log record: %s", err)
+		}
+		delete(r, slog.TimeKey)
+		records = append(records, r)
+	}
+	return records
+}
+
+func TestWith(t *testing.T) {
+	var b bytes.Buffer
+	h, err := NewHandler(&b, Config{Level: "TRACE", Format: "json"})
+	if err != nil {
+		t.Fatalf("failed to create a handler: %s", err)
+	}
+	logger := slog.New(h)
+
+	ctx := With(context.Background(), "migration", "mig1.hcl", "type", "state")
+	ctx = With(ctx, "dir", "dir1", "phase", "plan")
+	// a later value overrides an earlier one with the same key.
+	applyCtx := With(ctx, "phase", "apply")
+
+	logger.InfoContext(ctx, "foo")
+	logger.Log(applyCtx, LevelTrace, "bar", "dir", "tmp1")
+	logger.InfoContext(context.Background(), "baz")
+
+	got := decodeJSONLines(t, b.Bytes())
+	want := []map[string]any{
+		{"level": "INFO", "msg": "foo", "migration": "mig1.hcl", "type": "state", "dir": "dir1", "phase": "plan"},
+		// an attribute of a record takes precedence over the context.
+		{"level": "TRACE", "msg": "bar", "migration": "mig1.hcl", "type": "state", "dir": "tmp1", "phase": "apply"},
+		{"level": "INFO", "msg": "baz"},
+	}
+	if diff := cmp.Diff(got, want); diff != "" {
+		t.Errorf("got: %v, want: %v, diff: %s", got, want, diff)
+	}
+}
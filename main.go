@@ -1,34 +1,54 @@
 package main
 
 import (
+	"context"
 	"fmt"
-	"io"
-	"log"
+	"log/slog"
 	"os"
 	"strings"
+	"time"
 
-	"github.com/hashicorp/logutils"
 	"github.com/minamijoyo/tfmigrate/command"
+	"github.com/minamijoyo/tfmigrate/logging"
+	"github.com/minamijoyo/tfmigrate/tracing"
 	"github.com/mitchellh/cli"
 )
 
 // Version is a version number.
 var version = "0.4.5"
 
+// tracingShutdownTimeout is a timeout for flushing spans on exit.
+const tracingShutdownTimeout = 5 * time.Second
+
 func main() {
-	log.SetOutput(logOutput())
+	// global logging flags must precede a subcommand.
+	logConfig := logging.NewConfigFromEnv()
+	args, err := logConfig.ParseArgs(os.Args[1:])
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to parse logging flags: %s\n", err)
+		os.Exit(1)
+	}
+	closeLog, err := logging.Setup(logConfig, os.Stderr)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to set up logging: %s\n", err)
+		os.Exit(1)
+	}
+
+	shutdownTracing, err := tracing.Setup(context.Background(), tracing.NewConfigFromEnv(), version)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to set up tracing: %s\n", err)
+		os.Exit(1)
+	}
 
 	// #nosec G706: Log injection via taint analysis
-	log.Printf("[DEBUG] [main] start: %s", strings.Join(os.Args, " "))
-	log.Printf("[DEBUG] [main] tfmigrate version: %s", version)
+	slog.Debug("start", "component", "main", "args", strings.Join(os.Args, " "))
+	slog.Debug("tfmigrate version", "component", "main", "version", version)
 
 	ui := &cli.BasicUi{
 		Writer: os.Stdout,
 	}
 	commands := initCommands(ui)
 
-	args := os.Args[1:]
-
 	c := &cli.CLI{
 		Name:       "tfmigrate",
 		Version:    version,
@@ -42,29 +62,16 @@ func main() {
 		ui.Error(fmt.Sprintf("Failed to execute CLI: %s", err))
 	}
 
-	os.Exit(exitStatus)
-}
-
-func logOutput() io.Writer {
-	levels := []logutils.LogLevel{"TRACE", "DEBUG", "INFO", "WARN", "ERROR"}
-	minLevel := os.Getenv("TFMIGRATE_LOG")
-	if len(minLevel) == 0 {
-		minLevel = "INFO" // default log level
+	// os.Exit doesn't run deferred functions.
+	// Flush remaining spans with a deadline not to block exit forever when the
+	// OTLP endpoint is unreachable.
+	ctx, cancel := context.WithTimeout(context.Background(), tracingShutdownTimeout)
+	if err := shutdownTracing(ctx); err != nil {
+		slog.Warn("failed to export spans", "component", "main", "error", err)
 	}
-
-	// default log writer is null device.
-	writer := io.Discard
-	if minLevel != "" {
-		writer = os.Stderr
-	}
-
-	filter := &logutils.LevelFilter{
-		Levels:   levels,
-		MinLevel: logutils.LogLevel(minLevel),
-		Writer:   writer,
-	}
-
-	return filter
+	cancel()
+	_ = closeLog()
+	os.Exit(exitStatus)
 }
 
 func initCommands(ui cli.Ui) map[string]cli.CommandFactory {
@@ -83,11 +90,56 @@ func initCommands(ui cli.Ui) map[string]cli.CommandFactory {
 				Meta: meta,
 			}, nil
 		},
+		"cleanup": func() (cli.Command, error) {
+			return &command.CleanupCommand{
+				Meta: meta,
+			}, nil
+		},
+		"export": func() (cli.Command, error) {
+			return &command.ExportCommand{
+				Meta: meta,
+			}, nil
+		},
+		"force-unlock": func() (cli.Command, error) {
+			return &command.ForceUnlockCommand{
+				Meta: meta,
+			}, nil
+		},
 		"list": func() (cli.Command, error) {
 			return &command.ListCommand{
 				Meta: meta,
 			}, nil
 		},
+		"moved": func() (cli.Command, error) {
+			return &command.MovedCommand{
+				Meta: meta,
+			}, nil
+		},
+		"new": func() (cli.Command, error) {
+			return &command.NewCommand{
+				Meta: meta,
+			}, nil
+		},
+		"restore": func() (cli.Command, error) {
+			return &command.RestoreCommand{
+				Meta: meta,
+			}, nil
+		},
+		"rollback": func() (cli.Command, error) {
+			return &command.RollbackCommand{
+				Meta: meta,
+			}, nil
+		},
+		"suggest": func() (cli.Command, error) {
+			return &command.SuggestCommand{
+				Meta: meta,
+			}, nil
+		},
+		"validate": func() (cli.Command, error) {
+			return &command.ValidateCommand{
+				Meta: meta,
+			}, nil
+		},
 	}
 
 	return commands
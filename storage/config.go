@@ -1,7 +1,29 @@
 package storage
 
+import (
+	"net/url"
+	"strings"
+)
+
 // Config is an interface of factory method for Storage
 type Config interface {
 	// NewStorage returns a new instance of Storage.
 	NewStorage() (Storage, error)
 }
+
+// KeyedConfig is an interface of factory method for Storage which stores an
+// object at a given key under a common prefix. It is used for storing data
+// other than a migration history, such as state backups.
+type KeyedConfig interface {
+	// NewKeyedStorage returns a new instance of Storage for an object at a
+	// given key. The key is a slash-separated relative path which is joined
+	// to the path of the config.
+	NewKeyedStorage(key string) (Storage, error)
+}
+
+// EscapeKeySegment escapes a given string to be used as a single segment of
+// a key for KeyedConfig. Dots are also escaped so that `.` and `..` are never
+// interpreted as a path.
+func EscapeKeySegment(s string) string {
+	return strings.ReplaceAll(url.PathEscape(s), ".", "%2E")
+}
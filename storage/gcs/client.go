@@ -15,6 +15,15 @@ type Client interface {
 
 	// Write an object onto a GCS bucket.
 	Write(ctx context.Context, p []byte) error
+
+	// Read an object and its generation from a GCS bucket.
+	ReadGeneration(ctx context.Context) ([]byte, int64, error)
+
+	// Create an object onto a GCS bucket only if it does not exist.
+	Create(ctx context.Context, p []byte) error
+
+	// Delete an object from a GCS bucket only if its generation matches.
+	Delete(ctx context.Context, generation int64) error
 }
 
 // An implementation of Client that delegates actual operation to gcsStorage.Client.
@@ -49,6 +58,34 @@ func (a Adapter) Write(ctx context.Context, p []byte) error {
 	return w.Close()
 }
 
+func (a Adapter) ReadGeneration(ctx context.Context) ([]byte, int64, error) {
+	r, err := a.client.Bucket(a.config.Bucket).Object(a.config.Name).NewReader(ctx)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer r.Close()
+
+	body, err := io.ReadAll(r)
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed reading from gcs://%s/%s: %w", a.config.Bucket, a.config.Name, err)
+	}
+	return body, r.Attrs.Generation, nil
+}
+
+func (a Adapter) Create(ctx context.Context, p []byte) error {
+	w := a.client.Bucket(a.config.Bucket).Object(a.config.Name).If(gcStorage.Conditions{DoesNotExist: true}).NewWriter(ctx)
+	_, err := w.Write(p)
+
+	if err != nil {
+		return fmt.Errorf("failed writing to gcs://%s/%s: %w", a.config.Bucket, a.config.Name, err)
+	}
+	return w.Close()
+}
+
+func (a Adapter) Delete(ctx context.Context, generation int64) error {
+	return a.client.Bucket(a.config.Bucket).Object(a.config.Name).If(gcStorage.Conditions{GenerationMatch: generation}).Delete(ctx)
+}
+
 // NewClient returns a new Client with given Context and Config.
 func NewClient(ctx context.Context, config Config) (Client, error) {
 	c, err := gcStorage.NewClient(ctx)
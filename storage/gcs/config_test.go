@@ -33,3 +33,23 @@ func TestConfigNewStorage(t *testing.T) {
 		})
 	}
 }
+
+func TestConfigNewKeyedStorage(t *testing.T) {
+	config := &Config{
+		Bucket: "tfmigrate-test",
+		Name:   "tfmigrate/backup",
+	}
+
+	got, err := config.NewKeyedStorage("foo/bar.tfstate")
+	if err != nil {
+		t.Fatalf("unexpected err: %s", err)
+	}
+
+	s := got.(*Storage)
+	if s.config.Name != "tfmigrate/backup/foo/bar.tfstate" {
+		t.Errorf("got: %s, want: tfmigrate/backup/foo/bar.tfstate", s.config.Name)
+	}
+	if config.Name != "tfmigrate/backup" {
+		t.Errorf("the original config must not be changed, got: %s", config.Name)
+	}
+}
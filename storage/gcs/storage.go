@@ -2,9 +2,14 @@ package gcs
 
 import (
 	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
 
 	gcStorage "cloud.google.com/go/storage"
 	"github.com/minamijoyo/tfmigrate/storage"
+	"google.golang.org/api/googleapi"
 )
 
 // An implementation of [storage.Storage] interface.
@@ -19,6 +24,8 @@ type Storage struct {
 
 var _ storage.Storage = (*Storage)(nil)
 
+var _ storage.LockStorage = (*Storage)(nil)
+
 // NewStorage returns a new instance of Storage.
 func NewStorage(config *Config, client Client) (*Storage, error) {
 	s := &Storage{
@@ -52,6 +59,65 @@ func (s *Storage) Read(ctx context.Context) ([]byte, error) {
 	return r, nil
 }
 
+// ReadVersion reads an object and its generation as a version.
+func (s *Storage) ReadVersion(ctx context.Context) ([]byte, string, error) {
+	err := s.init(ctx)
+	if err != nil {
+		return nil, "", err
+	}
+
+	r, generation, err := s.client.ReadGeneration(ctx)
+	if err == gcStorage.ErrObjectNotExist {
+		return []byte{}, "", nil
+	} else if err != nil {
+		return nil, "", err
+	}
+	return r, strconv.FormatInt(generation, 10), nil
+}
+
+// Create writes an object only if it does not exist, which is a write with
+// the ifGenerationMatch=0 precondition.
+func (s *Storage) Create(ctx context.Context, b []byte) error {
+	err := s.init(ctx)
+	if err != nil {
+		return err
+	}
+
+	err = s.client.Create(ctx, b)
+	if isPreconditionFailed(err) {
+		return storage.ErrPreconditionFailed
+	}
+	return err
+}
+
+// Delete deletes an object only if its generation matches a given version.
+func (s *Storage) Delete(ctx context.Context, version string) error {
+	err := s.init(ctx)
+	if err != nil {
+		return err
+	}
+
+	generation, err := strconv.ParseInt(version, 10, 64)
+	if err != nil {
+		return fmt.Errorf("failed to parse generation: %s", err)
+	}
+
+	err = s.client.Delete(ctx, generation)
+	if err == gcStorage.ErrObjectNotExist {
+		return nil
+	} else if isPreconditionFailed(err) {
+		return storage.ErrPreconditionFailed
+	}
+	return err
+}
+
+// isPreconditionFailed returns true if a given error means that a
+// precondition of a request doesn't match.
+func isPreconditionFailed(err error) bool {
+	var gErr *googleapi.Error
+	return errors.As(err, &gErr) && gErr.Code == http.StatusPreconditionFailed
+}
+
 func (s *Storage) init(ctx context.Context) error {
 	if s.client == nil {
 		client, err := gcStorage.NewClient(ctx)
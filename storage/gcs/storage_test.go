@@ -2,14 +2,19 @@ package gcs
 
 import (
 	"context"
+	"errors"
+	"net/http"
 	"testing"
 
 	gcStorage "cloud.google.com/go/storage"
+	"github.com/minamijoyo/tfmigrate/storage"
+	"google.golang.org/api/googleapi"
 )
 
 // mockClient is a mock implementation for testing.
 type mockClient struct {
 	dataToRead []byte
+	generation int64
 	err        error
 }
 
@@ -21,6 +26,21 @@ func (c *mockClient) Write(_ context.Context, _ []byte) error {
 	return c.err
 }
 
+func (c *mockClient) ReadGeneration(_ context.Context) ([]byte, int64, error) {
+	return c.dataToRead, c.generation, c.err
+}
+
+func (c *mockClient) Create(_ context.Context, _ []byte) error {
+	return c.err
+}
+
+func (c *mockClient) Delete(_ context.Context, generation int64) error {
+	if c.err == nil && generation != c.generation {
+		return &googleapi.Error{Code: http.StatusPreconditionFailed}
+	}
+	return c.err
+}
+
 func TestStorageWrite(t *testing.T) {
 	cases := []struct {
 		desc     string
@@ -142,3 +162,92 @@ func TestStorageRead(t *testing.T) {
 		})
 	}
 }
+
+func TestStorageLock(t *testing.T) {
+	config := &Config{
+		Bucket: "tfmigrate-test",
+		Name:   "tfmigrate/lock",
+	}
+
+	cases := []struct {
+		desc    string
+		client  *mockClient
+		op      func(s *Storage) error
+		wantErr error
+		ok      bool
+	}{
+		{
+			desc:   "read version",
+			client: &mockClient{dataToRead: []byte("foo"), generation: 3},
+			op: func(s *Storage) error {
+				b, version, err := s.ReadVersion(context.Background())
+				if err == nil && (string(b) != "foo" || version != "3") {
+					t.Errorf("got: %s, %s, want: foo, 3", b, version)
+				}
+				return err
+			},
+			wantErr: nil,
+			ok:      true,
+		},
+		{
+			desc:   "read version of an object which does not exist",
+			client: &mockClient{err: gcStorage.ErrObjectNotExist},
+			op: func(s *Storage) error {
+				b, version, err := s.ReadVersion(context.Background())
+				if err == nil && (len(b) != 0 || version != "") {
+					t.Errorf("got: %s, %s, want empty", b, version)
+				}
+				return err
+			},
+			wantErr: nil,
+			ok:      true,
+		},
+		{
+			desc:    "create an object which already exists",
+			client:  &mockClient{err: &googleapi.Error{Code: http.StatusPreconditionFailed}},
+			op:      func(s *Storage) error { return s.Create(context.Background(), []byte("foo")) },
+			wantErr: storage.ErrPreconditionFailed,
+			ok:      false,
+		},
+		{
+			desc:    "delete",
+			client:  &mockClient{generation: 3},
+			op:      func(s *Storage) error { return s.Delete(context.Background(), "3") },
+			wantErr: nil,
+			ok:      true,
+		},
+		{
+			desc:    "delete a changed object",
+			client:  &mockClient{generation: 4},
+			op:      func(s *Storage) error { return s.Delete(context.Background(), "3") },
+			wantErr: storage.ErrPreconditionFailed,
+			ok:      false,
+		},
+		{
+			desc:    "delete an object which does not exist",
+			client:  &mockClient{err: gcStorage.ErrObjectNotExist},
+			op:      func(s *Storage) error { return s.Delete(context.Background(), "3") },
+			wantErr: nil,
+			ok:      true,
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.desc, func(t *testing.T) {
+			s, err := NewStorage(config, tc.client)
+			if err != nil {
+				t.Fatalf("failed to NewStorage: %s", err)
+			}
+			err = tc.op(s)
+			if tc.ok && err != nil {
+				t.Fatalf("unexpected err: %s", err)
+			}
+			if !tc.ok && err == nil {
+				t.Fatal("expected to return an error, but no error")
+			}
+			if tc.wantErr != nil && !errors.Is(err, tc.wantErr) {
+				t.Errorf("got err: %s, want: %s", err, tc.wantErr)
+			}
+		})
+	}
+}
@@ -1,6 +1,10 @@
 package local
 
-import "github.com/minamijoyo/tfmigrate/storage"
+import (
+	"path/filepath"
+
+	"github.com/minamijoyo/tfmigrate/storage"
+)
 
 // Config is a config for local storage.
 type Config struct {
@@ -11,7 +15,21 @@ type Config struct {
 // Config implements a storage.Config.
 var _ storage.Config = (*Config)(nil)
 
+// Config implements a storage.KeyedConfig.
+var _ storage.KeyedConfig = (*Config)(nil)
+
 // NewStorage returns a new instance of storage.Storage.
 func (c *Config) NewStorage() (storage.Storage, error) {
 	return NewStorage(c)
 }
+
+// NewKeyedStorage returns a new instance of storage.Storage for a file at a
+// given key. The path of the config is used as a directory.
+func (c *Config) NewKeyedStorage(key string) (storage.Storage, error) {
+	s, err := NewStorage(&Config{Path: filepath.Join(c.Path, filepath.FromSlash(key))})
+	if err != nil {
+		return nil, err
+	}
+	s.createDir = true
+	return s, nil
+}
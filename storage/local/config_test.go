@@ -1,6 +1,11 @@
 package local
 
-import "testing"
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+)
 
 func TestConfigNewStorage(t *testing.T) {
 	cases := []struct {
@@ -32,3 +37,28 @@ func TestConfigNewStorage(t *testing.T) {
 		})
 	}
 }
+
+func TestConfigNewKeyedStorage(t *testing.T) {
+	localDir := t.TempDir()
+	config := &Config{
+		Path: filepath.Join(localDir, "backup"),
+	}
+
+	s, err := config.NewKeyedStorage("foo/bar.tfstate")
+	if err != nil {
+		t.Fatalf("unexpected err: %s", err)
+	}
+
+	err = s.Write(context.Background(), []byte("foo"))
+	if err != nil {
+		t.Fatalf("failed to write: %s", err)
+	}
+
+	got, err := os.ReadFile(filepath.Join(localDir, "backup", "foo", "bar.tfstate"))
+	if err != nil {
+		t.Fatalf("failed to read contents: %s", err)
+	}
+	if string(got) != "foo" {
+		t.Errorf("got: %s, want: foo", string(got))
+	}
+}
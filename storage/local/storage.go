@@ -2,7 +2,12 @@ package local
 
 import (
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io/fs"
 	"os"
+	"path/filepath"
 
 	"github.com/minamijoyo/tfmigrate/storage"
 )
@@ -14,10 +19,15 @@ import (
 type Storage struct {
 	// config is a storage config for local.
 	config *Config
+	// createDir is a flag to create parent directories on write.
+	// It's set for keyed objects because they are nested under the path.
+	createDir bool
 }
 
 var _ storage.Storage = (*Storage)(nil)
 
+var _ storage.LockStorage = (*Storage)(nil)
+
 // NewStorage returns a new instance of Storage.
 func NewStorage(config *Config) (*Storage, error) {
 	s := &Storage{
@@ -28,6 +38,12 @@ func NewStorage(config *Config) (*Storage, error) {
 
 // Write writes migration history data to storage.
 func (s *Storage) Write(_ context.Context, b []byte) error {
+	if s.createDir {
+		if err := os.MkdirAll(filepath.Dir(s.config.Path), 0755); err != nil {
+			return err
+		}
+	}
+
 	// nolint gosec
 	// G306: Expect WriteFile permissions to be 0600 or less
 	// We ignore it because a history file doesn't contains sensitive data.
@@ -45,3 +61,70 @@ func (s *Storage) Read(_ context.Context) ([]byte, error) {
 	}
 	return os.ReadFile(s.config.Path)
 }
+
+// ReadVersion reads data and its version from storage.
+// The version is a hash of the data, because a lock object written by Create
+// contains a unique ID.
+func (s *Storage) ReadVersion(_ context.Context) ([]byte, string, error) {
+	b, err := os.ReadFile(s.config.Path)
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return []byte{}, "", nil
+		}
+		return nil, "", err
+	}
+	sum := sha256.Sum256(b)
+	return b, hex.EncodeToString(sum[:]), nil
+}
+
+// Create writes data to storage only if the file does not exist.
+// The data is written to a temporary file and then linked to the path, so
+// that no one reads a partially written file.
+func (s *Storage) Create(_ context.Context, b []byte) error {
+	if s.createDir {
+		if err := os.MkdirAll(filepath.Dir(s.config.Path), 0755); err != nil {
+			return err
+		}
+	}
+
+	f, err := os.CreateTemp(filepath.Dir(s.config.Path), filepath.Base(s.config.Path)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+	if _, err := f.Write(b); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+
+	if err := os.Link(f.Name(), s.config.Path); err != nil {
+		if errors.Is(err, fs.ErrExist) {
+			return storage.ErrPreconditionFailed
+		}
+		return err
+	}
+	return nil
+}
+
+// Delete deletes the file only if its version matches.
+// Note that checking the version and deleting the file are not atomic, which
+// is acceptable for the local storage mainly used for debugging.
+func (s *Storage) Delete(ctx context.Context, version string) error {
+	_, current, err := s.ReadVersion(ctx)
+	if err != nil {
+		return err
+	}
+	if len(current) == 0 {
+		return nil
+	}
+	if current != version {
+		return storage.ErrPreconditionFailed
+	}
+	if err := os.Remove(s.config.Path); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+	return nil
+}
@@ -13,11 +13,16 @@ type Config struct {
 
 	// A reference to an instance of mock storage for testing.
 	s *Storage
+	// References to instances of mock storage for keyed objects.
+	keyed map[string]*Storage
 }
 
 // Config implements a storage.Config.
 var _ storage.Config = (*Config)(nil)
 
+// Config implements a storage.KeyedConfig.
+var _ storage.KeyedConfig = (*Config)(nil)
+
 // NewStorage returns a new instance of storage.Storage.
 func (c *Config) NewStorage() (storage.Storage, error) {
 	s, err := NewStorage(c)
@@ -31,3 +36,28 @@ func (c *Config) NewStorage() (storage.Storage, error) {
 func (c *Config) Storage() *Storage {
 	return c.s
 }
+
+// NewKeyedStorage returns an instance of storage.Storage for a given key.
+// It returns the same instance for the same key so that written data can be
+// read later. The keyed storage starts with empty data.
+func (c *Config) NewKeyedStorage(key string) (storage.Storage, error) {
+	if c.keyed == nil {
+		c.keyed = make(map[string]*Storage)
+	}
+	if s, ok := c.keyed[key]; ok {
+		return s, nil
+	}
+
+	s, err := NewStorage(&Config{WriteError: c.WriteError, ReadError: c.ReadError})
+	if err != nil {
+		return nil, err
+	}
+	c.keyed[key] = s
+	return s, nil
+}
+
+// KeyedStorage returns a reference to an instance of mock storage for a given
+// key for testing. It returns nil if not found.
+func (c *Config) KeyedStorage(key string) *Storage {
+	return c.keyed[key]
+}
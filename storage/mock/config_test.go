@@ -1,6 +1,9 @@
 package mock
 
-import "testing"
+import (
+	"context"
+	"testing"
+)
 
 func TestConfigNewStorage(t *testing.T) {
 	cases := []struct {
@@ -34,3 +37,33 @@ func TestConfigNewStorage(t *testing.T) {
 		})
 	}
 }
+
+func TestConfigNewKeyedStorage(t *testing.T) {
+	config := &Config{
+		Data: "foo",
+	}
+
+	s1, err := config.NewKeyedStorage("foo")
+	if err != nil {
+		t.Fatalf("unexpected err: %s", err)
+	}
+	if err := s1.Write(context.Background(), []byte("bar")); err != nil {
+		t.Fatalf("failed to write: %s", err)
+	}
+
+	s2, err := config.NewKeyedStorage("foo")
+	if err != nil {
+		t.Fatalf("unexpected err: %s", err)
+	}
+	got, err := s2.Read(context.Background())
+	if err != nil {
+		t.Fatalf("failed to read: %s", err)
+	}
+	if string(got) != "bar" {
+		t.Errorf("got: %s, want: bar", string(got))
+	}
+
+	if config.KeyedStorage("baz") != nil {
+		t.Errorf("expected nil for unknown key")
+	}
+}
@@ -3,6 +3,7 @@ package mock
 import (
 	"context"
 	"fmt"
+	"strconv"
 
 	"github.com/minamijoyo/tfmigrate/storage"
 )
@@ -14,10 +15,15 @@ type Storage struct {
 	config *Config
 	// data stores a serialized data for history.
 	data string
+	// version is incremented whenever data is written.
+	// Empty data means that the key does not exist.
+	version int
 }
 
 var _ storage.Storage = (*Storage)(nil)
 
+var _ storage.LockStorage = (*Storage)(nil)
+
 // NewStorage returns a new instance of Storage.
 func NewStorage(config *Config) (*Storage, error) {
 	s := &Storage{
@@ -38,6 +44,7 @@ func (s *Storage) Write(_ context.Context, b []byte) error {
 		return fmt.Errorf("failed to write mock storage: writeError = %t", s.config.WriteError)
 	}
 	s.data = string(b)
+	s.version++
 	return nil
 }
 
@@ -48,3 +55,36 @@ func (s *Storage) Read(_ context.Context) ([]byte, error) {
 	}
 	return []byte(s.data), nil
 }
+
+// ReadVersion reads data and its version from storage.
+func (s *Storage) ReadVersion(ctx context.Context) ([]byte, string, error) {
+	b, err := s.Read(ctx)
+	if err != nil || len(b) == 0 {
+		return b, "", err
+	}
+	return b, strconv.Itoa(s.version), nil
+}
+
+// Create writes data to storage only if no data exists.
+func (s *Storage) Create(ctx context.Context, b []byte) error {
+	if len(s.data) != 0 {
+		return storage.ErrPreconditionFailed
+	}
+	return s.Write(ctx, b)
+}
+
+// Delete deletes data from storage only if its version matches.
+func (s *Storage) Delete(_ context.Context, version string) error {
+	if s.config.WriteError {
+		return fmt.Errorf("failed to write mock storage: writeError = %t", s.config.WriteError)
+	}
+	if len(s.data) == 0 {
+		return nil
+	}
+	if version != strconv.Itoa(s.version) {
+		return storage.ErrPreconditionFailed
+	}
+	s.data = ""
+	s.version++
+	return nil
+}
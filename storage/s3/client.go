@@ -17,6 +17,8 @@ type Client interface {
 	PutObject(ctx context.Context, params *s3.PutObjectInput, optFns ...func(*s3.Options)) (*s3.PutObjectOutput, error)
 	// GetObject gets a file from S3.
 	GetObject(ctx context.Context, params *s3.GetObjectInput, optFns ...func(*s3.Options)) (*s3.GetObjectOutput, error)
+	// DeleteObject deletes a file from S3.
+	DeleteObject(ctx context.Context, params *s3.DeleteObjectInput, optFns ...func(*s3.Options)) (*s3.DeleteObjectOutput, error)
 }
 
 // client is a real implementation of the Client.
@@ -77,3 +79,8 @@ func (c *client) PutObject(ctx context.Context, params *s3.PutObjectInput, optFn
 func (c *client) GetObject(ctx context.Context, params *s3.GetObjectInput, optFns ...func(*s3.Options)) (*s3.GetObjectOutput, error) {
 	return c.s3Client.GetObject(ctx, params, optFns...)
 }
+
+// DeleteObject deletes a file from S3.
+func (c *client) DeleteObject(ctx context.Context, params *s3.DeleteObjectInput, optFns ...func(*s3.Options)) (*s3.DeleteObjectOutput, error) {
+	return c.s3Client.DeleteObject(ctx, params, optFns...)
+}
@@ -1,6 +1,10 @@
 package s3
 
-import "github.com/minamijoyo/tfmigrate/storage"
+import (
+	"path"
+
+	"github.com/minamijoyo/tfmigrate/storage"
+)
 
 // Config is a config for s3 storage.
 // This is expected to have almost the same options as Terraform s3 backend.
@@ -39,7 +43,18 @@ type Config struct {
 // Config implements a storage.Config.
 var _ storage.Config = (*Config)(nil)
 
+// Config implements a storage.KeyedConfig.
+var _ storage.KeyedConfig = (*Config)(nil)
+
 // NewStorage returns a new instance of storage.Storage.
 func (c *Config) NewStorage() (storage.Storage, error) {
 	return NewStorage(c, nil)
 }
+
+// NewKeyedStorage returns a new instance of storage.Storage for an object at a
+// given key. The key of the config is used as a prefix.
+func (c *Config) NewKeyedStorage(key string) (storage.Storage, error) {
+	keyed := *c
+	keyed.Key = path.Join(c.Key, key)
+	return NewStorage(&keyed, nil)
+}
@@ -43,3 +43,30 @@ func TestConfigNewStorage(t *testing.T) {
 		})
 	}
 }
+
+func TestConfigNewKeyedStorage(t *testing.T) {
+	config := &Config{
+		Bucket:                    "tfmigrate-test",
+		Key:                       "tfmigrate/backup",
+		Region:                    "ap-northeast-1",
+		Endpoint:                  "http://localstack:4566",
+		AccessKey:                 "dummy",
+		SecretKey:                 "dummy",
+		SkipCredentialsValidation: true,
+		SkipMetadataAPICheck:      true,
+		ForcePathStyle:            true,
+	}
+
+	got, err := config.NewKeyedStorage("foo/bar.tfstate")
+	if err != nil {
+		t.Fatalf("unexpected err: %s", err)
+	}
+
+	s := got.(*Storage)
+	if s.config.Key != "tfmigrate/backup/foo/bar.tfstate" {
+		t.Errorf("got: %s, want: tfmigrate/backup/foo/bar.tfstate", s.config.Key)
+	}
+	if config.Key != "tfmigrate/backup" {
+		t.Errorf("the original config must not be changed, got: %s", config.Key)
+	}
+}
@@ -8,6 +8,7 @@ import (
 	"github.com/aws/aws-sdk-go-v2/aws"
 	"github.com/aws/aws-sdk-go-v2/service/s3"
 	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"github.com/aws/smithy-go"
 	"github.com/minamijoyo/tfmigrate/storage"
 )
 
@@ -22,6 +23,8 @@ type Storage struct {
 
 var _ storage.Storage = (*Storage)(nil)
 
+var _ storage.LockStorage = (*Storage)(nil)
+
 // NewStorage returns a new instance of Storage.
 func NewStorage(config *Config, client Client) (*Storage, error) {
 	if client == nil {
@@ -42,6 +45,13 @@ func NewStorage(config *Config, client Client) (*Storage, error) {
 
 // Write writes migration history data to storage.
 func (s *Storage) Write(ctx context.Context, b []byte) error {
+	_, err := s.client.PutObject(ctx, s.putObjectInput(b))
+
+	return err
+}
+
+// putObjectInput returns an input of PutObject for given data.
+func (s *Storage) putObjectInput(b []byte) *s3.PutObjectInput {
 	input := &s3.PutObjectInput{
 		Bucket: aws.String(s.config.Bucket),
 		Key:    aws.String(s.config.Key),
@@ -51,16 +61,20 @@ func (s *Storage) Write(ctx context.Context, b []byte) error {
 		input.SSEKMSKeyId = &s.config.KmsKeyID
 		input.ServerSideEncryption = types.ServerSideEncryptionAwsKms
 	}
-
-	_, err := s.client.PutObject(ctx, input)
-
-	return err
+	return input
 }
 
 // Read reads migration history data from storage.
 // If the key does not exist, it is assumed to be uninitialized and returns
 // an empty array instead of an error.
 func (s *Storage) Read(ctx context.Context) ([]byte, error) {
+	b, _, err := s.ReadVersion(ctx)
+	return b, err
+}
+
+// ReadVersion reads data and its ETag from storage.
+// If the key does not exist, it returns an empty array and an empty version.
+func (s *Storage) ReadVersion(ctx context.Context) ([]byte, string, error) {
 	input := &s3.GetObjectInput{
 		Bucket: aws.String(s.config.Bucket),
 		Key:    aws.String(s.config.Key),
@@ -71,10 +85,10 @@ func (s *Storage) Read(ctx context.Context) ([]byte, error) {
 		var nsk *types.NoSuchKey
 		if errors.As(err, &nsk) {
 			// If the key does not exist
-			return []byte{}, nil
+			return []byte{}, "", nil
 		}
 		// unexpected error
-		return nil, err
+		return nil, "", err
 	}
 
 	defer output.Body.Close()
@@ -82,8 +96,59 @@ func (s *Storage) Read(ctx context.Context) ([]byte, error) {
 	buf := bytes.NewBuffer(nil)
 	_, err = buf.ReadFrom(output.Body)
 	if err != nil {
-		return nil, err
+		return nil, "", err
+	}
+
+	return buf.Bytes(), aws.ToString(output.ETag), nil
+}
+
+// Create writes data to storage only if the key does not exist.
+// It requires conditional writes of S3 with the If-None-Match header.
+func (s *Storage) Create(ctx context.Context, b []byte) error {
+	input := s.putObjectInput(b)
+	input.IfNoneMatch = aws.String("*")
+
+	_, err := s.client.PutObject(ctx, input)
+	if isPreconditionFailed(err) {
+		return storage.ErrPreconditionFailed
+	}
+	return err
+}
+
+// Delete deletes the object only if its ETag matches a given version.
+// It requires conditional deletes of S3 with the If-Match header.
+func (s *Storage) Delete(ctx context.Context, version string) error {
+	input := &s3.DeleteObjectInput{
+		Bucket:  aws.String(s.config.Bucket),
+		Key:     aws.String(s.config.Key),
+		IfMatch: aws.String(version),
 	}
 
-	return buf.Bytes(), nil
+	_, err := s.client.DeleteObject(ctx, input)
+	var nsk *types.NoSuchKey
+	switch {
+	case errors.As(err, &nsk), errorCode(err) == "NotFound":
+		// If the key does not exist
+		return nil
+	case isPreconditionFailed(err):
+		return storage.ErrPreconditionFailed
+	}
+	return err
+}
+
+// isPreconditionFailed returns true if a given error means that a condition
+// of a request doesn't match, or a concurrent conditional request conflicts.
+func isPreconditionFailed(err error) bool {
+	code := errorCode(err)
+	return code == "PreconditionFailed" || code == "ConditionalRequestConflict"
+}
+
+// errorCode returns an error code of a given API error.
+// It returns an empty string if the error is not an API error.
+func errorCode(err error) string {
+	var apiErr smithy.APIError
+	if errors.As(err, &apiErr) {
+		return apiErr.ErrorCode()
+	}
+	return ""
 }
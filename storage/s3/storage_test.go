@@ -2,6 +2,7 @@ package s3
 
 import (
 	"context"
+	"errors"
 	"io"
 	"strings"
 	"testing"
@@ -9,17 +10,25 @@ import (
 	"github.com/aws/aws-sdk-go-v2/aws"
 	"github.com/aws/aws-sdk-go-v2/service/s3"
 	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"github.com/aws/smithy-go"
+	"github.com/minamijoyo/tfmigrate/storage"
 )
 
 // mockClient is a mock implementation for testing.
 type mockClient struct {
-	putOutput *s3.PutObjectOutput
-	getOutput *s3.GetObjectOutput
-	err       error
+	putOutput    *s3.PutObjectOutput
+	getOutput    *s3.GetObjectOutput
+	deleteOutput *s3.DeleteObjectOutput
+	err          error
+
+	// putInput and deleteInput record the last inputs for test assertion.
+	putInput    *s3.PutObjectInput
+	deleteInput *s3.DeleteObjectInput
 }
 
 // PutObjectWithContext returns a mocked response.
-func (c *mockClient) PutObject(_ context.Context, _ *s3.PutObjectInput, _ ...func(*s3.Options)) (*s3.PutObjectOutput, error) {
+func (c *mockClient) PutObject(_ context.Context, params *s3.PutObjectInput, _ ...func(*s3.Options)) (*s3.PutObjectOutput, error) {
+	c.putInput = params
 	return c.putOutput, c.err
 }
 
@@ -28,6 +37,12 @@ func (c *mockClient) GetObject(_ context.Context, _ *s3.GetObjectInput, _ ...fun
 	return c.getOutput, c.err
 }
 
+// DeleteObject returns a mocked response.
+func (c *mockClient) DeleteObject(_ context.Context, params *s3.DeleteObjectInput, _ ...func(*s3.Options)) (*s3.DeleteObjectOutput, error) {
+	c.deleteInput = params
+	return c.deleteOutput, c.err
+}
+
 func TestStorageWrite(t *testing.T) {
 	cases := []struct {
 		desc     string
@@ -154,3 +169,109 @@ func TestStorageRead(t *testing.T) {
 		})
 	}
 }
+
+func TestStorageCreate(t *testing.T) {
+	cases := []struct {
+		desc    string
+		client  *mockClient
+		wantErr error
+		ok      bool
+	}{
+		{
+			desc:    "simple",
+			client:  &mockClient{putOutput: &s3.PutObjectOutput{}},
+			wantErr: nil,
+			ok:      true,
+		},
+		{
+			desc:    "already exists",
+			client:  &mockClient{err: &smithy.GenericAPIError{Code: "PreconditionFailed"}},
+			wantErr: storage.ErrPreconditionFailed,
+			ok:      false,
+		},
+		{
+			desc:    "conflict",
+			client:  &mockClient{err: &smithy.GenericAPIError{Code: "ConditionalRequestConflict"}},
+			wantErr: storage.ErrPreconditionFailed,
+			ok:      false,
+		},
+		{
+			desc:    "bucket does not exist",
+			client:  &mockClient{err: &types.NoSuchBucket{Message: aws.String("The specified bucket does not exist.")}},
+			wantErr: nil,
+			ok:      false,
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.desc, func(t *testing.T) {
+			s, err := NewStorage(&Config{Bucket: "tfmigrate-test", Key: "tfmigrate/lock"}, tc.client)
+			if err != nil {
+				t.Fatalf("failed to NewStorage: %s", err)
+			}
+			err = s.Create(context.Background(), []byte("foo"))
+			if tc.ok && err != nil {
+				t.Fatalf("unexpected err: %s", err)
+			}
+			if !tc.ok && err == nil {
+				t.Fatal("expected to return an error, but no error")
+			}
+			if tc.wantErr != nil && !errors.Is(err, tc.wantErr) {
+				t.Errorf("got err: %s, want: %s", err, tc.wantErr)
+			}
+			if got := aws.ToString(tc.client.putInput.IfNoneMatch); got != "*" {
+				t.Errorf("got If-None-Match: %q, want: %q", got, "*")
+			}
+		})
+	}
+}
+
+func TestStorageDelete(t *testing.T) {
+	cases := []struct {
+		desc    string
+		client  *mockClient
+		wantErr error
+		ok      bool
+	}{
+		{
+			desc:    "simple",
+			client:  &mockClient{deleteOutput: &s3.DeleteObjectOutput{}},
+			wantErr: nil,
+			ok:      true,
+		},
+		{
+			desc:    "key does not exist",
+			client:  &mockClient{err: &smithy.GenericAPIError{Code: "NotFound"}},
+			wantErr: nil,
+			ok:      true,
+		},
+		{
+			desc:    "changed",
+			client:  &mockClient{err: &smithy.GenericAPIError{Code: "PreconditionFailed"}},
+			wantErr: storage.ErrPreconditionFailed,
+			ok:      false,
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.desc, func(t *testing.T) {
+			s, err := NewStorage(&Config{Bucket: "tfmigrate-test", Key: "tfmigrate/lock"}, tc.client)
+			if err != nil {
+				t.Fatalf("failed to NewStorage: %s", err)
+			}
+			err = s.Delete(context.Background(), `"etag"`)
+			if tc.ok && err != nil {
+				t.Fatalf("unexpected err: %s", err)
+			}
+			if !tc.ok && err == nil {
+				t.Fatal("expected to return an error, but no error")
+			}
+			if tc.wantErr != nil && !errors.Is(err, tc.wantErr) {
+				t.Errorf("got err: %s, want: %s", err, tc.wantErr)
+			}
+			if got := aws.ToString(tc.client.deleteInput.IfMatch); got != `"etag"` {
+				t.Errorf("got If-Match: %q, want: %q", got, `"etag"`)
+			}
+		})
+	}
+}
@@ -1,6 +1,13 @@
 package storage
 
-import "context"
+import (
+	"context"
+	"errors"
+)
+
+// ErrPreconditionFailed is returned by a conditional operation of LockStorage
+// when the object has been created, changed or deleted by someone else.
+var ErrPreconditionFailed = errors.New("precondition failed")
 
 // Storage is an abstraction layer for migration history data store.
 // As you know, this is the equivalent of Terraform's backend, but we have
@@ -15,3 +22,21 @@ type Storage interface {
 	// an empty array instead of an error.
 	Read(ctx context.Context) ([]byte, error)
 }
+
+// LockStorage is an optional interface of Storage which supports conditional
+// operations. Since Write is last-writer-wins, locks require them to be
+// mutually exclusive.
+type LockStorage interface {
+	Storage
+	// ReadVersion reads data and an opaque version of the object, which is
+	// changed whenever the object is written. If the key does not exist, it
+	// returns an empty array and an empty version.
+	ReadVersion(ctx context.Context) ([]byte, string, error)
+	// Create writes data only if the key does not exist.
+	// Otherwise, it returns ErrPreconditionFailed.
+	Create(ctx context.Context, b []byte) error
+	// Delete deletes the object only if its version matches a given one.
+	// Otherwise, it returns ErrPreconditionFailed. If the key does not exist,
+	// it does nothing.
+	Delete(ctx context.Context, version string) error
+}
@@ -2,6 +2,7 @@ package tfexec
 
 import (
 	"bytes"
+	"context"
 	"os/exec"
 )
 
@@ -28,13 +29,28 @@ type command struct {
 	stdout *bytes.Buffer
 	// stderr is a buffer for stderr.
 	stderr *bytes.Buffer
+	// streams is a list of writers to stream output, which are flushed after
+	// the command exits.
+	streams []*prefixWriter
+	// logCtx is a context which the command was built with. It's used only to
+	// add fields of the caller such as a migration to log records.
+	logCtx context.Context
 }
 
 var _ Command = (*command)(nil)
 
 // Run executes an arbitrary command.
 func (c *command) Run() error {
-	return c.osExecCmd.Run()
+	err := c.osExecCmd.Start()
+	if err == nil {
+		untrack := trackProcess(c.osExecCmd.Process)
+		err = c.osExecCmd.Wait()
+		untrack()
+	}
+	for _, w := range c.streams {
+		w.Flush()
+	}
+	return err
 }
 
 // Stdout returns outputs of stdout.
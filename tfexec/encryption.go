@@ -0,0 +1,270 @@
+package tfexec
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/hashicorp/hcl/v2"
+	"github.com/hashicorp/hcl/v2/hclsyntax"
+	"github.com/hashicorp/hcl/v2/hclwrite"
+	hcljson "github.com/hashicorp/hcl/v2/json"
+	"github.com/zclconf/go-cty/cty"
+)
+
+const (
+	// encryptionEnv is an environment variable to configure OpenTofu state
+	// encryption, which is merged into the encryption block in .tf files.
+	encryptionEnv = "TF_ENCRYPTION"
+
+	// overrideEncryptionMethod is a name of the unencrypted method added to the
+	// override file for the local backend.
+	overrideEncryptionMethod = "tfmigrate"
+)
+
+// stateEncryption is the state target of OpenTofu state encryption config.
+// We don't parse key providers and methods, because they are never changed
+// by tfmigrate and OpenTofu merges them with the override file.
+type stateEncryption struct {
+	// method is a reference to the primary method of the state target, such as
+	// method.aes_gcm.default.
+	method string
+	// enforced is true if writing an unencrypted state is forbidden.
+	enforced bool
+}
+
+// encryptionSchema is a schema of the encryption config to read the state target.
+var encryptionSchema = &hcl.BodySchema{
+	Blocks: []hcl.BlockHeaderSchema{{Type: "state"}},
+}
+
+// stateEncryptionSchema is a schema of the state target.
+var stateEncryptionSchema = &hcl.BodySchema{
+	Attributes: []hcl.AttributeSchema{{Name: "method"}, {Name: "enforced"}},
+}
+
+// loadStateEncryption reads the state target of OpenTofu state encryption
+// from encryption blocks in .tf files in a given dir and a given value of the
+// TF_ENCRYPTION environment variable, and merges them in the same order as
+// OpenTofu: primary files, override files and then the environment variable.
+// A file with a given name to ignore is skipped, which is the override file
+// of tfmigrate possibly left in the dir. It returns nil if state encryption
+// is not configured, which is always true for Terraform.
+func loadStateEncryption(dir string, ignore string, env string) (*stateEncryption, error) {
+	filenames, err := filepath.Glob(filepath.Join(dir, "*.tf"))
+	if err != nil {
+		return nil, err
+	}
+	// Override files are merged after primary files.
+	sort.SliceStable(filenames, func(i, j int) bool {
+		return !isOverrideFile(filenames[i]) && isOverrideFile(filenames[j])
+	})
+
+	var enc *stateEncryption
+	for _, filename := range filenames {
+		if filepath.Base(filename) == ignore {
+			continue
+		}
+
+		source, err := os.ReadFile(filename)
+		if err != nil {
+			return nil, err
+		}
+
+		file, diags := hclsyntax.ParseConfig(source, filename, hcl.Pos{Line: 1, Column: 1})
+		if diags.HasErrors() {
+			return nil, diags
+		}
+
+		content, _, diags := file.Body.PartialContent(&hcl.BodySchema{
+			Blocks: []hcl.BlockHeaderSchema{{Type: "terraform"}},
+		})
+		if diags.HasErrors() {
+			return nil, diags
+		}
+		for _, tb := range content.Blocks {
+			inner, _, diags := tb.Body.PartialContent(&hcl.BodySchema{
+				Blocks: []hcl.BlockHeaderSchema{{Type: "encryption"}},
+			})
+			if diags.HasErrors() {
+				return nil, diags
+			}
+			for _, eb := range inner.Blocks {
+				enc, err = mergeStateEncryption(enc, eb.Body)
+				if err != nil {
+					return nil, err
+				}
+			}
+		}
+	}
+
+	if len(strings.TrimSpace(env)) > 0 {
+		body, err := parseEncryptionEnv(env)
+		if err != nil {
+			return nil, err
+		}
+		enc, err = mergeStateEncryption(enc, body)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return enc, nil
+}
+
+// isOverrideFile returns true if a given filename is an override file.
+func isOverrideFile(filename string) bool {
+	base := strings.TrimSuffix(filepath.Base(filename), ".tf")
+	return base == "override" || strings.HasSuffix(base, "_override")
+}
+
+// parseEncryptionEnv parses a value of TF_ENCRYPTION, which is the contents of
+// an encryption block in HCL or JSON.
+func parseEncryptionEnv(env string) (hcl.Body, error) {
+	var file *hcl.File
+	var diags hcl.Diagnostics
+	if strings.HasPrefix(strings.TrimSpace(env), "{") {
+		file, diags = hcljson.Parse([]byte(env), encryptionEnv)
+	} else {
+		file, diags = hclsyntax.ParseConfig([]byte(env), encryptionEnv, hcl.Pos{Line: 1, Column: 1})
+	}
+	if diags.HasErrors() {
+		return nil, diags
+	}
+	return file.Body, nil
+}
+
+// mergeStateEncryption merges the state target in a given body of an
+// encryption config into a given one. The method is overridden and enforced
+// is true if either is true, which is the same as OpenTofu.
+func mergeStateEncryption(enc *stateEncryption, body hcl.Body) (*stateEncryption, error) {
+	content, _, diags := body.PartialContent(encryptionSchema)
+	if diags.HasErrors() {
+		return nil, diags
+	}
+
+	for _, b := range content.Blocks {
+		attrs, _, diags := b.Body.PartialContent(stateEncryptionSchema)
+		if diags.HasErrors() {
+			return nil, diags
+		}
+
+		merged := stateEncryption{}
+		if enc != nil {
+			merged = *enc
+		}
+
+		if attr, ok := attrs.Attributes["method"]; ok {
+			traversal, diags := hcl.AbsTraversalForExpr(attr.Expr)
+			if diags.HasErrors() {
+				return nil, fmt.Errorf("%s: the method attribute of the state encryption must be a reference to a method", attr.Expr.Range().String())
+			}
+			merged.method = traversalString(traversal)
+		}
+
+		if attr, ok := attrs.Attributes["enforced"]; ok {
+			v, diags := attr.Expr.Value(nil)
+			if diags.HasErrors() || !v.Type().Equals(cty.Bool) || v.IsNull() {
+				return nil, fmt.Errorf("%s: the enforced attribute of the state encryption must be a bool", attr.Expr.Range().String())
+			}
+			merged.enforced = merged.enforced || v.True()
+		}
+
+		enc = &merged
+	}
+
+	return enc, nil
+}
+
+// traversalString returns a string representation of a given traversal such
+// as method.aes_gcm.default.
+func traversalString(traversal hcl.Traversal) string {
+	names := []string{}
+	for _, t := range traversal {
+		switch t := t.(type) {
+		case hcl.TraverseRoot:
+			names = append(names, t.Name)
+		case hcl.TraverseAttr:
+			names = append(names, t.Name)
+		}
+	}
+	return strings.Join(names, ".")
+}
+
+// overrideFileContents returns contents of the override file to switch the
+// backend to local with a given state encryption config.
+//
+// The state encryption is configured to write plaintext states and read both
+// plaintext and encrypted states, because states are passed between terraform
+// commands through temporary files as plaintext, which is the same format as
+// state pull and state push. OpenTofu merges the encryption block in the
+// override file with the original one, so key providers and methods are
+// carried over as they are.
+func overrideFileContents(enc *stateEncryption) (string, error) {
+	if enc == nil {
+		return `
+terraform {
+  backend "local" {
+  }
+}
+`, nil
+	}
+	if enc.enforced {
+		return "", fmt.Errorf("OpenTofu state encryption with enforced = true is not supported, because tfmigrate needs to pass plaintext states between commands. Please set enforced = false during migrations")
+	}
+
+	f := hclwrite.NewEmptyFile()
+	tf := f.Body().AppendNewBlock("terraform", nil).Body()
+	tf.AppendNewBlock("backend", []string{"local"})
+
+	tf.AppendNewline()
+	encryption := tf.AppendNewBlock("encryption", nil).Body()
+	encryption.AppendNewBlock("method", []string{"unencrypted", overrideEncryptionMethod})
+	state := encryption.AppendNewBlock("state", nil).Body()
+	state.SetAttributeTraversal("method", hcl.Traversal{
+		hcl.TraverseRoot{Name: "method"},
+		hcl.TraverseAttr{Name: "unencrypted"},
+		hcl.TraverseAttr{Name: overrideEncryptionMethod},
+	})
+	if len(enc.method) > 0 {
+		traversal, diags := hclsyntax.ParseTraversalAbs([]byte(enc.method), "", hcl.Pos{Line: 1, Column: 1})
+		if diags.HasErrors() {
+			return "", diags
+		}
+		state.AppendNewBlock("fallback", nil).Body().SetAttributeTraversal("method", traversal)
+	}
+
+	return "\n" + string(hclwrite.Format(f.Bytes())), nil
+}
+
+// withoutStateEncryption returns a given value of TF_ENCRYPTION without the
+// state target. The environment variable is merged after the override file,
+// so the state target in it must be removed while the backend is local.
+func withoutStateEncryption(env string) (string, error) {
+	if strings.HasPrefix(strings.TrimSpace(env), "{") {
+		var config map[string]json.RawMessage
+		if err := json.Unmarshal([]byte(env), &config); err != nil {
+			return "", fmt.Errorf("failed to parse %s: %s", encryptionEnv, err)
+		}
+		delete(config, "state")
+		b, err := json.Marshal(config)
+		if err != nil {
+			return "", err
+		}
+		return string(b), nil
+	}
+
+	f, diags := hclwrite.ParseConfig([]byte(env), encryptionEnv, hcl.Pos{Line: 1, Column: 1})
+	if diags.HasErrors() {
+		return "", diags
+	}
+	for _, b := range f.Body().Blocks() {
+		if b.Type() == "state" {
+			f.Body().RemoveBlock(b)
+		}
+	}
+	return string(f.Bytes()), nil
+}
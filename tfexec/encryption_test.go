@@ -0,0 +1,279 @@
+package tfexec
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestLoadStateEncryption(t *testing.T) {
+	encryption := `
+terraform {
+  encryption {
+    key_provider "pbkdf2" "default" {
+      passphrase = "correct-horse-battery-staple"
+    }
+    method "aes_gcm" "default" {
+      keys = key_provider.pbkdf2.default
+    }
+    state {
+      method = method.aes_gcm.default
+    }
+  }
+}
+`
+	cases := []struct {
+		desc  string
+		files map[string]string
+		env   string
+		want  *stateEncryption
+		ok    bool
+	}{
+		{
+			desc:  "not configured",
+			files: map[string]string{"main.tf": `resource "terraform_data" "foo" {}`},
+			env:   "",
+			want:  nil,
+			ok:    true,
+		},
+		{
+			desc:  "file",
+			files: map[string]string{"main.tf": encryption},
+			env:   "",
+			want:  &stateEncryption{method: "method.aes_gcm.default"},
+			ok:    true,
+		},
+		{
+			desc: "override file",
+			files: map[string]string{
+				"a_override.tf": `
+terraform {
+  encryption {
+    state {
+      method   = method.aes_gcm.new
+      enforced = true
+    }
+  }
+}
+`,
+				"main.tf": encryption,
+			},
+			env:  "",
+			want: &stateEncryption{method: "method.aes_gcm.new", enforced: true},
+			ok:   true,
+		},
+		{
+			desc: "ignore the override file of tfmigrate",
+			files: map[string]string{
+				"_tfmigrate_override.tf": `
+terraform {
+  encryption {
+    state {
+      method = method.unencrypted.tfmigrate
+    }
+  }
+}
+`,
+				"main.tf": encryption,
+			},
+			env:  "",
+			want: &stateEncryption{method: "method.aes_gcm.default"},
+			ok:   true,
+		},
+		{
+			desc:  "env in HCL",
+			files: map[string]string{"main.tf": encryption},
+			env: `
+method "aes_gcm" "env" {
+  keys = key_provider.pbkdf2.default
+}
+state {
+  method = method.aes_gcm.env
+}
+`,
+			want: &stateEncryption{method: "method.aes_gcm.env"},
+			ok:   true,
+		},
+		{
+			desc:  "env in JSON",
+			files: map[string]string{},
+			env:   `{"state": {"method": "method.aes_gcm.env", "enforced": true}}`,
+			want:  &stateEncryption{method: "method.aes_gcm.env", enforced: true},
+			ok:    true,
+		},
+		{
+			desc: "env without state",
+			files: map[string]string{
+				"main.tf": encryption,
+			},
+			env:  `key_provider "pbkdf2" "default" { passphrase = "correct-horse-battery-staple" }`,
+			want: &stateEncryption{method: "method.aes_gcm.default"},
+			ok:   true,
+		},
+		{
+			desc: "invalid method",
+			files: map[string]string{
+				"main.tf": `
+terraform {
+  encryption {
+    state {
+      method = "foo"
+    }
+  }
+}
+`,
+			},
+			env:  "",
+			want: nil,
+			ok:   false,
+		},
+		{
+			desc:  "invalid env",
+			files: map[string]string{},
+			env:   `state {`,
+			want:  nil,
+			ok:    false,
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.desc, func(t *testing.T) {
+			dir := t.TempDir()
+			for name, contents := range tc.files {
+				if err := os.WriteFile(filepath.Join(dir, name), []byte(contents), 0600); err != nil {
+					t.Fatalf("failed to write file: %s", err)
+				}
+			}
+
+			got, err := loadStateEncryption(dir, "_tfmigrate_override.tf", tc.env)
+			if tc.ok && err != nil {
+				t.Fatalf("unexpected err: %s", err)
+			}
+			if !tc.ok && err == nil {
+				t.Fatalf("expected to return an error, but no error, got: %#v", got)
+			}
+			if !tc.ok {
+				return
+			}
+			if (got == nil) != (tc.want == nil) || (got != nil && *got != *tc.want) {
+				t.Errorf("got: %#v, want: %#v", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestOverrideFileContents(t *testing.T) {
+	cases := []struct {
+		desc string
+		enc  *stateEncryption
+		want string
+		ok   bool
+	}{
+		{
+			desc: "not encrypted",
+			enc:  nil,
+			want: `
+terraform {
+  backend "local" {
+  }
+}
+`,
+			ok: true,
+		},
+		{
+			desc: "encrypted",
+			enc:  &stateEncryption{method: "method.aes_gcm.default"},
+			want: `
+terraform {
+  backend "local" {
+  }
+
+  encryption {
+    method "unencrypted" "tfmigrate" {
+    }
+    state {
+      method = method.unencrypted.tfmigrate
+      fallback {
+        method = method.aes_gcm.default
+      }
+    }
+  }
+}
+`,
+			ok: true,
+		},
+		{
+			desc: "enforced",
+			enc:  &stateEncryption{method: "method.aes_gcm.default", enforced: true},
+			want: "",
+			ok:   false,
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.desc, func(t *testing.T) {
+			got, err := overrideFileContents(tc.enc)
+			if tc.ok && err != nil {
+				t.Fatalf("unexpected err: %s", err)
+			}
+			if !tc.ok && err == nil {
+				t.Fatalf("expected to return an error, but no error, got: %s", got)
+			}
+			if got != tc.want {
+				t.Errorf("got:\n%s\nwant:\n%s", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestWithoutStateEncryption(t *testing.T) {
+	cases := []struct {
+		desc string
+		env  string
+		want string
+		ok   bool
+	}{
+		{
+			desc: "HCL",
+			env: `key_provider "pbkdf2" "default" {
+  passphrase = "correct-horse-battery-staple"
+}
+state {
+  method = method.aes_gcm.default
+}
+`,
+			want: `key_provider "pbkdf2" "default" {
+  passphrase = "correct-horse-battery-staple"
+}
+`,
+			ok: true,
+		},
+		{
+			desc: "JSON",
+			env:  `{"key_provider": {"pbkdf2": {"default": {"passphrase": "correct-horse-battery-staple"}}}, "state": {"method": "method.aes_gcm.default"}}`,
+			want: `{"key_provider":{"pbkdf2":{"default":{"passphrase":"correct-horse-battery-staple"}}}}`,
+			ok:   true,
+		},
+		{
+			desc: "invalid JSON",
+			env:  `{"state": `,
+			want: "",
+			ok:   false,
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.desc, func(t *testing.T) {
+			got, err := withoutStateEncryption(tc.env)
+			if tc.ok && err != nil {
+				t.Fatalf("unexpected err: %s", err)
+			}
+			if !tc.ok && err == nil {
+				t.Fatalf("expected to return an error, but no error, got: %s", got)
+			}
+			if got != tc.want {
+				t.Errorf("got: %q, want: %q", got, tc.want)
+			}
+		})
+	}
+}
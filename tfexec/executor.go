@@ -4,12 +4,13 @@ import (
 	"bytes"
 	"context"
 	"io"
-	"log"
+	"log/slog"
 	"os"
 	"os/exec"
 	"strings"
 
 	"github.com/davecgh/go-spew/spew"
+	"github.com/minamijoyo/tfmigrate/logging"
 )
 
 // Executor abstracts the os command execution layer.
@@ -58,27 +59,65 @@ func (e *executor) NewCommandContext(ctx context.Context, name string, args ...s
 	stderr := &bytes.Buffer{}
 	osExecCmd.Stdout = stdout
 	osExecCmd.Stderr = stderr
+	// Tee output to the console in real time if requested. The buffers are
+	// still used for parsing and error messages.
+	var writers []*prefixWriter
+	if o, ok := streamFromContext(ctx); ok {
+		prefix := "[" + o.label + "] "
+		// Output is buffered if requested by the context, so that output of
+		// concurrent migrations is not interleaved.
+		if o.stdout {
+			w := newPrefixWriter(logging.Writer(ctx, e.outStream), prefix)
+			osExecCmd.Stdout = io.MultiWriter(stdout, w)
+			writers = append(writers, w)
+		}
+		w := newPrefixWriter(logging.Writer(ctx, e.errStream), prefix)
+		osExecCmd.Stderr = io.MultiWriter(stderr, w)
+		writers = append(writers, w)
+	}
 	osExecCmd.Dir = e.dir
 	osExecCmd.Env = e.env
+	// Forward a signal to the command on cancellation instead of killing it,
+	// so that terraform can exit gracefully and release the state lock.
+	// Sending a signal is not supported on Windows, so kill it instead of
+	// waiting for cancelWaitDelay.
+	osExecCmd.Cancel = func() error {
+		if err := osExecCmd.Process.Signal(cancelSignal(ctx)); err != nil {
+			return osExecCmd.Process.Kill()
+		}
+		return nil
+	}
+	osExecCmd.WaitDelay = cancelWaitDelay
+	setProcessGroup(osExecCmd)
 
 	return &command{
 		osExecCmd: osExecCmd,
 		stdout:    stdout,
 		stderr:    stderr,
+		streams:   writers,
+		logCtx:    ctx,
 	}, nil
 }
 
 // Run executes a command.
 func (e *executor) Run(cmd Command) error {
+	ctx := context.Background()
+	if c, ok := cmd.(*command); ok && c.logCtx != nil {
+		ctx = c.logCtx
+	}
+	// The dir in the context is the original one, which may differ from the
+	// work dir in isolated mode.
+	ctx = logging.With(ctx, "component", "executor", "work_dir", e.dir)
+
 	// #nosec G706: Log injection via taint analysis
 	// Including user input in the debug log is acceptable.
-	log.Printf("[DEBUG] [executor@%s]$ %s", e.dir, strings.Join(cmd.Args(), " "))
+	slog.DebugContext(ctx, "run command", "command", strings.Join(cmd.Args(), " "))
 	err := cmd.Run()
 	// #nosec G706: Log injection via taint analysis
-	log.Printf("[TRACE] [executor@%s] cmd=%s ", e.dir, spew.Sdump(cmd))
+	slog.Log(ctx, logging.LevelTrace, "command details", "cmd", spew.Sdump(cmd))
 	if err != nil {
 		// #nosec G706: Log injection via taint analysis
-		log.Printf("[DEBUG] [executor@%s] failed to run command: %s", e.dir, spew.Sdump(err))
+		slog.DebugContext(ctx, "failed to run command", "error", spew.Sdump(err))
 		if osExecErr, ok := err.(*exec.ExitError); ok {
 			return &exitError{
 				osExecErr: osExecErr,
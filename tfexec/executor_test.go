@@ -5,7 +5,9 @@ import (
 	"fmt"
 	"os"
 	"strings"
+	"syscall"
 	"testing"
+	"time"
 )
 
 // mock functions
@@ -199,3 +201,77 @@ func TestExecutorDir(t *testing.T) {
 		})
 	}
 }
+
+func TestExecutorCancel(t *testing.T) {
+	cases := []struct {
+		desc  string
+		cause error
+		want  string
+	}{
+		{
+			desc:  "forward a received signal",
+			cause: &SignalError{Signal: syscall.SIGTERM},
+			want:  "TERM\n",
+		},
+		{
+			desc:  "interrupt by default",
+			cause: context.Canceled,
+			want:  "INT\n",
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.desc, func(t *testing.T) {
+			ctx, cancel := context.WithCancelCause(context.Background())
+			defer cancel(nil)
+
+			// The trap prints a received signal and exits.
+			script := "trap 'echo INT; exit 3' INT; trap 'echo TERM; exit 3' TERM; echo ready; while true; do sleep 0.1; done"
+			e := NewExecutor(".", nil)
+			cmd, err := e.NewCommandContext(ctx, "/bin/sh", "-c", script)
+			if err != nil {
+				t.Fatalf("failed to NewCommandContext: %s", err)
+			}
+
+			time.AfterFunc(500*time.Millisecond, func() { cancel(tc.cause) })
+			err = e.Run(cmd)
+			if err == nil {
+				t.Fatalf("expected to return an error, but no error")
+			}
+			exitErr, ok := err.(ExitError)
+			if !ok || exitErr.ExitCode() != 3 {
+				t.Fatalf("expected to exit gracefully, got: %s", err)
+			}
+			if got := cmd.Stdout(); got != "ready\n"+tc.want {
+				t.Errorf("unexpected stdout. got: %s, want: %s", got, "ready\n"+tc.want)
+			}
+		})
+	}
+}
+
+func TestSignalRunningCommands(t *testing.T) {
+	// The background sleep is in the same process group as the shell and
+	// keeps stdout open, so Run doesn't return until both are terminated.
+	script := "echo ready; sleep 30 & wait"
+	e := NewExecutor(".", nil)
+	cmd, err := e.NewCommandContext(context.Background(), "/bin/sh", "-c", script)
+	if err != nil {
+		t.Fatalf("failed to NewCommandContext: %s", err)
+	}
+
+	time.AfterFunc(500*time.Millisecond, func() { SignalRunningCommands(syscall.SIGTERM) })
+	start := time.Now()
+	err = e.Run(cmd)
+	if err == nil {
+		t.Fatalf("expected to return an error, but no error")
+	}
+	if elapsed := time.Since(start); elapsed > 10*time.Second {
+		t.Errorf("expected to terminate the process group, but took %s", elapsed)
+	}
+
+	runningProcesses.mu.Lock()
+	defer runningProcesses.mu.Unlock()
+	if len(runningProcesses.m) != 0 {
+		t.Errorf("expected no running processes, got %d", len(runningProcesses.m))
+	}
+}
@@ -0,0 +1,214 @@
+package tfexec
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/minamijoyo/tfmigrate/logging"
+)
+
+// isolatedExcludes is a list of files and directories in a root module which
+// are never shared with an isolated work dir. They are written by terraform
+// init or tfmigrate, so sharing them would touch the user's checkout.
+var isolatedExcludes = map[string]bool{
+	".terraform":             true,
+	".terraform.lock.hcl":    true,
+	"terraform.tfstate.d":    true,
+	"_tfmigrate_override.tf": true,
+}
+
+// NewIsolatedWorkDir creates a temporary work dir which overlays a given root
+// module directory and returns a path of the root module in it and a function
+// to remove it. Files in the root module are symlinked except for the ones
+// written by terraform, and the .terraform.lock.hcl is copied so that
+// terraform init can update it without touching the original one. Running
+// terraform in the isolated work dir never changes the original directory.
+//
+// Local module sources such as "../modules/foo" are resolved relative to the
+// root module, so siblings of ancestor directories referenced by them are
+// also symlinked in the same layout.
+//
+// The excludes is a list of additional names of entries in the root module
+// which are not shared, such as the Terragrunt cache dir.
+func NewIsolatedWorkDir(ctx context.Context, dir string, excludes []string) (string, func() error, error) {
+	ctx = logging.With(ctx, "component", "executor")
+
+	src, err := filepath.Abs(dir)
+	if err != nil {
+		return "", nil, err
+	}
+
+	depth, err := parentModuleDepth(src)
+	if err != nil {
+		return "", nil, err
+	}
+
+	tmpDir, err := os.MkdirTemp("", "tfmigrate-")
+	if err != nil {
+		return "", nil, fmt.Errorf("failed to create an isolated work dir: %s", err)
+	}
+	cleanup := func() error {
+		slog.InfoContext(ctx, "remove the isolated work dir", "work_dir", tmpDir)
+		return os.RemoveAll(tmpDir)
+	}
+
+	workDir, err := overlayAncestors(tmpDir, src, depth)
+	if err == nil {
+		err = overlayRootModule(workDir, src, excludes)
+	}
+	if err != nil {
+		// remove the temporary dir before return an error.
+		cleanup()
+		return "", nil, fmt.Errorf("failed to create an isolated work dir for %s: %s", dir, err)
+	}
+
+	slog.InfoContext(ctx, "create an isolated work dir", "work_dir", workDir)
+	return workDir, cleanup, nil
+}
+
+// localModuleSourceRe matches a local module source which refers to parent
+// directories and captures the leading "../" segments.
+var localModuleSourceRe = regexp.MustCompile(`source\s*=\s*"((?:\.\./)+)`)
+
+// parentModuleDepth returns the maximum number of parent directories referred
+// by local module sources in .tf files of a given directory.
+func parentModuleDepth(dir string) (int, error) {
+	filenames, err := filepath.Glob(filepath.Join(dir, "*.tf"))
+	if err != nil {
+		return 0, err
+	}
+
+	depth := 0
+	for _, filename := range filenames {
+		b, err := os.ReadFile(filename)
+		if err != nil {
+			return 0, err
+		}
+		for _, m := range localModuleSourceRe.FindAllSubmatch(b, -1) {
+			if n := strings.Count(string(m[1]), "../"); n > depth {
+				depth = n
+			}
+		}
+	}
+	return depth, nil
+}
+
+// overlayAncestors reproduces the layout of ancestor directories of a given
+// root module up to depth levels under a given base directory, and returns a
+// path corresponding to the root module in it. The siblings in each level are
+// symlinked.
+func overlayAncestors(base string, src string, depth int) (string, error) {
+	// collect path segments from the top ancestor to the root module.
+	segments := []string{}
+	ancestor := src
+	for i := 0; i < depth; i++ {
+		parent := filepath.Dir(ancestor)
+		if parent == ancestor {
+			return "", fmt.Errorf("local module source refers to outside of the filesystem root")
+		}
+		segments = append([]string{filepath.Base(ancestor)}, segments...)
+		ancestor = parent
+	}
+
+	dst := base
+	for _, segment := range segments {
+		entries, err := os.ReadDir(ancestor)
+		if err != nil {
+			return "", err
+		}
+		for _, e := range entries {
+			if e.Name() == segment {
+				continue
+			}
+			if err := os.Symlink(filepath.Join(ancestor, e.Name()), filepath.Join(dst, e.Name())); err != nil {
+				return "", err
+			}
+		}
+		ancestor = filepath.Join(ancestor, segment)
+		dst = filepath.Join(dst, segment)
+		if err := os.Mkdir(dst, 0700); err != nil {
+			return "", err
+		}
+	}
+	return dst, nil
+}
+
+// overlayRootModule symlinks files in a given root module to a given
+// destination directory except for given excludes, and copies the
+// .terraform.lock.hcl if exists.
+func overlayRootModule(dst string, src string, excludes []string) error {
+	entries, err := os.ReadDir(src)
+	if err != nil {
+		return err
+	}
+
+	excluded := make(map[string]bool)
+	for _, name := range excludes {
+		excluded[name] = true
+	}
+
+	for _, e := range entries {
+		if isolatedExcludes[e.Name()] || excluded[e.Name()] {
+			continue
+		}
+		if err := os.Symlink(filepath.Join(src, e.Name()), filepath.Join(dst, e.Name())); err != nil {
+			return err
+		}
+	}
+
+	return copyFile(filepath.Join(dst, ".terraform.lock.hcl"), filepath.Join(src, ".terraform.lock.hcl"))
+}
+
+// copyFile copies a file from src to dst. It does nothing if src doesn't exist.
+func copyFile(dst string, src string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+	defer in.Close()
+
+	out, err := os.OpenFile(dst, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0600)
+	if err != nil {
+		return err
+	}
+
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
+
+// IsolatedEnv returns environment variables for running terraform in an
+// isolated work dir. Since an isolated work dir starts without the .terraform
+// directory, it sets TF_PLUGIN_CACHE_DIR to a shared cache directory unless
+// it's already set so that providers are not downloaded every time.
+func IsolatedEnv(env []string) ([]string, error) {
+	for _, kv := range env {
+		if strings.HasPrefix(kv, "TF_PLUGIN_CACHE_DIR=") && len(kv) > len("TF_PLUGIN_CACHE_DIR=") {
+			return env, nil
+		}
+	}
+
+	cacheDir, err := os.UserCacheDir()
+	if err != nil {
+		return nil, fmt.Errorf("failed to find a plugin cache dir: %s", err)
+	}
+	pluginCacheDir := filepath.Join(cacheDir, "tfmigrate", "plugin-cache")
+	if err := os.MkdirAll(pluginCacheDir, 0700); err != nil {
+		return nil, fmt.Errorf("failed to create a plugin cache dir: %s", err)
+	}
+
+	// copy the slice to avoid modifying the caller's one.
+	newEnv := append([]string{}, env...)
+	return append(newEnv, "TF_PLUGIN_CACHE_DIR="+pluginCacheDir), nil
+}
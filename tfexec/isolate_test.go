@@ -0,0 +1,124 @@
+package tfexec
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestNewIsolatedWorkDir(t *testing.T) {
+	base := t.TempDir()
+	dir := filepath.Join(base, "envs", "prod")
+	files := map[string]string{
+		"envs/prod/main.tf": `
+module "foo" {
+  source = "../../modules/foo"
+}
+`,
+		"envs/prod/.terraform.lock.hcl":        "# lock file\n",
+		"envs/prod/.terraform/environment":     "default",
+		"envs/prod/_tfmigrate_override.tf":     "# leftover\n",
+		"envs/stg/main.tf":                     "",
+		"modules/foo/main.tf":                  "",
+		"envs/prod/terraform.tfstate.d/foo/.k": "",
+	}
+	for name, content := range files {
+		path := filepath.Join(base, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatalf("failed to create dir: %s", err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatalf("failed to write file: %s", err)
+		}
+	}
+
+	workDir, cleanup, err := NewIsolatedWorkDir(context.Background(), dir, nil)
+	if err != nil {
+		t.Fatalf("unexpected err: %s", err)
+	}
+
+	if filepath.Base(workDir) != "prod" || filepath.Base(filepath.Dir(workDir)) != "envs" {
+		t.Errorf("unexpected layout of work dir: %s", workDir)
+	}
+
+	// files in the root module and the local module are visible.
+	for _, name := range []string{"main.tf", "../stg/main.tf", "../../modules/foo/main.tf"} {
+		if _, err := os.Stat(filepath.Join(workDir, name)); err != nil {
+			t.Errorf("expected %s to exist: %s", name, err)
+		}
+	}
+
+	// files written by terraform or tfmigrate are not shared.
+	for _, name := range []string{".terraform", "_tfmigrate_override.tf", "terraform.tfstate.d"} {
+		if _, err := os.Lstat(filepath.Join(workDir, name)); !os.IsNotExist(err) {
+			t.Errorf("expected %s not to exist: %v", name, err)
+		}
+	}
+
+	// the lock file is copied, not symlinked.
+	lockFile := filepath.Join(workDir, ".terraform.lock.hcl")
+	fi, err := os.Lstat(lockFile)
+	if err != nil {
+		t.Fatalf("failed to stat lock file: %s", err)
+	}
+	if fi.Mode()&os.ModeSymlink != 0 {
+		t.Errorf("expected the lock file to be copied, but symlinked")
+	}
+	if err := os.WriteFile(lockFile, []byte("# updated\n"), 0644); err != nil {
+		t.Fatalf("failed to write lock file: %s", err)
+	}
+	got, err := os.ReadFile(filepath.Join(dir, ".terraform.lock.hcl"))
+	if err != nil {
+		t.Fatalf("failed to read lock file: %s", err)
+	}
+	if string(got) != "# lock file\n" {
+		t.Errorf("expected the original lock file not to be changed, got: %s", string(got))
+	}
+
+	// writing to the work dir doesn't touch the original dir.
+	if err := os.WriteFile(filepath.Join(workDir, "_tfmigrate_override.tf"), []byte("# override\n"), 0600); err != nil {
+		t.Fatalf("failed to write override file: %s", err)
+	}
+	got, err = os.ReadFile(filepath.Join(dir, "_tfmigrate_override.tf"))
+	if err != nil {
+		t.Fatalf("failed to read override file: %s", err)
+	}
+	if string(got) != "# leftover\n" {
+		t.Errorf("expected the original override file not to be changed, got: %s", string(got))
+	}
+
+	if err := cleanup(); err != nil {
+		t.Fatalf("failed to cleanup: %s", err)
+	}
+	if _, err := os.Stat(workDir); !os.IsNotExist(err) {
+		t.Errorf("expected the work dir to be removed: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(base, "modules", "foo", "main.tf")); err != nil {
+		t.Errorf("expected the original files to be kept: %s", err)
+	}
+}
+
+func TestIsolatedEnv(t *testing.T) {
+	t.Setenv("XDG_CACHE_HOME", t.TempDir())
+
+	got, err := IsolatedEnv([]string{"TF_PLUGIN_CACHE_DIR=/tmp/cache"})
+	if err != nil {
+		t.Fatalf("unexpected err: %s", err)
+	}
+	if len(got) != 1 || got[0] != "TF_PLUGIN_CACHE_DIR=/tmp/cache" {
+		t.Errorf("expected the plugin cache dir to be kept, got: %v", got)
+	}
+
+	got, err = IsolatedEnv([]string{"FOO=bar"})
+	if err != nil {
+		t.Fatalf("unexpected err: %s", err)
+	}
+	if len(got) != 2 || !strings.HasPrefix(got[1], "TF_PLUGIN_CACHE_DIR=") {
+		t.Fatalf("expected the plugin cache dir to be set, got: %v", got)
+	}
+	if _, err := os.Stat(strings.TrimPrefix(got[1], "TF_PLUGIN_CACHE_DIR=")); err != nil {
+		t.Errorf("expected the plugin cache dir to be created: %s", err)
+	}
+}
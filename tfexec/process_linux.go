@@ -0,0 +1,13 @@
+package tfexec
+
+import (
+	"syscall"
+)
+
+// setParentDeathSignal asks the kernel to send SIGTERM to a command when
+// tfmigrate dies, for example, by SIGKILL. Since the command runs in its own
+// process group, it would otherwise be orphaned and keep holding the state
+// lock. terraform handles SIGTERM in the same way as an interrupt.
+func setParentDeathSignal(attr *syscall.SysProcAttr) {
+	attr.Pdeathsig = syscall.SIGTERM
+}
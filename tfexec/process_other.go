@@ -0,0 +1,10 @@
+//go:build !windows && !linux
+
+package tfexec
+
+import (
+	"syscall"
+)
+
+// setParentDeathSignal does nothing except on Linux.
+func setParentDeathSignal(_ *syscall.SysProcAttr) {}
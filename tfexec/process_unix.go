@@ -0,0 +1,29 @@
+//go:build !windows
+
+package tfexec
+
+import (
+	"os"
+	"os/exec"
+	"syscall"
+)
+
+// setProcessGroup runs a command in a new process group, so that a signal
+// sent to the foreground process group by the terminal, such as Ctrl-C, is
+// delivered only to tfmigrate, which forwards it to the command. Otherwise,
+// terraform would receive the signal twice and exit immediately without
+// cleaning up.
+func setProcessGroup(cmd *exec.Cmd) {
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+	setParentDeathSignal(cmd.SysProcAttr)
+}
+
+// signalProcessGroup sends a given signal to the process group of a given
+// process.
+func signalProcessGroup(p *os.Process, sig os.Signal) error {
+	s, ok := sig.(syscall.Signal)
+	if !ok {
+		return p.Signal(sig)
+	}
+	return syscall.Kill(-p.Pid, s)
+}
@@ -0,0 +1,17 @@
+//go:build windows
+
+package tfexec
+
+import (
+	"os"
+	"os/exec"
+)
+
+// setProcessGroup does nothing on Windows.
+func setProcessGroup(_ *exec.Cmd) {}
+
+// signalProcessGroup kills a given process, because sending a signal is not
+// supported on Windows.
+func signalProcessGroup(p *os.Process, _ os.Signal) error {
+	return p.Kill()
+}
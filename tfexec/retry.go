@@ -0,0 +1,146 @@
+package tfexec
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"time"
+)
+
+// DefaultRetryPatterns is a list of regular expressions which match stderr of
+// transient errors of remote backends such as throttling, 5xx responses and
+// network errors. They are anchored to error messages of backends rather than
+// bare status codes, because a plan output may contain any numbers.
+var DefaultRetryPatterns = []string{
+	`\bThrottling(Exception)?\b`,
+	`(?i)\brate exceeded\b`,
+	`(?i)\brate limit exceeded\b`,
+	`(?i)\btoo many requests\b`,
+	`\bSlowDown\b`,
+	`\bRequestLimitExceeded\b`,
+	`(?i)\bservice unavailable\b`,
+	`(?i)\binternal server error\b`,
+	`(?i)\bbad gateway\b`,
+	`(?i)\bgateway timeout\b`,
+	`(?i)\bstatus ?code[:=]? ?(429|500|502|503|504)\b`,
+	`\bgoogleapi: Error (429|500|502|503|504)\b`,
+	`(?i)connection reset by peer`,
+	`(?i)connection refused`,
+	`(?i)i/o timeout`,
+	`(?i)TLS handshake timeout`,
+}
+
+// idempotentCommands is a list of terraform subcommands which are safe to
+// retry. They never change remote states. Note that state push is not
+// included, because it's not safe to retry blindly if the previous attempt
+// may have been partially applied.
+var idempotentCommands = []string{
+	"version",
+	"init",
+	"plan",
+	"providers",
+	"show",
+	"state list",
+	"state pull",
+	"state show",
+	"workspace list",
+	"workspace select",
+	"workspace show",
+}
+
+// RetryPolicy is a policy to retry terraform commands which failed with
+// transient errors. Only idempotent subcommands are retried, and only if the
+// stderr matches one of the patterns.
+type RetryPolicy struct {
+	// MaxAttempts is the maximum number of attempts including the first one.
+	MaxAttempts int
+	// Backoff is an interval before the first retry.
+	// It's doubled for each retry up to MaxBackoff.
+	Backoff time.Duration
+	// MaxBackoff is the maximum interval between retries.
+	MaxBackoff time.Duration
+	// Patterns is a list of regular expressions for stderr of retryable errors.
+	Patterns []string
+
+	// res is a list of compiled Patterns.
+	res []*regexp.Regexp
+}
+
+// NewRetryPolicy returns a new RetryPolicy instance.
+// It returns an error if any pattern is not a valid regular expression.
+func NewRetryPolicy(maxAttempts int, backoff time.Duration, maxBackoff time.Duration, patterns []string) (*RetryPolicy, error) {
+	if maxAttempts < 1 {
+		return nil, fmt.Errorf("max attempts must be greater than or equal to 1: %d", maxAttempts)
+	}
+	if backoff < 0 || maxBackoff < 0 {
+		return nil, fmt.Errorf("backoff must not be negative: backoff = %s, max_backoff = %s", backoff, maxBackoff)
+	}
+
+	res := make([]*regexp.Regexp, 0, len(patterns))
+	for _, p := range patterns {
+		re, err := regexp.Compile(p)
+		if err != nil {
+			return nil, fmt.Errorf("failed to compile a retry pattern: %s", err)
+		}
+		res = append(res, re)
+	}
+
+	return &RetryPolicy{
+		MaxAttempts: maxAttempts,
+		Backoff:     backoff,
+		MaxBackoff:  maxBackoff,
+		Patterns:    patterns,
+		res:         res,
+	}, nil
+}
+
+// isIdempotent returns true if given arguments of terraform command are an
+// idempotent subcommand.
+func isIdempotent(args []string) bool {
+	return matchSubcommand(args, idempotentCommands)
+}
+
+// retryable returns true if a command with given arguments which failed with
+// a given error and stderr can be retried. Exit code 2 is never retried,
+// because terraform plan -detailed-exitcode returns it if there is a diff.
+func (p *RetryPolicy) retryable(args []string, err error, stderr string) bool {
+	if !isIdempotent(args) {
+		return false
+	}
+	if exitErr, ok := err.(ExitError); ok && exitErr.ExitCode() == 2 {
+		return false
+	}
+	for _, re := range p.res {
+		if re.MatchString(stderr) {
+			return true
+		}
+	}
+	return false
+}
+
+// backoff returns an interval before a given number of retry starting from 1.
+func (p *RetryPolicy) backoff(retry int) time.Duration {
+	d := p.Backoff
+	for i := 1; i < retry; i++ {
+		d *= 2
+		if p.MaxBackoff > 0 && d >= p.MaxBackoff {
+			return p.MaxBackoff
+		}
+	}
+	if p.MaxBackoff > 0 && d > p.MaxBackoff {
+		return p.MaxBackoff
+	}
+	return d
+}
+
+// sleep waits for a given duration or until the context is canceled.
+func sleep(ctx context.Context, d time.Duration) error {
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-t.C:
+		return nil
+	case <-ctx.Done():
+		return context.Cause(ctx)
+	}
+}
@@ -0,0 +1,265 @@
+package tfexec
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestIsIdempotent(t *testing.T) {
+	cases := []struct {
+		args []string
+		want bool
+	}{
+		{args: []string{"version"}, want: true},
+		{args: []string{"init", "-input=false", "-no-color"}, want: true},
+		{args: []string{"plan", "-state=/tmp/foo", "-detailed-exitcode"}, want: true},
+		{args: []string{"state", "pull"}, want: true},
+		{args: []string{"state", "list", "-state=/tmp/foo"}, want: true},
+		{args: []string{"workspace", "select", "foo"}, want: true},
+		{args: []string{"-chdir=foo", "state", "pull"}, want: true},
+		{args: []string{"state", "push", "/tmp/foo"}, want: false},
+		{args: []string{"state", "mv", "foo", "bar"}, want: false},
+		{args: []string{"state", "rm", "foo"}, want: false},
+		{args: []string{"import", "foo", "bar"}, want: false},
+		{args: []string{"apply", "-auto-approve"}, want: false},
+		{args: []string{"workspace", "new", "foo"}, want: false},
+		{args: []string{}, want: false},
+	}
+
+	for _, tc := range cases {
+		if got := isIdempotent(tc.args); got != tc.want {
+			t.Errorf("isIdempotent(%v) = %t, want = %t", tc.args, got, tc.want)
+		}
+	}
+}
+
+func TestNewRetryPolicy(t *testing.T) {
+	cases := []struct {
+		desc        string
+		maxAttempts int
+		backoff     time.Duration
+		patterns    []string
+		ok          bool
+	}{
+		{
+			desc:        "valid",
+			maxAttempts: 3,
+			backoff:     time.Second,
+			patterns:    DefaultRetryPatterns,
+			ok:          true,
+		},
+		{
+			desc:        "zero attempts",
+			maxAttempts: 0,
+			backoff:     time.Second,
+			patterns:    nil,
+			ok:          false,
+		},
+		{
+			desc:        "negative backoff",
+			maxAttempts: 3,
+			backoff:     -time.Second,
+			patterns:    nil,
+			ok:          false,
+		},
+		{
+			desc:        "invalid pattern",
+			maxAttempts: 3,
+			backoff:     time.Second,
+			patterns:    []string{"("},
+			ok:          false,
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.desc, func(t *testing.T) {
+			_, err := NewRetryPolicy(tc.maxAttempts, tc.backoff, 0, tc.patterns)
+			if tc.ok && err != nil {
+				t.Fatalf("unexpected err: %s", err)
+			}
+			if !tc.ok && err == nil {
+				t.Fatal("expected to return an error, but no error")
+			}
+		})
+	}
+}
+
+func TestRetryPolicyBackoff(t *testing.T) {
+	p, err := NewRetryPolicy(5, time.Second, 3*time.Second, nil)
+	if err != nil {
+		t.Fatalf("unexpected err: %s", err)
+	}
+
+	want := []time.Duration{time.Second, 2 * time.Second, 3 * time.Second, 3 * time.Second}
+	for i, w := range want {
+		if got := p.backoff(i + 1); got != w {
+			t.Errorf("backoff(%d) = %s, want = %s", i+1, got, w)
+		}
+	}
+}
+
+func TestDefaultRetryPatterns(t *testing.T) {
+	cases := []struct {
+		desc   string
+		stderr string
+		want   bool
+	}{
+		{
+			desc:   "s3 throttling",
+			stderr: "Error: operation error S3: GetObject, https response error StatusCode: 503, api error SlowDown: Please reduce your request rate.",
+			want:   true,
+		},
+		{
+			desc:   "aws status code",
+			stderr: "Error: failed to get state: StatusCode: 500, RequestID: xxx",
+			want:   true,
+		},
+		{
+			desc:   "gcs error",
+			stderr: "Error: googleapi: Error 429: The rate of change requests to the object is too high",
+			want:   true,
+		},
+		{
+			desc:   "network error",
+			stderr: "Error: dial tcp 127.0.0.1:443: connect: connection refused",
+			want:   true,
+		},
+		{
+			desc:   "bare numbers",
+			stderr: `Error: Invalid index: aws_instance.foo[503] and module.bar["429"] are not found`,
+			want:   false,
+		},
+		{
+			desc:   "resource name",
+			stderr: `Error: Reference to undeclared resource: aws_api_gateway_method_settings.throttle_500`,
+			want:   false,
+		},
+	}
+
+	p, err := NewRetryPolicy(2, 0, 0, DefaultRetryPatterns)
+	if err != nil {
+		t.Fatalf("unexpected err: %s", err)
+	}
+	for _, tc := range cases {
+		t.Run(tc.desc, func(t *testing.T) {
+			got := p.retryable([]string{"plan"}, nil, tc.stderr)
+			if got != tc.want {
+				t.Errorf("got: %t, want: %t", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestTerraformCLIRunWithRetry(t *testing.T) {
+	cases := []struct {
+		desc         string
+		mockCommands []*mockCommand
+		args         []string
+		want         string
+		ok           bool
+	}{
+		{
+			desc: "retry a transient error",
+			mockCommands: []*mockCommand{
+				{
+					args:     []string{"terraform", "state", "pull"},
+					stderr:   "Error: SlowDown: Please reduce your request rate.",
+					exitCode: 1,
+				},
+				{
+					args:     []string{"terraform", "state", "pull"},
+					stdout:   "{}",
+					exitCode: 0,
+				},
+			},
+			args: []string{"state", "pull"},
+			want: "{}",
+			ok:   true,
+		},
+		{
+			desc: "give up after max attempts",
+			mockCommands: []*mockCommand{
+				{
+					args:     []string{"terraform", "init"},
+					stderr:   "503 Service Unavailable",
+					exitCode: 1,
+				},
+				{
+					args:     []string{"terraform", "init"},
+					stderr:   "503 Service Unavailable",
+					exitCode: 1,
+				},
+			},
+			args: []string{"init"},
+			want: "",
+			ok:   false,
+		},
+		{
+			desc: "never retry a non-transient error",
+			mockCommands: []*mockCommand{
+				{
+					args:     []string{"terraform", "init"},
+					stderr:   "Error: Invalid backend configuration",
+					exitCode: 1,
+				},
+			},
+			args: []string{"init"},
+			want: "",
+			ok:   false,
+		},
+		{
+			desc: "never retry a plan with a diff",
+			mockCommands: []*mockCommand{
+				{
+					args:     []string{"terraform", "plan", "-detailed-exitcode"},
+					stdout:   "Plan: 1 to add, 0 to change, 0 to destroy.",
+					stderr:   "Warning: Service Unavailable is deprecated",
+					exitCode: 2,
+				},
+			},
+			args: []string{"plan", "-detailed-exitcode"},
+			want: "Plan: 1 to add, 0 to change, 0 to destroy.",
+			ok:   false,
+		},
+		{
+			desc: "never retry a non-idempotent command",
+			mockCommands: []*mockCommand{
+				{
+					args:     []string{"terraform", "state", "push", "foo"},
+					stderr:   "503 Service Unavailable",
+					exitCode: 1,
+				},
+			},
+			args: []string{"state", "push", "foo"},
+			want: "",
+			ok:   false,
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.desc, func(t *testing.T) {
+			p, err := NewRetryPolicy(2, 0, 0, DefaultRetryPatterns)
+			if err != nil {
+				t.Fatalf("unexpected err: %s", err)
+			}
+			e := NewMockExecutor(tc.mockCommands)
+			terraformCLI := NewTerraformCLI(e)
+			terraformCLI.SetExecPath("terraform")
+			terraformCLI.SetRetryPolicy(p)
+			got, _, err := terraformCLI.Run(context.Background(), tc.args...)
+			if tc.ok && err != nil {
+				t.Fatalf("unexpected err: %s", err)
+			}
+			if !tc.ok && err == nil {
+				t.Fatalf("expected to return an error, but no error, got: %s", got)
+			}
+			if got != tc.want {
+				t.Errorf("got: %s, want: %s", got, tc.want)
+			}
+			if runCalls := e.(*mockExecutor).runCalls; runCalls != len(tc.mockCommands) {
+				t.Errorf("got %d runs, want = %d", runCalls, len(tc.mockCommands))
+			}
+		})
+	}
+}
@@ -0,0 +1,73 @@
+package tfexec
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+)
+
+// SignalError is an error set as a cause of context cancellation when a
+// signal is received. A running command receives the same signal on
+// cancellation so that it can exit gracefully.
+type SignalError struct {
+	// Signal is the received signal.
+	Signal os.Signal
+}
+
+// Error returns a string useful for displaying error messages.
+func (e *SignalError) Error() string {
+	return fmt.Sprintf("received signal: %s", e.Signal)
+}
+
+// cancelWaitDelay is a duration to wait for a command to exit after
+// forwarding a signal on cancellation. If the command doesn't exit, it's
+// killed.
+const cancelWaitDelay = 1 * time.Minute
+
+// cancelSignal returns a signal to be forwarded to a running command when a
+// given context is canceled. It's the signal received if the cause is a
+// SignalError, otherwise os.Interrupt.
+func cancelSignal(ctx context.Context) os.Signal {
+	var sigErr *SignalError
+	if errors.As(context.Cause(ctx), &sigErr) {
+		return sigErr.Signal
+	}
+	return os.Interrupt
+}
+
+// runningProcesses is a set of processes of running commands, which are
+// signaled when tfmigrate is terminated immediately.
+var runningProcesses = struct {
+	mu sync.Mutex
+	m  map[*os.Process]struct{}
+}{m: make(map[*os.Process]struct{})}
+
+// trackProcess registers a given process as running until the returned
+// function is called.
+func trackProcess(p *os.Process) func() {
+	runningProcesses.mu.Lock()
+	defer runningProcesses.mu.Unlock()
+	runningProcesses.m[p] = struct{}{}
+	return func() {
+		runningProcesses.mu.Lock()
+		defer runningProcesses.mu.Unlock()
+		delete(runningProcesses.m, p)
+	}
+}
+
+// SignalRunningCommands sends a given signal to the process groups of all
+// running commands. Since commands run in their own process groups, they
+// don't receive a signal sent to tfmigrate by the terminal. It's intended to
+// be called before terminating tfmigrate immediately, so that no terraform
+// process is left holding a state lock. On Windows, the processes are killed.
+func SignalRunningCommands(sig os.Signal) {
+	runningProcesses.mu.Lock()
+	defer runningProcesses.mu.Unlock()
+	for p := range runningProcesses.m {
+		// The process may have exited already, so ignore errors.
+		_ = signalProcessGroup(p, sig)
+	}
+}
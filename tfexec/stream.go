@@ -0,0 +1,104 @@
+package tfexec
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"sync"
+)
+
+// parsedCommands is a list of terraform subcommands whose stdout is parsed by
+// tfmigrate. Their stdout is never streamed, because it's a machine-readable
+// output such as a state, and it may contain sensitive values.
+var parsedCommands = []string{
+	"version",
+	"providers",
+	"show",
+	"state list",
+	"state pull",
+	"state show",
+	"workspace list",
+	"workspace show",
+}
+
+// streamMu serializes writes of streamed lines so that lines of concurrent
+// commands are not mixed up.
+var streamMu sync.Mutex
+
+// prefixWriter is an io.Writer which writes each line to an underlying writer
+// with a prefix. An incomplete line is buffered until a newline is written or
+// it's flushed.
+type prefixWriter struct {
+	// w is an underlying writer.
+	w io.Writer
+	// prefix is a string prepended to each line.
+	prefix []byte
+	// buf is a buffer for an incomplete line.
+	buf []byte
+}
+
+var _ io.Writer = (*prefixWriter)(nil)
+
+// newPrefixWriter returns a new prefixWriter instance.
+func newPrefixWriter(w io.Writer, prefix string) *prefixWriter {
+	return &prefixWriter{
+		w:      w,
+		prefix: []byte(prefix),
+	}
+}
+
+// Write writes complete lines in a given bytes with the prefix.
+// It always consumes all the bytes. Errors of the underlying writer are
+// ignored, because streaming is a best-effort display for humans.
+func (p *prefixWriter) Write(b []byte) (int, error) {
+	p.buf = append(p.buf, b...)
+	for {
+		i := bytes.IndexByte(p.buf, '\n')
+		if i < 0 {
+			break
+		}
+		p.writeLine(p.buf[:i+1])
+		p.buf = p.buf[i+1:]
+	}
+	return len(b), nil
+}
+
+// Flush writes a buffered incomplete line with a newline.
+func (p *prefixWriter) Flush() {
+	if len(p.buf) == 0 {
+		return
+	}
+	p.writeLine(append(p.buf, '\n'))
+	p.buf = nil
+}
+
+// writeLine writes a given line with the prefix.
+func (p *prefixWriter) writeLine(line []byte) {
+	streamMu.Lock()
+	defer streamMu.Unlock()
+	_, _ = p.w.Write(append(append([]byte{}, p.prefix...), line...))
+}
+
+// streamKey is a context key for streamOption.
+type streamKey struct{}
+
+// streamOption is an option passed to the executor via a context to stream
+// output of a command.
+type streamOption struct {
+	// label is a string shown in a prefix of each line.
+	label string
+	// stdout streams stdout in addition to stderr if true.
+	stdout bool
+}
+
+// withStream returns a context which asks the executor to stream output of a
+// command with a given label. Stdout is streamed only if stdout is true.
+func withStream(ctx context.Context, label string, stdout bool) context.Context {
+	return context.WithValue(ctx, streamKey{}, streamOption{label: label, stdout: stdout})
+}
+
+// streamFromContext returns a streamOption in a given context if any.
+func streamFromContext(ctx context.Context) (streamOption, bool) {
+	o, ok := ctx.Value(streamKey{}).(streamOption)
+	return o, ok
+}
@@ -0,0 +1,122 @@
+package tfexec
+
+import (
+	"bytes"
+	"context"
+	"testing"
+)
+
+func TestPrefixWriter(t *testing.T) {
+	cases := []struct {
+		desc   string
+		writes []string
+		flush  bool
+		want   string
+	}{
+		{
+			desc:   "complete lines",
+			writes: []string{"foo\nbar\n"},
+			flush:  false,
+			want:   "[dir1] foo\n[dir1] bar\n",
+		},
+		{
+			desc:   "split lines",
+			writes: []string{"fo", "o\nba", "r\n"},
+			flush:  false,
+			want:   "[dir1] foo\n[dir1] bar\n",
+		},
+		{
+			desc:   "incomplete line is buffered",
+			writes: []string{"foo\nbar"},
+			flush:  false,
+			want:   "[dir1] foo\n",
+		},
+		{
+			desc:   "incomplete line is flushed",
+			writes: []string{"foo\nbar"},
+			flush:  true,
+			want:   "[dir1] foo\n[dir1] bar\n",
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.desc, func(t *testing.T) {
+			var b bytes.Buffer
+			w := newPrefixWriter(&b, "[dir1] ")
+			for _, s := range tc.writes {
+				n, err := w.Write([]byte(s))
+				if err != nil || n != len(s) {
+					t.Fatalf("failed to write: n = %d, err = %v", n, err)
+				}
+			}
+			if tc.flush {
+				w.Flush()
+			}
+			if got := b.String(); got != tc.want {
+				t.Errorf("got = %q, want = %q", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestTerraformCLIRunStreamOutput(t *testing.T) {
+	cases := []struct {
+		desc       string
+		args       []string
+		label      string
+		wantStdout string
+		wantStderr string
+	}{
+		{
+			desc:       "stream stdout and stderr",
+			args:       []string{"plan"},
+			label:      "dir1",
+			wantStdout: "[dir1] out\n",
+			wantStderr: "[dir1] err\n",
+		},
+		{
+			desc:       "never stream stdout of parsed commands",
+			args:       []string{"state", "pull"},
+			label:      "dir1",
+			wantStdout: "",
+			wantStderr: "[dir1] err\n",
+		},
+		{
+			desc:       "disabled",
+			args:       []string{"plan"},
+			label:      "",
+			wantStdout: "",
+			wantStderr: "",
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.desc, func(t *testing.T) {
+			var outStream, errStream bytes.Buffer
+			e := &executor{
+				outStream: &outStream,
+				errStream: &errStream,
+				dir:       ".",
+			}
+			// The script ignores the subcommand passed as $0.
+			terraformCLI := NewTerraformCLI(e)
+			terraformCLI.SetExecPath("/bin/sh -c 'echo out; echo err >&2'")
+			terraformCLI.SetStreamOutput(tc.label)
+
+			stdout, stderr, err := terraformCLI.Run(context.Background(), tc.args...)
+			if err != nil {
+				t.Fatalf("unexpected err: %s", err)
+			}
+			// output is still buffered.
+			if stdout != "out\n" || stderr != "err\n" {
+				t.Errorf("got buffered stdout = %q, stderr = %q", stdout, stderr)
+			}
+			if got := outStream.String(); got != tc.wantStdout {
+				t.Errorf("got streamed stdout = %q, want = %q", got, tc.wantStdout)
+			}
+			if got := errStream.String(); got != tc.wantStderr {
+				t.Errorf("got streamed stderr = %q, want = %q", got, tc.wantStderr)
+			}
+		})
+	}
+}
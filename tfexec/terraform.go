@@ -2,19 +2,26 @@ package tfexec
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
-	"log"
+	"log/slog"
 	"os"
 	"path/filepath"
+	"sort"
 	"strings"
 
 	"github.com/hashicorp/go-version"
 	"github.com/mattn/go-shellwords"
+	"github.com/minamijoyo/tfmigrate/logging"
+	"github.com/minamijoyo/tfmigrate/tracing"
 )
 
 // State is a named type for tfstate.
 // We don't parse contents of tfstate to avoid depending on internal details,
 // but we define it as a named type to clarify interface.
+// The only exception is a few top-level metadata such as lineage and serial,
+// which are stable across state format versions.
 type State []byte
 
 // Bytes returns raw contents of tfstate as []byte.
@@ -22,6 +29,46 @@ func (s *State) Bytes() []byte {
 	return []byte(*s)
 }
 
+// Lineage returns the lineage of tfstate.
+// The lineage is a unique ID assigned to a state when it is created.
+func (s *State) Lineage() (string, error) {
+	meta, err := s.meta()
+	if err != nil {
+		return "", err
+	}
+	return meta.Lineage, nil
+}
+
+// Serial returns the serial of tfstate.
+// The serial is incremented every time the state is written.
+func (s *State) Serial() (uint64, error) {
+	meta, err := s.meta()
+	if err != nil {
+		return 0, err
+	}
+	return meta.Serial, nil
+}
+
+// stateMeta is top-level metadata of tfstate.
+type stateMeta struct {
+	Lineage string `json:"lineage"`
+	Serial  uint64 `json:"serial"`
+	// EncryptionVersion is set only if the state is encrypted by OpenTofu.
+	EncryptionVersion string `json:"encryption_version"`
+}
+
+// meta parses top-level metadata of tfstate.
+func (s *State) meta() (*stateMeta, error) {
+	var meta stateMeta
+	if err := json.Unmarshal(s.Bytes(), &meta); err != nil {
+		return nil, fmt.Errorf("failed to parse state: %s", err)
+	}
+	if len(meta.EncryptionVersion) > 0 {
+		return nil, fmt.Errorf("failed to parse state: the state is encrypted by OpenTofu")
+	}
+	return &meta, nil
+}
+
 // NewState returns a new State instance with a given content of tfstate.
 func NewState(b []byte) *State {
 	s := State(b)
@@ -83,6 +130,10 @@ type TerraformCLI interface {
 	// their provider requirements.
 	Providers(ctx context.Context) (string, error)
 
+	// Show returns a human-readable or machine-readable representation of a given plan.
+	// If a plan is not given, it shows the current state.
+	Show(ctx context.Context, plan *Plan, opts ...string) (string, error)
+
 	// StateList shows a list of resources.
 	// If a state is given, use it for the input state.
 	StateList(ctx context.Context, state *State, addresses []string, opts ...string) ([]string, error)
@@ -131,6 +182,24 @@ type TerraformCLI interface {
 	// It's intended to inject a wrapper command such as direnv.
 	SetExecPath(execPath string)
 
+	// SetRetryPolicy sets a policy to retry idempotent commands which failed
+	// with transient errors. If nil, no command is retried.
+	SetRetryPolicy(p *RetryPolicy)
+
+	// SetTimeouts sets timeouts for classes of commands. If a command doesn't
+	// finish within the timeout, it's interrupted and a TimeoutError is returned.
+	SetTimeouts(t Timeouts)
+
+	// SetStreamOutput streams output of commands to the console in real time
+	// with a `[label] ` prefix. Stdout of commands parsed by tfmigrate such as
+	// state pull is never streamed. If label is empty, output is not streamed.
+	SetStreamOutput(label string)
+
+	// SetTerragrunt runs terraform commands via Terragrunt with a given config.
+	// The override file for a local backend is placed in a directory where
+	// Terragrunt runs terraform. If nil, terraform commands are run directly.
+	SetTerragrunt(t *Terragrunt)
+
 	// OverrideBackendToLocal switches the backend to local and returns a function
 	// to switch it back to remote with defer.
 	// The -state flag for terraform command is not valid for remote state,
@@ -155,6 +224,19 @@ type terraformCLI struct {
 	// execPath is a string which executes the terraform command.
 	// Default to terraform. To use OpenTofu, set this to `tofu`.
 	execPath string
+
+	// retryPolicy is a policy to retry commands failed with transient errors.
+	retryPolicy *RetryPolicy
+
+	// timeouts is a set of timeouts for classes of commands.
+	timeouts Timeouts
+
+	// streamLabel is a label of streamed output. If empty, output is not streamed.
+	streamLabel string
+
+	// terragrunt is a config to run terraform commands via Terragrunt.
+	// If nil, terraform commands are run directly.
+	terragrunt *Terragrunt
 }
 
 var _ TerraformCLI = (*terraformCLI)(nil)
@@ -176,13 +258,37 @@ func NewTerraformCLI(e Executor) TerraformCLI {
 }
 
 // Run is a low-level generic method for running an arbitrary terraform command.
-func (c *terraformCLI) Run(ctx context.Context, args ...string) (string, string, error) {
-	name := c.execPath
+func (c *terraformCLI) Run(ctx context.Context, args ...string) (stdout string, stderr string, err error) {
+	subcommand := strings.Join(subcommandOf(args), " ")
+	ctx, span := tracing.Start(ctx, "terraform "+subcommand,
+		tracing.AttrSubcommand.String(subcommand),
+		tracing.AttrArgs.StringSlice(redactArgs(args)),
+		tracing.AttrWorkDir.String(c.Dir()),
+	)
+	defer func() {
+		var exitErr ExitError
+		if err == nil {
+			span.SetAttributes(tracing.AttrExitCode.Int(0))
+		} else if errors.As(err, &exitErr) {
+			span.SetAttributes(tracing.AttrExitCode.Int(exitErr.ExitCode()))
+		}
+		tracing.End(span, err)
+	}()
+
+	originalArgs := args
+	execPath := c.execPath
+	if c.terragrunt != nil {
+		if err := c.terragrunt.checkConfigFile(c.Dir()); err != nil {
+			return "", "", err
+		}
+		execPath = c.terragrunt.ExecPath
+	}
+	name := execPath
 	// If execPath is customized
 	if name != "terraform" {
 		// execPath may contain spaces and environment variables, so we parse it.
 		// e.g.) "direnv exec . terraform" => ["direnv", "exec", ".", "terraform"]
-		parts, err := shellwords.Parse(c.execPath)
+		parts, err := shellwords.Parse(execPath)
 		if err != nil {
 			return "", "", err
 		}
@@ -194,14 +300,106 @@ func (c *terraformCLI) Run(ctx context.Context, args ...string) (string, string,
 		}
 	}
 
-	cmd, err := c.NewCommandContext(ctx, name, args...)
+	// prefixed args may contain a wrapper command, so check the original one.
+	retryable := func(err error, stderr string) bool {
+		return c.retryPolicy != nil && c.retryPolicy.retryable(originalArgs, err, stderr)
+	}
+
+	for attempt := 1; ; attempt++ {
+		cmd, err := c.runOnce(ctx, originalArgs, name, args...)
+		if cmd == nil {
+			return "", "", err
+		}
+		var timeoutErr *TimeoutError
+		if err == nil || ctx.Err() != nil || errors.As(err, &timeoutErr) || attempt >= c.maxAttempts() || !retryable(err, cmd.Stderr()) {
+			span.SetAttributes(tracing.AttrAttempts.Int(attempt))
+			return cmd.Stdout(), cmd.Stderr(), err
+		}
+
+		backoff := c.retryPolicy.backoff(attempt)
+		slog.WarnContext(ctx, "retry a transient error", "component", "executor", "backoff", backoff, "retry", attempt, "max_retries", c.maxAttempts()-1, "error", err)
+		span.AddEvent("retry")
+		if serr := sleep(ctx, backoff); serr != nil {
+			span.SetAttributes(tracing.AttrAttempts.Int(attempt))
+			return cmd.Stdout(), cmd.Stderr(), err
+		}
+	}
+}
+
+// runOnce runs a command once with a timeout for given original arguments.
+// If the timeout is exceeded, it returns a TimeoutError. It returns a nil
+// command if failed to build the command.
+func (c *terraformCLI) runOnce(ctx context.Context, originalArgs []string, name string, args ...string) (Command, error) {
+	cmdCtx, cancel := c.timeouts.withCommandTimeout(ctx, originalArgs)
+	defer cancel()
+	if len(c.streamLabel) > 0 {
+		cmdCtx = withStream(cmdCtx, c.streamLabel, !matchSubcommand(originalArgs, parsedCommands))
+	}
+
+	cmd, err := c.NewCommandContext(cmdCtx, name, args...)
 	if err != nil {
-		return "", "", err
+		return nil, err
 	}
 
 	err = c.Executor.Run(cmd)
+	return cmd, timeoutError(cmdCtx, err)
+}
 
-	return cmd.Stdout(), cmd.Stderr(), err
+// subcommandOf returns up to two leading words of given arguments of
+// terraform command which are not options, such as ["state", "pull"].
+func subcommandOf(args []string) []string {
+	subcommand := []string{}
+	for _, arg := range args {
+		if strings.HasPrefix(arg, "-") {
+			// skip global options such as -chdir.
+			continue
+		}
+		subcommand = append(subcommand, arg)
+		if len(subcommand) == 2 {
+			break
+		}
+	}
+	return subcommand
+}
+
+// redactArgs returns a copy of given arguments of terraform command in which
+// values of -backend-config=KEY=VALUE are redacted, because they may contain
+// credentials. A path to a backend config file is kept as it is.
+func redactArgs(args []string) []string {
+	redacted := make([]string, 0, len(args))
+	for _, arg := range args {
+		if v, ok := strings.CutPrefix(arg, "-backend-config="); ok {
+			if key, _, ok := strings.Cut(v, "="); ok {
+				arg = "-backend-config=" + key + "=REDACTED"
+			}
+		}
+		redacted = append(redacted, arg)
+	}
+	return redacted
+}
+
+// matchSubcommand returns true if the subcommand of given arguments matches
+// any of given commands, which are a single word such as "init" or two words
+// such as "state pull".
+func matchSubcommand(args []string, commands []string) bool {
+	subcommand := subcommandOf(args)
+	if len(subcommand) == 0 {
+		return false
+	}
+	for _, c := range commands {
+		if c == subcommand[0] || c == strings.Join(subcommand, " ") {
+			return true
+		}
+	}
+	return false
+}
+
+// maxAttempts returns the maximum number of attempts for a command.
+func (c *terraformCLI) maxAttempts() int {
+	if c.retryPolicy == nil {
+		return 1
+	}
+	return c.retryPolicy.MaxAttempts
 }
 
 // Dir returns a working directory where terraform command is executed.
@@ -215,6 +413,53 @@ func (c *terraformCLI) SetExecPath(execPath string) {
 	c.execPath = execPath
 }
 
+// SetRetryPolicy sets a policy to retry idempotent commands which failed with
+// transient errors. If nil, no command is retried.
+func (c *terraformCLI) SetRetryPolicy(p *RetryPolicy) {
+	c.retryPolicy = p
+}
+
+// SetTimeouts sets timeouts for classes of commands. If a command doesn't
+// finish within the timeout, it's interrupted and a TimeoutError is returned.
+func (c *terraformCLI) SetTimeouts(t Timeouts) {
+	c.timeouts = t
+}
+
+// SetStreamOutput streams output of commands to the console in real time
+// with a `[label] ` prefix. Stdout of commands parsed by tfmigrate such as
+// state pull is never streamed. If label is empty, output is not streamed.
+func (c *terraformCLI) SetStreamOutput(label string) {
+	c.streamLabel = label
+}
+
+// SetTerragrunt runs terraform commands via Terragrunt with a given config.
+// The override file for a local backend is placed in a directory where
+// Terragrunt runs terraform. If nil, terraform commands are run directly.
+func (c *terraformCLI) SetTerragrunt(t *Terragrunt) {
+	c.terragrunt = t
+	if t == nil {
+		return
+	}
+	env := t.env(c.Dir())
+	keys := make([]string, 0, len(env))
+	for k := range env {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		c.AppendEnv(k, env[k])
+	}
+}
+
+// workDir returns a directory where terraform actually runs. It differs from
+// Dir only if Terragrunt runs terraform in its cache dir.
+func (c *terraformCLI) workDir() (string, error) {
+	if c.terragrunt == nil {
+		return c.Dir(), nil
+	}
+	return c.terragrunt.FindWorkDir(c.Dir())
+}
+
 // OverrideBackendToLocal switches the backend to local and returns a function
 // that will switch it back to remote with defer.
 // The -state flag for terraform command is not valid for remote state,
@@ -223,82 +468,127 @@ func (c *terraformCLI) SetExecPath(execPath string) {
 // (e.g.) _tfexec_override.tf
 func (c *terraformCLI) OverrideBackendToLocal(ctx context.Context, filename string,
 	workspace string, isBackendTerraformCloud bool, backendConfig []string, supportsStateReplaceProvider bool) (func() error, error) {
+	// Terragrunt generates a backend file in its cache dir, so the override
+	// file must be placed next to it.
+	workDir, err := c.workDir()
+	if err != nil {
+		return nil, err
+	}
+
+	// OpenTofu state encryption must be carried into the override file, so that
+	// states in temporary files can be read and written with the local backend.
+	env := os.Getenv(encryptionEnv)
+	enc, err := loadStateEncryption(workDir, filename, env)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load state encryption config: %s", err)
+	}
+
 	// create local backend override file.
-	path := filepath.Join(c.Dir(), filename)
-	contents := `
-terraform {
-  backend "local" {
-  }
-}
-`
-	log.Printf("[INFO] [executor@%s] create an override file\n", c.Dir())
+	path := filepath.Join(workDir, filename)
+	contents, err := overrideFileContents(enc)
+	if err != nil {
+		return nil, err
+	}
+	ctx = logging.With(ctx, "component", "executor")
+	slog.InfoContext(ctx, "create an override file")
 	if err := os.WriteFile(path, []byte(contents), 0600); err != nil {
 		return nil, fmt.Errorf("failed to create override file: %s", err)
 	}
 
+	// TF_ENCRYPTION is merged after the override file, so remove the state
+	// target from it while the backend is local, and restore it on switching
+	// back to remote.
+	restoreEnv := func() {}
+	if enc != nil && len(env) > 0 {
+		localEnv, err := withoutStateEncryption(env)
+		if err != nil {
+			os.Remove(path)
+			return nil, err
+		}
+		c.AppendEnv(encryptionEnv, localEnv)
+		restoreEnv = func() { c.AppendEnv(encryptionEnv, env) }
+	}
+
 	// create local workspace state directory
-	workspaceStatePath := filepath.Join(c.Dir(), "terraform.tfstate.d", workspace)
-	workspacePath := filepath.Join(c.Dir(), "terraform.tfstate.d")
-	log.Printf("[INFO] [migrator@%s] creating local workspace folder in: %s\n", c.Dir(), workspaceStatePath)
+	workspaceStatePath := filepath.Join(workDir, "terraform.tfstate.d", workspace)
+	workspacePath := filepath.Join(workDir, "terraform.tfstate.d")
+	slog.InfoContext(ctx, "create a local workspace folder", "path", workspaceStatePath)
 	if err := os.MkdirAll(workspaceStatePath, os.ModePerm); err != nil {
 		return nil, fmt.Errorf("failed to create local workspace state directory: %s", err)
 	}
 
-	log.Printf("[INFO] [executor@%s] switch backend to local\n", c.Dir())
-	err := c.Init(ctx, "-input=false", "-no-color", "-reconfigure")
+	// Switching back to remote must run even if the context has been canceled,
+	// otherwise the work dir is left with the local backend.
+	cleanupCtx := context.WithoutCancel(ctx)
+	initRemote := func() error {
+		slog.InfoContext(cleanupCtx, "switch back to remote")
+		restoreEnv()
+
+		var args = []string{"-input=false", "-no-color"}
+		for _, b := range backendConfig {
+			args = append(args, fmt.Sprintf("-backend-config=%s", b))
+		}
+		// Run the correct init command depending on whether the remote backend is Terraform Cloud
+		if !isBackendTerraformCloud {
+			args = append(args, "-reconfigure")
+		}
+
+		err := c.Init(cleanupCtx, args...)
+		if err != nil {
+			if supportsStateReplaceProvider && strings.Contains(err.Error(), AcceptableLegacyStateInitError) {
+				slog.InfoContext(cleanupCtx, "ignoring an error; the error is expected when using Terraform with a legacy Terraform state", "error", AcceptableLegacyStateInitError)
+			} else {
+				slog.ErrorContext(cleanupCtx, "failed to switch back to remote", "error", err)
+				slog.ErrorContext(cleanupCtx, "please re-run terraform init -reconfigure")
+				return err
+			}
+		}
+
+		return nil
+	}
+
+	slog.InfoContext(ctx, "switch backend to local")
+	err = c.Init(ctx, "-input=false", "-no-color", "-reconfigure")
 	if err != nil {
+		restoreEnv()
 		// remove the override file before return an error.
 		os.Remove(path)
 		os.Remove(workspaceStatePath)
 		os.Remove(workspacePath)
+		// If canceled or timed out, terraform init may have been interrupted
+		// after switching the backend, so switch it back to remote.
+		var timeoutErr *TimeoutError
+		if ctx.Err() != nil || errors.As(err, &timeoutErr) {
+			return nil, errors.Join(fmt.Errorf("failed to switch backend to local: %s", err), initRemote())
+		}
 		return nil, fmt.Errorf("failed to switch backend to local: %s", err)
 	}
 
 	switchBackToRemoteFunc := func() error {
-		log.Printf("[INFO] [executor@%s] remove the override file\n", c.Dir())
+		restoreEnv()
+		slog.InfoContext(cleanupCtx, "remove the override file")
 		err := os.Remove(path)
 		if err != nil {
-			log.Printf("[ERROR] [executor@%s] failed to remove the override file: %s\n", c.Dir(), err)
-			log.Printf("[ERROR] [executor@%s] please remove the override file(%s) and re-run terraform init -reconfigure\n", c.Dir(), path)
+			slog.ErrorContext(cleanupCtx, "failed to remove the override file", "error", err)
+			slog.ErrorContext(cleanupCtx, "please remove the override file and re-run terraform init -reconfigure", "path", path)
 			return err
 		}
 		// cleanup the local workspace directly used for local state
-		log.Printf("[INFO] [executor@%s] remove the workspace state folder\n", c.Dir())
+		slog.InfoContext(cleanupCtx, "remove the workspace state folder")
 		err = os.Remove(workspaceStatePath)
 		if err != nil {
-			log.Printf("[ERROR] [executor@%s] failed to remove local workspace state directory: %s\n", c.Dir(), err)
-			log.Printf("[ERROR] [executor@%s] please remove the local workspace state directory(%s) and re-run terraform init -reconfigure\n", c.Dir(), workspaceStatePath)
+			slog.ErrorContext(cleanupCtx, "failed to remove local workspace state directory", "error", err)
+			slog.ErrorContext(cleanupCtx, "please remove the local workspace state directory and re-run terraform init -reconfigure", "path", workspaceStatePath)
 			return err
 		}
 		err = os.Remove(workspacePath)
 		if err != nil {
-			log.Printf("[ERROR] [executor@%s] failed to remove local workspace directory: %s\n", c.Dir(), err)
-			log.Printf("[ERROR] [executor@%s] please remove the local workspace directory(%s) and re-run terraform init -reconfigure\n", c.Dir(), workspacePath)
+			slog.ErrorContext(cleanupCtx, "failed to remove local workspace directory", "error", err)
+			slog.ErrorContext(cleanupCtx, "please remove the local workspace directory and re-run terraform init -reconfigure", "path", workspacePath)
 			return err
 		}
-		log.Printf("[INFO] [executor@%s] switch back to remote\n", c.Dir())
 
-		var args = []string{"-input=false", "-no-color"}
-		for _, b := range backendConfig {
-			args = append(args, fmt.Sprintf("-backend-config=%s", b))
-		}
-		// Run the correct init command depending on whether the remote backend is Terraform Cloud
-		if !isBackendTerraformCloud {
-			args = append(args, "-reconfigure")
-		}
-
-		err = c.Init(ctx, args...)
-		if err != nil {
-			if supportsStateReplaceProvider && strings.Contains(err.Error(), AcceptableLegacyStateInitError) {
-				log.Printf("[INFO] [migrator@%s] ignoring error '%s'; the error is expected when using Terraform with a legacy Terraform state\n", c.Dir(), AcceptableLegacyStateInitError)
-			} else {
-				log.Printf("[ERROR] [executor@%s] failed to switch back to remote: %s\n", c.Dir(), err)
-				log.Printf("[ERROR] [executor@%s] please re-run terraform init -reconfigure\n", c.Dir())
-				return err
-			}
-		}
-
-		return nil
+		return initRemote()
 	}
 
 	return switchBackToRemoteFunc, nil
@@ -2,12 +2,21 @@ package tfexec
 
 import (
 	"context"
+	"sync"
 )
 
+// initMu serializes terraform init across concurrent migrations in a process,
+// because the plugin cache directory set by TF_PLUGIN_CACHE_DIR or the CLI
+// config is not safe for concurrent use.
+var initMu sync.Mutex
+
 // Init initializes the current work directory.
 func (c *terraformCLI) Init(ctx context.Context, opts ...string) error {
 	args := []string{"init"}
 	args = append(args, opts...)
+
+	initMu.Lock()
+	defer initMu.Unlock()
 	_, _, err := c.Run(ctx, args...)
 	return err
 }
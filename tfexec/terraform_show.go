@@ -0,0 +1,30 @@
+package tfexec
+
+import (
+	"context"
+	"os"
+)
+
+// Show returns a human-readable or machine-readable representation of a given plan.
+// If a plan is not given, it shows the current state.
+// To get a machine-readable output, pass the -json option.
+func (c *terraformCLI) Show(ctx context.Context, plan *Plan, opts ...string) (string, error) {
+	args := []string{"show"}
+	args = append(args, opts...)
+
+	if plan != nil {
+		tmpPlan, err := writeTempFile(plan.Bytes())
+		if err != nil {
+			return "", err
+		}
+		defer os.Remove(tmpPlan.Name())
+		args = append(args, tmpPlan.Name())
+	}
+
+	stdout, _, err := c.Run(ctx, args...)
+	if err != nil {
+		return "", err
+	}
+
+	return stdout, nil
+}
@@ -0,0 +1,94 @@
+package tfexec
+
+import (
+	"context"
+	"os"
+	"regexp"
+	"testing"
+)
+
+func TestTerraformCLIShow(t *testing.T) {
+	plan := NewPlan([]byte("dummy plan"))
+	// check if a temporary plan file is passed.
+	runFunc := func(args ...string) error {
+		got, err := os.ReadFile(args[len(args)-1])
+		if err != nil {
+			return err
+		}
+		if string(got) != string(plan.Bytes()) {
+			t.Errorf("got: %s, want: %s", string(got), string(plan.Bytes()))
+		}
+		return nil
+	}
+
+	cases := []struct {
+		desc         string
+		mockCommands []*mockCommand
+		plan         *Plan
+		opts         []string
+		want         string
+		ok           bool
+	}{
+		{
+			desc: "show state",
+			mockCommands: []*mockCommand{
+				{
+					args:     []string{"terraform", "show", "-json"},
+					stdout:   `{"format_version":"1.0"}`,
+					exitCode: 0,
+				},
+			},
+			plan: nil,
+			opts: []string{"-json"},
+			want: `{"format_version":"1.0"}`,
+			ok:   true,
+		},
+		{
+			desc: "show plan",
+			mockCommands: []*mockCommand{
+				{
+					args:     []string{"terraform", "show", "-json", "/path/to/planfile"},
+					argsRe:   regexp.MustCompile(`^terraform show -json \S+$`),
+					runFunc:  runFunc,
+					stdout:   `{"format_version":"1.0","resource_changes":[]}`,
+					exitCode: 0,
+				},
+			},
+			plan: plan,
+			opts: []string{"-json"},
+			want: `{"format_version":"1.0","resource_changes":[]}`,
+			ok:   true,
+		},
+		{
+			desc: "failed to run terraform show",
+			mockCommands: []*mockCommand{
+				{
+					args:     []string{"terraform", "show", "-json"},
+					exitCode: 1,
+				},
+			},
+			plan: nil,
+			opts: []string{"-json"},
+			want: "",
+			ok:   false,
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.desc, func(t *testing.T) {
+			e := NewMockExecutor(tc.mockCommands)
+			terraformCLI := NewTerraformCLI(e)
+			terraformCLI.SetExecPath("terraform")
+			got, err := terraformCLI.Show(context.Background(), tc.plan, tc.opts...)
+			if tc.ok && err != nil {
+				t.Fatalf("unexpected err: %s", err)
+			}
+			if !tc.ok && err == nil {
+				t.Fatal("expected to return an error, but no error")
+			}
+			if tc.ok && got != tc.want {
+				t.Errorf("got: %s, want: %s", got, tc.want)
+			}
+		})
+	}
+}
@@ -5,7 +5,16 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+	"reflect"
+	"strings"
 	"testing"
+
+	"github.com/minamijoyo/tfmigrate/tracing"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
 )
 
 func TestTerraformCLIRun(t *testing.T) {
@@ -107,6 +116,81 @@ func TestTerraformCLIRun(t *testing.T) {
 	}
 }
 
+func TestTerraformCLIRunSpan(t *testing.T) {
+	recorder := tracetest.NewSpanRecorder()
+	orig := otel.GetTracerProvider()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)))
+	t.Cleanup(func() { otel.SetTracerProvider(orig) })
+
+	mockCommands := []*mockCommand{
+		{
+			args:     []string{"terraform", "plan", "-detailed-exitcode"},
+			exitCode: 2,
+		},
+	}
+	e := NewMockExecutor(mockCommands)
+	terraformCLI := NewTerraformCLI(e)
+	_, _, err := terraformCLI.Run(context.Background(), "plan", "-detailed-exitcode")
+	if err == nil {
+		t.Fatalf("expected to return an error, but no error")
+	}
+
+	spans := recorder.Ended()
+	if len(spans) != 1 {
+		t.Fatalf("got %d spans, want 1", len(spans))
+	}
+	span := spans[0]
+	if span.Name() != "terraform plan" {
+		t.Errorf("got name = %s, want = terraform plan", span.Name())
+	}
+	if span.Status().Code != codes.Error {
+		t.Errorf("got status = %s, want = %s", span.Status().Code, codes.Error)
+	}
+	got := map[attribute.Key]attribute.Value{}
+	for _, kv := range span.Attributes() {
+		got[kv.Key] = kv.Value
+	}
+	want := map[attribute.Key]attribute.Value{
+		tracing.AttrSubcommand: attribute.StringValue("plan"),
+		tracing.AttrArgs:       attribute.StringSliceValue([]string{"plan", "-detailed-exitcode"}),
+		tracing.AttrExitCode:   attribute.IntValue(2),
+		tracing.AttrAttempts:   attribute.IntValue(1),
+	}
+	for k, v := range want {
+		if got[k] != v {
+			t.Errorf("got %s = %s, want = %s", k, got[k].Emit(), v.Emit())
+		}
+	}
+}
+
+func TestRedactArgs(t *testing.T) {
+	cases := []struct {
+		desc string
+		args []string
+		want []string
+	}{
+		{
+			desc: "no backend config",
+			args: []string{"init", "-input=false"},
+			want: []string{"init", "-input=false"},
+		},
+		{
+			desc: "backend config",
+			args: []string{"init", "-backend-config=token=secret", "-backend-config=backend.hcl"},
+			want: []string{"init", "-backend-config=token=REDACTED", "-backend-config=backend.hcl"},
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.desc, func(t *testing.T) {
+			got := redactArgs(tc.args)
+			if !reflect.DeepEqual(got, tc.want) {
+				t.Errorf("got: %v, want: %v", got, tc.want)
+			}
+		})
+	}
+}
+
 func TestAccTerraformCLIOverrideBackendToLocal(t *testing.T) {
 	SkipUnlessAcceptanceTestEnabled(t)
 
@@ -362,6 +446,84 @@ func TestAccTerraformCLIPlanHasChange(t *testing.T) {
 	}
 }
 
+func TestAccTerraformCLIOverrideBackendToLocalWithStateEncryption(t *testing.T) {
+	SkipUnlessAcceptanceTestEnabled(t)
+	SkipUnlessStateEncryptionSupported(t)
+
+	backend := GetTestAccBackendS3Config(t.Name())
+	encryption := GetTestAccStateEncryptionConfig(false)
+	source := `
+resource "null_resource" "foo" {}
+resource "null_resource" "bar" {}
+`
+	workspace := "default"
+	terraformCLI := SetupTestAccWithApply(t, workspace, backend+encryption+source)
+
+	updatedSource := `
+resource "null_resource" "foo2" {}
+resource "null_resource" "bar" {}
+`
+	UpdateTestAccSource(t, terraformCLI, backend+encryption+updatedSource)
+
+	// state pull always returns a plaintext state.
+	state, err := terraformCLI.StatePull(context.Background())
+	if err != nil {
+		t.Fatalf("failed to run terraform state pull: %s", err)
+	}
+	if _, err := state.Lineage(); err != nil {
+		t.Fatalf("failed to parse the pulled state: %s", err)
+	}
+
+	filename := "_tfexec_override.tf"
+	switchBackToRemoteFunc, err := terraformCLI.OverrideBackendToLocal(context.Background(), filename, workspace, false, nil, true)
+	if err != nil {
+		t.Fatalf("failed to run OverrideBackendToLocal: %s", err)
+	}
+
+	override, err := os.ReadFile(filepath.Join(terraformCLI.Dir(), filename))
+	if err != nil {
+		t.Fatalf("failed to read the override file: %s", err)
+	}
+	if !strings.Contains(string(override), "method = method.aes_gcm.test") {
+		t.Errorf("the override file doesn't carry the encryption config: %s", string(override))
+	}
+
+	updatedState, _, err := terraformCLI.StateMv(context.Background(), state, nil, "null_resource.foo", "null_resource.foo2")
+	if err != nil {
+		t.Fatalf("failed to run terraform state mv: %s", err)
+	}
+	// states in temporary files are written as plaintext.
+	if _, err := updatedState.Lineage(); err != nil {
+		t.Fatalf("failed to parse the updated state: %s", err)
+	}
+
+	changed, err := terraformCLI.PlanHasChange(context.Background(), updatedState)
+	if err != nil {
+		t.Fatalf("failed to run PlanHasChange: %s", err)
+	}
+	if changed {
+		t.Fatalf("expect not to have changes")
+	}
+
+	err = switchBackToRemoteFunc()
+	if err != nil {
+		t.Fatalf("unexpected err switching back to remote backend: %s", err)
+	}
+
+	err = terraformCLI.StatePush(context.Background(), updatedState)
+	if err != nil {
+		t.Fatalf("failed to run terraform state push: %s", err)
+	}
+
+	changed, err = terraformCLI.PlanHasChange(context.Background(), nil)
+	if err != nil {
+		t.Fatalf("failed to run PlanHasChange: %s", err)
+	}
+	if changed {
+		t.Fatalf("expect not to have changes")
+	}
+}
+
 func TestGetOptionValue(t *testing.T) {
 	cases := []struct {
 		desc   string
@@ -392,3 +554,89 @@ func TestGetOptionValue(t *testing.T) {
 		})
 	}
 }
+
+func TestStateLineage(t *testing.T) {
+	cases := []struct {
+		desc  string
+		state *State
+		want  string
+		ok    bool
+	}{
+		{
+			desc:  "valid",
+			state: NewState([]byte(`{"version": 4, "serial": 1, "lineage": "d7a1f1a4-0c2e-8c2a-5c0b-0f4e2d6c7a9b"}`)),
+			want:  "d7a1f1a4-0c2e-8c2a-5c0b-0f4e2d6c7a9b",
+			ok:    true,
+		},
+		{
+			desc:  "no lineage",
+			state: NewState([]byte(`{"version": 4}`)),
+			want:  "",
+			ok:    true,
+		},
+		{
+			desc:  "invalid",
+			state: NewState([]byte(`foo`)),
+			want:  "",
+			ok:    false,
+		},
+		{
+			desc:  "encrypted",
+			state: NewState([]byte(`{"meta": {"key_provider.pbkdf2.default": "e30="}, "encrypted_data": "Zm9v", "encryption_version": "v0"}`)),
+			want:  "",
+			ok:    false,
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.desc, func(t *testing.T) {
+			got, err := tc.state.Lineage()
+			if tc.ok && err != nil {
+				t.Fatalf("unexpected err: %s", err)
+			}
+			if !tc.ok && err == nil {
+				t.Fatalf("expected to return an error, but no error, got: %s", got)
+			}
+			if got != tc.want {
+				t.Errorf("got: %s, want: %s", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestStateSerial(t *testing.T) {
+	cases := []struct {
+		desc  string
+		state *State
+		want  uint64
+		ok    bool
+	}{
+		{
+			desc:  "valid",
+			state: NewState([]byte(`{"version": 4, "serial": 3, "lineage": "d7a1f1a4-0c2e-8c2a-5c0b-0f4e2d6c7a9b"}`)),
+			want:  3,
+			ok:    true,
+		},
+		{
+			desc:  "invalid",
+			state: NewState([]byte(`foo`)),
+			want:  0,
+			ok:    false,
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.desc, func(t *testing.T) {
+			got, err := tc.state.Serial()
+			if tc.ok && err != nil {
+				t.Fatalf("unexpected err: %s", err)
+			}
+			if !tc.ok && err == nil {
+				t.Fatalf("expected to return an error, but no error, got: %d", got)
+			}
+			if got != tc.want {
+				t.Errorf("got: %d, want: %d", got, tc.want)
+			}
+		})
+	}
+}
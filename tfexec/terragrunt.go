@@ -0,0 +1,194 @@
+package tfexec
+
+import (
+	"bytes"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+)
+
+const (
+	// DefaultTerragruntExecPath is a default command to run terraform via
+	// Terragrunt, which is followed by arguments of terraform command.
+	// It requires Terragrunt v0.73.0 or higher.
+	DefaultTerragruntExecPath = "terragrunt run --"
+	// DefaultTerragruntCacheDir is a default directory where Terragrunt
+	// downloads a terraform configuration specified in the source attribute.
+	DefaultTerragruntCacheDir = ".terragrunt-cache"
+	// DefaultTerragruntConfigFile is a default name of the Terragrunt
+	// configuration file.
+	DefaultTerragruntConfigFile = "terragrunt.hcl"
+
+	// terragruntSignature is a prefix of files generated by Terragrunt.
+	terragruntSignature = "# Generated by Terragrunt"
+)
+
+// terragruntBackendRe matches a backend block in a file generated by the
+// generate attribute of the remote_state block.
+var terragruntBackendRe = regexp.MustCompile(`(?m)^\s*backend\s+"[^"]+"`)
+
+// Terragrunt is a config to run terraform commands via Terragrunt.
+// Terragrunt runs terraform in a directory in the cache if the source
+// attribute is set, so the override file must be placed there instead of the
+// directory which contains the Terragrunt configuration file.
+type Terragrunt struct {
+	// ExecPath is a string how terragrunt command is executed, which is
+	// followed by arguments of terraform command.
+	// Default to `terragrunt run --`. For Terragrunt < v0.73.0, set it to
+	// `terragrunt`.
+	ExecPath string
+	// CacheDir is a directory where Terragrunt downloads a terraform
+	// configuration. A relative path is resolved against each working dir.
+	// Default to `.terragrunt-cache`.
+	CacheDir string
+	// ConfigFile is a name of the Terragrunt configuration file, which must
+	// exist in each working dir. Default to `terragrunt.hcl`.
+	ConfigFile string
+}
+
+// NewTerragrunt returns a new Terragrunt instance.
+// Empty arguments are set to the default values.
+func NewTerragrunt(execPath string, cacheDir string, configFile string) *Terragrunt {
+	if len(execPath) == 0 {
+		execPath = DefaultTerragruntExecPath
+	}
+	if len(cacheDir) == 0 {
+		cacheDir = DefaultTerragruntCacheDir
+	}
+	if len(configFile) == 0 {
+		configFile = DefaultTerragruntConfigFile
+	}
+	return &Terragrunt{
+		ExecPath:   execPath,
+		CacheDir:   cacheDir,
+		ConfigFile: configFile,
+	}
+}
+
+// cacheDirFor returns a path of the cache dir for a given working dir.
+func (t *Terragrunt) cacheDirFor(dir string) string {
+	cacheDir := t.CacheDir
+	if !filepath.IsAbs(cacheDir) {
+		cacheDir = filepath.Join(dir, cacheDir)
+	}
+	// The cache dir is passed to terragrunt running in the dir, so it should
+	// be absolute. If it fails, the relative path still works.
+	if abs, err := filepath.Abs(cacheDir); err == nil {
+		return abs
+	}
+	return cacheDir
+}
+
+// IsolatedExclude returns a name of an entry in a root module which must not
+// be shared with an isolated work dir, because Terragrunt downloads a
+// terraform configuration into it. If the cache dir is absolute, the default
+// name is returned, because the cache dir is moved to it in the isolated work
+// dir. See also Isolated.
+func (t *Terragrunt) IsolatedExclude() string {
+	if filepath.IsAbs(t.CacheDir) {
+		return DefaultTerragruntCacheDir
+	}
+	return strings.Split(filepath.ToSlash(filepath.Clean(t.CacheDir)), "/")[0]
+}
+
+// Isolated returns a copy of the config whose cache dir is in a given
+// isolated work dir, so that Terragrunt never downloads into the original
+// directory. A relative cache dir is resolved against the isolated work dir,
+// and an absolute one is replaced with the default name in it.
+func (t *Terragrunt) Isolated(workDir string) *Terragrunt {
+	cacheDir := t.CacheDir
+	if filepath.IsAbs(cacheDir) {
+		cacheDir = DefaultTerragruntCacheDir
+	}
+	return &Terragrunt{
+		ExecPath:   t.ExecPath,
+		CacheDir:   filepath.Join(workDir, cacheDir),
+		ConfigFile: t.ConfigFile,
+	}
+}
+
+// env returns environment variables for terragrunt running in a given dir.
+// They make terragrunt use the cache dir and never prompt. Both the current
+// and legacy names are set to support a wide range of Terragrunt versions.
+func (t *Terragrunt) env(dir string) map[string]string {
+	cacheDir := t.cacheDirFor(dir)
+	return map[string]string{
+		"TG_DOWNLOAD_DIR":            cacheDir,
+		"TERRAGRUNT_DOWNLOAD":        cacheDir,
+		"TG_NON_INTERACTIVE":         "true",
+		"TERRAGRUNT_NON_INTERACTIVE": "true",
+	}
+}
+
+// checkConfigFile returns an error if the Terragrunt configuration file
+// doesn't exist in a given dir.
+func (t *Terragrunt) checkConfigFile(dir string) error {
+	path := filepath.Join(dir, t.ConfigFile)
+	if _, err := os.Stat(path); err != nil {
+		return fmt.Errorf("failed to find a Terragrunt configuration file %s: %s", path, err)
+	}
+	return nil
+}
+
+// FindWorkDir returns a directory where Terragrunt runs terraform for a given
+// working dir, that is, where the generated backend file exists. If the cache
+// dir doesn't exist, Terragrunt runs terraform in the given dir. Otherwise, it
+// returns a directory in the cache which contains the most recently generated
+// backend file. It must be called after terragrunt init.
+func (t *Terragrunt) FindWorkDir(dir string) (string, error) {
+	cacheDir := t.cacheDirFor(dir)
+	if _, err := os.Stat(cacheDir); err != nil {
+		if os.IsNotExist(err) {
+			return dir, nil
+		}
+		return "", err
+	}
+
+	var found string
+	var foundModTime time.Time
+	err := filepath.WalkDir(cacheDir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			// skip provider plugins and modules installed by terraform init.
+			if d.Name() == ".terraform" {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if filepath.Ext(path) != ".tf" {
+			return nil
+		}
+
+		b, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		if !bytes.HasPrefix(b, []byte(terragruntSignature)) || !terragruntBackendRe.Match(b) {
+			return nil
+		}
+
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		if len(found) == 0 || info.ModTime().After(foundModTime) {
+			found = filepath.Dir(path)
+			foundModTime = info.ModTime()
+		}
+		return nil
+	})
+	if err != nil {
+		return "", fmt.Errorf("failed to search the Terragrunt cache dir %s: %s", cacheDir, err)
+	}
+
+	if len(found) == 0 {
+		return "", fmt.Errorf("failed to find a backend file generated by Terragrunt in %s. The remote_state block must have the generate attribute", cacheDir)
+	}
+	return found, nil
+}
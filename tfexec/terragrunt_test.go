@@ -0,0 +1,198 @@
+package tfexec
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestTerragruntFindWorkDir(t *testing.T) {
+	generated := "# Generated by Terragrunt. Sig: nIlQXj57tbuaRZEa\nterraform {\n  backend \"s3\" {}\n}\n"
+	cases := []struct {
+		desc  string
+		files map[string]string
+		// want is a path relative to the dir.
+		want string
+		ok   bool
+	}{
+		{
+			desc:  "no cache dir",
+			files: map[string]string{"terragrunt.hcl": ""},
+			want:  ".",
+			ok:    true,
+		},
+		{
+			desc: "generated backend in cache",
+			files: map[string]string{
+				"terragrunt.hcl":                       "",
+				".terragrunt-cache/abc/def/main.tf":    "resource \"null_resource\" \"foo\" {}\n",
+				".terragrunt-cache/abc/def/backend.tf": generated,
+				// a backend in a module installed by terraform init is ignored.
+				".terragrunt-cache/abc/def/.terraform/modules/foo/backend.tf": generated,
+			},
+			want: ".terragrunt-cache/abc/def",
+			ok:   true,
+		},
+		{
+			desc: "not generated by terragrunt",
+			files: map[string]string{
+				"terragrunt.hcl":                       "",
+				".terragrunt-cache/abc/def/backend.tf": "terraform {\n  backend \"s3\" {}\n}\n",
+			},
+			want: "",
+			ok:   false,
+		},
+		{
+			desc: "generated without backend",
+			files: map[string]string{
+				"terragrunt.hcl":                        "",
+				".terragrunt-cache/abc/def/provider.tf": "# Generated by Terragrunt. Sig: nIlQXj57tbuaRZEa\nprovider \"null\" {}\n",
+			},
+			want: "",
+			ok:   false,
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.desc, func(t *testing.T) {
+			dir := t.TempDir()
+			for name, contents := range tc.files {
+				path := filepath.Join(dir, name)
+				if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+					t.Fatalf("failed to create dir: %s", err)
+				}
+				if err := os.WriteFile(path, []byte(contents), 0600); err != nil {
+					t.Fatalf("failed to write file: %s", err)
+				}
+			}
+
+			got, err := NewTerragrunt("", "", "").FindWorkDir(dir)
+			if tc.ok && err != nil {
+				t.Fatalf("unexpected err: %s", err)
+			}
+			if !tc.ok && err == nil {
+				t.Fatalf("expected to return an error, but no error, got: %s", got)
+			}
+			if tc.ok && got != filepath.Join(dir, tc.want) {
+				t.Errorf("got = %s, want = %s", got, filepath.Join(dir, tc.want))
+			}
+		})
+	}
+}
+
+func TestTerragruntFindWorkDirLatest(t *testing.T) {
+	dir := t.TempDir()
+	old := filepath.Join(dir, ".terragrunt-cache", "old", "backend.tf")
+	latest := filepath.Join(dir, ".terragrunt-cache", "latest", "backend.tf")
+	for _, path := range []string{old, latest} {
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatalf("failed to create dir: %s", err)
+		}
+		if err := os.WriteFile(path, []byte("# Generated by Terragrunt\nterraform {\n  backend \"local\" {}\n}\n"), 0600); err != nil {
+			t.Fatalf("failed to write file: %s", err)
+		}
+	}
+	past := time.Now().Add(-1 * time.Hour)
+	if err := os.Chtimes(old, past, past); err != nil {
+		t.Fatalf("failed to change times: %s", err)
+	}
+
+	got, err := NewTerragrunt("", "", "").FindWorkDir(dir)
+	if err != nil {
+		t.Fatalf("unexpected err: %s", err)
+	}
+	if want := filepath.Dir(latest); got != want {
+		t.Errorf("got = %s, want = %s", got, want)
+	}
+}
+
+func TestTerraformCLIRunTerragrunt(t *testing.T) {
+	cases := []struct {
+		desc       string
+		configFile string
+		want       string
+		ok         bool
+	}{
+		{
+			desc:       "run via terragrunt",
+			configFile: "terragrunt.hcl",
+			want:       "plan true\n",
+			ok:         true,
+		},
+		{
+			desc:       "no config file",
+			configFile: "",
+			want:       "",
+			ok:         false,
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.desc, func(t *testing.T) {
+			dir := t.TempDir()
+			if len(tc.configFile) > 0 {
+				if err := os.WriteFile(filepath.Join(dir, tc.configFile), []byte{}, 0600); err != nil {
+					t.Fatalf("failed to write file: %s", err)
+				}
+			}
+
+			terraformCLI := NewTerraformCLI(NewExecutor(dir, os.Environ()))
+			// The script prints the terraform subcommand passed as $0 and the
+			// non-interactive setting.
+			terraformCLI.SetTerragrunt(NewTerragrunt("/bin/sh -c 'echo $0 $TG_NON_INTERACTIVE'", "", ""))
+
+			got, _, err := terraformCLI.Run(context.Background(), "plan")
+			if tc.ok && err != nil {
+				t.Fatalf("unexpected err: %s", err)
+			}
+			if !tc.ok && err == nil {
+				t.Fatalf("expected to return an error, but no error, got: %s", got)
+			}
+			if got != tc.want {
+				t.Errorf("got = %q, want = %q", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestTerragruntIsolated(t *testing.T) {
+	cases := []struct {
+		desc        string
+		cacheDir    string
+		wantExclude string
+		want        string
+	}{
+		{
+			desc:        "default",
+			cacheDir:    "",
+			wantExclude: ".terragrunt-cache",
+			want:        "/tmp/work/.terragrunt-cache",
+		},
+		{
+			desc:        "nested relative path",
+			cacheDir:    "./tmp/cache",
+			wantExclude: "tmp",
+			want:        "/tmp/work/tmp/cache",
+		},
+		{
+			desc:        "absolute path",
+			cacheDir:    "/var/cache/terragrunt",
+			wantExclude: ".terragrunt-cache",
+			want:        "/tmp/work/.terragrunt-cache",
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.desc, func(t *testing.T) {
+			tg := NewTerragrunt("", tc.cacheDir, "")
+			if got := tg.IsolatedExclude(); got != tc.wantExclude {
+				t.Errorf("got exclude: %s, want: %s", got, tc.wantExclude)
+			}
+			if got := tg.Isolated("/tmp/work").cacheDirFor("/tmp/work"); got != tc.want {
+				t.Errorf("got cache dir: %s, want: %s", got, tc.want)
+			}
+		})
+	}
+}
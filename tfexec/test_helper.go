@@ -288,6 +288,55 @@ terraform {
 	return backendConfig
 }
 
+// TestStateEncryptionPassphrase is a passphrase of the local key provider for
+// OpenTofu state encryption in acceptance testing.
+const TestStateEncryptionPassphrase = "tfmigrate-test-passphrase"
+
+// GetTestAccStateEncryptionConfig returns a terraform block which encrypts
+// states with a local passphrase key provider for OpenTofu v1.7+.
+// If allowUnencrypted is true, an unencrypted state can also be read, which
+// is required to migrate an existing state to encrypted one.
+func GetTestAccStateEncryptionConfig(allowUnencrypted bool) string {
+	fallback := ""
+	if allowUnencrypted {
+		fallback = `
+      fallback {
+        method = method.unencrypted.migrate
+      }`
+	}
+
+	return fmt.Sprintf(`
+terraform {
+  encryption {
+    key_provider "pbkdf2" "test" {
+      passphrase = "%s"
+    }
+    method "aes_gcm" "test" {
+      keys = key_provider.pbkdf2.test
+    }
+    method "unencrypted" "migrate" {}
+    state {
+      method = method.aes_gcm.test%s
+    }
+  }
+}
+`, TestStateEncryptionPassphrase, fallback)
+}
+
+// SkipUnlessStateEncryptionSupported skips tests unless OpenTofu v1.7+ is
+// used, which supports state encryption.
+func SkipUnlessStateEncryptionSupported(t *testing.T) {
+	t.Helper()
+	tf := NewTerraformCLI(NewExecutor("", os.Environ()))
+	execType, v, err := tf.Version(context.Background())
+	if err != nil {
+		t.Fatalf("failed to get terraform version: %s", err)
+	}
+	if execType != "opentofu" || v.LessThan(version.Must(version.NewVersion("1.7.0"))) {
+		t.Skipf("skip tests for state encryption with %s v%s", execType, v)
+	}
+}
+
 // SetupTestAccForStateReplaceProvider is an acceptance test helper specifically
 // for initializing a temporary work directory with a given source for the
 // purposes of testing `state replace-provider` actions.
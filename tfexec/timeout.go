@@ -0,0 +1,97 @@
+package tfexec
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// Timeouts is a set of timeouts for classes of terraform subcommands.
+// A zero value means no timeout.
+type Timeouts struct {
+	// Init is a timeout for terraform init.
+	Init time.Duration
+	// Plan is a timeout for terraform plan.
+	Plan time.Duration
+	// State is a timeout for state operations except for state push, such as
+	// state pull, state mv, import and workspace commands.
+	State time.Duration
+	// Push is a timeout for terraform state push.
+	Push time.Duration
+}
+
+// TimeoutError is an error returned when a terraform command or a whole
+// migration doesn't finish within a timeout. It's also set as a cause of
+// context cancellation, so that the running command is interrupted.
+type TimeoutError struct {
+	// Target is a description of what timed out, such as "terraform init".
+	Target string
+	// Timeout is the exceeded timeout.
+	Timeout time.Duration
+	// Err is an underlying error returned by the interrupted command if any.
+	Err error
+}
+
+// Error returns a string useful for displaying error messages.
+func (e *TimeoutError) Error() string {
+	if e.Err != nil {
+		return fmt.Sprintf("%s timed out after %s: %s", e.Target, e.Timeout, e.Err)
+	}
+	return fmt.Sprintf("%s timed out after %s", e.Target, e.Timeout)
+}
+
+// Unwrap returns the underlying error.
+func (e *TimeoutError) Unwrap() error {
+	return e.Err
+}
+
+// timeoutFor returns a timeout and a description of a class for given
+// arguments of terraform command. It returns zero if no timeout is set for
+// the class.
+func (t Timeouts) timeoutFor(args []string) (time.Duration, string) {
+	subcommand := subcommandOf(args)
+	if len(subcommand) == 0 {
+		return 0, ""
+	}
+
+	switch subcommand[0] {
+	case "init":
+		return t.Init, "terraform init"
+	case "plan":
+		return t.Plan, "terraform plan"
+	case "import", "workspace":
+		return t.State, "terraform " + subcommand[0]
+	case "state":
+		if len(subcommand) == 2 && subcommand[1] == "push" {
+			return t.Push, "terraform state push"
+		}
+		return t.State, "terraform state"
+	default:
+		return 0, ""
+	}
+}
+
+// withCommandTimeout returns a context which is canceled with a TimeoutError
+// when the timeout for given arguments is exceeded. If no timeout is set, it
+// returns a given context as it is.
+func (t Timeouts) withCommandTimeout(ctx context.Context, args []string) (context.Context, context.CancelFunc) {
+	timeout, target := t.timeoutFor(args)
+	if timeout <= 0 {
+		return ctx, func() {}
+	}
+	return context.WithTimeoutCause(ctx, timeout, &TimeoutError{Target: target, Timeout: timeout})
+}
+
+// timeoutError returns a TimeoutError wrapping a given error if a given
+// context has been canceled by a timeout, otherwise the error as it is.
+func timeoutError(ctx context.Context, err error) error {
+	if err == nil {
+		return nil
+	}
+	var timeoutErr *TimeoutError
+	if errors.As(context.Cause(ctx), &timeoutErr) {
+		return &TimeoutError{Target: timeoutErr.Target, Timeout: timeoutErr.Timeout, Err: err}
+	}
+	return err
+}
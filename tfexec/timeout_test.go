@@ -0,0 +1,77 @@
+package tfexec
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestTimeoutsTimeoutFor(t *testing.T) {
+	timeouts := Timeouts{
+		Init:  1 * time.Minute,
+		Plan:  2 * time.Minute,
+		State: 3 * time.Minute,
+		Push:  4 * time.Minute,
+	}
+
+	cases := []struct {
+		args       []string
+		wantTarget string
+		want       time.Duration
+	}{
+		{args: []string{"init", "-input=false"}, wantTarget: "terraform init", want: 1 * time.Minute},
+		{args: []string{"plan", "-state=foo"}, wantTarget: "terraform plan", want: 2 * time.Minute},
+		{args: []string{"state", "pull"}, wantTarget: "terraform state", want: 3 * time.Minute},
+		{args: []string{"state", "mv", "-state=foo", "a", "b"}, wantTarget: "terraform state", want: 3 * time.Minute},
+		{args: []string{"workspace", "select", "foo"}, wantTarget: "terraform workspace", want: 3 * time.Minute},
+		{args: []string{"import", "foo", "bar"}, wantTarget: "terraform import", want: 3 * time.Minute},
+		{args: []string{"state", "push", "foo"}, wantTarget: "terraform state push", want: 4 * time.Minute},
+		{args: []string{"version"}, wantTarget: "", want: 0},
+		{args: []string{}, wantTarget: "", want: 0},
+	}
+
+	for _, tc := range cases {
+		got, gotTarget := timeouts.timeoutFor(tc.args)
+		if got != tc.want || gotTarget != tc.wantTarget {
+			t.Errorf("timeoutFor(%v) = (%s, %s), want = (%s, %s)", tc.args, got, gotTarget, tc.want, tc.wantTarget)
+		}
+	}
+}
+
+func TestTerraformCLIRunTimeout(t *testing.T) {
+	cases := []struct {
+		desc     string
+		timeouts Timeouts
+		timeout  bool
+	}{
+		{
+			desc:     "timed out",
+			timeouts: Timeouts{Plan: 200 * time.Millisecond},
+			timeout:  true,
+		},
+		{
+			desc:     "no timeout for the class",
+			timeouts: Timeouts{Init: 200 * time.Millisecond},
+			timeout:  false,
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.desc, func(t *testing.T) {
+			// The script ignores the subcommand passed as $0 and sleeps.
+			terraformCLI := NewTerraformCLI(NewExecutor(".", nil))
+			terraformCLI.SetExecPath("/bin/sh -c 'sleep 1'")
+			terraformCLI.SetTimeouts(tc.timeouts)
+
+			_, _, err := terraformCLI.Run(context.Background(), "plan")
+			var timeoutErr *TimeoutError
+			if got := errors.As(err, &timeoutErr); got != tc.timeout {
+				t.Fatalf("got a timeout error: %t, want: %t, err: %v", got, tc.timeout, err)
+			}
+			if tc.timeout && timeoutErr.Target != "terraform plan" {
+				t.Errorf("got target: %s, want: terraform plan", timeoutErr.Target)
+			}
+		})
+	}
+}
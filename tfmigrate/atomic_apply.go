@@ -0,0 +1,214 @@
+package tfmigrate
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"strconv"
+
+	"github.com/minamijoyo/tfmigrate/tfexec"
+)
+
+// Lock acquires locks of all remote states registered in the chain, and
+// returns a function to release them. It's intended to hold the locks from
+// planning all the migrations until pushing the new states in atomic apply.
+func (c *PlanChain) Lock(ctx context.Context, o *MigratorOption) (func(context.Context) error, error) {
+	unlocks := []func(context.Context) error{}
+	unlockAll := func(ctx context.Context) error {
+		var errs []error
+		for i := len(unlocks) - 1; i >= 0; i-- {
+			errs = append(errs, unlocks[i](ctx))
+		}
+		return errors.Join(errs...)
+	}
+
+	for _, t := range c.targets {
+		unlock, err := lockState(ctx, o, t.dir, t.workspace)
+		if err != nil {
+			return nil, errors.Join(err, unlockAll(context.WithoutCancel(ctx)))
+		}
+		unlocks = append(unlocks, unlock)
+	}
+	return unlockAll, nil
+}
+
+// chainResult is a pair of a remote state pulled before the first migration
+// and a new state computed by the last migration for a given state target.
+type chainResult struct {
+	stateTarget
+	chainOrigin
+	newState *tfexec.State
+}
+
+// results returns computed states in order of registration.
+// It returns an error if any state has not been planned yet.
+func (c *PlanChain) results() ([]chainResult, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	results := make([]chainResult, 0, len(c.targets))
+	for _, t := range c.targets {
+		key := planChainKey(t.dir, t.workspace)
+		origin, ok := c.origins[key]
+		newState, computed := c.states[key]
+		if !ok || !computed || c.remaining[key] != 0 {
+			return nil, fmt.Errorf("the state in %s (workspace: %s) has not been planned yet", t.dir, t.workspace)
+		}
+		results = append(results, chainResult{stateTarget: t, chainOrigin: origin, newState: newState})
+	}
+	return results, nil
+}
+
+// Push pushes the new states computed by all the migrations in the chain to
+// remote. It must be called after all the migrations have been planned
+// successfully. Before pushing any state, it checks that no remote state has
+// been changed since planning and backs up the remote states. If pushing a
+// state fails, it restores the states already pushed to the ones pulled
+// before the first migration on a best-effort basis.
+func (c *PlanChain) Push(ctx context.Context, o *MigratorOption) (err error) {
+	results, err := c.results()
+	if err != nil {
+		return err
+	}
+
+	// prepare all work dirs before pushing any state.
+	tfs := make([]tfexec.TerraformCLI, len(results))
+	for i, r := range results {
+		ctx := logContext(ctx, r.dir, r.workspace)
+		tf := newTerraformCLI(o, r.dir, os.Environ())
+
+		tf, cleanup, isolateErr := isolateWorkDir(ctx, o, tf, r.dir)
+		if isolateErr != nil {
+			return isolateErr
+		}
+		// remove the isolated work dir on exit.
+		defer func() {
+			err = errors.Join(err, cleanup())
+		}()
+
+		if err := initRemoteWorkDir(ctx, tf, r.workspace, o); err != nil {
+			return err
+		}
+
+		// make sure that no one has changed the remote state since we pulled it.
+		if err := checkRemoteStateUnchanged(ctx, tf, r.state); err != nil {
+			return err
+		}
+		tfs[i] = tf
+	}
+
+	for _, r := range results {
+		for _, b := range r.backups {
+			if err := backupState(ctx, &MigratorOption{Backup: b}, r.dir, r.workspace, r.state); err != nil {
+				return err
+			}
+		}
+	}
+
+	// push the new states to remote unless canceled.
+	if err := checkNotCanceled(ctx); err != nil {
+		return err
+	}
+	pushCtx := context.WithoutCancel(ctx)
+	for i, r := range results {
+		ctx := logContext(pushCtx, r.dir, r.workspace)
+		slog.InfoContext(ctx, "push the new state to remote")
+		if err := tfs[i].StatePush(ctx, r.newState); err != nil {
+			slog.ErrorContext(ctx, "failed to push the new state", "error", err)
+			pushErr := fmt.Errorf("failed to push the new state in %s (workspace: %s): %w", r.dir, r.workspace, err)
+			return errors.Join(pushErr, restorePushedStates(pushCtx, tfs[:i], results[:i]))
+		}
+	}
+
+	return nil
+}
+
+// restorePushedStates pushes back the remote states pulled before the first
+// migration in reverse order. It tries all of them even if some fail.
+func restorePushedStates(ctx context.Context, tfs []tfexec.TerraformCLI, results []chainResult) error {
+	var errs []error
+	for i := len(results) - 1; i >= 0; i-- {
+		r := results[i]
+		ctx := logContext(ctx, r.dir, r.workspace)
+		if len(r.state.Bytes()) == 0 {
+			// No state existed before the migration. Since a state can't be
+			// deleted by terraform state push, push an empty state instead.
+			slog.WarnContext(ctx, "restore the state before the migration by removing all resources")
+			if err := pushEmptyState(ctx, tfs[i], r.newState); err != nil {
+				slog.ErrorContext(ctx, "failed to restore the state. The remote state may be inconsistent", "error", err)
+				errs = append(errs, fmt.Errorf("failed to restore the state in %s (workspace: %s) which didn't exist before the migration, remove all resources from it manually: %s", r.dir, r.workspace, err))
+			}
+			continue
+		}
+
+		// The serial of the original state is lower than the pushed one,
+		// so we need to force push it.
+		slog.WarnContext(ctx, "restore the state before the migration")
+		if err := tfs[i].StatePush(ctx, r.state, "-force"); err != nil {
+			slog.ErrorContext(ctx, "failed to restore the state. The remote state may be inconsistent", "error", err)
+			errs = append(errs, fmt.Errorf("failed to restore the state in %s (workspace: %s): %s", r.dir, r.workspace, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// pushEmptyState pushes a state without any resources and outputs in place of
+// a given state pushed to remote. The empty state has the same lineage and a
+// higher serial, so it can be pushed without -force.
+func pushEmptyState(ctx context.Context, tf tfexec.TerraformCLI, pushed *tfexec.State) error {
+	empty, err := emptyStateOf(pushed)
+	if err != nil {
+		return err
+	}
+	return tf.StatePush(ctx, empty)
+}
+
+// emptyStateOf returns a state without any resources and outputs derived
+// from a given state, whose serial is incremented.
+func emptyStateOf(state *tfexec.State) (*tfexec.State, error) {
+	serial, err := state.Serial()
+	if err != nil {
+		return nil, err
+	}
+
+	// Keep unknown top-level attributes such as version and lineage as they are.
+	var m map[string]json.RawMessage
+	if err := json.Unmarshal(state.Bytes(), &m); err != nil {
+		return nil, fmt.Errorf("failed to parse state: %s", err)
+	}
+	m["serial"] = json.RawMessage(strconv.FormatUint(serial+1, 10))
+	m["resources"] = json.RawMessage("[]")
+	m["outputs"] = json.RawMessage("{}")
+	delete(m, "check_results")
+
+	b, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	return tfexec.NewState(b), nil
+}
+
+// initRemoteWorkDir is a helper function to initialize work dir with the
+// remote backend and switch to a given workspace.
+// The dir is expected to be set in the context for logging.
+func initRemoteWorkDir(ctx context.Context, tf tfexec.TerraformCLI, workspace string, o *MigratorOption) error {
+	slog.InfoContext(ctx, "initialize work dir")
+	if err := tf.Init(ctx, remoteInitArgs(o)...); err != nil {
+		return err
+	}
+
+	currentWorkspace, err := tf.WorkspaceShow(ctx)
+	if err != nil {
+		return err
+	}
+	if currentWorkspace != workspace {
+		slog.InfoContext(ctx, "switch to remote workspace")
+		if err := tf.WorkspaceSelect(ctx, workspace); err != nil {
+			return err
+		}
+	}
+	return nil
+}
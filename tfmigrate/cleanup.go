@@ -0,0 +1,306 @@
+package tfmigrate
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sort"
+
+	"github.com/minamijoyo/tfmigrate/logging"
+	"github.com/minamijoyo/tfmigrate/tfexec"
+)
+
+// MigrationDirs returns a list of working directories referenced by a given
+// migration.
+func MigrationDirs(mc *MigrationConfig) ([]string, error) {
+	targets, err := stateTargets(mc)
+	if err != nil {
+		return nil, err
+	}
+
+	dirs := []string{}
+	for _, t := range targets {
+		dirs = append(dirs, t.dir)
+	}
+	return dirs, nil
+}
+
+// CleanupWorkDir removes artifacts left in a given dir by a migration which
+// has been killed, that is, the override file and the local workspace
+// folders created for switching the backend to local, and re-initializes the
+// dir with the remote backend. It returns false if nothing is left.
+//
+// A local state in a workspace folder may have been written during the
+// migration, so unless force is true, it refuses to remove a local state
+// which is newer than the remote state or has a different lineage. It also
+// refuses to remove local states without the override file, because the
+// workspace folders may be used by the local backend. The override file is
+// kept until the check passes, so that cleanup can be re-run after pushing
+// the local state manually.
+func CleanupWorkDir(ctx context.Context, dir string, o *MigratorOption, force bool) (bool, error) {
+	ctx = logging.With(ctx, "component", "cleanup", "dir", dir)
+
+	// Terragrunt may run terraform in its cache dir, where the override file
+	// has been placed.
+	workDir := dir
+	if o != nil && o.Terragrunt != nil {
+		var err error
+		workDir, err = o.Terragrunt.FindWorkDir(dir)
+		if err != nil {
+			return false, err
+		}
+	}
+	overridePath := filepath.Join(workDir, overrideFileName)
+	asidePath := overridePath + overrideAsideSuffix
+	workspacesPath := filepath.Join(workDir, "terraform.tfstate.d")
+
+	// An override file moved aside is left if the previous cleanup has been
+	// killed before checking the local states.
+	if err := restoreAsideFile(asidePath, overridePath); err != nil {
+		return false, err
+	}
+	hasOverride, err := fileExists(overridePath)
+	if err != nil {
+		return false, err
+	}
+	hasWorkspaces, err := fileExists(workspacesPath)
+	if err != nil {
+		return false, err
+	}
+	if !hasOverride && !hasWorkspaces {
+		slog.InfoContext(ctx, "nothing to clean up")
+		return false, nil
+	}
+
+	localStates, err := loadLocalStates(workspacesPath)
+	if err != nil {
+		return false, err
+	}
+	if !hasOverride && len(localStates) > 0 && !force {
+		return false, fmt.Errorf("found local states in %s without %s. They may be used by the local backend. If you are sure that they are left by tfmigrate, re-run with --force", workspacesPath, overrideFileName)
+	}
+
+	// Move the override file aside instead of removing it until the local
+	// states are checked against the remote states, so that cleanup can be
+	// re-run without --force if the check fails.
+	if hasOverride {
+		slog.InfoContext(ctx, "move the override file aside")
+		if err := os.Rename(overridePath, asidePath); err != nil {
+			return false, err
+		}
+	}
+
+	tf := newTerraformCLI(o, dir, os.Environ())
+	if err := switchBackAndCheckLocalStates(ctx, tf, o, localStates, force); err != nil {
+		if hasOverride {
+			return false, errors.Join(err, restoreOverrideFile(context.WithoutCancel(ctx), tf, asidePath, overridePath))
+		}
+		return false, err
+	}
+
+	if hasOverride {
+		slog.InfoContext(ctx, "remove the override file")
+		if err := os.Remove(asidePath); err != nil {
+			return false, err
+		}
+	}
+
+	slog.InfoContext(ctx, "remove the workspace state folder")
+	if err := os.RemoveAll(workspacesPath); err != nil {
+		return false, err
+	}
+
+	return true, nil
+}
+
+// overrideAsideSuffix is a suffix of the override file moved aside during
+// cleanup. terraform ignores it, because it doesn't end with .tf.
+const overrideAsideSuffix = ".cleanup"
+
+// switchBackAndCheckLocalStates switches the backend back to remote and checks
+// that given local states are not newer than the remote states.
+func switchBackAndCheckLocalStates(ctx context.Context, tf tfexec.TerraformCLI, o *MigratorOption, localStates map[string]*tfexec.State, force bool) error {
+	slog.InfoContext(ctx, "switch back to remote")
+	if err := tf.Init(ctx, remoteInitArgs(o)...); err != nil {
+		return fmt.Errorf("failed to switch back to remote in %s: %s", tf.Dir(), err)
+	}
+
+	return checkLocalStatesNotNewer(ctx, tf, localStates, force)
+}
+
+// restoreOverrideFile moves the override file back and switches the backend
+// back to local, so that the work dir is left as it was before cleanup.
+func restoreOverrideFile(ctx context.Context, tf tfexec.TerraformCLI, asidePath string, overridePath string) error {
+	slog.InfoContext(ctx, "move the override file back")
+	if err := os.Rename(asidePath, overridePath); err != nil {
+		return fmt.Errorf("failed to move the override file back. Rename %s to %s manually: %s", asidePath, overridePath, err)
+	}
+
+	slog.InfoContext(ctx, "switch backend to local")
+	if err := tf.Init(ctx, "-input=false", "-no-color", "-reconfigure"); err != nil {
+		return fmt.Errorf("failed to switch backend back to local in %s. Re-run terraform init -reconfigure: %s", tf.Dir(), err)
+	}
+	return nil
+}
+
+// restoreAsideFile moves a given file moved aside back to a given path if
+// any, unless the path already exists.
+func restoreAsideFile(asidePath string, path string) error {
+	hasAside, err := fileExists(asidePath)
+	if err != nil || !hasAside {
+		return err
+	}
+	exists, err := fileExists(path)
+	if err != nil {
+		return err
+	}
+	if exists {
+		return os.Remove(asidePath)
+	}
+	return os.Rename(asidePath, path)
+}
+
+// fileExists returns true if a given file or directory exists.
+func fileExists(path string) (bool, error) {
+	_, err := os.Stat(path)
+	if err == nil {
+		return true, nil
+	}
+	if os.IsNotExist(err) {
+		return false, nil
+	}
+	return false, err
+}
+
+// loadLocalStates reads non-empty local states in workspace folders under a
+// given terraform.tfstate.d directory and returns them keyed by workspace.
+func loadLocalStates(workspacesPath string) (map[string]*tfexec.State, error) {
+	states := make(map[string]*tfexec.State)
+
+	entries, err := os.ReadDir(workspacesPath)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return states, nil
+		}
+		return nil, err
+	}
+
+	for _, e := range entries {
+		if !e.IsDir() {
+			continue
+		}
+		b, err := os.ReadFile(filepath.Join(workspacesPath, e.Name(), "terraform.tfstate"))
+		if err != nil {
+			if os.IsNotExist(err) {
+				continue
+			}
+			return nil, err
+		}
+		if len(b) == 0 {
+			continue
+		}
+		states[e.Name()] = tfexec.NewState(b)
+	}
+	return states, nil
+}
+
+// remoteInitArgs returns arguments of terraform init to switch the backend
+// back to remote.
+func remoteInitArgs(o *MigratorOption) []string {
+	args := []string{"-input=false", "-no-color"}
+	if o == nil {
+		return append(args, "-reconfigure")
+	}
+
+	for _, b := range o.BackendConfig {
+		args = append(args, fmt.Sprintf("-backend-config=%s", b))
+	}
+	// Terraform Cloud doesn't support the -reconfigure flag.
+	if !o.IsBackendTerraformCloud {
+		args = append(args, "-reconfigure")
+	}
+	return args
+}
+
+// checkLocalStatesNotNewer compares given local states with the remote states
+// of each workspace and returns an error if any local state may be lost by
+// removing it. If force is true, it only logs a warning.
+func checkLocalStatesNotNewer(ctx context.Context, tf tfexec.TerraformCLI, localStates map[string]*tfexec.State, force bool) error {
+	if len(localStates) == 0 {
+		return nil
+	}
+
+	currentWorkspace, err := tf.WorkspaceShow(ctx)
+	if err != nil {
+		return err
+	}
+
+	workspaces := make([]string, 0, len(localStates))
+	for workspace := range localStates {
+		workspaces = append(workspaces, workspace)
+	}
+	sort.Strings(workspaces)
+
+	for _, workspace := range workspaces {
+		if err := tf.WorkspaceSelect(ctx, workspace); err != nil {
+			return err
+		}
+		remote, err := tf.StatePull(ctx)
+		if err != nil {
+			return err
+		}
+
+		newer, err := isLocalStateNewer(localStates[workspace], remote)
+		if err != nil {
+			return err
+		}
+		if !newer {
+			continue
+		}
+
+		if !force {
+			// restore the original workspace before return an error.
+			if serr := tf.WorkspaceSelect(ctx, currentWorkspace); serr != nil {
+				slog.ErrorContext(ctx, "failed to switch back to workspace", "workspace", currentWorkspace, "error", serr)
+			}
+			return fmt.Errorf("the local state of workspace %s in %s is newer than the remote state or has a different lineage. Push it to remote manually, or re-run with --force to discard it", workspace, tf.Dir())
+		}
+		slog.WarnContext(ctx, "discard the local state which is newer than the remote state", "workspace", workspace)
+	}
+
+	return tf.WorkspaceSelect(ctx, currentWorkspace)
+}
+
+// isLocalStateNewer returns true if a given local state has a different
+// lineage from the remote state or a greater serial.
+func isLocalStateNewer(local *tfexec.State, remote *tfexec.State) (bool, error) {
+	// The remote state may be empty if it has never been written.
+	if len(remote.Bytes()) == 0 {
+		return true, nil
+	}
+
+	localLineage, err := local.Lineage()
+	if err != nil {
+		return false, err
+	}
+	remoteLineage, err := remote.Lineage()
+	if err != nil {
+		return false, err
+	}
+	if localLineage != remoteLineage {
+		return true, nil
+	}
+
+	localSerial, err := local.Serial()
+	if err != nil {
+		return false, err
+	}
+	remoteSerial, err := remote.Serial()
+	if err != nil {
+		return false, err
+	}
+	return localSerial > remoteSerial, nil
+}
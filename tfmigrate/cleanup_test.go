@@ -0,0 +1,230 @@
+package tfmigrate
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/minamijoyo/tfmigrate/tfexec"
+)
+
+func TestMigrationDirs(t *testing.T) {
+	cases := []struct {
+		desc string
+		mc   *MigrationConfig
+		want []string
+	}{
+		{
+			desc: "state",
+			mc: &MigrationConfig{
+				Type:     "state",
+				Name:     "test",
+				Migrator: &StateMigratorConfig{Dir: "dir1"},
+			},
+			want: []string{"dir1"},
+		},
+		{
+			desc: "state without dir",
+			mc: &MigrationConfig{
+				Type:     "state",
+				Name:     "test",
+				Migrator: &StateMigratorConfig{},
+			},
+			want: []string{"."},
+		},
+		{
+			desc: "multi_state",
+			mc: &MigrationConfig{
+				Type:     "multi_state",
+				Name:     "test",
+				Migrator: &MultiStateMigratorConfig{FromDir: "dir1", ToDir: "dir2"},
+			},
+			want: []string{"dir1", "dir2"},
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.desc, func(t *testing.T) {
+			got, err := MigrationDirs(tc.mc)
+			if err != nil {
+				t.Fatalf("unexpected err: %s", err)
+			}
+			if diff := cmp.Diff(got, tc.want); diff != "" {
+				t.Errorf("got: %v, want: %v, diff: %s", got, tc.want, diff)
+			}
+		})
+	}
+}
+
+func TestIsLocalStateNewer(t *testing.T) {
+	cases := []struct {
+		desc   string
+		local  string
+		remote string
+		want   bool
+	}{
+		{
+			desc:   "same",
+			local:  `{"version": 4, "serial": 3, "lineage": "foo"}`,
+			remote: `{"version": 4, "serial": 3, "lineage": "foo"}`,
+			want:   false,
+		},
+		{
+			desc:   "older",
+			local:  `{"version": 4, "serial": 2, "lineage": "foo"}`,
+			remote: `{"version": 4, "serial": 3, "lineage": "foo"}`,
+			want:   false,
+		},
+		{
+			desc:   "newer",
+			local:  `{"version": 4, "serial": 4, "lineage": "foo"}`,
+			remote: `{"version": 4, "serial": 3, "lineage": "foo"}`,
+			want:   true,
+		},
+		{
+			desc:   "different lineage",
+			local:  `{"version": 4, "serial": 1, "lineage": "bar"}`,
+			remote: `{"version": 4, "serial": 3, "lineage": "foo"}`,
+			want:   true,
+		},
+		{
+			desc:   "empty remote",
+			local:  `{"version": 4, "serial": 1, "lineage": "foo"}`,
+			remote: ``,
+			want:   true,
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.desc, func(t *testing.T) {
+			got, err := isLocalStateNewer(tfexec.NewState([]byte(tc.local)), tfexec.NewState([]byte(tc.remote)))
+			if err != nil {
+				t.Fatalf("unexpected err: %s", err)
+			}
+			if got != tc.want {
+				t.Errorf("got: %t, want: %t", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestCleanupWorkDirNothingLeft(t *testing.T) {
+	dir := t.TempDir()
+	cleaned, err := CleanupWorkDir(context.Background(), dir, &MigratorOption{}, false)
+	if err != nil {
+		t.Fatalf("unexpected err: %s", err)
+	}
+	if cleaned {
+		t.Errorf("expected nothing to clean up")
+	}
+}
+
+func TestCleanupWorkDirLocalStatesWithoutOverride(t *testing.T) {
+	dir := t.TempDir()
+	workspacePath := filepath.Join(dir, "terraform.tfstate.d", "foo")
+	if err := os.MkdirAll(workspacePath, 0755); err != nil {
+		t.Fatalf("failed to create dir: %s", err)
+	}
+	state := `{"version": 4, "serial": 1, "lineage": "foo"}`
+	if err := os.WriteFile(filepath.Join(workspacePath, "terraform.tfstate"), []byte(state), 0644); err != nil {
+		t.Fatalf("failed to write file: %s", err)
+	}
+
+	_, err := CleanupWorkDir(context.Background(), dir, &MigratorOption{}, false)
+	if err == nil {
+		t.Fatalf("expected to return an error, but no error")
+	}
+	if _, err := os.Stat(workspacePath); err != nil {
+		t.Errorf("expected the local state to be kept: %s", err)
+	}
+}
+
+func TestCleanupWorkDirKeepsOverrideIfLocalStateIsNewer(t *testing.T) {
+	dir := t.TempDir()
+	workspacePath := filepath.Join(dir, "terraform.tfstate.d", "default")
+	if err := os.MkdirAll(workspacePath, 0755); err != nil {
+		t.Fatalf("failed to create dir: %s", err)
+	}
+	local := `{"version": 4, "serial": 2, "lineage": "foo"}`
+	if err := os.WriteFile(filepath.Join(workspacePath, "terraform.tfstate"), []byte(local), 0644); err != nil {
+		t.Fatalf("failed to write file: %s", err)
+	}
+	overridePath := filepath.Join(dir, overrideFileName)
+	if err := os.WriteFile(overridePath, []byte(`terraform { backend "local" {} }`), 0644); err != nil {
+		t.Fatalf("failed to write file: %s", err)
+	}
+
+	// a fake terraform command whose remote state is older than the local one.
+	fake := filepath.Join(t.TempDir(), "terraform")
+	script := `#!/bin/sh
+case "$1" in
+  init) exit 0 ;;
+  workspace) [ "$2" = "show" ] && echo default; exit 0 ;;
+  state) echo '{"version": 4, "serial": 1, "lineage": "foo"}'; exit 0 ;;
+esac
+exit 1
+`
+	if err := os.WriteFile(fake, []byte(script), 0755); err != nil {
+		t.Fatalf("failed to write file: %s", err)
+	}
+
+	// cleanup can be re-run without --force.
+	o := &MigratorOption{ExecPath: fake}
+	for i := 0; i < 2; i++ {
+		_, err := CleanupWorkDir(context.Background(), dir, o, false)
+		if err == nil || !strings.Contains(err.Error(), "newer than the remote state") {
+			t.Fatalf("expected the check to fail on run %d, got: %v", i+1, err)
+		}
+		if _, err := os.Stat(overridePath); err != nil {
+			t.Fatalf("expected the override file to be kept: %s", err)
+		}
+		if _, err := os.Stat(workspacePath); err != nil {
+			t.Fatalf("expected the local state to be kept: %s", err)
+		}
+	}
+}
+
+func TestAccCleanupWorkDir(t *testing.T) {
+	tfexec.SkipUnlessAcceptanceTestEnabled(t)
+
+	backend := tfexec.GetTestAccBackendS3Config(t.Name())
+
+	source := `
+resource "null_resource" "foo" {}
+`
+
+	workspace := "default"
+	tf := tfexec.SetupTestAccWithApply(t, workspace, backend+source)
+	ctx := context.Background()
+
+	// simulate a migration killed after switching the backend to local.
+	_, err := tf.OverrideBackendToLocal(ctx, overrideFileName, workspace, false, nil, false)
+	if err != nil {
+		t.Fatalf("failed to run OverrideBackendToLocal: %s", err)
+	}
+
+	cleaned, err := CleanupWorkDir(ctx, tf.Dir(), &MigratorOption{}, false)
+	if err != nil {
+		t.Fatalf("failed to run CleanupWorkDir: %s", err)
+	}
+	if !cleaned {
+		t.Errorf("expected to clean up")
+	}
+
+	for _, name := range []string{overrideFileName, "terraform.tfstate.d"} {
+		if _, err := os.Stat(filepath.Join(tf.Dir(), name)); !os.IsNotExist(err) {
+			t.Errorf("expected %s to be removed: %v", name, err)
+		}
+	}
+
+	got, err := tf.StateList(ctx, nil, nil)
+	if err != nil {
+		t.Fatalf("failed to run terraform state list: %s", err)
+	}
+	if diff := cmp.Diff(got, []string{"null_resource.foo"}); diff != "" {
+		t.Errorf("unexpected remote state: %v, diff: %s", got, diff)
+	}
+}
@@ -1,5 +1,11 @@
 package tfmigrate
 
+import (
+	"context"
+
+	"github.com/minamijoyo/tfmigrate/tfexec"
+)
+
 // MigrationConfig is a config for a migration.
 type MigrationConfig struct {
 	// Type is a type for migration.
@@ -34,4 +40,63 @@ type MigratorOption struct {
 
 	// BackendConfig is a -backend-config option for remote state
 	BackendConfig []string
+
+	// RerunOnRemoteStateChange is the maximum number of times to re-run a
+	// migration against the fresh remote state when the remote state has been
+	// changed by someone else during the migration. Default to 0, which means
+	// to abort the migration.
+	RerunOnRemoteStateChange int
+
+	// Isolated runs terraform commands in a temporary work dir which overlays
+	// the root module instead of the original one, so that the original
+	// directory is never touched even if the migration is interrupted.
+	Isolated bool
+
+	// PlanChain carries states computed by plans of stacked migrations.
+	// If set, a migration is planned against the state computed by the
+	// previous migration for the same dir and workspace. It's only for plan.
+	PlanChain *PlanChain
+
+	// Backup is a store for backups of remote states.
+	// If set, the current remote states are saved to it before pushing new
+	// states. If nil, no backup is taken.
+	Backup StateBackup
+
+	// Lock is a locker for remote states.
+	// If set, locks of remote states are held from pulling states until
+	// pushing new states in apply. If nil, no lock is acquired.
+	Lock StateLocker
+
+	// Retry is a policy to retry idempotent terraform commands which failed
+	// with transient errors. If nil, no command is retried.
+	Retry *tfexec.RetryPolicy
+
+	// Timeouts is a set of timeouts for classes of terraform commands.
+	// A zero value means no timeout.
+	Timeouts tfexec.Timeouts
+
+	// StreamOutput streams output of terraform commands to the console in
+	// real time with a prefix of the working directory.
+	StreamOutput bool
+
+	// Terragrunt runs terraform commands via Terragrunt if set.
+	// If nil, terraform commands are run directly.
+	Terragrunt *tfexec.Terragrunt
+}
+
+// StateBackup abstracts a store for backups of remote states.
+type StateBackup interface {
+	// Save saves a given state as a backup for a given dir and workspace.
+	Save(ctx context.Context, dir string, workspace string, state []byte) error
+
+	// Load loads a backup for a given dir and workspace. It returns an empty
+	// state if no state existed when the backup was saved.
+	Load(ctx context.Context, dir string, workspace string) ([]byte, error)
+}
+
+// StateLocker abstracts a locker for remote states.
+type StateLocker interface {
+	// Lock acquires a lock for a given dir and workspace, and returns a
+	// function to release it.
+	Lock(ctx context.Context, dir string, workspace string) (func(context.Context) error, error)
 }
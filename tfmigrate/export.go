@@ -0,0 +1,227 @@
+package tfmigrate
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"log/slog"
+	"os"
+	"strings"
+
+	"github.com/hashicorp/hcl/v2/hclwrite"
+)
+
+// ExportedConfig is Terraform configuration translated from a migration.
+type ExportedConfig struct {
+	// Dir is a working directory where the configuration should be placed.
+	Dir string
+	// Source is the configuration in HCL.
+	Source []byte
+	// Unsupported is a list of messages for actions which cannot be expressed
+	// in configuration.
+	Unsupported []string
+}
+
+// ExportMigration translates a given migration into Terraform configuration
+// blocks: moved (Terraform v1.1+), import (v1.5+) and removed (v1.7+).
+// Since an xmv action is expanded against the current remote state, it runs
+// terraform init and terraform state list in the working directory only if the
+// migration contains wildcards. Actions which cannot be expressed in
+// configuration, such as cross-state moves and replace-provider, are written
+// as comments and reported as unsupported.
+func ExportMigration(ctx context.Context, mc *MigrationConfig, o *MigratorOption) (*ExportedConfig, error) {
+	switch c := mc.Migrator.(type) {
+	case *StateMigratorConfig:
+		return exportStateMigration(ctx, c, mc.Name, o)
+
+	case *MultiStateMigratorConfig:
+		return exportMultiStateMigration(c, mc.Name)
+
+	default:
+		return nil, fmt.Errorf("export is not supported for migration type: %s", mc.Type)
+	}
+}
+
+// exportStateMigration translates a state migration into configuration.
+func exportStateMigration(ctx context.Context, c *StateMigratorConfig, name string, o *MigratorOption) (*ExportedConfig, error) {
+	dir := "."
+	if len(c.Dir) > 0 {
+		dir = c.Dir
+	}
+	workspace := "default"
+	if len(c.Workspace) > 0 {
+		workspace = c.Workspace
+	}
+
+	actions := []StateAction{}
+	needsState := false
+	for _, cmdStr := range c.Actions {
+		action, err := NewStateActionFromString(cmdStr)
+		if err != nil {
+			return nil, err
+		}
+		if xmv, ok := action.(*StateXmvAction); ok && newXmvExpander(xmv).nrOfWildcards() > 0 {
+			needsState = true
+		}
+		actions = append(actions, action)
+	}
+
+	e := newConfigExporter(name)
+	if needsState {
+		tf := newTerraformCLI(o, dir, os.Environ())
+		ctx := logContext(ctx, dir, workspace)
+		if err := initWorkDir(ctx, tf, workspace); err != nil {
+			return nil, err
+		}
+		slog.InfoContext(ctx, "list resources in the current remote state")
+		addresses, err := tf.StateList(ctx, nil, nil)
+		if err != nil {
+			return nil, err
+		}
+		e.addresses = addresses
+	}
+
+	if err := e.exportStateActions(c.Actions, actions); err != nil {
+		return nil, err
+	}
+
+	return e.result(dir), nil
+}
+
+// exportMultiStateMigration translates a multi state migration into
+// configuration. Since moved blocks cannot move resources across states, all
+// actions are unsupported.
+func exportMultiStateMigration(c *MultiStateMigratorConfig, name string) (*ExportedConfig, error) {
+	e := newConfigExporter(name)
+	for _, cmdStr := range c.Actions {
+		if _, err := NewMultiStateActionFromString(cmdStr); err != nil {
+			return nil, err
+		}
+		e.unsupported(cmdStr, fmt.Sprintf("cross-state move from %s to %s cannot be expressed in configuration", c.FromDir, c.ToDir))
+	}
+	return e.result(c.ToDir), nil
+}
+
+// configExporter is a helper object for rendering configuration blocks.
+type configExporter struct {
+	// b is a buffer of rendered configuration.
+	b bytes.Buffer
+	// addresses is a list of addresses in the state after applying actions
+	// exported so far. It's used for expanding wildcards of xmv actions.
+	addresses []string
+	// unsupportedMessages is a list of messages for unsupported actions.
+	unsupportedMessages []string
+}
+
+// newConfigExporter returns a new configExporter instance.
+func newConfigExporter(name string) *configExporter {
+	e := &configExporter{}
+	fmt.Fprintf(&e.b, "# Exported from tfmigrate migration %s\n", hclString(name))
+	return e
+}
+
+// comment writes a given comment line.
+func (e *configExporter) comment(line string) {
+	fmt.Fprintf(&e.b, "\n%s\n", line)
+}
+
+// unsupported records an action which cannot be expressed in configuration.
+func (e *configExporter) unsupported(cmdStr string, reason string) {
+	msg := fmt.Sprintf("%s: %s", cmdStr, reason)
+	e.unsupportedMessages = append(e.unsupportedMessages, msg)
+	e.comment("# unsupported: " + msg)
+}
+
+// moved writes a moved block.
+func (e *configExporter) moved(cmdStr string, source string, destination string) {
+	if isDataResourceAddress(source) || isDataResourceAddress(destination) {
+		e.unsupported(cmdStr, fmt.Sprintf("moved blocks cannot move data resources: %s => %s", source, destination))
+		return
+	}
+	fmt.Fprintf(&e.b, "\n# %s\nmoved {\nfrom = %s\nto = %s\n}\n", cmdStr, source, destination)
+
+	for i, addr := range e.addresses {
+		if addr == source || strings.HasPrefix(addr, source+".") || strings.HasPrefix(addr, source+"[") {
+			e.addresses[i] = destination + strings.TrimPrefix(addr, source)
+		}
+	}
+}
+
+// removed writes a removed block which forgets a resource without destroying it.
+func (e *configExporter) removed(cmdStr string, address string) {
+	if isDataResourceAddress(address) {
+		e.unsupported(cmdStr, fmt.Sprintf("removed blocks cannot remove data resources: %s", address))
+		return
+	}
+	if strings.Contains(address, "[") {
+		e.unsupported(cmdStr, fmt.Sprintf("removed blocks cannot remove a specific instance: %s", address))
+		return
+	}
+	fmt.Fprintf(&e.b, "\n# %s\nremoved {\nfrom = %s\nlifecycle {\ndestroy = false\n}\n}\n", cmdStr, address)
+
+	addresses := []string{}
+	for _, addr := range e.addresses {
+		if addr == address || strings.HasPrefix(addr, address+".") || strings.HasPrefix(addr, address+"[") {
+			continue
+		}
+		addresses = append(addresses, addr)
+	}
+	e.addresses = addresses
+}
+
+// imported writes an import block.
+func (e *configExporter) imported(cmdStr string, address string, id string) {
+	fmt.Fprintf(&e.b, "\n# %s\nimport {\nto = %s\nid = %s\n}\n", cmdStr, address, hclString(id))
+	e.addresses = append(e.addresses, address)
+}
+
+// exportStateActions writes configuration blocks for given state actions.
+// The cmdStrs is a list of original action strings used for comments.
+func (e *configExporter) exportStateActions(cmdStrs []string, actions []StateAction) error {
+	for i, action := range actions {
+		cmdStr := cmdStrs[i]
+		switch a := action.(type) {
+		case *StateMvAction:
+			e.moved(cmdStr, a.source, a.destination)
+
+		case *StateXmvAction:
+			mvs, err := newXmvExpander(a).expand(e.addresses)
+			if err != nil {
+				return err
+			}
+			if len(mvs) == 0 {
+				e.comment("# " + cmdStr + " matches no resources in the current state")
+			}
+			for _, mv := range mvs {
+				e.moved(cmdStr, mv.source, mv.destination)
+			}
+
+		case *StateRmAction:
+			for _, addr := range a.addresses {
+				e.removed(cmdStr, addr)
+			}
+
+		case *StateImportAction:
+			e.imported(cmdStr, a.address, a.id)
+
+		default:
+			e.unsupported(cmdStr, "replace-provider cannot be expressed in configuration")
+		}
+	}
+
+	return nil
+}
+
+// result returns a formatted configuration.
+func (e *configExporter) result(dir string) *ExportedConfig {
+	return &ExportedConfig{
+		Dir:         dir,
+		Source:      hclwrite.Format(e.b.Bytes()),
+		Unsupported: e.unsupportedMessages,
+	}
+}
+
+// isDataResourceAddress returns true if a given address is a data resource.
+func isDataResourceAddress(addr string) bool {
+	return strings.HasPrefix(addr[len(modulePathRe.FindString(addr)):], "data.")
+}
@@ -0,0 +1,214 @@
+package tfmigrate
+
+import (
+	"context"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestExportMigration(t *testing.T) {
+	cases := []struct {
+		desc        string
+		mc          *MigrationConfig
+		dir         string
+		source      string
+		unsupported []string
+		ok          bool
+	}{
+		{
+			desc: "state",
+			mc: &MigrationConfig{
+				Type: "state",
+				Name: "test",
+				Migrator: &StateMigratorConfig{
+					Dir: "dir1",
+					Actions: []string{
+						"mv aws_security_group.foo aws_security_group.foo2",
+						"mv module.foo module.bar",
+						"rm aws_security_group.baz module.qux",
+						"rm aws_security_group.qux[0]",
+						"import aws_security_group.qux2 sg-1234",
+						"replace-provider registry.terraform.io/-/null registry.terraform.io/hashicorp/null",
+					},
+				},
+			},
+			dir: "dir1",
+			source: `# Exported from tfmigrate migration "test"
+
+# mv aws_security_group.foo aws_security_group.foo2
+moved {
+  from = aws_security_group.foo
+  to   = aws_security_group.foo2
+}
+
+# mv module.foo module.bar
+moved {
+  from = module.foo
+  to   = module.bar
+}
+
+# rm aws_security_group.baz module.qux
+removed {
+  from = aws_security_group.baz
+  lifecycle {
+    destroy = false
+  }
+}
+
+# rm aws_security_group.baz module.qux
+removed {
+  from = module.qux
+  lifecycle {
+    destroy = false
+  }
+}
+
+# unsupported: rm aws_security_group.qux[0]: removed blocks cannot remove a specific instance: aws_security_group.qux[0]
+
+# import aws_security_group.qux2 sg-1234
+import {
+  to = aws_security_group.qux2
+  id = "sg-1234"
+}
+
+# unsupported: replace-provider registry.terraform.io/-/null registry.terraform.io/hashicorp/null: replace-provider cannot be expressed in configuration
+`,
+			unsupported: []string{
+				"rm aws_security_group.qux[0]: removed blocks cannot remove a specific instance: aws_security_group.qux[0]",
+				"replace-provider registry.terraform.io/-/null registry.terraform.io/hashicorp/null: replace-provider cannot be expressed in configuration",
+			},
+			ok: true,
+		},
+		{
+			desc: "multi_state",
+			mc: &MigrationConfig{
+				Type: "multi_state",
+				Name: "test",
+				Migrator: &MultiStateMigratorConfig{
+					FromDir: "dir1",
+					ToDir:   "dir2",
+					Actions: []string{
+						"mv aws_security_group.foo aws_security_group.foo2",
+					},
+				},
+			},
+			dir: "dir2",
+			source: `# Exported from tfmigrate migration "test"
+
+# unsupported: mv aws_security_group.foo aws_security_group.foo2: cross-state move from dir1 to dir2 cannot be expressed in configuration
+`,
+			unsupported: []string{
+				"mv aws_security_group.foo aws_security_group.foo2: cross-state move from dir1 to dir2 cannot be expressed in configuration",
+			},
+			ok: true,
+		},
+		{
+			desc: "invalid action",
+			mc: &MigrationConfig{
+				Type: "state",
+				Name: "test",
+				Migrator: &StateMigratorConfig{
+					Actions: []string{
+						"mv aws_security_group.foo",
+					},
+				},
+			},
+			ok: false,
+		},
+		{
+			desc: "mock",
+			mc: &MigrationConfig{
+				Type:     "mock",
+				Name:     "test",
+				Migrator: &MockMigratorConfig{},
+			},
+			ok: false,
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.desc, func(t *testing.T) {
+			got, err := ExportMigration(context.Background(), tc.mc, nil)
+			if tc.ok && err != nil {
+				t.Fatalf("unexpected err: %s", err)
+			}
+			if !tc.ok && err == nil {
+				t.Fatalf("expected to return an error, but no error, got: %#v", got)
+			}
+			if tc.ok {
+				if got.Dir != tc.dir {
+					t.Errorf("got dir: %s, want = %s", got.Dir, tc.dir)
+				}
+				if diff := cmp.Diff(string(got.Source), tc.source); diff != "" {
+					t.Errorf("got source:\n%s\nwant:\n%s\ndiff = %s", string(got.Source), tc.source, diff)
+				}
+				if diff := cmp.Diff(got.Unsupported, tc.unsupported); diff != "" {
+					t.Errorf("got unsupported: %v, want = %v, diff = %s", got.Unsupported, tc.unsupported, diff)
+				}
+			}
+		})
+	}
+}
+
+func TestConfigExporterExportStateActions(t *testing.T) {
+	cmdStrs := []string{
+		"mv aws_security_group.foo aws_security_group.foo2",
+		"xmv aws_security_group.* aws_security_group.${1}_new",
+		"xmv data.aws_ami.* data.aws_ami.${1}_new",
+	}
+	actions := []StateAction{}
+	for _, cmdStr := range cmdStrs {
+		action, err := NewStateActionFromString(cmdStr)
+		if err != nil {
+			t.Fatalf("failed to parse action: %s", err)
+		}
+		actions = append(actions, action)
+	}
+
+	e := newConfigExporter("test")
+	e.addresses = []string{
+		"aws_security_group.foo",
+		"aws_security_group.bar",
+		"data.aws_ami.baz",
+	}
+	if err := e.exportStateActions(cmdStrs, actions); err != nil {
+		t.Fatalf("unexpected err: %s", err)
+	}
+
+	got := string(e.result(".").Source)
+	want := `# Exported from tfmigrate migration "test"
+
+# mv aws_security_group.foo aws_security_group.foo2
+moved {
+  from = aws_security_group.foo
+  to   = aws_security_group.foo2
+}
+
+# xmv aws_security_group.* aws_security_group.${1}_new
+moved {
+  from = aws_security_group.foo2
+  to   = aws_security_group.foo2_new
+}
+
+# xmv aws_security_group.* aws_security_group.${1}_new
+moved {
+  from = aws_security_group.bar
+  to   = aws_security_group.bar_new
+}
+
+# unsupported: xmv data.aws_ami.* data.aws_ami.${1}_new: moved blocks cannot move data resources: data.aws_ami.baz => data.aws_ami.baz_new
+`
+	if diff := cmp.Diff(got, want); diff != "" {
+		t.Errorf("got:\n%s\nwant:\n%s\ndiff = %s", got, want, diff)
+	}
+
+	wantAddresses := []string{
+		"aws_security_group.foo2_new",
+		"aws_security_group.bar_new",
+		"data.aws_ami.baz",
+	}
+	if diff := cmp.Diff(e.addresses, wantAddresses); diff != "" {
+		t.Errorf("got addresses: %v, want = %v, diff = %s", e.addresses, wantAddresses, diff)
+	}
+}
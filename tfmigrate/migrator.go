@@ -2,9 +2,14 @@ package tfmigrate
 
 import (
 	"context"
-	"log"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
 	"strings"
 
+	"github.com/minamijoyo/tfmigrate/logging"
 	"github.com/minamijoyo/tfmigrate/tfexec"
 )
 
@@ -21,6 +26,39 @@ type Migrator interface {
 	Apply(ctx context.Context) error
 }
 
+// overrideFileName is a name of the override file to switch the backend to
+// local during a migration.
+const overrideFileName = "_tfmigrate_override.tf"
+
+// newTerraformCLI is a helper function to create a TerraformCLI which runs in
+// a given dir with given environment variables and customized by the option.
+func newTerraformCLI(o *MigratorOption, dir string, env []string) tfexec.TerraformCLI {
+	tf := tfexec.NewTerraformCLI(tfexec.NewExecutor(dir, env))
+	if o == nil {
+		return tf
+	}
+	if len(o.ExecPath) > 0 {
+		// While NewTerraformCLI reads the environment variable TFMIGRATE_EXEC_PATH
+		// at initialization, the MigratorOption takes precedence over it.
+		tf.SetExecPath(o.ExecPath)
+	}
+	tf.SetRetryPolicy(o.Retry)
+	tf.SetTimeouts(o.Timeouts)
+	if o.StreamOutput {
+		tf.SetStreamOutput(dir)
+	}
+	tf.SetTerragrunt(o.Terragrunt)
+	return tf
+}
+
+// logContext is a helper function which returns a context to add a given dir
+// and workspace to log records of a migrator. Helper functions which take a
+// TerraformCLI instead of a dir expect that the dir is set in the context,
+// because the TerraformCLI may run in an isolated work dir.
+func logContext(ctx context.Context, dir string, workspace string) context.Context {
+	return logging.With(ctx, "component", "migrator", "dir", dir, "workspace", workspace)
+}
+
 // setupWorkDir is a common helper function to set up work dir and returns the
 // current state and a switch back function.
 func setupWorkDir(ctx context.Context, tf tfexec.TerraformCLI, workspace string, isBackendTerraformCloud bool, backendConfig []string, ignoreLegacyStateInitErr bool) (*tfexec.State, func() error, error) {
@@ -29,7 +67,7 @@ func setupWorkDir(ctx context.Context, tf tfexec.TerraformCLI, workspace string,
 	if err != nil {
 		return nil, nil, err
 	}
-	log.Printf("[INFO] [migrator@%s] %s version: %s\n", tf.Dir(), execType, version)
+	slog.InfoContext(ctx, "terraform version", "exec_type", execType, "version", version)
 
 	supportsStateReplaceProvider, constraints, err := tf.SupportsStateReplaceProvider(ctx)
 	if err != nil {
@@ -37,11 +75,11 @@ func setupWorkDir(ctx context.Context, tf tfexec.TerraformCLI, workspace string,
 	}
 
 	// init folder
-	log.Printf("[INFO] [migrator@%s] initialize work dir\n", tf.Dir())
+	slog.InfoContext(ctx, "initialize work dir")
 	err = tf.Init(ctx, "-input=false", "-no-color")
 	if err != nil {
 		if supportsStateReplaceProvider && ignoreLegacyStateInitErr && strings.Contains(err.Error(), tfexec.AcceptableLegacyStateInitError) {
-			log.Printf("[INFO] [migrator@%s] ignoring error '%s' initilizing work dir; the error is expected when using Terraform %s with a legacy Terraform state\n", tf.Dir(), tfexec.AcceptableLegacyStateInitError, constraints)
+			slog.InfoContext(ctx, "ignoring an error initializing work dir; the error is expected when using Terraform with a legacy Terraform state", "error", tfexec.AcceptableLegacyStateInitError, "constraints", constraints)
 		} else {
 			return nil, nil, err
 		}
@@ -52,10 +90,10 @@ func setupWorkDir(ctx context.Context, tf tfexec.TerraformCLI, workspace string,
 	if err != nil {
 		return nil, nil, err
 	}
-	log.Printf("[DEBUG] [migrator@%s] currentWorkspace = %s, workspace = %s\n", tf.Dir(), currentWorkspace, workspace)
+	slog.DebugContext(ctx, "check current workspace", "current_workspace", currentWorkspace)
 	if currentWorkspace != workspace {
 		// switch to workspace
-		log.Printf("[INFO] [migrator@%s] switch to remote workspace %s\n", tf.Dir(), workspace)
+		slog.InfoContext(ctx, "switch to remote workspace")
 		err = tf.WorkspaceSelect(ctx, workspace)
 		if err != nil {
 			return nil, nil, err
@@ -63,16 +101,209 @@ func setupWorkDir(ctx context.Context, tf tfexec.TerraformCLI, workspace string,
 	}
 
 	// get the current remote state.
-	log.Printf("[INFO] [migrator@%s] get the current remote state\n", tf.Dir())
+	slog.InfoContext(ctx, "get the current remote state")
 	currentState, err := tf.StatePull(ctx)
 	if err != nil {
 		return nil, nil, err
 	}
 	// override backend to local
-	log.Printf("[INFO] [migrator@%s] override backend to local\n", tf.Dir())
-	switchBackToRemoteFunc, err := tf.OverrideBackendToLocal(ctx, "_tfmigrate_override.tf", workspace, isBackendTerraformCloud, backendConfig, ignoreLegacyStateInitErr)
+	slog.InfoContext(ctx, "override backend to local")
+	switchBackToRemoteFunc, err := tf.OverrideBackendToLocal(ctx, overrideFileName, workspace, isBackendTerraformCloud, backendConfig, ignoreLegacyStateInitErr)
 	if err != nil {
 		return nil, nil, err
 	}
 	return currentState, switchBackToRemoteFunc, nil
 }
+
+// initWorkDir is a helper function to initialize work dir and switch to a
+// given workspace without overriding the backend. It's intended for read-only
+// operations which never push a state.
+func initWorkDir(ctx context.Context, tf tfexec.TerraformCLI, workspace string) error {
+	slog.InfoContext(ctx, "initialize work dir")
+	if err := tf.Init(ctx, "-input=false", "-no-color"); err != nil {
+		return err
+	}
+
+	currentWorkspace, err := tf.WorkspaceShow(ctx)
+	if err != nil {
+		return err
+	}
+	if currentWorkspace != workspace {
+		slog.InfoContext(ctx, "switch to remote workspace")
+		if err := tf.WorkspaceSelect(ctx, workspace); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// backupState is a helper function to save a given state as a backup before
+// pushing a new state. It does nothing if no backup is configured.
+func backupState(ctx context.Context, o *MigratorOption, dir string, workspace string, state *tfexec.State) error {
+	if o == nil || o.Backup == nil {
+		return nil
+	}
+
+	slog.InfoContext(ctx, "back up the current remote state", "dir", dir, "workspace", workspace)
+	if err := o.Backup.Save(ctx, dir, workspace, state.Bytes()); err != nil {
+		return fmt.Errorf("failed to back up the current remote state in %s: %s", dir, err)
+	}
+	return nil
+}
+
+// ErrRemoteStateChanged is an error returned when the remote state has been
+// changed by someone else after it was pulled for a migration.
+var ErrRemoteStateChanged = errors.New("remote state changed during migration")
+
+// checkRemoteStateUnchanged is a helper function to re-pull the remote state
+// and compare it with a given state pulled at the beginning of a migration.
+// It returns ErrRemoteStateChanged if the lineage or serial is different.
+// It must be called after switching back the backend to remote.
+func checkRemoteStateUnchanged(ctx context.Context, tf tfexec.TerraformCLI, pulledState *tfexec.State) error {
+	slog.InfoContext(ctx, "check if the remote state has not been changed")
+	currentState, err := tf.StatePull(ctx)
+	if err != nil {
+		return err
+	}
+
+	if err := compareStateVersions(pulledState, currentState); err != nil {
+		slog.ErrorContext(ctx, "remote state changed", "error", err)
+		return fmt.Errorf("%w in %s: %s", ErrRemoteStateChanged, tf.Dir(), err)
+	}
+	return nil
+}
+
+// compareStateVersions returns an error if the lineage or serial of given
+// two states is different. An empty state means no state exists.
+func compareStateVersions(before *tfexec.State, after *tfexec.State) error {
+	beforeEmpty := len(before.Bytes()) == 0
+	afterEmpty := len(after.Bytes()) == 0
+	if beforeEmpty || afterEmpty {
+		if beforeEmpty != afterEmpty {
+			return fmt.Errorf("state has been created or deleted")
+		}
+		return nil
+	}
+
+	beforeLineage, err := before.Lineage()
+	if err != nil {
+		return err
+	}
+	afterLineage, err := after.Lineage()
+	if err != nil {
+		return err
+	}
+	if beforeLineage != afterLineage {
+		return fmt.Errorf("lineage has been changed from %s to %s", beforeLineage, afterLineage)
+	}
+
+	beforeSerial, err := before.Serial()
+	if err != nil {
+		return err
+	}
+	afterSerial, err := after.Serial()
+	if err != nil {
+		return err
+	}
+	if beforeSerial != afterSerial {
+		return fmt.Errorf("serial has been changed from %d to %d", beforeSerial, afterSerial)
+	}
+	return nil
+}
+
+// rerunOnRemoteStateChange is a helper function to run a given apply function
+// and re-run it against the fresh remote state if it fails with
+// ErrRemoteStateChanged, up to the number of times set in the option.
+func rerunOnRemoteStateChange(ctx context.Context, o *MigratorOption, apply func(ctx context.Context) error) error {
+	maxReruns := 0
+	if o != nil {
+		maxReruns = o.RerunOnRemoteStateChange
+	}
+
+	for i := 0; ; i++ {
+		err := apply(ctx)
+		if err == nil || !errors.Is(err, ErrRemoteStateChanged) || i >= maxReruns || ctx.Err() != nil {
+			return err
+		}
+		slog.WarnContext(ctx, "re-run the migration against the fresh remote state", "rerun", i+1, "max_reruns", maxReruns, "error", err)
+	}
+}
+
+// checkNotCanceled is a helper function to refuse to push new states after
+// the migration has been canceled. Once it passes, new states should be pushed
+// with a context which is never canceled, so that a signal received during
+// pushing doesn't leave states half pushed.
+func checkNotCanceled(ctx context.Context) error {
+	if ctx.Err() != nil {
+		return fmt.Errorf("refuse to push new states because the migration has been canceled: %w", context.Cause(ctx))
+	}
+	return nil
+}
+
+// lockState is a helper function to acquire a lock of a remote state for a
+// given dir and workspace, and returns a function to release it. It does
+// nothing if no locker is configured.
+func lockState(ctx context.Context, o *MigratorOption, dir string, workspace string) (func(context.Context) error, error) {
+	if o == nil || o.Lock == nil {
+		return func(context.Context) error { return nil }, nil
+	}
+
+	slog.InfoContext(ctx, "lock the remote state", "dir", dir, "workspace", workspace)
+	return o.Lock.Lock(ctx, dir, workspace)
+}
+
+// isolateWorkDir is a helper function to create an isolated work dir for a
+// given dir if enabled, and returns a TerraformCLI which runs in it and a
+// function to remove it. If not enabled, it returns a given TerraformCLI as
+// it is.
+// The dir is expected to be set in the context for logging.
+func isolateWorkDir(ctx context.Context, o *MigratorOption, tf tfexec.TerraformCLI, dir string) (tfexec.TerraformCLI, func() error, error) {
+	if o == nil || !o.Isolated {
+		return tf, func() error { return nil }, nil
+	}
+
+	env, err := tfexec.IsolatedEnv(os.Environ())
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var excludes []string
+	if o.Terragrunt != nil {
+		excludes = append(excludes, o.Terragrunt.IsolatedExclude())
+	}
+
+	workDir, cleanup, err := tfexec.NewIsolatedWorkDir(ctx, dir, excludes)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// Terragrunt downloads a terraform configuration into the cache dir, so
+	// it must be in the isolated work dir, too.
+	isolatedOption := *o
+	if o.Terragrunt != nil {
+		isolatedOption.Terragrunt = o.Terragrunt.Isolated(workDir)
+	}
+	isolated := newTerraformCLI(&isolatedOption, workDir, env)
+	if o.StreamOutput {
+		// show the original dir instead of the temporary one.
+		isolated.SetStreamOutput(dir)
+	}
+	return isolated, cleanup, nil
+}
+
+// planOutOption is a helper function to build a -out option for terraform
+// plan in a given dir. In isolated mode, a relative path is resolved against
+// the original dir, because the isolated work dir is removed on exit.
+// It's also resolved when running via Terragrunt, because Terragrunt may run
+// terraform in its cache dir.
+func planOutOption(o *MigratorOption, dir string) (string, error) {
+	planOut := o.PlanOut
+	if (o.Isolated || o.Terragrunt != nil) && !filepath.IsAbs(planOut) {
+		absDir, err := filepath.Abs(dir)
+		if err != nil {
+			return "", err
+		}
+		planOut = filepath.Join(absDir, planOut)
+	}
+	return "-out=" + planOut, nil
+}
@@ -0,0 +1,354 @@
+package tfmigrate
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/minamijoyo/tfmigrate/tfexec"
+)
+
+func TestCompareStateVersions(t *testing.T) {
+	cases := []struct {
+		desc   string
+		before string
+		after  string
+		ok     bool
+	}{
+		{
+			desc:   "unchanged",
+			before: `{"version": 4, "serial": 1, "lineage": "foo"}`,
+			after:  `{"version": 4, "serial": 1, "lineage": "foo"}`,
+			ok:     true,
+		},
+		{
+			desc:   "both empty",
+			before: ``,
+			after:  ``,
+			ok:     true,
+		},
+		{
+			desc:   "serial changed",
+			before: `{"version": 4, "serial": 1, "lineage": "foo"}`,
+			after:  `{"version": 4, "serial": 2, "lineage": "foo"}`,
+			ok:     false,
+		},
+		{
+			desc:   "lineage changed",
+			before: `{"version": 4, "serial": 1, "lineage": "foo"}`,
+			after:  `{"version": 4, "serial": 1, "lineage": "bar"}`,
+			ok:     false,
+		},
+		{
+			desc:   "created",
+			before: ``,
+			after:  `{"version": 4, "serial": 1, "lineage": "foo"}`,
+			ok:     false,
+		},
+		{
+			desc:   "deleted",
+			before: `{"version": 4, "serial": 1, "lineage": "foo"}`,
+			after:  ``,
+			ok:     false,
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.desc, func(t *testing.T) {
+			err := compareStateVersions(tfexec.NewState([]byte(tc.before)), tfexec.NewState([]byte(tc.after)))
+			if tc.ok && err != nil {
+				t.Fatalf("unexpected err: %s", err)
+			}
+			if !tc.ok && err == nil {
+				t.Fatalf("expected to return an error, but no error")
+			}
+		})
+	}
+}
+
+func TestRerunOnRemoteStateChange(t *testing.T) {
+	cases := []struct {
+		desc      string
+		o         *MigratorOption
+		errs      []error
+		wantCalls int
+		ok        bool
+	}{
+		{
+			desc:      "success",
+			o:         &MigratorOption{},
+			errs:      []error{nil},
+			wantCalls: 1,
+			ok:        true,
+		},
+		{
+			desc:      "changed without rerun",
+			o:         &MigratorOption{},
+			errs:      []error{fmt.Errorf("%w in dir1", ErrRemoteStateChanged)},
+			wantCalls: 1,
+			ok:        false,
+		},
+		{
+			desc: "changed and rerun success",
+			o:    &MigratorOption{RerunOnRemoteStateChange: 2},
+			errs: []error{
+				fmt.Errorf("%w in dir1", ErrRemoteStateChanged),
+				nil,
+			},
+			wantCalls: 2,
+			ok:        true,
+		},
+		{
+			desc: "changed and rerun exceeded",
+			o:    &MigratorOption{RerunOnRemoteStateChange: 1},
+			errs: []error{
+				fmt.Errorf("%w in dir1", ErrRemoteStateChanged),
+				fmt.Errorf("%w in dir1", ErrRemoteStateChanged),
+			},
+			wantCalls: 2,
+			ok:        false,
+		},
+		{
+			desc:      "other error",
+			o:         &MigratorOption{RerunOnRemoteStateChange: 2},
+			errs:      []error{errors.New("failed")},
+			wantCalls: 1,
+			ok:        false,
+		},
+		{
+			desc:      "nil option",
+			o:         nil,
+			errs:      []error{fmt.Errorf("%w in dir1", ErrRemoteStateChanged)},
+			wantCalls: 1,
+			ok:        false,
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.desc, func(t *testing.T) {
+			calls := 0
+			apply := func(_ context.Context) error {
+				err := tc.errs[calls]
+				calls++
+				return err
+			}
+			err := rerunOnRemoteStateChange(context.Background(), tc.o, apply)
+			if tc.ok && err != nil {
+				t.Fatalf("unexpected err: %s", err)
+			}
+			if !tc.ok && err == nil {
+				t.Fatalf("expected to return an error, but no error")
+			}
+			if calls != tc.wantCalls {
+				t.Errorf("got calls: %d, want: %d", calls, tc.wantCalls)
+			}
+		})
+	}
+}
+
+// mockLocker is a StateLocker for testing.
+type mockLocker struct {
+	locked []string
+}
+
+var _ StateLocker = (*mockLocker)(nil)
+
+func (l *mockLocker) Lock(_ context.Context, dir string, workspace string) (func(context.Context) error, error) {
+	key := dir + "/" + workspace
+	l.locked = append(l.locked, key)
+	unlock := func(context.Context) error {
+		for i, k := range l.locked {
+			if k == key {
+				l.locked = append(l.locked[:i], l.locked[i+1:]...)
+				return nil
+			}
+		}
+		return fmt.Errorf("not locked: %s", key)
+	}
+	return unlock, nil
+}
+
+func TestLockState(t *testing.T) {
+	ctx := context.Background()
+
+	// no locker
+	unlock, err := lockState(ctx, &MigratorOption{}, "dir1", "default")
+	if err != nil {
+		t.Fatalf("unexpected err: %s", err)
+	}
+	if err := unlock(ctx); err != nil {
+		t.Fatalf("unexpected err: %s", err)
+	}
+
+	l := &mockLocker{}
+	unlock, err = lockState(ctx, &MigratorOption{Lock: l}, "dir1", "default")
+	if err != nil {
+		t.Fatalf("unexpected err: %s", err)
+	}
+	if len(l.locked) != 1 || l.locked[0] != "dir1/default" {
+		t.Fatalf("expected to lock dir1/default, got: %v", l.locked)
+	}
+	if err := unlock(ctx); err != nil {
+		t.Fatalf("unexpected err: %s", err)
+	}
+	if len(l.locked) != 0 {
+		t.Fatalf("expected to unlock, got: %v", l.locked)
+	}
+}
+
+func TestPlanOutOption(t *testing.T) {
+	absDir, err := filepath.Abs("dir1")
+	if err != nil {
+		t.Fatalf("failed to get an absolute path: %s", err)
+	}
+
+	cases := []struct {
+		desc string
+		o    *MigratorOption
+		dir  string
+		want string
+	}{
+		{
+			desc: "not isolated",
+			o:    &MigratorOption{PlanOut: "foo.tfplan"},
+			dir:  "dir1",
+			want: "-out=foo.tfplan",
+		},
+		{
+			desc: "isolated with a relative path",
+			o:    &MigratorOption{PlanOut: "foo.tfplan", Isolated: true},
+			dir:  "dir1",
+			want: "-out=" + filepath.Join(absDir, "foo.tfplan"),
+		},
+		{
+			desc: "isolated with an absolute path",
+			o:    &MigratorOption{PlanOut: "/tmp/foo.tfplan", Isolated: true},
+			dir:  "dir1",
+			want: "-out=/tmp/foo.tfplan",
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.desc, func(t *testing.T) {
+			got, err := planOutOption(tc.o, tc.dir)
+			if err != nil {
+				t.Fatalf("unexpected err: %s", err)
+			}
+			if got != tc.want {
+				t.Errorf("got: %s, want: %s", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestIsolateWorkDirWithTerragrunt(t *testing.T) {
+	dir := t.TempDir()
+	files := map[string]string{
+		"terragrunt.hcl": "",
+		"main.tf":        "",
+		// a cache downloaded by a previous run of Terragrunt in the checkout.
+		".terragrunt-cache/old/backend.tf": "# Generated by Terragrunt\nterraform {\n  backend \"s3\" {}\n}\n",
+	}
+	for name, content := range files {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatalf("failed to create dir: %s", err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatalf("failed to write file: %s", err)
+		}
+	}
+	before := snapshotDir(t, dir)
+
+	// a fake terragrunt command which downloads a configuration into the cache
+	// dir and generates a backend file on init.
+	fake := filepath.Join(t.TempDir(), "terragrunt")
+	script := `#!/bin/sh
+if [ "$1" = "init" ]; then
+  mkdir -p "$TG_DOWNLOAD_DIR/new" .terraform
+  printf '# Generated by Terragrunt\nterraform {\n  backend "s3" {}\n}\n' > "$TG_DOWNLOAD_DIR/new/backend.tf"
+fi
+exit 0
+`
+	if err := os.WriteFile(fake, []byte(script), 0755); err != nil {
+		t.Fatalf("failed to write file: %s", err)
+	}
+
+	ctx := context.Background()
+	o := &MigratorOption{Isolated: true, Terragrunt: tfexec.NewTerragrunt(fake, "", "")}
+	tf, cleanup, err := isolateWorkDir(ctx, o, newTerraformCLI(o, dir, nil), dir)
+	if err != nil {
+		t.Fatalf("failed to isolate work dir: %s", err)
+	}
+	defer cleanup()
+
+	if err := tf.Init(ctx, "-input=false", "-no-color"); err != nil {
+		t.Fatalf("failed to run init: %s", err)
+	}
+	switchBackToRemote, err := tf.OverrideBackendToLocal(ctx, overrideFileName, "default", false, nil, false)
+	if err != nil {
+		t.Fatalf("failed to override backend: %s", err)
+	}
+	if _, err := os.Stat(filepath.Join(tf.Dir(), ".terragrunt-cache", "new", overrideFileName)); err != nil {
+		t.Errorf("expected the override file to be in the isolated cache dir: %s", err)
+	}
+	if err := switchBackToRemote(); err != nil {
+		t.Fatalf("failed to switch back to remote: %s", err)
+	}
+
+	if diff := cmp.Diff(snapshotDir(t, dir), before); diff != "" {
+		t.Errorf("expected the original dir not to be changed, diff: %s", diff)
+	}
+}
+
+// snapshotDir returns a map of relative paths to contents of files in a given
+// dir for comparison.
+func snapshotDir(t *testing.T, dir string) map[string]string {
+	t.Helper()
+	snapshot := make(map[string]string)
+	err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(dir, path)
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			snapshot[rel] = "<dir>"
+			return nil
+		}
+		b, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		snapshot[rel] = string(b)
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("failed to walk dir: %s", err)
+	}
+	return snapshot
+}
+
+func TestCheckNotCanceled(t *testing.T) {
+	ctx, cancel := context.WithCancelCause(context.Background())
+	if err := checkNotCanceled(ctx); err != nil {
+		t.Fatalf("unexpected err: %s", err)
+	}
+
+	cause := &tfexec.SignalError{Signal: os.Interrupt}
+	cancel(cause)
+	err := checkNotCanceled(ctx)
+	if err == nil {
+		t.Fatalf("expected to return an error, but no error")
+	}
+	if !errors.Is(err, cause) {
+		t.Errorf("expected to wrap the cause, got: %s", err)
+	}
+}
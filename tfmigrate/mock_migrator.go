@@ -3,8 +3,9 @@ package tfmigrate
 import (
 	"context"
 	"fmt"
-	"log"
+	"log/slog"
 
+	"github.com/minamijoyo/tfmigrate/logging"
 	"github.com/minamijoyo/tfmigrate/tfexec"
 )
 
@@ -55,28 +56,31 @@ func (m *MockMigrator) plan(_ context.Context) (*tfexec.State, error) {
 // Plan computes a new state by applying state migration operations to a temporary state.
 // It does nothing, but can return an error.
 func (m *MockMigrator) Plan(ctx context.Context) error {
-	log.Printf("[INFO] [migrator] start state migrator plan\n")
+	ctx = logging.With(ctx, "component", "migrator", "phase", "plan")
+	slog.InfoContext(ctx, "start state migrator plan")
 	_, err := m.plan(ctx)
 	if err != nil {
 		return err
 	}
-	log.Printf("[INFO] [migrator] state migrator plan success!\n")
+	slog.InfoContext(ctx, "state migrator plan success!")
 	return nil
 }
 
 // Apply computes a new state and pushes it to remote state.
 // It does nothing, but can return an error.
 func (m *MockMigrator) Apply(ctx context.Context) error {
-	log.Printf("[INFO] [migrator] start state migrator plan phase for apply\n")
+	ctx = logging.With(ctx, "component", "migrator", "phase", "plan")
+	slog.InfoContext(ctx, "start state migrator plan phase for apply")
 	_, err := m.plan(ctx)
 	if err != nil {
 		return err
 	}
 
-	log.Printf("[INFO] [migrator] start state migrator apply phase\n")
+	ctx = logging.With(ctx, "phase", "apply")
+	slog.InfoContext(ctx, "start state migrator apply phase")
 	if m.applyError {
 		return fmt.Errorf("failed to apply mock migrator: applyError = %t", m.applyError)
 	}
-	log.Printf("[INFO] [migrator] state migrator apply success!\n")
+	slog.InfoContext(ctx, "state migrator apply success!")
 	return nil
 }
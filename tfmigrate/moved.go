@@ -0,0 +1,335 @@
+package tfmigrate
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/hashicorp/hcl/v2"
+	"github.com/hashicorp/hcl/v2/hclsyntax"
+	"github.com/hashicorp/hcl/v2/hclwrite"
+	"github.com/minamijoyo/tfmigrate/logging"
+	"github.com/zclconf/go-cty/cty"
+)
+
+// MovedBlock is a moved block in Terraform configuration.
+type MovedBlock struct {
+	// From is an address of resource or module moved from.
+	From string
+	// To is an address of resource or module moved to.
+	To string
+}
+
+// LoadMovedBlocks reads moved blocks from .tf files in a given directory.
+// Note that it doesn't read child modules, because moved blocks in a child
+// module are relative to the module and can be applied only through it.
+func LoadMovedBlocks(ctx context.Context, dir string) ([]MovedBlock, error) {
+	ctx = logging.With(ctx, "component", "moved", "dir", dir)
+
+	filenames, err := filepath.Glob(filepath.Join(dir, "*.tf"))
+	if err != nil {
+		return nil, err
+	}
+
+	blocks := []MovedBlock{}
+	for _, filename := range filenames {
+		source, err := os.ReadFile(filename)
+		if err != nil {
+			return nil, err
+		}
+
+		file, diags := hclsyntax.ParseConfig(source, filename, hcl.Pos{Line: 1, Column: 1})
+		if diags.HasErrors() {
+			return nil, diags
+		}
+
+		body, ok := file.Body.(*hclsyntax.Body)
+		if !ok {
+			return nil, fmt.Errorf("failed to parse %s: unexpected body type", filename)
+		}
+
+		for _, b := range body.Blocks {
+			if b.Type != "moved" {
+				continue
+			}
+
+			from, err := movedBlockAddress(b, "from")
+			if err != nil {
+				return nil, err
+			}
+			to, err := movedBlockAddress(b, "to")
+			if err != nil {
+				return nil, err
+			}
+			slog.DebugContext(ctx, "found a moved block", "file", filename, "from", from, "to", to)
+			blocks = append(blocks, MovedBlock{From: from, To: to})
+		}
+	}
+
+	return blocks, nil
+}
+
+// movedBlockAddress returns an address of a given attribute in a moved block
+// in the canonical form.
+func movedBlockAddress(b *hclsyntax.Block, name string) (string, error) {
+	attr, ok := b.Body.Attributes[name]
+	if !ok {
+		return "", fmt.Errorf("%s: the %q attribute is required in a moved block", b.DefRange().String(), name)
+	}
+
+	traversal, diags := hcl.AbsTraversalForExpr(attr.Expr)
+	if diags.HasErrors() {
+		return "", fmt.Errorf("%s: the %q attribute must be an address", attr.Expr.Range().String(), name)
+	}
+
+	return formatTraversal(traversal)
+}
+
+// canonicalAddress parses a given address and returns it in the canonical
+// form, so that addresses which differ only in formatting such as spaces can
+// be compared as strings.
+func canonicalAddress(addr string) (string, error) {
+	traversal, diags := hclsyntax.ParseTraversalAbs([]byte(addr), "", hcl.Pos{Line: 1, Column: 1})
+	if diags.HasErrors() {
+		return "", fmt.Errorf("failed to parse address %q: %s", addr, diags)
+	}
+	return formatTraversal(traversal)
+}
+
+// formatTraversal returns a string representation of a given traversal in
+// the same form as Terraform prints an address.
+func formatTraversal(traversal hcl.Traversal) (string, error) {
+	var sb strings.Builder
+	for _, step := range traversal {
+		switch s := step.(type) {
+		case hcl.TraverseRoot:
+			sb.WriteString(s.Name)
+		case hcl.TraverseAttr:
+			sb.WriteString("." + s.Name)
+		case hcl.TraverseIndex:
+			switch {
+			case s.Key.IsNull() || !s.Key.IsKnown():
+				return "", fmt.Errorf("%s: invalid index key", s.SrcRange.String())
+			case s.Key.Type() == cty.String:
+				fmt.Fprintf(&sb, "[%q]", s.Key.AsString())
+			case s.Key.Type() == cty.Number:
+				fmt.Fprintf(&sb, "[%s]", s.Key.AsBigFloat().Text('f', -1))
+			default:
+				return "", fmt.Errorf("%s: invalid index key type %s", s.SrcRange.String(), s.Key.Type().FriendlyName())
+			}
+		default:
+			return "", fmt.Errorf("%s: unsupported traversal step", step.SourceRange().String())
+		}
+	}
+	return sb.String(), nil
+}
+
+// SortMovedBlocks sorts moved blocks in the order of state mv actions.
+// Terraform follows a chain of moved blocks such as A => B and B => C, so we
+// need to move A to B before moving B to C. Otherwise, the order of blocks is
+// preserved. It returns an error if the moved blocks have a cycle.
+func SortMovedBlocks(blocks []MovedBlock) ([]MovedBlock, error) {
+	sorted := []MovedBlock{}
+	done := make([]bool, len(blocks))
+	for len(sorted) < len(blocks) {
+		progress := false
+		for i, b := range blocks {
+			if done[i] || hasPendingMoveTo(blocks, done, b.From) {
+				continue
+			}
+			sorted = append(sorted, b)
+			done[i] = true
+			progress = true
+		}
+		if !progress {
+			return nil, fmt.Errorf("moved blocks have a cycle")
+		}
+	}
+	return sorted, nil
+}
+
+// hasPendingMoveTo returns true if any pending block moves something to a given address.
+func hasPendingMoveTo(blocks []MovedBlock, done []bool, addr string) bool {
+	for i, b := range blocks {
+		if !done[i] && b.To == addr {
+			return true
+		}
+	}
+	return false
+}
+
+// NewStateMigrationFromMovedBlocks renders a draft state migration file which
+// has mv actions equivalent to given moved blocks. If removeMovedBlocks is
+// true, it sets the remove_moved_blocks attribute so that the moved blocks
+// are removed after the migration is recorded in history.
+func NewStateMigrationFromMovedBlocks(blocks []MovedBlock, dir string, workspace string, name string, removeMovedBlocks bool) ([]byte, error) {
+	sorted, err := SortMovedBlocks(blocks)
+	if err != nil {
+		return nil, err
+	}
+
+	s := &suggestion{}
+	for _, b := range sorted {
+		s.moves = append(s.moves, &moveSuggestion{
+			source:           b.From,
+			destination:      b.To,
+			attributeMatched: true,
+		})
+	}
+
+	attrs := []migrationAttribute{{name: "dir", value: hclString(dir)}}
+	if workspace != "default" {
+		attrs = append(attrs, migrationAttribute{name: "workspace", value: hclString(workspace)})
+	}
+	if removeMovedBlocks {
+		attrs = append(attrs, migrationAttribute{name: "remove_moved_blocks", value: "true"})
+	}
+	return renderSuggestedMigration("state", name, attrs, s), nil
+}
+
+// RemoveMovedBlocks removes given moved blocks from .tf files in a given
+// directory. It returns the number of removed blocks. Addresses are compared
+// in the canonical form, so formatting differences don't matter. A given
+// block which is not found in any file is logged as a warning.
+func RemoveMovedBlocks(ctx context.Context, dir string, blocks []MovedBlock) (int, error) {
+	ctx = logging.With(ctx, "component", "moved", "dir", dir)
+
+	filenames, err := filepath.Glob(filepath.Join(dir, "*.tf"))
+	if err != nil {
+		return 0, err
+	}
+
+	// targets maps a block to remove to whether or not it has been found.
+	targets := make(map[MovedBlock]bool)
+	order := []MovedBlock{}
+	for _, b := range blocks {
+		mb, err := canonicalMovedBlock(b.From, b.To)
+		if err != nil {
+			slog.WarnContext(ctx, "skip a moved block with an invalid address", "from", b.From, "to", b.To, "error", err)
+			continue
+		}
+		if _, ok := targets[mb]; ok {
+			continue
+		}
+		targets[mb] = false
+		order = append(order, mb)
+	}
+
+	removed := 0
+	for _, filename := range filenames {
+		source, err := os.ReadFile(filename)
+		if err != nil {
+			return removed, err
+		}
+
+		file, diags := hclwrite.ParseConfig(source, filename, hcl.Pos{Line: 1, Column: 1})
+		if diags.HasErrors() {
+			return removed, diags
+		}
+
+		changed := false
+		for _, b := range file.Body().Blocks() {
+			if b.Type() != "moved" {
+				continue
+			}
+			from := b.Body().GetAttribute("from")
+			to := b.Body().GetAttribute("to")
+			if from == nil || to == nil {
+				continue
+			}
+			mb, err := canonicalMovedBlock(
+				string(from.Expr().BuildTokens(nil).Bytes()),
+				string(to.Expr().BuildTokens(nil).Bytes()),
+			)
+			if err != nil {
+				// Not a valid moved block, which Terraform rejects anyway.
+				continue
+			}
+			if _, ok := targets[mb]; !ok {
+				continue
+			}
+			slog.InfoContext(ctx, "remove a moved block", "file", filename, "from", mb.From, "to", mb.To)
+			file.Body().RemoveBlock(b)
+			targets[mb] = true
+			changed = true
+			removed++
+		}
+
+		if !changed {
+			continue
+		}
+
+		fi, err := os.Stat(filename)
+		if err != nil {
+			return removed, err
+		}
+		// Removing a block leaves blank lines around it, so squash them.
+		updated := consecutiveBlankLinesRe.ReplaceAll(hclwrite.Format(file.Bytes()), []byte("\n\n"))
+		updated = append(bytes.TrimRight(updated, "\n"), '\n')
+		if err := os.WriteFile(filename, updated, fi.Mode().Perm()); err != nil {
+			return removed, err
+		}
+	}
+
+	for _, mb := range order {
+		if !targets[mb] {
+			slog.WarnContext(ctx, "no moved block found for a mv action", "from", mb.From, "to", mb.To)
+		}
+	}
+
+	return removed, nil
+}
+
+// canonicalMovedBlock returns a moved block with given addresses in the
+// canonical form.
+func canonicalMovedBlock(from string, to string) (MovedBlock, error) {
+	f, err := canonicalAddress(strings.TrimSpace(from))
+	if err != nil {
+		return MovedBlock{}, err
+	}
+	t, err := canonicalAddress(strings.TrimSpace(to))
+	if err != nil {
+		return MovedBlock{}, err
+	}
+	return MovedBlock{From: f, To: t}, nil
+}
+
+// consecutiveBlankLinesRe matches two or more consecutive blank lines.
+var consecutiveBlankLinesRe = regexp.MustCompile(`\n{3,}`)
+
+// CleanupMovedBlocks removes moved blocks equivalent to mv actions of the
+// migration from .tf files in the working directory if remove_moved_blocks is
+// set. It's intended to be called after the migration is recorded in history.
+func (c *StateMigratorConfig) CleanupMovedBlocks(ctx context.Context) error {
+	if !c.RemoveMovedBlocks {
+		return nil
+	}
+
+	dir := "."
+	if len(c.Dir) > 0 {
+		dir = c.Dir
+	}
+
+	blocks := []MovedBlock{}
+	for _, cmdStr := range c.Actions {
+		action, err := NewStateActionFromString(cmdStr)
+		if err != nil {
+			return err
+		}
+		if mv, ok := action.(*StateMvAction); ok {
+			blocks = append(blocks, MovedBlock{From: mv.source, To: mv.destination})
+		}
+	}
+
+	n, err := RemoveMovedBlocks(ctx, dir, blocks)
+	if err != nil {
+		return err
+	}
+	slog.InfoContext(logging.With(ctx, "component", "moved", "dir", dir), "removed moved blocks", "count", n)
+	return nil
+}
@@ -0,0 +1,281 @@
+package tfmigrate
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestLoadMovedBlocks(t *testing.T) {
+	dir := t.TempDir()
+	files := map[string]string{
+		"main.tf": `
+resource "null_resource" "bar" {}
+
+moved {
+  from = null_resource.foo
+  to   = null_resource.bar
+}
+`,
+		"moved.tf": `
+moved {
+  from = module.foo[ "a" ]
+  to   = module.bar
+}
+`,
+		"README.md": `
+moved {
+  from = null_resource.ignored
+  to   = null_resource.ignored2
+}
+`,
+	}
+	for name, content := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0644); err != nil {
+			t.Fatalf("failed to write file: %s", err)
+		}
+	}
+
+	got, err := LoadMovedBlocks(context.Background(), dir)
+	if err != nil {
+		t.Fatalf("unexpected err: %s", err)
+	}
+
+	want := []MovedBlock{
+		{From: "null_resource.foo", To: "null_resource.bar"},
+		{From: `module.foo["a"]`, To: "module.bar"},
+	}
+	if diff := cmp.Diff(got, want); diff != "" {
+		t.Errorf("got: %#v, want = %#v, diff = %s", got, want, diff)
+	}
+}
+
+func TestLoadMovedBlocksInvalid(t *testing.T) {
+	cases := []struct {
+		desc   string
+		source string
+	}{
+		{
+			desc: "missing to",
+			source: `
+moved {
+  from = null_resource.foo
+}
+`,
+		},
+		{
+			desc: "not an address",
+			source: `
+moved {
+  from = "null_resource.foo"
+  to   = null_resource.bar
+}
+`,
+		},
+		{
+			desc: "syntax error",
+			source: `
+moved {
+`,
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.desc, func(t *testing.T) {
+			dir := t.TempDir()
+			if err := os.WriteFile(filepath.Join(dir, "main.tf"), []byte(tc.source), 0644); err != nil {
+				t.Fatalf("failed to write file: %s", err)
+			}
+			got, err := LoadMovedBlocks(context.Background(), dir)
+			if err == nil {
+				t.Fatalf("expected to return an error, but no error, got: %#v", got)
+			}
+		})
+	}
+}
+
+func TestSortMovedBlocks(t *testing.T) {
+	cases := []struct {
+		desc   string
+		blocks []MovedBlock
+		want   []MovedBlock
+		ok     bool
+	}{
+		{
+			desc: "chain",
+			blocks: []MovedBlock{
+				{From: "null_resource.b", To: "null_resource.c"},
+				{From: "null_resource.x", To: "null_resource.y"},
+				{From: "null_resource.a", To: "null_resource.b"},
+			},
+			want: []MovedBlock{
+				{From: "null_resource.x", To: "null_resource.y"},
+				{From: "null_resource.a", To: "null_resource.b"},
+				{From: "null_resource.b", To: "null_resource.c"},
+			},
+			ok: true,
+		},
+		{
+			desc: "cycle",
+			blocks: []MovedBlock{
+				{From: "null_resource.a", To: "null_resource.b"},
+				{From: "null_resource.b", To: "null_resource.a"},
+			},
+			ok: false,
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.desc, func(t *testing.T) {
+			got, err := SortMovedBlocks(tc.blocks)
+			if tc.ok && err != nil {
+				t.Fatalf("unexpected err: %s", err)
+			}
+			if !tc.ok && err == nil {
+				t.Fatalf("expected to return an error, but no error, got: %#v", got)
+			}
+			if tc.ok {
+				if diff := cmp.Diff(got, tc.want); diff != "" {
+					t.Errorf("got: %#v, want = %#v, diff = %s", got, tc.want, diff)
+				}
+			}
+		})
+	}
+}
+
+func TestCanonicalAddress(t *testing.T) {
+	cases := []struct {
+		desc string
+		addr string
+		want string
+		ok   bool
+	}{
+		{
+			desc: "resource",
+			addr: "null_resource.foo",
+			want: "null_resource.foo",
+			ok:   true,
+		},
+		{
+			desc: "string key with spaces",
+			addr: `module.foo[ "a" ].null_resource.bar`,
+			want: `module.foo["a"].null_resource.bar`,
+			ok:   true,
+		},
+		{
+			desc: "number key",
+			addr: "null_resource.foo[ 0 ]",
+			want: "null_resource.foo[0]",
+			ok:   true,
+		},
+		{
+			desc: "not an address",
+			addr: `"null_resource.foo"`,
+			ok:   false,
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.desc, func(t *testing.T) {
+			got, err := canonicalAddress(tc.addr)
+			if tc.ok && err != nil {
+				t.Fatalf("unexpected err: %s", err)
+			}
+			if !tc.ok && err == nil {
+				t.Fatalf("expected to return an error, but no error, got: %s", got)
+			}
+			if tc.ok && got != tc.want {
+				t.Errorf("got: %s, want: %s", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestNewStateMigrationFromMovedBlocks(t *testing.T) {
+	blocks := []MovedBlock{
+		{From: "null_resource.b", To: "null_resource.c"},
+		{From: "null_resource.a", To: "null_resource.b"},
+	}
+
+	got, err := NewStateMigrationFromMovedBlocks(blocks, "dir1", "default", "test", true)
+	if err != nil {
+		t.Fatalf("unexpected err: %s", err)
+	}
+
+	want := `migration "state" "test" {
+  dir = "dir1"
+  remove_moved_blocks = true
+  actions = [
+    "mv null_resource.a null_resource.b",
+    "mv null_resource.b null_resource.c",
+  ]
+}
+`
+	if diff := cmp.Diff(string(got), want); diff != "" {
+		t.Errorf("got:\n%s\nwant:\n%s\ndiff = %s", string(got), want, diff)
+	}
+}
+
+func TestStateMigratorConfigCleanupMovedBlocks(t *testing.T) {
+	dir := t.TempDir()
+	source := `resource "null_resource" "bar" {}
+
+moved {
+  from = null_resource.foo
+  to   = null_resource.bar
+}
+
+moved {
+  from = module.foo[ "a" ]
+  to   = module.bar
+}
+
+moved {
+  from = null_resource.list[0]
+  to   = null_resource.list[1]
+}
+
+moved {
+  from = null_resource.baz
+  to   = null_resource.qux
+}
+`
+	filename := filepath.Join(dir, "main.tf")
+	if err := os.WriteFile(filename, []byte(source), 0644); err != nil {
+		t.Fatalf("failed to write file: %s", err)
+	}
+
+	c := &StateMigratorConfig{
+		Dir: dir,
+		Actions: []string{
+			"mv null_resource.foo null_resource.bar",
+			`mv 'module.foo["a"]' module.bar`,
+			"mv null_resource.list[0] null_resource.list[1]",
+			"mv null_resource.missing null_resource.qux",
+			"rm null_resource.baz",
+		},
+		RemoveMovedBlocks: true,
+	}
+	if err := c.CleanupMovedBlocks(context.Background()); err != nil {
+		t.Fatalf("unexpected err: %s", err)
+	}
+
+	got, err := os.ReadFile(filename)
+	if err != nil {
+		t.Fatalf("failed to read file: %s", err)
+	}
+
+	want := `resource "null_resource" "bar" {}
+
+moved {
+  from = null_resource.baz
+  to   = null_resource.qux
+}
+`
+	if diff := cmp.Diff(string(got), want); diff != "" {
+		t.Errorf("got:\n%s\nwant:\n%s\ndiff = %s", string(got), want, diff)
+	}
+}
@@ -14,6 +14,17 @@ type MultiStateAction interface {
 	MultiStateUpdate(ctx context.Context, fromTf tfexec.TerraformCLI, toTf tfexec.TerraformCLI, fromState *tfexec.State, toState *tfexec.State) (*tfexec.State, *tfexec.State, error)
 }
 
+// InvertibleMultiStateAction is an optional interface for a MultiStateAction
+// which has a natural inverse. It's used for computing actions to roll back
+// a migration.
+type InvertibleMultiStateAction interface {
+	MultiStateAction
+	// Inverse returns a new action which reverts the action.
+	// Note that the returned action moves a resource in the opposite direction,
+	// so it must be run with swapped from and to states.
+	Inverse() MultiStateAction
+}
+
 // NewMultiStateActionFromString is a factory method which returns a new
 // MultiStateAction from a given string.
 // cmdStr is a plain text for state operation.
@@ -4,10 +4,14 @@ import (
 	"context"
 	"errors"
 	"fmt"
-	"log"
+	"log/slog"
 	"os"
+	"sort"
 
+	"github.com/minamijoyo/tfmigrate/logging"
 	"github.com/minamijoyo/tfmigrate/tfexec"
+	"github.com/minamijoyo/tfmigrate/tracing"
+	"go.opentelemetry.io/otel/trace"
 )
 
 // MultiStateMigratorConfig is a config for MultiStateMigrator.
@@ -30,10 +34,19 @@ type MultiStateMigratorConfig struct {
 	// Each action is a plain text for state operation.
 	// Valid formats are the following.
 	// "mv <source> <destination>"
-	Actions []string `hcl:"actions"`
+	// Either Actions or Up is required.
+	Actions []string `hcl:"actions,optional"`
 	// Force option controls behaviour in case of unexpected diff in plan.
 	// When set forces applying even if plan shows diff.
 	Force bool `hcl:"force,optional"`
+	// Up is a block which defines actions of the migration.
+	// It's an alternative to Actions to pair with Down, and the parser copies
+	// its actions to Actions.
+	Up *UpConfig `hcl:"up,block"`
+	// Down is a block which defines actions to roll back the migration.
+	// The actions move resources from ToDir back to FromDir.
+	// If not set, they are computed from inverses of the actions.
+	Down *DownConfig `hcl:"down,block"`
 }
 
 // MultiStateMigratorConfig implements a MigratorConfig.
@@ -68,6 +81,12 @@ func (c *MultiStateMigratorConfig) NewMigrator(o *MigratorOption) (Migrator, err
 
 // MultiStateMigrator implements the Migrator interface.
 type MultiStateMigrator struct {
+	// fromDir is a working directory where states of resources move from.
+	// It's used as a key for locks and backups even in isolated mode.
+	fromDir string
+	// toDir is a working directory where states of resources move to.
+	// It's used as a key for locks and backups even in isolated mode.
+	toDir string
 	// fromTf is an instance of TerraformCLI which executes terraform command in a fromDir.
 	fromTf tfexec.TerraformCLI
 	// fromSkipPlan disables the running of Terraform plan in fromDir.
@@ -94,16 +113,12 @@ var _ Migrator = (*MultiStateMigrator)(nil)
 // NewMultiStateMigrator returns a new MultiStateMigrator instance.
 func NewMultiStateMigrator(fromDir string, toDir string, fromWorkspace string, toWorkspace string,
 	actions []MultiStateAction, o *MigratorOption, force bool, fromSkipPlan bool, toSkipPlan bool) *MultiStateMigrator {
-	fromTf := tfexec.NewTerraformCLI(tfexec.NewExecutor(fromDir, os.Environ()))
-	toTf := tfexec.NewTerraformCLI(tfexec.NewExecutor(toDir, os.Environ()))
-	if o != nil && len(o.ExecPath) > 0 {
-		// While NewTerraformCLI reads the environment variable TFMIGRATE_EXEC_PATH
-		// at initialization, the MigratorOption takes precedence over it.
-		fromTf.SetExecPath(o.ExecPath)
-		toTf.SetExecPath(o.ExecPath)
-	}
+	fromTf := newTerraformCLI(o, fromDir, os.Environ())
+	toTf := newTerraformCLI(o, toDir, os.Environ())
 
 	return &MultiStateMigrator{
+		fromDir:       fromDir,
+		toDir:         toDir,
 		fromTf:        fromTf,
 		fromSkipPlan:  fromSkipPlan,
 		toTf:          toTf,
@@ -120,99 +135,159 @@ func NewMultiStateMigrator(fromDir string, toDir string, fromWorkspace string, t
 // It will fail if terraform plan detects any diffs with at least one new state.
 // We intentionally make this method private to avoid exposing internal states and unify
 // the Migrator interface between a single and multi state migrator.
-func (m *MultiStateMigrator) plan(ctx context.Context) (fromCurrentState *tfexec.State, toCurrentState *tfexec.State, err error) {
+// It returns the pulled remote states as well as the new states so that the
+// caller can back up the remote states before pushing new ones.
+func (m *MultiStateMigrator) plan(ctx context.Context) (fromPulledState *tfexec.State, toPulledState *tfexec.State, fromCurrentState *tfexec.State, toCurrentState *tfexec.State, err error) {
+	ctx, span := tracing.Start(ctx, "plan phase", tracing.AttrPhase.String("plan"))
+	defer func() { tracing.End(span, err) }()
+
+	fromCtx := logContext(ctx, m.fromDir, m.fromWorkspace)
+	toCtx := logContext(ctx, m.toDir, m.toWorkspace)
+
 	// setup fromDir.
-	fromCurrentState, fromSwitchBackToRemoteFunc, err := setupWorkDir(ctx, m.fromTf, m.fromWorkspace, m.o.IsBackendTerraformCloud, m.o.BackendConfig, false)
+	fromCurrentState, fromSwitchBackToRemoteFunc, err := setupWorkDir(fromCtx, m.fromTf, m.fromWorkspace, m.o.IsBackendTerraformCloud, m.o.BackendConfig, false)
 	if err != nil {
-		return nil, nil, err
+		return nil, nil, nil, nil, err
 	}
+	fromPulledState = fromCurrentState
+	fromCurrentState = chainedState(m.o, m.fromDir, m.fromWorkspace, fromCurrentState)
 	// switch back it to remote on exit.
 	defer func() {
 		err = errors.Join(err, fromSwitchBackToRemoteFunc())
 	}()
 
 	// setup toDir.
-	toCurrentState, toSwitchBackToRemoteFunc, err := setupWorkDir(ctx, m.toTf, m.toWorkspace, m.o.IsBackendTerraformCloud, m.o.BackendConfig, false)
+	toCurrentState, toSwitchBackToRemoteFunc, err := setupWorkDir(toCtx, m.toTf, m.toWorkspace, m.o.IsBackendTerraformCloud, m.o.BackendConfig, false)
 	if err != nil {
-		return nil, nil, err
+		return nil, nil, nil, nil, err
 	}
+	toPulledState = toCurrentState
+	toCurrentState = chainedState(m.o, m.toDir, m.toWorkspace, toCurrentState)
 	// switch back it to remote on exit.
 	defer func() {
 		err = errors.Join(err, toSwitchBackToRemoteFunc())
 	}()
 
-	// computes new states by applying state migration operations to temporary states.
-	log.Printf("[INFO] [migrator] compute new states (%s => %s)\n", m.fromTf.Dir(), m.toTf.Dir())
-	var fromNewState, toNewState *tfexec.State
-	for _, action := range m.actions {
-		fromNewState, toNewState, err = action.MultiStateUpdate(ctx, m.fromTf, m.toTf, fromCurrentState, toCurrentState)
-		if err != nil {
-			return nil, nil, err
-		}
-		fromCurrentState = tfexec.NewState(fromNewState.Bytes())
-		toCurrentState = tfexec.NewState(toNewState.Bytes())
+	fromCurrentState, toCurrentState, err = m.computeNewStates(ctx, fromCurrentState, toCurrentState)
+	if err != nil {
+		return nil, nil, nil, nil, err
 	}
 
 	// build plan options
-	planOpts := []string{"-input=false", "-no-color", "-detailed-exitcode"}
+	fromPlanOpts := []string{"-input=false", "-no-color", "-detailed-exitcode"}
+	toPlanOpts := []string{"-input=false", "-no-color", "-detailed-exitcode"}
 	if m.o.PlanOut != "" {
-		planOpts = append(planOpts, "-out="+m.o.PlanOut)
+		fromPlanOutOpt, err := planOutOption(m.o, m.fromDir)
+		if err != nil {
+			return nil, nil, nil, nil, err
+		}
+		fromPlanOpts = append(fromPlanOpts, fromPlanOutOpt)
+		toPlanOutOpt, err := planOutOption(m.o, m.toDir)
+		if err != nil {
+			return nil, nil, nil, nil, err
+		}
+		toPlanOpts = append(toPlanOpts, toPlanOutOpt)
 	}
 
 	if m.fromSkipPlan {
-		log.Printf("[INFO] [migrator@%s] skipping check diffs\n", m.fromTf.Dir())
+		slog.InfoContext(fromCtx, "skipping check diffs")
+	} else if !needsPlanCheck(m.o, m.fromDir, m.fromWorkspace) {
+		slog.InfoContext(fromCtx, "skipping check diffs until the last pending migration")
 	} else {
 		// check if a plan in fromDir has no changes.
-		log.Printf("[INFO] [migrator@%s] check diffs\n", m.fromTf.Dir())
-		_, err = m.fromTf.Plan(ctx, fromCurrentState, planOpts...)
+		slog.InfoContext(fromCtx, "check diffs")
+		_, err = m.fromTf.Plan(fromCtx, fromCurrentState, fromPlanOpts...)
 		if err != nil {
 			if exitErr, ok := err.(tfexec.ExitError); ok && exitErr.ExitCode() == 2 {
 				if !m.force {
-					log.Printf("[ERROR] [migrator@%s] unexpected diffs\n", m.fromTf.Dir())
-					return nil, nil, fmt.Errorf("terraform plan command returns unexpected diffs in %s from_dir: %s", m.fromTf.Dir(), err)
+					slog.ErrorContext(fromCtx, "unexpected diffs")
+					return nil, nil, nil, nil, fmt.Errorf("terraform plan command returns unexpected diffs in %s from_dir: %s", m.fromTf.Dir(), err)
 				}
-				log.Printf("[INFO] [migrator@%s] unexpected diffs, ignoring as force option is true: %s", m.fromTf.Dir(), err)
+				slog.InfoContext(fromCtx, "unexpected diffs, ignoring as force option is true", "error", err)
 				// reset err to nil to intentionally ignore unexpected diffs.
 				err = nil
 			} else {
-				return nil, nil, err
+				return nil, nil, nil, nil, err
 			}
 		}
 	}
 
 	if m.toSkipPlan {
-		log.Printf("[INFO] [migrator@%s] skipping check diffs\n", m.toTf.Dir())
+		slog.InfoContext(toCtx, "skipping check diffs")
+	} else if !needsPlanCheck(m.o, m.toDir, m.toWorkspace) {
+		slog.InfoContext(toCtx, "skipping check diffs until the last pending migration")
 	} else {
 		// check if a plan in toDir has no changes.
-		log.Printf("[INFO] [migrator@%s] check diffs\n", m.toTf.Dir())
-		_, err = m.toTf.Plan(ctx, toCurrentState, planOpts...)
+		slog.InfoContext(toCtx, "check diffs")
+		_, err = m.toTf.Plan(toCtx, toCurrentState, toPlanOpts...)
 		if err != nil {
 			if exitErr, ok := err.(tfexec.ExitError); ok && exitErr.ExitCode() == 2 {
 				if !m.force {
-					log.Printf("[ERROR] [migrator@%s] unexpected diffs\n", m.toTf.Dir())
-					return nil, nil, fmt.Errorf("terraform plan command returns unexpected diffs in %s to_dir: %s", m.toTf.Dir(), err)
+					slog.ErrorContext(toCtx, "unexpected diffs")
+					return nil, nil, nil, nil, fmt.Errorf("terraform plan command returns unexpected diffs in %s to_dir: %s", m.toTf.Dir(), err)
 				}
-				log.Printf("[INFO] [migrator@%s] unexpected diffs, ignoring as force option is true: %s", m.toTf.Dir(), err)
+				slog.InfoContext(toCtx, "unexpected diffs, ignoring as force option is true", "error", err)
 				// reset err to nil to intentionally ignore unexpected diffs.
 				err = nil
 			} else {
-				return nil, nil, err
+				return nil, nil, nil, nil, err
 			}
 		}
 	}
 
-	return fromCurrentState, toCurrentState, err
+	storeChainedState(m.o, m.fromDir, m.fromWorkspace, fromCurrentState)
+	storeChainedState(m.o, m.toDir, m.toWorkspace, toCurrentState)
+	return fromPulledState, toPulledState, fromCurrentState, toCurrentState, err
+}
+
+// computeNewStates computes new states by applying multi state migration
+// operations to given temporary states.
+func (m *MultiStateMigrator) computeNewStates(ctx context.Context, fromCurrentState *tfexec.State, toCurrentState *tfexec.State) (_ *tfexec.State, _ *tfexec.State, err error) {
+	ctx, span := tracing.Start(ctx, "compute new states")
+	defer func() { tracing.End(span, err) }()
+
+	slog.InfoContext(ctx, "compute new states")
+	for _, action := range m.actions {
+		fromNewState, toNewState, err := action.MultiStateUpdate(ctx, m.fromTf, m.toTf, fromCurrentState, toCurrentState)
+		if err != nil {
+			return nil, nil, err
+		}
+		fromCurrentState = tfexec.NewState(fromNewState.Bytes())
+		toCurrentState = tfexec.NewState(toNewState.Bytes())
+	}
+	return fromCurrentState, toCurrentState, nil
+}
+
+// startSpan starts a span for the migrator.
+func (m *MultiStateMigrator) startSpan(ctx context.Context, name string) (context.Context, trace.Span) {
+	return tracing.Start(ctx, name,
+		tracing.AttrDir.StringSlice([]string{m.fromDir, m.toDir}),
+		tracing.AttrWorkspace.StringSlice([]string{m.fromWorkspace, m.toWorkspace}),
+	)
 }
 
 // Plan computes new states by applying multi state migration operations to temporary states.
 // It will fail if terraform plan detects any diffs with at least one new state.
-func (m *MultiStateMigrator) Plan(ctx context.Context) error {
-	log.Printf("[INFO] [migrator] multi start state migrator plan\n")
-	_, _, err := m.plan(ctx)
+func (m *MultiStateMigrator) Plan(ctx context.Context) (err error) {
+	ctx, span := m.startSpan(ctx, "multi state migrator plan")
+	defer func() { tracing.End(span, err) }()
+
+	ctx = logging.With(m.logContext(ctx), "phase", "plan")
+	cleanup, err := m.isolate(ctx)
+	if err != nil {
+		return err
+	}
+	// remove the isolated work dirs on exit.
+	defer func() {
+		err = errors.Join(err, cleanup())
+	}()
+
+	slog.InfoContext(ctx, "start multi state migrator plan")
+	_, _, _, _, err = m.plan(ctx)
 	if err != nil {
 		return err
 	}
-	log.Printf("[INFO] [migrator] multi state migrator plan success!\n")
+	slog.InfoContext(ctx, "multi state migrator plan success!")
 	return nil
 }
 
@@ -220,11 +295,116 @@ func (m *MultiStateMigrator) Plan(ctx context.Context) error {
 // It will fail if terraform plan detects any diffs with at least one new state.
 // We are intended to this is used for state refactoring.
 // Any state migration operations should not break any real resources.
-func (m *MultiStateMigrator) Apply(ctx context.Context) error {
+// If the remote states have been changed during the migration, it aborts or
+// re-runs the migration against the fresh remote states.
+func (m *MultiStateMigrator) Apply(ctx context.Context) (err error) {
+	ctx, span := m.startSpan(ctx, "multi state migrator apply")
+	defer func() { tracing.End(span, err) }()
+
+	ctx = logging.With(m.logContext(ctx), "phase", "apply")
+	cleanup, err := m.isolate(ctx)
+	if err != nil {
+		return err
+	}
+	// remove the isolated work dirs on exit.
+	defer func() {
+		err = errors.Join(err, cleanup())
+	}()
+
+	return rerunOnRemoteStateChange(ctx, m.o, m.apply)
+}
+
+// logContext returns a context which adds both dirs and workspaces to log
+// records. The dir and workspace fields are set for each side when logging
+// operations for either one.
+func (m *MultiStateMigrator) logContext(ctx context.Context) context.Context {
+	return logging.With(ctx,
+		"component", "migrator",
+		"from_dir", m.fromDir,
+		"from_workspace", m.fromWorkspace,
+		"to_dir", m.toDir,
+		"to_workspace", m.toWorkspace,
+	)
+}
+
+// isolate switches the TerraformCLIs to isolated work dirs if enabled, and
+// returns a function to switch them back and remove the isolated work dirs.
+func (m *MultiStateMigrator) isolate(ctx context.Context) (func() error, error) {
+	fromTf, fromCleanup, err := isolateWorkDir(logContext(ctx, m.fromDir, m.fromWorkspace), m.o, m.fromTf, m.fromDir)
+	if err != nil {
+		return nil, err
+	}
+	toTf, toCleanup, err := isolateWorkDir(logContext(ctx, m.toDir, m.toWorkspace), m.o, m.toTf, m.toDir)
+	if err != nil {
+		return nil, errors.Join(err, fromCleanup())
+	}
+
+	origFromTf, origToTf := m.fromTf, m.toTf
+	m.fromTf, m.toTf = fromTf, toTf
+	return func() error {
+		m.fromTf, m.toTf = origFromTf, origToTf
+		return errors.Join(fromCleanup(), toCleanup())
+	}, nil
+}
+
+// apply computes new states and pushes them to remote states.
+// It holds locks of both remote states from pulling the states until pushing
+// new states.
+func (m *MultiStateMigrator) apply(ctx context.Context) (err error) {
+	// To avoid a deadlock with another migration which moves resources in the
+	// opposite direction, acquire locks in a consistent order.
+	type target struct {
+		dir       string
+		workspace string
+	}
+	targets := []target{
+		{dir: m.fromDir, workspace: m.fromWorkspace},
+		{dir: m.toDir, workspace: m.toWorkspace},
+	}
+	sort.Slice(targets, func(i, j int) bool {
+		if targets[i].dir != targets[j].dir {
+			return targets[i].dir < targets[j].dir
+		}
+		return targets[i].workspace < targets[j].workspace
+	})
+	for _, t := range targets {
+		unlock, lockErr := lockState(ctx, m.o, t.dir, t.workspace)
+		if lockErr != nil {
+			return lockErr
+		}
+		// release the lock on exit even if canceled.
+		defer func() {
+			err = errors.Join(err, unlock(context.WithoutCancel(ctx)))
+		}()
+	}
+
 	// Check if new states don't have any diffs compared to real resources
 	// before push new states to remote.
-	log.Printf("[INFO] [migrator] start multi state migrator plan phase for apply\n")
-	fromState, toState, err := m.plan(ctx)
+	planCtx := logging.With(ctx, "phase", "plan")
+	slog.InfoContext(planCtx, "start multi state migrator plan phase for apply")
+	fromPulledState, toPulledState, fromState, toState, err := m.plan(planCtx)
+	if err != nil {
+		return err
+	}
+
+	// make sure that no one has changed the remote states since we pulled them.
+	// Both of them are checked before pushing either one.
+	err = checkRemoteStateUnchanged(logContext(ctx, m.fromDir, m.fromWorkspace), m.fromTf, fromPulledState)
+	if err != nil {
+		return err
+	}
+	err = checkRemoteStateUnchanged(logContext(ctx, m.toDir, m.toWorkspace), m.toTf, toPulledState)
+	if err != nil {
+		return err
+	}
+
+	// back up the current remote states before overwriting them.
+	// Both of them are saved before pushing either one.
+	err = backupState(ctx, m.o, m.fromDir, m.fromWorkspace, fromPulledState)
+	if err != nil {
+		return err
+	}
+	err = backupState(ctx, m.o, m.toDir, m.toWorkspace, toPulledState)
 	if err != nil {
 		return err
 	}
@@ -232,17 +412,112 @@ func (m *MultiStateMigrator) Apply(ctx context.Context) error {
 	// push the new states to remote.
 	// We push toState before fromState, because when moving resources across
 	// states, write them to new state first and then remove them from old one.
-	log.Printf("[INFO] [migrator] start multi state migrator apply phase\n")
-	log.Printf("[INFO] [migrator@%s] push the new state to remote\n", m.toTf.Dir())
-	err = m.toTf.StatePush(ctx, toState)
+	// Once started, both of them are pushed even if canceled.
+	err = checkNotCanceled(ctx)
 	if err != nil {
 		return err
 	}
-	log.Printf("[INFO] [migrator@%s] push the new state to remote\n", m.fromTf.Dir())
-	err = m.fromTf.StatePush(ctx, fromState)
+	pushCtx, pushSpan := tracing.Start(context.WithoutCancel(ctx), "apply phase", tracing.AttrPhase.String("apply"))
+	slog.InfoContext(pushCtx, "start multi state migrator apply phase")
+	err = m.push(pushCtx, fromPulledState, fromState, toState, toPulledState)
+	tracing.End(pushSpan, err)
 	if err != nil {
 		return err
 	}
-	log.Printf("[INFO] [migrator] multi state migrator apply success!\n")
+	slog.InfoContext(ctx, "multi state migrator apply success!")
 	return nil
 }
+
+// push pushes toState and then fromState. If pushing fromState fails, the
+// moved resources may exist in both states. The push may have landed even if
+// it reported an error, so it re-pulls the state of from_dir and pushes back
+// toPulledState to to_dir, or an empty state if to_dir had no state, to cancel
+// the move only if the state of from_dir is provably unchanged from
+// fromPulledState. Pushing a state is never retried.
+// The returned error describes which state ended up where and what remains to
+// be done manually.
+func (m *MultiStateMigrator) push(ctx context.Context, fromPulledState *tfexec.State, fromState *tfexec.State, toState *tfexec.State, toPulledState *tfexec.State) error {
+	from := fmt.Sprintf("%s (workspace: %s)", m.fromDir, m.fromWorkspace)
+	to := fmt.Sprintf("%s (workspace: %s)", m.toDir, m.toWorkspace)
+	fromCtx := logContext(ctx, m.fromDir, m.fromWorkspace)
+	toCtx := logContext(ctx, m.toDir, m.toWorkspace)
+
+	slog.InfoContext(toCtx, "push the new state to remote")
+	if err := m.toTf.StatePush(ctx, toState); err != nil {
+		return fmt.Errorf("failed to push the new state to %s, neither state has been changed: %s", to, err)
+	}
+
+	slog.InfoContext(fromCtx, "push the new state to remote")
+	err := m.fromTf.StatePush(ctx, fromState)
+	if err == nil {
+		return nil
+	}
+	slog.ErrorContext(fromCtx, "failed to push the new state", "error", err)
+	pushErr := fmt.Errorf("failed to push the new state to %s after pushing the new state to %s: %s", from, to, err)
+
+	// If the push to from_dir has actually landed, pushing back the original
+	// state to to_dir would lose the moved resources from both states.
+	// Cancel the move only if the state of from_dir is provably unchanged.
+	if checkErr := checkRemoteStateUnchanged(fromCtx, m.fromTf, fromPulledState); checkErr != nil {
+		return fmt.Errorf("%s. The new state has been pushed to %s, but the state of %s couldn't be verified as unchanged, so the state of %s has been left as it is: %s. "+
+			"Check if the moved resources remain in %s with: terraform -chdir=%s state list. "+
+			"If they remain, %s",
+			pushErr, to, from, to, checkErr, from, m.fromDir, m.manualPushInstruction(fromState))
+	}
+
+	// Cancel the move by pushing back the original state to to_dir. Its serial
+	// is lower than the pushed one, so we need to force push it. If no state
+	// existed before the migration, push an empty state with the same lineage
+	// instead, because there is nothing to push back.
+	if len(toPulledState.Bytes()) == 0 {
+		slog.WarnContext(toCtx, "push an empty state to remote, because no state existed before the migration")
+		if compensateErr := pushEmptyState(ctx, m.toTf, toState); compensateErr != nil {
+			slog.ErrorContext(toCtx, "failed to push an empty state", "error", compensateErr)
+			return fmt.Errorf("%s, and failed to push an empty state to %s: %s. "+
+				"The new state has been pushed to %s, but the state of %s is unchanged, so the moved resources are managed in both states, and %s",
+				pushErr, to, compensateErr, to, from, m.manualPushInstruction(fromState))
+		}
+		return fmt.Errorf("%s. No state existed in %s before the migration, so an empty state has been pushed to it, and the moved resources are managed only in %s", pushErr, to, from)
+	}
+
+	slog.WarnContext(toCtx, "push back the original state to remote")
+	compensateErr := m.toTf.StatePush(ctx, toPulledState, "-force")
+	if compensateErr == nil {
+		return fmt.Errorf("%s. The state of %s has been pushed back to the original one, so neither state has been changed", pushErr, to)
+	}
+	slog.ErrorContext(toCtx, "failed to push back the original state", "error", compensateErr)
+
+	// The moved resources are managed in both states. Save the new state of
+	// from_dir so that the user can push it manually.
+	return fmt.Errorf("%s, and failed to push back the original state to %s: %s. "+
+		"The new state has been pushed to %s, but the state of %s is unchanged, so the moved resources are managed in both states, and %s",
+		pushErr, to, compensateErr, to, from, m.manualPushInstruction(fromState))
+}
+
+// manualPushInstruction saves a given new state of from_dir to a file and
+// returns an instruction to push it manually.
+func (m *MultiStateMigrator) manualPushInstruction(fromState *tfexec.State) string {
+	from := fmt.Sprintf("%s (workspace: %s)", m.fromDir, m.fromWorkspace)
+	filename, err := saveStateFile(fromState)
+	if err != nil {
+		return fmt.Sprintf("remove the moved resources from the state of %s manually. The new state couldn't be saved: %s", from, err)
+	}
+	return fmt.Sprintf("the new state of %s has been saved to %s. Push it manually in the workspace: terraform -chdir=%s state push %s", from, filename, m.fromDir, filename)
+}
+
+// saveStateFile saves a given state to a new temporary file and returns its
+// path.
+func saveStateFile(state *tfexec.State) (string, error) {
+	f, err := os.CreateTemp("", "tfmigrate-*.tfstate")
+	if err != nil {
+		return "", err
+	}
+	if _, err := f.Write(state.Bytes()); err != nil {
+		f.Close()
+		return "", err
+	}
+	if err := f.Close(); err != nil {
+		return "", err
+	}
+	return f.Name(), nil
+}
@@ -161,6 +161,165 @@ func TestMultiStateMigratorConfigNewMigrator(t *testing.T) {
 	}
 }
 
+// pushRecorder is a TerraformCLI which records pushed states and fails to
+// push for a given number of times. StatePull returns a given state.
+type pushRecorder struct {
+	tfexec.TerraformCLI
+	dir      string
+	failures int
+	pushed   []string
+	pulled   string
+	pullErr  error
+}
+
+func (r *pushRecorder) Dir() string {
+	return r.dir
+}
+
+func (r *pushRecorder) StatePush(_ context.Context, state *tfexec.State, _ ...string) error {
+	if r.failures != 0 {
+		r.failures--
+		return fmt.Errorf("failed to push %s", state.Bytes())
+	}
+	r.pushed = append(r.pushed, string(state.Bytes()))
+	return nil
+}
+
+func (r *pushRecorder) StatePull(_ context.Context, _ ...string) (*tfexec.State, error) {
+	if r.pullErr != nil {
+		return nil, r.pullErr
+	}
+	return tfexec.NewState([]byte(r.pulled)), nil
+}
+
+func TestMultiStateMigratorPush(t *testing.T) {
+	from0 := `{"lineage": "from", "serial": 1}`
+	from1 := `{"lineage": "from", "serial": 2}`
+	to1 := `{"lineage": "to", "serial": 1, "resources": [{"name": "foo"}]}`
+	toEmpty := `{
+  "lineage": "to",
+  "outputs": {},
+  "resources": [],
+  "serial": 2
+}`
+	cases := []struct {
+		desc         string
+		fromFailures int
+		toFailures   int
+		fromPulled   string
+		fromPullErr  error
+		toPulled     string
+		wantFrom     []string
+		wantTo       []string
+		wantErr      string
+	}{
+		{
+			desc:         "success",
+			fromFailures: 0,
+			toFailures:   0,
+			fromPulled:   from0,
+			fromPullErr:  nil,
+			toPulled:     "to0",
+			wantFrom:     []string{from1},
+			wantTo:       []string{to1},
+			wantErr:      "",
+		},
+		{
+			desc:         "to push fails",
+			fromFailures: 0,
+			toFailures:   1,
+			fromPulled:   from0,
+			fromPullErr:  nil,
+			toPulled:     "to0",
+			wantFrom:     nil,
+			wantTo:       nil,
+			wantErr:      "neither state has been changed",
+		},
+		{
+			desc:         "from push is never retried",
+			fromFailures: 1,
+			toFailures:   0,
+			fromPulled:   from0,
+			fromPullErr:  nil,
+			toPulled:     "to0",
+			wantFrom:     nil,
+			wantTo:       []string{to1, "to0"},
+			wantErr:      "has been pushed back to the original one",
+		},
+		{
+			desc:         "from push fails and to was empty",
+			fromFailures: 1,
+			toFailures:   0,
+			fromPulled:   from0,
+			fromPullErr:  nil,
+			toPulled:     "",
+			wantFrom:     nil,
+			wantTo:       []string{to1, toEmpty},
+			wantErr:      "an empty state has been pushed to it",
+		},
+		{
+			desc:         "from push fails but has landed",
+			fromFailures: 1,
+			toFailures:   0,
+			fromPulled:   from1,
+			fromPullErr:  nil,
+			toPulled:     "to0",
+			wantFrom:     nil,
+			wantTo:       []string{to1},
+			wantErr:      "has been left as it is",
+		},
+		{
+			desc:         "from push fails and pull fails",
+			fromFailures: 1,
+			toFailures:   0,
+			fromPulled:   "",
+			fromPullErr:  fmt.Errorf("failed to pull"),
+			toPulled:     "to0",
+			wantFrom:     nil,
+			wantTo:       []string{to1},
+			wantErr:      "has been saved to",
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.desc, func(t *testing.T) {
+			fromTf := &pushRecorder{dir: "dir1", failures: tc.fromFailures, pulled: tc.fromPulled, pullErr: tc.fromPullErr}
+			toTf := &pushRecorder{dir: "dir2", failures: tc.toFailures}
+			m := &MultiStateMigrator{
+				fromTf:        fromTf,
+				toTf:          toTf,
+				fromDir:       "dir1",
+				toDir:         "dir2",
+				fromWorkspace: "default",
+				toWorkspace:   "default",
+			}
+
+			err := m.push(context.Background(), tfexec.NewState([]byte(from0)), tfexec.NewState([]byte(from1)), tfexec.NewState([]byte(to1)), tfexec.NewState([]byte(tc.toPulled)))
+			if tc.wantErr == "" && err != nil {
+				t.Fatalf("unexpected err: %s", err)
+			}
+			if tc.wantErr != "" && (err == nil || !strings.Contains(err.Error(), tc.wantErr)) {
+				t.Fatalf("expected an error containing %q, got: %v", tc.wantErr, err)
+			}
+			if !reflect.DeepEqual(fromTf.pushed, tc.wantFrom) {
+				t.Errorf("got from states: %v, want: %v", fromTf.pushed, tc.wantFrom)
+			}
+			if !reflect.DeepEqual(toTf.pushed, tc.wantTo) {
+				t.Errorf("got to states: %v, want: %v", toTf.pushed, tc.wantTo)
+			}
+			if err != nil && strings.Contains(err.Error(), "has been saved to") {
+				filename := strings.Fields(err.Error()[strings.Index(err.Error(), "has been saved to"):])[4]
+				filename = strings.TrimSuffix(filename, ".")
+				defer os.Remove(filename)
+				b, rerr := os.ReadFile(filename)
+				if rerr != nil || string(b) != from1 {
+					t.Errorf("expected the new state to be saved to %s, got: %q, %v", filename, b, rerr)
+				}
+			}
+		})
+	}
+}
+
 func TestAccMultiStateMigratorApplySimple(t *testing.T) {
 	tfexec.SkipUnlessAcceptanceTestEnabled(t)
 	ctx := context.Background()
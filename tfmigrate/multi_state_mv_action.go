@@ -16,7 +16,7 @@ type MultiStateMvAction struct {
 	destination string
 }
 
-var _ MultiStateAction = (*MultiStateMvAction)(nil)
+var _ InvertibleMultiStateAction = (*MultiStateMvAction)(nil)
 
 // NewMultiStateMvAction returns a new MultiStateMvAction instance.
 func NewMultiStateMvAction(source string, destination string) *MultiStateMvAction {
@@ -45,3 +45,9 @@ func (a *MultiStateMvAction) MultiStateUpdate(ctx context.Context, fromTf tfexec
 
 	return fromNewState, toNewState, nil
 }
+
+// Inverse returns a new action which moves a resource from destination address
+// back to source address. It must be run with swapped from and to states.
+func (a *MultiStateMvAction) Inverse() MultiStateAction {
+	return NewMultiStateMvAction(a.destination, a.source)
+}
@@ -45,7 +45,10 @@ func (a *MultiStateXmvAction) MultiStateUpdate(ctx context.Context, fromTf tfexe
 }
 
 // generateMvActions uses an xmv and use the state to determine the corresponding mv actions.
-func (a *MultiStateXmvAction) generateMvActions(ctx context.Context, fromTf tfexec.TerraformCLI, fromState *tfexec.State) ([]*MultiStateMvAction, error) {
+func (a *MultiStateXmvAction) generateMvActions(ctx context.Context, fromTf tfexec.TerraformCLI, fromState *tfexec.State) (actions []*MultiStateMvAction, err error) {
+	ctx, span := startXmvSpan(ctx, a.source, a.destination)
+	defer func() { endXmvSpan(span, len(actions), err) }()
+
 	stateList, err := fromTf.StateList(ctx, fromState, nil)
 	if err != nil {
 		return nil, err
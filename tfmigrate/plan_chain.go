@@ -0,0 +1,164 @@
+package tfmigrate
+
+import (
+	"log/slog"
+	"path/filepath"
+	"sync"
+
+	"github.com/minamijoyo/tfmigrate/tfexec"
+)
+
+// PlanChain carries in-memory states computed by plans of stacked unapplied
+// migrations, so that a migration is planned against the state as it would
+// be after applying the previous ones instead of the current remote state.
+// States are keyed by a pair of a working directory and a workspace.
+//
+// Since the configuration reflects the state after applying all the
+// migrations, an intermediate state usually has diffs. So a terraform plan
+// check runs only after the last migration for each state unless
+// checkEveryStep is true.
+//
+// It's safe for concurrent use.
+type PlanChain struct {
+	// mu protects the following fields.
+	mu sync.Mutex
+	// states is a map of computed states.
+	states map[string]*tfexec.State
+	// remaining is a map of the number of migrations not planned yet.
+	remaining map[string]int
+	// checkEveryStep runs a terraform plan check after every migration.
+	checkEveryStep bool
+	// targets is a list of states registered in order.
+	targets []stateTarget
+	// origins is a map of remote states pulled before the first migration.
+	origins map[string]chainOrigin
+}
+
+// chainOrigin is a remote state pulled by the first migration for a given dir
+// and workspace, and stores to back it up before pushing a new state.
+// The state is backed up for every migration which touches it, so that any
+// of the migrations can be restored.
+type chainOrigin struct {
+	state   *tfexec.State
+	backups []StateBackup
+}
+
+// NewPlanChain returns a new PlanChain instance.
+func NewPlanChain(checkEveryStep bool) *PlanChain {
+	return &PlanChain{
+		states:         make(map[string]*tfexec.State),
+		remaining:      make(map[string]int),
+		checkEveryStep: checkEveryStep,
+		origins:        make(map[string]chainOrigin),
+	}
+}
+
+// planChainKey returns a key for a given dir and workspace.
+func planChainKey(dir string, workspace string) string {
+	return filepath.Clean(defaultDir(dir)) + "@" + defaultWorkspace(workspace)
+}
+
+// AddMigration registers a given migration to be planned in the chain.
+// It must be called for all the migrations in order before planning them.
+func (c *PlanChain) AddMigration(mc *MigrationConfig) error {
+	targets, err := stateTargets(mc)
+	if err != nil {
+		return err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for _, t := range targets {
+		key := planChainKey(t.dir, t.workspace)
+		if _, ok := c.remaining[key]; !ok {
+			c.targets = append(c.targets, t)
+		}
+		c.remaining[key]++
+	}
+	return nil
+}
+
+// Load returns a state computed by the previous migration for a given dir
+// and workspace. It returns false if no state has been computed yet.
+func (c *PlanChain) Load(dir string, workspace string) (*tfexec.State, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	state, ok := c.states[planChainKey(dir, workspace)]
+	return state, ok
+}
+
+// setOrigin records a given remote state pulled for a given dir and
+// workspace unless already recorded, and adds a given store to back it up.
+func (c *PlanChain) setOrigin(dir string, workspace string, state *tfexec.State, backup StateBackup) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	key := planChainKey(dir, workspace)
+	origin, ok := c.origins[key]
+	if !ok {
+		origin = chainOrigin{state: tfexec.NewState(state.Bytes())}
+	}
+	if backup != nil {
+		origin.backups = append(origin.backups, backup)
+	}
+	c.origins[key] = origin
+}
+
+// Store saves a computed state for a given dir and workspace, and marks the
+// migration as planned.
+func (c *PlanChain) Store(dir string, workspace string, state *tfexec.State) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	key := planChainKey(dir, workspace)
+	c.states[key] = tfexec.NewState(state.Bytes())
+	if c.remaining[key] > 0 {
+		c.remaining[key]--
+	}
+}
+
+// NeedsCheck returns true if a terraform plan check is needed for a given dir
+// and workspace in the migration being planned, that is, no later migration
+// changes the state or checkEveryStep is true.
+func (c *PlanChain) NeedsCheck(dir string, workspace string) bool {
+	if c.checkEveryStep {
+		return true
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	// The migration being planned is included in the remaining.
+	return c.remaining[planChainKey(dir, workspace)] <= 1
+}
+
+// chainedState returns a state computed by the previous migration for a
+// given dir and workspace if the plan chain is enabled, otherwise a given
+// pulled state.
+func chainedState(o *MigratorOption, dir string, workspace string, pulledState *tfexec.State) *tfexec.State {
+	if o == nil || o.PlanChain == nil {
+		return pulledState
+	}
+	o.PlanChain.setOrigin(dir, workspace, pulledState, o.Backup)
+	state, ok := o.PlanChain.Load(dir, workspace)
+	if !ok {
+		return pulledState
+	}
+	slog.Info("continue from the state computed by the previous migration", "component", "migrator", "dir", dir, "workspace", workspace)
+	return state
+}
+
+// needsPlanCheck returns true if a terraform plan check is needed for a given
+// dir and workspace. It's always true if the plan chain is disabled.
+func needsPlanCheck(o *MigratorOption, dir string, workspace string) bool {
+	if o == nil || o.PlanChain == nil {
+		return true
+	}
+	return o.PlanChain.NeedsCheck(dir, workspace)
+}
+
+// storeChainedState saves a computed state for a given dir and workspace if
+// the plan chain is enabled.
+func storeChainedState(o *MigratorOption, dir string, workspace string, state *tfexec.State) {
+	if o == nil || o.PlanChain == nil {
+		return
+	}
+	o.PlanChain.Store(dir, workspace, state)
+}
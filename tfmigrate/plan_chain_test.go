@@ -0,0 +1,318 @@
+package tfmigrate
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/minamijoyo/tfmigrate/tfexec"
+)
+
+func TestPlanChain(t *testing.T) {
+	mcs := []*MigrationConfig{
+		{
+			Type:     "state",
+			Name:     "test1",
+			Migrator: &StateMigratorConfig{Dir: "dir1"},
+		},
+		{
+			Type:     "multi_state",
+			Name:     "test2",
+			Migrator: &MultiStateMigratorConfig{FromDir: "./dir1", ToDir: "dir2"},
+		},
+	}
+
+	c := NewPlanChain(false)
+	for _, mc := range mcs {
+		if err := c.AddMigration(mc); err != nil {
+			t.Fatalf("unexpected err: %s", err)
+		}
+	}
+
+	// test1
+	if _, ok := c.Load("dir1", "default"); ok {
+		t.Errorf("expected no state for dir1 before planning")
+	}
+	if c.NeedsCheck("dir1", "default") {
+		t.Errorf("expected not to check dir1 in test1, because test2 changes it")
+	}
+	state1 := tfexec.NewState([]byte("state1"))
+	c.Store("dir1", "default", state1)
+
+	// test2
+	got, ok := c.Load("dir1", "")
+	if !ok || string(got.Bytes()) != "state1" {
+		t.Errorf("expected the state computed by test1, got: %v", got)
+	}
+	if !c.NeedsCheck("dir1", "default") {
+		t.Errorf("expected to check dir1 in test2")
+	}
+	if !c.NeedsCheck("dir2", "default") {
+		t.Errorf("expected to check dir2 in test2")
+	}
+	if c.NeedsCheck("dir2", "foo") != true {
+		t.Errorf("expected to check an unknown state")
+	}
+}
+
+func TestPlanChainCheckEveryStep(t *testing.T) {
+	c := NewPlanChain(true)
+	for i := 0; i < 2; i++ {
+		mc := &MigrationConfig{
+			Type:     "state",
+			Name:     "test",
+			Migrator: &StateMigratorConfig{Dir: "dir1"},
+		}
+		if err := c.AddMigration(mc); err != nil {
+			t.Fatalf("unexpected err: %s", err)
+		}
+	}
+
+	if !c.NeedsCheck("dir1", "default") {
+		t.Errorf("expected to check every step")
+	}
+}
+
+func TestAccStateMigratorPlanWithPlanChain(t *testing.T) {
+	tfexec.SkipUnlessAcceptanceTestEnabled(t)
+
+	backend := tfexec.GetTestAccBackendS3Config(t.Name())
+
+	source := `
+resource "null_resource" "foo" {}
+`
+
+	workspace := "default"
+	tf := tfexec.SetupTestAccWithApply(t, workspace, backend+source)
+	ctx := context.Background()
+
+	updatedSource := `
+resource "null_resource" "baz" {}
+`
+
+	tfexec.UpdateTestAccSource(t, tf, backend+updatedSource)
+
+	// The second migration depends on the first one.
+	mcs := []*MigrationConfig{
+		{
+			Type: "state",
+			Name: "test1",
+			Migrator: &StateMigratorConfig{
+				Dir:     tf.Dir(),
+				Actions: []string{"mv null_resource.foo null_resource.bar"},
+			},
+		},
+		{
+			Type: "state",
+			Name: "test2",
+			Migrator: &StateMigratorConfig{
+				Dir:     tf.Dir(),
+				Actions: []string{"mv null_resource.bar null_resource.baz"},
+			},
+		},
+	}
+
+	o := &MigratorOption{PlanChain: NewPlanChain(false)}
+	for _, mc := range mcs {
+		if err := o.PlanChain.AddMigration(mc); err != nil {
+			t.Fatalf("failed to add migration: %s", err)
+		}
+	}
+
+	for _, mc := range mcs {
+		m, err := mc.Migrator.NewMigrator(o)
+		if err != nil {
+			t.Fatalf("failed to new migrator: %s", err)
+		}
+		if err := m.Plan(ctx); err != nil {
+			t.Fatalf("failed to run migrator plan for %s: %s", mc.Name, err)
+		}
+	}
+}
+
+func TestPlanChainResults(t *testing.T) {
+	mc := &MigrationConfig{
+		Type:     "multi_state",
+		Name:     "test",
+		Migrator: &MultiStateMigratorConfig{FromDir: "dir1", ToDir: "dir2"},
+	}
+	c := NewPlanChain(false)
+	if err := c.AddMigration(mc); err != nil {
+		t.Fatalf("unexpected err: %s", err)
+	}
+
+	backup1 := newMemoryBackup()
+	o := &MigratorOption{PlanChain: c, Backup: backup1}
+	before1 := tfexec.NewState([]byte("before1"))
+	chainedState(o, "dir1", "default", before1)
+	storeChainedState(o, "dir1", "default", tfexec.NewState([]byte("after1")))
+
+	// dir2 has not been planned yet.
+	if _, err := c.results(); err == nil {
+		t.Fatalf("expected to return an error, but no error")
+	}
+
+	chainedState(o, "dir2", "default", tfexec.NewState([]byte("before2")))
+	storeChainedState(o, "dir2", "default", tfexec.NewState([]byte("after2")))
+	// the origin is recorded only once, but backed up for every migration.
+	backup2 := newMemoryBackup()
+	o2 := &MigratorOption{PlanChain: c, Backup: backup2}
+	chainedState(o2, "dir1", "default", tfexec.NewState([]byte("unexpected")))
+
+	got, err := c.results()
+	if err != nil {
+		t.Fatalf("unexpected err: %s", err)
+	}
+	want := []string{"dir1:before1:after1", "dir2:before2:after2"}
+	if len(got) != len(want) {
+		t.Fatalf("got %d results, want = %d", len(got), len(want))
+	}
+	for i, r := range got {
+		s := r.dir + ":" + string(r.state.Bytes()) + ":" + string(r.newState.Bytes())
+		if s != want[i] {
+			t.Errorf("got = %s, want = %s", s, want[i])
+		}
+	}
+
+	wantBackups := [][]StateBackup{{backup1, backup2}, {backup1}}
+	for i, r := range got {
+		if !reflect.DeepEqual(r.backups, wantBackups[i]) {
+			t.Errorf("got backups of %s = %v, want = %v", r.dir, r.backups, wantBackups[i])
+		}
+	}
+}
+
+func TestRestorePushedStates(t *testing.T) {
+	before := `{"lineage": "dir1", "serial": 1}`
+	after := `{"version": 4, "lineage": "dir1", "serial": 2, "resources": [{"name": "foo"}], "outputs": {"bar": {}}}`
+	cases := []struct {
+		desc     string
+		state    string
+		newState string
+		failures int
+		want     []string
+		ok       bool
+	}{
+		{
+			desc:     "force push the state before the migration",
+			state:    before,
+			newState: after,
+			want:     []string{before},
+			ok:       true,
+		},
+		{
+			desc:     "push an empty state if no state existed",
+			state:    "",
+			newState: after,
+			want: []string{`{
+  "lineage": "dir1",
+  "outputs": {},
+  "resources": [],
+  "serial": 3,
+  "version": 4
+}`},
+			ok: true,
+		},
+		{
+			desc:     "push error",
+			state:    "",
+			newState: after,
+			failures: 1,
+			want:     nil,
+			ok:       false,
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.desc, func(t *testing.T) {
+			tf := &pushRecorder{dir: "dir1", failures: tc.failures}
+			results := []chainResult{
+				{
+					stateTarget: stateTarget{dir: "dir1", workspace: "default"},
+					chainOrigin: chainOrigin{state: tfexec.NewState([]byte(tc.state))},
+					newState:    tfexec.NewState([]byte(tc.newState)),
+				},
+			}
+			err := restorePushedStates(context.Background(), []tfexec.TerraformCLI{tf}, results)
+			if tc.ok && err != nil {
+				t.Fatalf("unexpected err: %s", err)
+			}
+			if !tc.ok && err == nil {
+				t.Fatalf("expected to return an error, but no error")
+			}
+			if diff := cmp.Diff(tf.pushed, tc.want); diff != "" {
+				t.Errorf("got: %v, want: %v, diff: %s", tf.pushed, tc.want, diff)
+			}
+		})
+	}
+}
+
+func TestAccPlanChainPush(t *testing.T) {
+	tfexec.SkipUnlessAcceptanceTestEnabled(t)
+
+	backend := tfexec.GetTestAccBackendS3Config(t.Name())
+
+	source := `
+resource "null_resource" "foo" {}
+`
+
+	workspace := "default"
+	tf := tfexec.SetupTestAccWithApply(t, workspace, backend+source)
+	ctx := context.Background()
+
+	updatedSource := `
+resource "null_resource" "baz" {}
+`
+
+	tfexec.UpdateTestAccSource(t, tf, backend+updatedSource)
+
+	mcs := []*MigrationConfig{
+		{
+			Type: "state",
+			Name: "test1",
+			Migrator: &StateMigratorConfig{
+				Dir:     tf.Dir(),
+				Actions: []string{"mv null_resource.foo null_resource.bar"},
+			},
+		},
+		{
+			Type: "state",
+			Name: "test2",
+			Migrator: &StateMigratorConfig{
+				Dir:     tf.Dir(),
+				Actions: []string{"mv null_resource.bar null_resource.baz"},
+			},
+		},
+	}
+
+	o := &MigratorOption{PlanChain: NewPlanChain(false)}
+	for _, mc := range mcs {
+		if err := o.PlanChain.AddMigration(mc); err != nil {
+			t.Fatalf("failed to add migration: %s", err)
+		}
+	}
+
+	for _, mc := range mcs {
+		m, err := mc.Migrator.NewMigrator(o)
+		if err != nil {
+			t.Fatalf("failed to new migrator: %s", err)
+		}
+		if err := m.Plan(ctx); err != nil {
+			t.Fatalf("failed to run migrator plan for %s: %s", mc.Name, err)
+		}
+	}
+
+	if err := o.PlanChain.Push(ctx, o); err != nil {
+		t.Fatalf("failed to push states: %s", err)
+	}
+
+	got, err := tf.StateList(ctx, nil, nil)
+	if err != nil {
+		t.Fatalf("failed to run terraform state list: %s", err)
+	}
+	want := []string{"null_resource.baz"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got state: %v, want state: %v", got, want)
+	}
+}
@@ -0,0 +1,231 @@
+package tfmigrate
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+
+	"github.com/minamijoyo/tfmigrate/logging"
+	"github.com/minamijoyo/tfmigrate/tfexec"
+)
+
+// stateTarget is a pair of dir and workspace whose remote state is modified
+// by a migration.
+type stateTarget struct {
+	dir       string
+	workspace string
+}
+
+// stateTargets returns a list of remote states modified by a given migration.
+// For a multi_state migration, from_dir comes first, because restoring it
+// first brings back the moved resources before removing them from to_dir.
+func stateTargets(mc *MigrationConfig) ([]stateTarget, error) {
+	switch c := mc.Migrator.(type) {
+	case *StateMigratorConfig:
+		return []stateTarget{
+			{dir: defaultDir(c.Dir), workspace: defaultWorkspace(c.Workspace)},
+		}, nil
+
+	case *MultiStateMigratorConfig:
+		return []stateTarget{
+			{dir: defaultDir(c.FromDir), workspace: defaultWorkspace(c.FromWorkspace)},
+			{dir: defaultDir(c.ToDir), workspace: defaultWorkspace(c.ToWorkspace)},
+		}, nil
+
+	case *MockMigratorConfig:
+		return []stateTarget{}, nil
+
+	default:
+		return nil, fmt.Errorf("unsupported migration type: %s", mc.Type)
+	}
+}
+
+// defaultDir returns a given dir or `.` if empty.
+func defaultDir(dir string) string {
+	if len(dir) == 0 {
+		return "."
+	}
+	return dir
+}
+
+// defaultWorkspace returns a given workspace or `default` if empty.
+func defaultWorkspace(workspace string) string {
+	if len(workspace) == 0 {
+		return "default"
+	}
+	return workspace
+}
+
+// RestoreMigration pushes backups of remote states taken before applying a
+// given migration back to remote. The backups are read from o.Backup.
+// Unless force is true, it refuses to restore a backup whose lineage is
+// different from the current remote state, because it is probably a backup
+// of another state.
+//
+// For a multi_state migration, all the backups are verified before pushing
+// any of them. If pushing a backup fails, the states already restored are
+// pushed back to the ones before the restore, so that no resource is managed
+// in both states.
+func RestoreMigration(ctx context.Context, mc *MigrationConfig, o *MigratorOption, force bool) (err error) {
+	if o == nil || o.Backup == nil {
+		return fmt.Errorf("no backup is configured")
+	}
+	ctx = logging.With(ctx, "phase", "restore")
+
+	targets, err := stateTargets(mc)
+	if err != nil {
+		return err
+	}
+
+	// load all backups before pushing any of them.
+	backups := make([]*tfexec.State, len(targets))
+	for i, t := range targets {
+		b, err := o.Backup.Load(ctx, t.dir, t.workspace)
+		if err != nil {
+			return fmt.Errorf("failed to load a backup for %s (workspace: %s): %s", t.dir, t.workspace, err)
+		}
+		backups[i] = tfexec.NewState(b)
+	}
+
+	// verify all backups against the current remote states before pushing
+	// any of them.
+	restores := make([]stateRestore, len(targets))
+	for i, t := range targets {
+		ctx := logContext(ctx, t.dir, t.workspace)
+		tf := newTerraformCLI(o, t.dir, os.Environ())
+
+		unlock, lockErr := lockState(ctx, o, t.dir, t.workspace)
+		if lockErr != nil {
+			return lockErr
+		}
+		// release the lock on exit even if canceled.
+		defer func() {
+			err = errors.Join(err, unlock(context.WithoutCancel(ctx)))
+		}()
+
+		if err := initWorkDir(ctx, tf, t.workspace); err != nil {
+			return err
+		}
+
+		slog.InfoContext(ctx, "get the current remote state")
+		current, err := tf.StatePull(ctx)
+		if err != nil {
+			return err
+		}
+
+		// A backup taken when no state existed has no lineage.
+		if !force && len(backups[i].Bytes()) != 0 {
+			if err := checkLineage(tf.Dir(), backups[i], current); err != nil {
+				return err
+			}
+		}
+		restores[i] = stateRestore{stateTarget: t, tf: tf, backup: backups[i], current: current}
+	}
+
+	if err := checkNotCanceled(ctx); err != nil {
+		return err
+	}
+	pushCtx := context.WithoutCancel(ctx)
+	for i, r := range restores {
+		if err := r.push(logContext(pushCtx, r.dir, r.workspace)); err != nil {
+			pushErr := fmt.Errorf("failed to push the backup in %s (workspace: %s): %w", r.dir, r.workspace, err)
+			return errors.Join(pushErr, revertRestores(pushCtx, restores[:i]))
+		}
+	}
+
+	return nil
+}
+
+// stateRestore is a backup of a remote state to restore and the current
+// remote state which it replaces.
+type stateRestore struct {
+	stateTarget
+	tf      tfexec.TerraformCLI
+	backup  *tfexec.State
+	current *tfexec.State
+}
+
+// push pushes the backup to remote. The serial of the backup is lower than
+// the current remote state, so it's force pushed. If no state existed when
+// the backup was taken, all resources are removed from the current remote
+// state instead, because terraform state push can't delete a state.
+func (r *stateRestore) push(ctx context.Context) error {
+	if len(r.backup.Bytes()) != 0 {
+		slog.InfoContext(ctx, "push the backup to remote")
+		return r.tf.StatePush(ctx, r.backup, "-force")
+	}
+
+	if len(r.current.Bytes()) == 0 {
+		return nil
+	}
+	slog.InfoContext(ctx, "push an empty state to remote")
+	return pushEmptyState(ctx, r.tf, r.current)
+}
+
+// revert pushes back the remote state before the restore.
+func (r *stateRestore) revert(ctx context.Context) error {
+	if len(r.current.Bytes()) != 0 {
+		slog.WarnContext(ctx, "push back the state before the restore")
+		return r.tf.StatePush(ctx, r.current, "-force")
+	}
+
+	if len(r.backup.Bytes()) == 0 {
+		return nil
+	}
+	slog.WarnContext(ctx, "push an empty state to remote, because no state existed before the restore")
+	return pushEmptyState(ctx, r.tf, r.backup)
+}
+
+// revertRestores reverts given restored states in reverse order. It tries
+// all of them even if some fail, and returns instructions to recover the
+// ones which failed.
+func revertRestores(ctx context.Context, restores []stateRestore) error {
+	var errs []error
+	for i := len(restores) - 1; i >= 0; i-- {
+		r := restores[i]
+		ctx := logContext(ctx, r.dir, r.workspace)
+		if err := r.revert(ctx); err != nil {
+			slog.ErrorContext(ctx, "failed to push back the state before the restore. Resources may be managed in multiple states", "error", err)
+			errs = append(errs, fmt.Errorf("the backup in %s (workspace: %s) has been restored, but failed to push back the state before the restore: %s. Resources may be managed in multiple states. Re-run tfmigrate restore to complete it, or %s", r.dir, r.workspace, err, r.manualRevertInstruction()))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// manualRevertInstruction returns a message which tells how to push back the
+// state before the restore manually.
+func (r *stateRestore) manualRevertInstruction() string {
+	if len(r.current.Bytes()) == 0 {
+		return fmt.Sprintf("remove all resources from the state of %s manually, because no state existed before the restore", r.dir)
+	}
+	filename, err := saveStateFile(r.current)
+	if err != nil {
+		return fmt.Sprintf("push back the state before the restore manually. It couldn't be saved: %s", err)
+	}
+	return fmt.Sprintf("push back the state before the restore saved to %s manually in the workspace: terraform -chdir=%s state push -force %s", filename, r.dir, filename)
+}
+
+// checkLineage returns an error if the lineage of a given backup is different
+// from the current remote state of a given dir.
+func checkLineage(dir string, backup *tfexec.State, remote *tfexec.State) error {
+	// The remote state may be empty if it has been deleted.
+	if len(remote.Bytes()) == 0 {
+		return nil
+	}
+
+	remoteLineage, err := remote.Lineage()
+	if err != nil {
+		return err
+	}
+	backupLineage, err := backup.Lineage()
+	if err != nil {
+		return err
+	}
+
+	if remoteLineage != backupLineage {
+		return fmt.Errorf("the lineage of the backup doesn't match the remote state in %s: backup = %s, remote = %s", dir, backupLineage, remoteLineage)
+	}
+	return nil
+}
@@ -0,0 +1,344 @@
+package tfmigrate
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/minamijoyo/tfmigrate/tfexec"
+)
+
+// memoryBackup is an in-memory StateBackup for testing.
+type memoryBackup struct {
+	states map[string][]byte
+}
+
+var _ StateBackup = (*memoryBackup)(nil)
+
+func newMemoryBackup() *memoryBackup {
+	return &memoryBackup{states: make(map[string][]byte)}
+}
+
+func (b *memoryBackup) Save(_ context.Context, dir string, workspace string, state []byte) error {
+	b.states[dir+"/"+workspace] = state
+	return nil
+}
+
+func (b *memoryBackup) Load(_ context.Context, dir string, workspace string) ([]byte, error) {
+	state, ok := b.states[dir+"/"+workspace]
+	if !ok {
+		return nil, fmt.Errorf("backup not found: %s/%s", dir, workspace)
+	}
+	return state, nil
+}
+
+func TestStateTargets(t *testing.T) {
+	cases := []struct {
+		desc string
+		mc   *MigrationConfig
+		want []stateTarget
+		ok   bool
+	}{
+		{
+			desc: "state with defaults",
+			mc: &MigrationConfig{
+				Type:     "state",
+				Migrator: &StateMigratorConfig{},
+			},
+			want: []stateTarget{
+				{dir: ".", workspace: "default"},
+			},
+			ok: true,
+		},
+		{
+			desc: "multi_state",
+			mc: &MigrationConfig{
+				Type: "multi_state",
+				Migrator: &MultiStateMigratorConfig{
+					FromDir:       "dir1",
+					ToDir:         "dir2",
+					FromWorkspace: "work1",
+				},
+			},
+			want: []stateTarget{
+				{dir: "dir1", workspace: "work1"},
+				{dir: "dir2", workspace: "default"},
+			},
+			ok: true,
+		},
+		{
+			desc: "mock",
+			mc: &MigrationConfig{
+				Type:     "mock",
+				Migrator: &MockMigratorConfig{},
+			},
+			want: []stateTarget{},
+			ok:   true,
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.desc, func(t *testing.T) {
+			got, err := stateTargets(tc.mc)
+			if tc.ok && err != nil {
+				t.Fatalf("unexpected err: %s", err)
+			}
+			if !tc.ok && err == nil {
+				t.Fatalf("expected to return an error, but no error, got: %#v", got)
+			}
+			if tc.ok {
+				if diff := cmp.Diff(got, tc.want, cmp.AllowUnexported(stateTarget{})); diff != "" {
+					t.Errorf("got: %#v, want = %#v, diff = %s", got, tc.want, diff)
+				}
+			}
+		})
+	}
+}
+
+func TestRestoreMigrationWithoutBackup(t *testing.T) {
+	mc := &MigrationConfig{
+		Type:     "state",
+		Migrator: &StateMigratorConfig{},
+	}
+	err := RestoreMigration(context.Background(), mc, &MigratorOption{}, false)
+	if err == nil {
+		t.Fatalf("expected to return an error, but no error")
+	}
+}
+
+func TestRestoreMigrationBackupNotFound(t *testing.T) {
+	mc := &MigrationConfig{
+		Type:     "state",
+		Migrator: &StateMigratorConfig{},
+	}
+	o := &MigratorOption{Backup: newMemoryBackup()}
+	err := RestoreMigration(context.Background(), mc, o, false)
+	if err == nil {
+		t.Fatalf("expected to return an error, but no error")
+	}
+}
+
+func TestStateRestorePush(t *testing.T) {
+	backup := `{"lineage": "foo", "serial": 1}`
+	current := `{"lineage": "foo", "serial": 2, "resources": [{"name": "foo"}]}`
+	cases := []struct {
+		desc    string
+		backup  string
+		current string
+		want    []string
+	}{
+		{
+			desc:    "push the backup",
+			backup:  backup,
+			current: current,
+			want:    []string{backup},
+		},
+		{
+			desc:    "remove all resources if no state existed",
+			backup:  "",
+			current: current,
+			want: []string{`{
+  "lineage": "foo",
+  "outputs": {},
+  "resources": [],
+  "serial": 3
+}`},
+		},
+		{
+			desc:    "no state existed and no remote state",
+			backup:  "",
+			current: "",
+			want:    nil,
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.desc, func(t *testing.T) {
+			tf := &pushRecorder{dir: "dir1"}
+			r := &stateRestore{
+				stateTarget: stateTarget{dir: "dir1", workspace: "default"},
+				tf:          tf,
+				backup:      tfexec.NewState([]byte(tc.backup)),
+				current:     tfexec.NewState([]byte(tc.current)),
+			}
+			if err := r.push(context.Background()); err != nil {
+				t.Fatalf("unexpected err: %s", err)
+			}
+			if diff := cmp.Diff(tf.pushed, tc.want); diff != "" {
+				t.Errorf("got: %v, want: %v, diff: %s", tf.pushed, tc.want, diff)
+			}
+		})
+	}
+}
+
+func TestRevertRestores(t *testing.T) {
+	from0 := `{"lineage": "from", "serial": 1}`
+	from1 := `{"lineage": "from", "serial": 2}`
+	cases := []struct {
+		desc     string
+		backup   string
+		current  string
+		failures int
+		want     []string
+		wantErr  string
+	}{
+		{
+			desc:    "push back the state before the restore",
+			backup:  from0,
+			current: from1,
+			want:    []string{from1},
+		},
+		{
+			desc:    "remove all resources if no state existed before the restore",
+			backup:  from0,
+			current: "",
+			want: []string{`{
+  "lineage": "from",
+  "outputs": {},
+  "resources": [],
+  "serial": 2
+}`},
+		},
+		{
+			desc:     "push error",
+			backup:   from0,
+			current:  from1,
+			failures: 1,
+			want:     nil,
+			wantErr:  "terraform -chdir=dir1 state push -force ",
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.desc, func(t *testing.T) {
+			tf := &pushRecorder{dir: "dir1", failures: tc.failures}
+			restores := []stateRestore{
+				{
+					stateTarget: stateTarget{dir: "dir1", workspace: "default"},
+					tf:          tf,
+					backup:      tfexec.NewState([]byte(tc.backup)),
+					current:     tfexec.NewState([]byte(tc.current)),
+				},
+			}
+			err := revertRestores(context.Background(), restores)
+			if tc.wantErr == "" && err != nil {
+				t.Fatalf("unexpected err: %s", err)
+			}
+			if tc.wantErr != "" && (err == nil || !strings.Contains(err.Error(), tc.wantErr)) {
+				t.Fatalf("expected an error containing %q, got: %v", tc.wantErr, err)
+			}
+			if diff := cmp.Diff(tf.pushed, tc.want); diff != "" {
+				t.Errorf("got: %v, want: %v, diff: %s", tf.pushed, tc.want, diff)
+			}
+		})
+	}
+}
+
+func TestCheckLineage(t *testing.T) {
+	cases := []struct {
+		desc   string
+		backup string
+		remote string
+		ok     bool
+	}{
+		{
+			desc:   "same lineage",
+			backup: `{"lineage": "foo", "serial": 1}`,
+			remote: `{"lineage": "foo", "serial": 2}`,
+			ok:     true,
+		},
+		{
+			desc:   "different lineage",
+			backup: `{"lineage": "foo", "serial": 1}`,
+			remote: `{"lineage": "bar", "serial": 2}`,
+			ok:     false,
+		},
+		{
+			desc:   "no remote state",
+			backup: `{"lineage": "foo", "serial": 1}`,
+			remote: "",
+			ok:     true,
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.desc, func(t *testing.T) {
+			err := checkLineage("dir1", tfexec.NewState([]byte(tc.backup)), tfexec.NewState([]byte(tc.remote)))
+			if tc.ok && err != nil {
+				t.Fatalf("unexpected err: %s", err)
+			}
+			if !tc.ok && err == nil {
+				t.Fatalf("expected to return an error, but no error")
+			}
+		})
+	}
+}
+
+func TestAccStateMigratorApplyWithBackupAndRestore(t *testing.T) {
+	tfexec.SkipUnlessAcceptanceTestEnabled(t)
+
+	backend := tfexec.GetTestAccBackendS3Config(t.Name())
+
+	source := `
+resource "null_resource" "foo" {}
+resource "null_resource" "bar" {}
+`
+
+	workspace := "default"
+	tf := tfexec.SetupTestAccWithApply(t, workspace, backend+source)
+	ctx := context.Background()
+
+	updatedSource := `
+resource "null_resource" "foo2" {}
+`
+
+	tfexec.UpdateTestAccSource(t, tf, backend+updatedSource)
+
+	actions := []StateAction{
+		NewStateMvAction("null_resource.foo", "null_resource.foo2"),
+		NewStateRmAction([]string{"null_resource.bar"}),
+	}
+
+	backup := newMemoryBackup()
+	o := &MigratorOption{Backup: backup}
+	m := NewStateMigrator(tf.Dir(), workspace, actions, o, false, false)
+	err := m.Apply(ctx)
+	if err != nil {
+		t.Fatalf("failed to run migrator apply: %s", err)
+	}
+
+	if _, err := backup.Load(ctx, tf.Dir(), workspace); err != nil {
+		t.Fatalf("expected to save a backup: %s", err)
+	}
+
+	mc := &MigrationConfig{
+		Type: "state",
+		Migrator: &StateMigratorConfig{
+			Dir:       tf.Dir(),
+			Workspace: workspace,
+		},
+	}
+	err = RestoreMigration(ctx, mc, o, false)
+	if err != nil {
+		t.Fatalf("failed to restore migration: %s", err)
+	}
+
+	got, err := tf.StateList(ctx, nil, nil)
+	if err != nil {
+		t.Fatalf("failed to run terraform state list: %s", err)
+	}
+
+	want := []string{
+		"null_resource.foo",
+		"null_resource.bar",
+	}
+	sort.Strings(got)
+	sort.Strings(want)
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got state: %v, want state: %v", got, want)
+	}
+}
@@ -0,0 +1,149 @@
+package tfmigrate
+
+import (
+	"fmt"
+)
+
+// UpConfig is a config for applying a migration.
+type UpConfig struct {
+	// Actions is a list of actions to apply the migration.
+	Actions []string `hcl:"actions"`
+}
+
+// DownConfig is a config for rolling back a migration.
+type DownConfig struct {
+	// Actions is a list of actions to roll back the migration.
+	// The format is the same as the actions of the migration.
+	Actions []string `hcl:"actions"`
+}
+
+// RollbackMigratorConfig is an optional interface for a MigratorConfig which
+// can build a migrator to roll back the migration.
+type RollbackMigratorConfig interface {
+	MigratorConfig
+	// NewRollbackMigrator returns a new instance of Migrator which reverts the
+	// migration against the current state.
+	NewRollbackMigrator(o *MigratorOption) (Migrator, error)
+}
+
+// StateMigratorConfig implements a RollbackMigratorConfig.
+var _ RollbackMigratorConfig = (*StateMigratorConfig)(nil)
+
+// NewRollbackMigrator returns a new instance of StateMigrator which reverts
+// the migration. If a down block is defined, its actions are used as they are.
+// Otherwise, inverses of the actions are applied in reverse order, and it
+// returns an error if any of them is not invertible.
+func (c *StateMigratorConfig) NewRollbackMigrator(o *MigratorOption) (Migrator, error) {
+	if c.Down != nil {
+		down := *c
+		down.Actions = c.Down.Actions
+		down.Down = nil
+		return down.NewMigrator(o)
+	}
+
+	if len(c.Actions) == 0 {
+		return nil, fmt.Errorf("failed to NewRollbackMigrator with no actions")
+	}
+
+	actions, err := invertStateActions(c.Actions)
+	if err != nil {
+		return nil, err
+	}
+
+	dir := "."
+	if len(c.Dir) > 0 {
+		dir = c.Dir
+	}
+	workspace := "default"
+	if len(c.Workspace) > 0 {
+		workspace = c.Workspace
+	}
+	skipPlan := c.SkipPlan || c.ToSkipPlan
+	return NewStateMigrator(dir, workspace, actions, o, c.Force, skipPlan), nil
+}
+
+// invertStateActions returns inverses of given state actions in reverse order.
+func invertStateActions(cmdStrs []string) ([]StateAction, error) {
+	actions := make([]StateAction, len(cmdStrs))
+	for i, cmdStr := range cmdStrs {
+		action, err := NewStateActionFromString(cmdStr)
+		if err != nil {
+			return nil, err
+		}
+		invertible, ok := action.(InvertibleStateAction)
+		if !ok {
+			return nil, fmt.Errorf("failed to invert action: %s, define actions to roll back in a down block", cmdStr)
+		}
+		actions[len(cmdStrs)-1-i] = invertible.Inverse()
+	}
+	return actions, nil
+}
+
+// MultiStateMigratorConfig implements a RollbackMigratorConfig.
+var _ RollbackMigratorConfig = (*MultiStateMigratorConfig)(nil)
+
+// NewRollbackMigrator returns a new instance of MultiStateMigrator which
+// reverts the migration. Since resources move back from to_dir to from_dir,
+// the from and to sides are swapped. If a down block is defined, its actions
+// are used as they are. Otherwise, inverses of the actions are applied in
+// reverse order, and it returns an error if any of them is not invertible.
+func (c *MultiStateMigratorConfig) NewRollbackMigrator(o *MigratorOption) (Migrator, error) {
+	var actions []MultiStateAction
+	if c.Down != nil {
+		for _, cmdStr := range c.Down.Actions {
+			action, err := NewMultiStateActionFromString(cmdStr)
+			if err != nil {
+				return nil, err
+			}
+			actions = append(actions, action)
+		}
+	} else {
+		var err error
+		actions, err = invertMultiStateActions(c.Actions)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if len(actions) == 0 {
+		return nil, fmt.Errorf("failed to NewRollbackMigrator with no actions")
+	}
+
+	fromWorkspace := "default"
+	if len(c.FromWorkspace) > 0 {
+		fromWorkspace = c.FromWorkspace
+	}
+	toWorkspace := "default"
+	if len(c.ToWorkspace) > 0 {
+		toWorkspace = c.ToWorkspace
+	}
+
+	return NewMultiStateMigrator(c.ToDir, c.FromDir, toWorkspace, fromWorkspace, actions, o, c.Force, c.ToSkipPlan, c.FromSkipPlan), nil
+}
+
+// invertMultiStateActions returns inverses of given multi state actions in
+// reverse order.
+func invertMultiStateActions(cmdStrs []string) ([]MultiStateAction, error) {
+	actions := make([]MultiStateAction, len(cmdStrs))
+	for i, cmdStr := range cmdStrs {
+		action, err := NewMultiStateActionFromString(cmdStr)
+		if err != nil {
+			return nil, err
+		}
+		invertible, ok := action.(InvertibleMultiStateAction)
+		if !ok {
+			return nil, fmt.Errorf("failed to invert action: %s, define actions to roll back in a down block", cmdStr)
+		}
+		actions[len(cmdStrs)-1-i] = invertible.Inverse()
+	}
+	return actions, nil
+}
+
+// MockMigratorConfig implements a RollbackMigratorConfig.
+var _ RollbackMigratorConfig = (*MockMigratorConfig)(nil)
+
+// NewRollbackMigrator returns a new instance of MockMigrator.
+// It behaves the same as NewMigrator.
+func (c *MockMigratorConfig) NewRollbackMigrator(o *MigratorOption) (Migrator, error) {
+	return c.NewMigrator(o)
+}
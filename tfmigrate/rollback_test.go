@@ -0,0 +1,278 @@
+package tfmigrate
+
+import (
+	"context"
+	"reflect"
+	"sort"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/minamijoyo/tfmigrate/tfexec"
+)
+
+func TestInvertStateActions(t *testing.T) {
+	cases := []struct {
+		desc    string
+		cmdStrs []string
+		want    []StateAction
+		ok      bool
+	}{
+		{
+			desc: "mv",
+			cmdStrs: []string{
+				"mv null_resource.foo null_resource.foo2",
+				"mv null_resource.bar null_resource.bar2",
+			},
+			want: []StateAction{
+				NewStateMvAction("null_resource.bar2", "null_resource.bar"),
+				NewStateMvAction("null_resource.foo2", "null_resource.foo"),
+			},
+			ok: true,
+		},
+		{
+			desc: "rm",
+			cmdStrs: []string{
+				"mv null_resource.foo null_resource.foo2",
+				"rm null_resource.bar",
+			},
+			ok: false,
+		},
+		{
+			desc: "import",
+			cmdStrs: []string{
+				"import time_static.qux 2006-01-02T15:04:05Z",
+			},
+			ok: false,
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.desc, func(t *testing.T) {
+			got, err := invertStateActions(tc.cmdStrs)
+			if tc.ok && err != nil {
+				t.Fatalf("unexpected err: %s", err)
+			}
+			if !tc.ok && err == nil {
+				t.Fatalf("expected to return an error, but no error, got: %#v", got)
+			}
+			if tc.ok {
+				if diff := cmp.Diff(got, tc.want, cmp.AllowUnexported(StateMvAction{})); diff != "" {
+					t.Errorf("got: %#v, want = %#v, diff = %s", got, tc.want, diff)
+				}
+			}
+		})
+	}
+}
+
+func TestInvertMultiStateActions(t *testing.T) {
+	cases := []struct {
+		desc    string
+		cmdStrs []string
+		want    []MultiStateAction
+		ok      bool
+	}{
+		{
+			desc: "mv",
+			cmdStrs: []string{
+				"mv null_resource.foo null_resource.foo2",
+				"mv null_resource.bar null_resource.bar",
+			},
+			want: []MultiStateAction{
+				NewMultiStateMvAction("null_resource.bar", "null_resource.bar"),
+				NewMultiStateMvAction("null_resource.foo2", "null_resource.foo"),
+			},
+			ok: true,
+		},
+		{
+			desc: "xmv",
+			cmdStrs: []string{
+				"xmv null_resource.* null_resource.${1}",
+			},
+			ok: false,
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.desc, func(t *testing.T) {
+			got, err := invertMultiStateActions(tc.cmdStrs)
+			if tc.ok && err != nil {
+				t.Fatalf("unexpected err: %s", err)
+			}
+			if !tc.ok && err == nil {
+				t.Fatalf("expected to return an error, but no error, got: %#v", got)
+			}
+			if tc.ok {
+				if diff := cmp.Diff(got, tc.want, cmp.AllowUnexported(MultiStateMvAction{})); diff != "" {
+					t.Errorf("got: %#v, want = %#v, diff = %s", got, tc.want, diff)
+				}
+			}
+		})
+	}
+}
+
+func TestStateMigratorConfigNewRollbackMigrator(t *testing.T) {
+	cases := []struct {
+		desc   string
+		config *StateMigratorConfig
+		want   []StateAction
+		ok     bool
+	}{
+		{
+			desc: "inverse",
+			config: &StateMigratorConfig{
+				Dir: "dir1",
+				Actions: []string{
+					"mv null_resource.foo null_resource.foo2",
+				},
+			},
+			want: []StateAction{
+				NewStateMvAction("null_resource.foo2", "null_resource.foo"),
+			},
+			ok: true,
+		},
+		{
+			desc: "down block",
+			config: &StateMigratorConfig{
+				Dir: "dir1",
+				Actions: []string{
+					"rm null_resource.foo",
+				},
+				Down: &DownConfig{
+					Actions: []string{
+						"import null_resource.foo 123",
+					},
+				},
+			},
+			want: []StateAction{
+				NewStateImportAction("null_resource.foo", "123"),
+			},
+			ok: true,
+		},
+		{
+			desc: "not invertible",
+			config: &StateMigratorConfig{
+				Dir: "dir1",
+				Actions: []string{
+					"rm null_resource.foo",
+				},
+			},
+			ok: false,
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.desc, func(t *testing.T) {
+			got, err := tc.config.NewRollbackMigrator(&MigratorOption{})
+			if tc.ok && err != nil {
+				t.Fatalf("unexpected err: %s", err)
+			}
+			if !tc.ok && err == nil {
+				t.Fatalf("expected to return an error, but no error, got: %#v", got)
+			}
+			if tc.ok {
+				m := got.(*StateMigrator)
+				if m.tf.Dir() != "dir1" {
+					t.Errorf("got dir: %s, want = dir1", m.tf.Dir())
+				}
+				if diff := cmp.Diff(m.actions, tc.want, cmp.AllowUnexported(StateMvAction{}, StateImportAction{})); diff != "" {
+					t.Errorf("got: %#v, want = %#v, diff = %s", m.actions, tc.want, diff)
+				}
+			}
+		})
+	}
+}
+
+func TestMultiStateMigratorConfigNewRollbackMigrator(t *testing.T) {
+	config := &MultiStateMigratorConfig{
+		FromDir:       "dir1",
+		ToDir:         "dir2",
+		FromWorkspace: "work1",
+		Actions: []string{
+			"mv null_resource.foo null_resource.foo2",
+		},
+	}
+
+	got, err := config.NewRollbackMigrator(&MigratorOption{})
+	if err != nil {
+		t.Fatalf("unexpected err: %s", err)
+	}
+
+	m := got.(*MultiStateMigrator)
+	if m.fromTf.Dir() != "dir2" || m.toTf.Dir() != "dir1" {
+		t.Errorf("expected to swap dirs, got from: %s, to: %s", m.fromTf.Dir(), m.toTf.Dir())
+	}
+	if m.fromWorkspace != "default" || m.toWorkspace != "work1" {
+		t.Errorf("expected to swap workspaces, got from: %s, to: %s", m.fromWorkspace, m.toWorkspace)
+	}
+	want := []MultiStateAction{
+		NewMultiStateMvAction("null_resource.foo2", "null_resource.foo"),
+	}
+	if diff := cmp.Diff(m.actions, want, cmp.AllowUnexported(MultiStateMvAction{})); diff != "" {
+		t.Errorf("got: %#v, want = %#v, diff = %s", m.actions, want, diff)
+	}
+}
+
+func TestAccStateMigratorRollback(t *testing.T) {
+	tfexec.SkipUnlessAcceptanceTestEnabled(t)
+
+	backend := tfexec.GetTestAccBackendS3Config(t.Name())
+
+	source := `
+resource "null_resource" "foo" {}
+resource "null_resource" "bar" {}
+`
+
+	workspace := "default"
+	tf := tfexec.SetupTestAccWithApply(t, workspace, backend+source)
+	ctx := context.Background()
+
+	updatedSource := `
+resource "null_resource" "foo2" {}
+resource "null_resource" "bar2" {}
+`
+
+	tfexec.UpdateTestAccSource(t, tf, backend+updatedSource)
+
+	config := &StateMigratorConfig{
+		Dir: tf.Dir(),
+		Actions: []string{
+			"mv null_resource.foo null_resource.foo2",
+			"mv null_resource.bar null_resource.bar2",
+		},
+	}
+	m, err := config.NewMigrator(&MigratorOption{})
+	if err != nil {
+		t.Fatalf("failed to new migrator: %s", err)
+	}
+	err = m.Apply(ctx)
+	if err != nil {
+		t.Fatalf("failed to run migrator apply: %s", err)
+	}
+
+	// roll back the configuration and the state.
+	tfexec.UpdateTestAccSource(t, tf, backend+source)
+
+	r, err := config.NewRollbackMigrator(&MigratorOption{})
+	if err != nil {
+		t.Fatalf("failed to new rollback migrator: %s", err)
+	}
+	err = r.Apply(ctx)
+	if err != nil {
+		t.Fatalf("failed to run rollback migrator apply: %s", err)
+	}
+
+	got, err := tf.StateList(ctx, nil, nil)
+	if err != nil {
+		t.Fatalf("failed to run terraform state list: %s", err)
+	}
+
+	want := []string{
+		"null_resource.foo",
+		"null_resource.bar",
+	}
+	sort.Strings(got)
+	sort.Strings(want)
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got state: %v, want state: %v", got, want)
+	}
+}
@@ -14,6 +14,16 @@ type StateAction interface {
 	StateUpdate(ctx context.Context, tf tfexec.TerraformCLI, state *tfexec.State) (*tfexec.State, error)
 }
 
+// InvertibleStateAction is an optional interface for a StateAction which has
+// a natural inverse. It's used for computing actions to roll back a migration.
+// Actions such as rm and import are not invertible, because the information
+// removed from the state cannot be recovered from the action itself.
+type InvertibleStateAction interface {
+	StateAction
+	// Inverse returns a new action which reverts the action.
+	Inverse() StateAction
+}
+
 // NewStateActionFromString is a factory method which returns a new StateAction
 // from a given string.
 // cmdStr is a plain text for state operation.
@@ -4,10 +4,13 @@ import (
 	"context"
 	"errors"
 	"fmt"
-	"log"
+	"log/slog"
 	"os"
 
+	"github.com/minamijoyo/tfmigrate/logging"
 	"github.com/minamijoyo/tfmigrate/tfexec"
+	"github.com/minamijoyo/tfmigrate/tracing"
+	"go.opentelemetry.io/otel/trace"
 )
 
 // StateMigratorConfig is a config for StateMigrator.
@@ -24,7 +27,8 @@ type StateMigratorConfig struct {
 	// We could define strict block schema for action, but intentionally use a
 	// schema-less string to allow us to easily copy terraform state command to
 	// action.
-	Actions []string `hcl:"actions"`
+	// Either Actions or Up is required.
+	Actions []string `hcl:"actions,optional"`
 	// Force option controls behaviour in case of unexpected diff in plan.
 	// When set forces applying even if plan shows diff.
 	Force bool `hcl:"force,optional"`
@@ -36,6 +40,17 @@ type StateMigratorConfig struct {
 	ToSkipPlan bool `hcl:"to_skip_plan,optional"`
 	// Workspace is the state workspace which the migration works with.
 	Workspace string `hcl:"workspace,optional"`
+	// RemoveMovedBlocks controls whether or not to remove moved blocks
+	// equivalent to mv actions from .tf files in the dir after the migration
+	// is recorded in history.
+	RemoveMovedBlocks bool `hcl:"remove_moved_blocks,optional"`
+	// Up is a block which defines actions of the migration.
+	// It's an alternative to Actions to pair with Down, and the parser copies
+	// its actions to Actions.
+	Up *UpConfig `hcl:"up,block"`
+	// Down is a block which defines actions to roll back the migration.
+	// If not set, they are computed from inverses of the actions.
+	Down *DownConfig `hcl:"down,block"`
 }
 
 // StateMigratorConfig implements a MigratorConfig.
@@ -72,13 +87,16 @@ func (c *StateMigratorConfig) NewMigrator(o *MigratorOption) (Migrator, error) {
 	// removed in a future version.
 	skipPlan := c.SkipPlan || c.ToSkipPlan
 	if c.ToSkipPlan {
-		log.Printf("[WARN] [migrator@%s] `to_skip_plan` is deprecated. Use `skip_plan` instead.", dir)
+		slog.Warn("`to_skip_plan` is deprecated. Use `skip_plan` instead.", "component", "migrator", "dir", dir)
 	}
 	return NewStateMigrator(dir, c.Workspace, actions, o, c.Force, skipPlan), nil
 }
 
 // StateMigrator implements the Migrator interface.
 type StateMigrator struct {
+	// dir is a working directory where the migration is executed.
+	// It's used as a key for locks and backups even in isolated mode.
+	dir string
 	// tf is an instance of TerraformCLI.
 	tf tfexec.TerraformCLI
 	// actions is a list of state migration operations.
@@ -99,15 +117,10 @@ var _ Migrator = (*StateMigrator)(nil)
 // NewStateMigrator returns a new StateMigrator instance.
 func NewStateMigrator(dir string, workspace string, actions []StateAction,
 	o *MigratorOption, force bool, skipPlan bool) *StateMigrator {
-	e := tfexec.NewExecutor(dir, os.Environ())
-	tf := tfexec.NewTerraformCLI(e)
-	if o != nil && len(o.ExecPath) > 0 {
-		// While NewTerraformCLI reads the environment variable TFMIGRATE_EXEC_PATH
-		// at initialization, the MigratorOption takes precedence over it.
-		tf.SetExecPath(o.ExecPath)
-	}
+	tf := newTerraformCLI(o, dir, os.Environ())
 
 	return &StateMigrator{
+		dir:       dir,
 		tf:        tf,
 		actions:   actions,
 		o:         o,
@@ -121,7 +134,12 @@ func NewStateMigrator(dir string, workspace string, actions []StateAction,
 // It will fail if terraform plan detects any diffs with the new state.
 // We intentionally keep this method private as to not expose internal states and unify
 // the Migrator interface between a single and multi state migrator.
-func (m *StateMigrator) plan(ctx context.Context) (currentState *tfexec.State, err error) {
+// It returns the pulled remote state as well as the new state so that the
+// caller can back up the remote state before pushing the new one.
+func (m *StateMigrator) plan(ctx context.Context) (pulledState *tfexec.State, currentState *tfexec.State, err error) {
+	ctx, span := tracing.Start(ctx, "plan phase", tracing.AttrPhase.String("plan"))
+	defer func() { tracing.End(span, err) }()
+
 	ignoreLegacyStateInitErr := false
 	for _, action := range m.actions {
 		// When invoking `state replace-provider`, it's necessary to first
@@ -137,63 +155,104 @@ func (m *StateMigrator) plan(ctx context.Context) (currentState *tfexec.State, e
 	// setup work dir.
 	currentState, switchBackToRemoteFunc, err := setupWorkDir(ctx, m.tf, m.workspace, m.o.IsBackendTerraformCloud, m.o.BackendConfig, ignoreLegacyStateInitErr)
 	if err != nil {
-		return nil, err
+		return nil, nil, err
 	}
+	pulledState = currentState
+	currentState = chainedState(m.o, m.dir, m.workspace, currentState)
 
 	// switch back it to remote on exit.
 	defer func() {
 		err = errors.Join(err, switchBackToRemoteFunc())
 	}()
 
-	// computes a new state by applying state migration operations to a temporary state.
-	log.Printf("[INFO] [migrator@%s] compute a new state\n", m.tf.Dir())
-	var newState *tfexec.State
-	for _, action := range m.actions {
-		newState, err = action.StateUpdate(ctx, m.tf, currentState)
-		if err != nil {
-			return nil, err
-		}
-		currentState = tfexec.NewState(newState.Bytes())
+	currentState, err = m.computeNewState(ctx, currentState)
+	if err != nil {
+		return nil, nil, err
 	}
 
 	// build plan options
 	planOpts := []string{"-input=false", "-no-color", "-detailed-exitcode"}
 	if m.o.PlanOut != "" {
-		planOpts = append(planOpts, "-out="+m.o.PlanOut)
+		planOutOpt, err := planOutOption(m.o, m.dir)
+		if err != nil {
+			return nil, nil, err
+		}
+		planOpts = append(planOpts, planOutOpt)
 	}
 
 	if m.skipPlan {
-		log.Printf("[INFO] [migrator@%s] skipping check diffs\n", m.tf.Dir())
+		slog.InfoContext(ctx, "skipping check diffs")
+	} else if !needsPlanCheck(m.o, m.dir, m.workspace) {
+		slog.InfoContext(ctx, "skipping check diffs until the last pending migration")
 	} else {
-		log.Printf("[INFO] [migrator@%s] check diffs\n", m.tf.Dir())
+		slog.InfoContext(ctx, "check diffs")
 		_, err = m.tf.Plan(ctx, currentState, planOpts...)
 		if err != nil {
 			if exitErr, ok := err.(tfexec.ExitError); ok && exitErr.ExitCode() == 2 {
 				if !m.force {
-					log.Printf("[ERROR] [migrator@%s] unexpected diffs\n", m.tf.Dir())
-					return nil, fmt.Errorf("terraform plan command returns unexpected diffs: %s", err)
+					slog.ErrorContext(ctx, "unexpected diffs")
+					return nil, nil, fmt.Errorf("terraform plan command returns unexpected diffs: %s", err)
 				}
-				log.Printf("[INFO] [migrator@%s] unexpected diffs, ignoring as force option is true: %s", m.tf.Dir(), err)
+				slog.InfoContext(ctx, "unexpected diffs, ignoring as force option is true", "error", err)
 				// reset err to nil to intentionally ignore unexpected diffs.
 				err = nil
 			} else {
-				return nil, err
+				return nil, nil, err
 			}
 		}
 	}
 
-	return currentState, err
+	storeChainedState(m.o, m.dir, m.workspace, currentState)
+	return pulledState, currentState, err
+}
+
+// computeNewState computes a new state by applying state migration operations
+// to a given temporary state.
+func (m *StateMigrator) computeNewState(ctx context.Context, currentState *tfexec.State) (newState *tfexec.State, err error) {
+	ctx, span := tracing.Start(ctx, "compute a new state")
+	defer func() { tracing.End(span, err) }()
+
+	slog.InfoContext(ctx, "compute a new state")
+	for _, action := range m.actions {
+		newState, err = action.StateUpdate(ctx, m.tf, currentState)
+		if err != nil {
+			return nil, err
+		}
+		currentState = tfexec.NewState(newState.Bytes())
+	}
+	return currentState, nil
+}
+
+// startSpan starts a span for the migrator.
+func (m *StateMigrator) startSpan(ctx context.Context, name string) (context.Context, trace.Span) {
+	return tracing.Start(ctx, name,
+		tracing.AttrDir.String(m.dir),
+		tracing.AttrWorkspace.String(m.workspace),
+	)
 }
 
 // Plan computes a new state by applying state migration operations to a temporary state.
 // It will fail if terraform plan detects any diffs with the new state.
-func (m *StateMigrator) Plan(ctx context.Context) error {
-	log.Printf("[INFO] [migrator] start state migrator plan\n")
-	_, err := m.plan(ctx)
+func (m *StateMigrator) Plan(ctx context.Context) (err error) {
+	ctx, span := m.startSpan(ctx, "state migrator plan")
+	defer func() { tracing.End(span, err) }()
+
+	ctx = logging.With(logContext(ctx, m.dir, m.workspace), "phase", "plan")
+	cleanup, err := m.isolate(ctx)
+	if err != nil {
+		return err
+	}
+	// remove the isolated work dir on exit.
+	defer func() {
+		err = errors.Join(err, cleanup())
+	}()
+
+	slog.InfoContext(ctx, "start state migrator plan")
+	_, _, err = m.plan(ctx)
 	if err != nil {
 		return err
 	}
-	log.Printf("[INFO] [migrator] state migrator plan success!\n")
+	slog.InfoContext(ctx, "state migrator plan success!")
 	return nil
 }
 
@@ -201,22 +260,88 @@ func (m *StateMigrator) Plan(ctx context.Context) error {
 // It will fail if terraform plan detects any diffs with the new state.
 // We are intended to this is used for state refactoring.
 // Any state migration operations should not break any real resources.
-func (m *StateMigrator) Apply(ctx context.Context) error {
+// If the remote state has been changed during the migration, it aborts or
+// re-runs the migration against the fresh remote state.
+func (m *StateMigrator) Apply(ctx context.Context) (err error) {
+	ctx, span := m.startSpan(ctx, "state migrator apply")
+	defer func() { tracing.End(span, err) }()
+
+	ctx = logging.With(logContext(ctx, m.dir, m.workspace), "phase", "apply")
+	cleanup, err := m.isolate(ctx)
+	if err != nil {
+		return err
+	}
+	// remove the isolated work dir on exit.
+	defer func() {
+		err = errors.Join(err, cleanup())
+	}()
+
+	return rerunOnRemoteStateChange(ctx, m.o, m.apply)
+}
+
+// isolate switches the TerraformCLI to an isolated work dir if enabled, and
+// returns a function to switch it back and remove the isolated work dir.
+func (m *StateMigrator) isolate(ctx context.Context) (func() error, error) {
+	tf, cleanup, err := isolateWorkDir(ctx, m.o, m.tf, m.dir)
+	if err != nil {
+		return nil, err
+	}
+
+	orig := m.tf
+	m.tf = tf
+	return func() error {
+		m.tf = orig
+		return cleanup()
+	}, nil
+}
+
+// apply computes a new state and pushes it to remote state.
+// It holds a lock of the remote state from pulling the state until pushing a
+// new state.
+func (m *StateMigrator) apply(ctx context.Context) (err error) {
+	unlock, err := lockState(ctx, m.o, m.dir, m.workspace)
+	if err != nil {
+		return err
+	}
+	// release the lock on exit even if canceled.
+	defer func() {
+		err = errors.Join(err, unlock(context.WithoutCancel(ctx)))
+	}()
+
 	// Check if a new state does not have any diffs compared to real resources
 	// before push a new state to remote.
-	log.Printf("[INFO] [migrator] start state migrator plan phase for apply\n")
-	state, err := m.plan(ctx)
+	planCtx := logging.With(ctx, "phase", "plan")
+	slog.InfoContext(planCtx, "start state migrator plan phase for apply")
+	pulledState, state, err := m.plan(planCtx)
+	if err != nil {
+		return err
+	}
+
+	// make sure that no one has changed the remote state since we pulled it.
+	err = checkRemoteStateUnchanged(ctx, m.tf, pulledState)
 	if err != nil {
 		return err
 	}
 
-	// push the new state to remote.
-	log.Printf("[INFO] [migrator] start state migrator apply phase\n")
-	log.Printf("[INFO] [migrator] push the new state to remote\n")
-	err = m.tf.StatePush(ctx, state)
+	// back up the current remote state before overwriting it.
+	err = backupState(ctx, m.o, m.dir, m.workspace, pulledState)
+	if err != nil {
+		return err
+	}
+
+	// push the new state to remote unless canceled.
+	err = checkNotCanceled(ctx)
+	if err != nil {
+		return err
+	}
+	pushCtx, pushSpan := tracing.Start(context.WithoutCancel(ctx), "apply phase", tracing.AttrPhase.String("apply"))
+	slog.InfoContext(pushCtx, "start state migrator apply phase")
+	slog.InfoContext(pushCtx, "push the new state to remote")
+	err = m.tf.StatePush(pushCtx, state)
+	tracing.End(pushSpan, err)
 	if err != nil {
 		return err
 	}
-	log.Printf("[INFO] [migrator] state migrator apply success!\n")
+	slog.InfoContext(ctx, "state migrator apply success!")
 	return nil
 }
@@ -226,6 +226,60 @@ resource "time_static" "qux" { triggers = {} }
 	}
 }
 
+func TestAccStateMigratorApplyIsolated(t *testing.T) {
+	tfexec.SkipUnlessAcceptanceTestEnabled(t)
+
+	backend := tfexec.GetTestAccBackendS3Config(t.Name())
+
+	source := `
+resource "null_resource" "foo" {}
+resource "null_resource" "bar" {}
+`
+
+	workspace := "default"
+	tf := tfexec.SetupTestAccWithApply(t, workspace, backend+source)
+	ctx := context.Background()
+
+	updatedSource := `
+resource "null_resource" "foo2" {}
+resource "null_resource" "bar" {}
+`
+
+	tfexec.UpdateTestAccSource(t, tf, backend+updatedSource)
+
+	actions := []StateAction{
+		NewStateMvAction("null_resource.foo", "null_resource.foo2"),
+	}
+
+	m := NewStateMigrator(tf.Dir(), workspace, actions, &MigratorOption{Isolated: true}, false, false)
+	err := m.Apply(ctx)
+	if err != nil {
+		t.Fatalf("failed to run migrator apply: %s", err)
+	}
+
+	// the original work dir is never touched.
+	for _, name := range []string{"_tfmigrate_override.tf", "terraform.tfstate.d"} {
+		if _, err := os.Stat(filepath.Join(tf.Dir(), name)); !os.IsNotExist(err) {
+			t.Errorf("expected %s not to exist in the original work dir: %v", name, err)
+		}
+	}
+
+	got, err := tf.StateList(ctx, nil, nil)
+	if err != nil {
+		t.Fatalf("failed to run terraform state list: %s", err)
+	}
+
+	want := []string{
+		"null_resource.foo2",
+		"null_resource.bar",
+	}
+	sort.Strings(got)
+	sort.Strings(want)
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got state: %v, want state: %v", got, want)
+	}
+}
+
 func TestAccStateMigratorApplyWithWorkspace(t *testing.T) {
 	tfexec.SkipUnlessAcceptanceTestEnabled(t)
 
@@ -630,3 +684,168 @@ resource "null_resource" "bar" {}
 		t.Fatalf("expected migrator plan error to contain bucket required error: %s", err.Error())
 	}
 }
+
+func TestAccStateMigratorApplyWithStateEncryption(t *testing.T) {
+	tfexec.SkipUnlessAcceptanceTestEnabled(t)
+	tfexec.SkipUnlessStateEncryptionSupported(t)
+
+	backend := tfexec.GetTestAccBackendS3Config(t.Name())
+	encryption := tfexec.GetTestAccStateEncryptionConfig(false)
+
+	source := `
+resource "null_resource" "foo" {}
+resource "null_resource" "bar" {}
+`
+
+	workspace := "default"
+	tf := tfexec.SetupTestAccWithApply(t, workspace, backend+encryption+source)
+	ctx := context.Background()
+
+	updatedSource := `
+resource "null_resource" "foo2" {}
+resource "null_resource" "bar" {}
+`
+
+	tfexec.UpdateTestAccSource(t, tf, backend+encryption+updatedSource)
+
+	actions := []StateAction{
+		NewStateMvAction("null_resource.foo", "null_resource.foo2"),
+	}
+
+	m := NewStateMigrator(tf.Dir(), workspace, actions, &MigratorOption{}, false, false)
+	err := m.Apply(ctx)
+	if err != nil {
+		t.Fatalf("failed to run migrator apply: %s", err)
+	}
+
+	got, err := tf.StateList(ctx, nil, nil)
+	if err != nil {
+		t.Fatalf("failed to run terraform state list: %s", err)
+	}
+
+	want := []string{
+		"null_resource.foo2",
+		"null_resource.bar",
+	}
+	sort.Strings(got)
+	sort.Strings(want)
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got state: %v, want state: %v", got, want)
+	}
+
+	changed, err := tf.PlanHasChange(ctx, nil)
+	if err != nil {
+		t.Fatalf("failed to run PlanHasChange: %s", err)
+	}
+	if changed {
+		t.Fatalf("expect not to have changes")
+	}
+}
+
+func TestAccStateMigratorApplyWithStateEncryptionEnv(t *testing.T) {
+	tfexec.SkipUnlessAcceptanceTestEnabled(t)
+	tfexec.SkipUnlessStateEncryptionSupported(t)
+
+	// The state target in the environment variable takes precedence over the
+	// override file, so it must be removed while the backend is local.
+	t.Setenv("TF_ENCRYPTION", fmt.Sprintf(`
+key_provider "pbkdf2" "test" {
+  passphrase = "%s"
+}
+method "aes_gcm" "test" {
+  keys = key_provider.pbkdf2.test
+}
+state {
+  method = method.aes_gcm.test
+}
+`, tfexec.TestStateEncryptionPassphrase))
+
+	backend := tfexec.GetTestAccBackendS3Config(t.Name())
+
+	source := `
+resource "null_resource" "foo" {}
+resource "null_resource" "bar" {}
+`
+
+	workspace := "default"
+	tf := tfexec.SetupTestAccWithApply(t, workspace, backend+source)
+	ctx := context.Background()
+
+	updatedSource := `
+resource "null_resource" "foo2" {}
+resource "null_resource" "bar" {}
+`
+
+	tfexec.UpdateTestAccSource(t, tf, backend+updatedSource)
+
+	actions := []StateAction{
+		NewStateMvAction("null_resource.foo", "null_resource.foo2"),
+	}
+
+	m := NewStateMigrator(tf.Dir(), workspace, actions, &MigratorOption{}, false, false)
+	err := m.Apply(ctx)
+	if err != nil {
+		t.Fatalf("failed to run migrator apply: %s", err)
+	}
+
+	changed, err := tf.PlanHasChange(ctx, nil)
+	if err != nil {
+		t.Fatalf("failed to run PlanHasChange: %s", err)
+	}
+	if changed {
+		t.Fatalf("expect not to have changes")
+	}
+}
+
+func TestAccStateMigratorApplyWithStateEncryptionTransition(t *testing.T) {
+	tfexec.SkipUnlessAcceptanceTestEnabled(t)
+	tfexec.SkipUnlessStateEncryptionSupported(t)
+
+	backend := tfexec.GetTestAccBackendS3Config(t.Name())
+
+	source := `
+resource "null_resource" "foo" {}
+resource "null_resource" "bar" {}
+`
+
+	// The remote state is written as plaintext.
+	workspace := "default"
+	tf := tfexec.SetupTestAccWithApply(t, workspace, backend+source)
+	ctx := context.Background()
+
+	updatedSource := `
+resource "null_resource" "foo2" {}
+resource "null_resource" "bar" {}
+`
+
+	// Enable encryption with a fallback to read the plaintext remote state.
+	tfexec.UpdateTestAccSource(t, tf, backend+tfexec.GetTestAccStateEncryptionConfig(true)+updatedSource)
+
+	actions := []StateAction{
+		NewStateMvAction("null_resource.foo", "null_resource.foo2"),
+	}
+
+	m := NewStateMigrator(tf.Dir(), workspace, actions, &MigratorOption{}, false, false)
+	err := m.Apply(ctx)
+	if err != nil {
+		t.Fatalf("failed to run migrator apply: %s", err)
+	}
+
+	// Remove the fallback to make sure that the pushed state is encrypted.
+	tfexec.UpdateTestAccSource(t, tf, backend+tfexec.GetTestAccStateEncryptionConfig(false)+updatedSource)
+
+	got, err := tf.StateList(ctx, nil, nil)
+	if err != nil {
+		t.Fatalf("failed to run terraform state list: %s", err)
+	}
+
+	want := []string{
+		"null_resource.foo2",
+		"null_resource.bar",
+	}
+	sort.Strings(got)
+	sort.Strings(want)
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got state: %v, want state: %v", got, want)
+	}
+}
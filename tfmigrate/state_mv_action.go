@@ -16,7 +16,7 @@ type StateMvAction struct {
 	destination string
 }
 
-var _ StateAction = (*StateMvAction)(nil)
+var _ InvertibleStateAction = (*StateMvAction)(nil)
 
 // NewStateMvAction returns a new StateMvAction instance.
 func NewStateMvAction(source string, destination string) *StateMvAction {
@@ -35,3 +35,9 @@ func (a *StateMvAction) StateUpdate(ctx context.Context, tf tfexec.TerraformCLI,
 	newState, _, err := tf.StateMv(ctx, state, nil, a.source, a.destination, "-backup=/dev/null")
 	return newState, err
 }
+
+// Inverse returns a new action which moves a resource from destination address
+// back to source address.
+func (a *StateMvAction) Inverse() StateAction {
+	return NewStateMvAction(a.destination, a.source)
+}
@@ -45,7 +45,10 @@ func (a *StateXmvAction) StateUpdate(ctx context.Context, tf tfexec.TerraformCLI
 }
 
 // generateMvActions uses an xmv and use the state to determine the corresponding mv actions.
-func (a *StateXmvAction) generateMvActions(ctx context.Context, tf tfexec.TerraformCLI, state *tfexec.State) ([]*StateMvAction, error) {
+func (a *StateXmvAction) generateMvActions(ctx context.Context, tf tfexec.TerraformCLI, state *tfexec.State) (actions []*StateMvAction, err error) {
+	ctx, span := startXmvSpan(ctx, a.source, a.destination)
+	defer func() { endXmvSpan(span, len(actions), err) }()
+
 	stateList, err := tf.StateList(ctx, state, nil)
 	if err != nil {
 		return nil, err
@@ -0,0 +1,535 @@
+package tfmigrate
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"math"
+	"os"
+	"reflect"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/hashicorp/hcl/v2/hclwrite"
+	"github.com/minamijoyo/tfmigrate/logging"
+	"github.com/minamijoyo/tfmigrate/tfexec"
+	"github.com/zclconf/go-cty/cty"
+)
+
+// resourceChange is a subset of a resource change in the JSON output of
+// terraform show for a plan file. We only decode fields we need.
+type resourceChange struct {
+	// Address is an absolute address of resource instance.
+	Address string `json:"address"`
+	// Mode is `managed` or `data`.
+	Mode string `json:"mode"`
+	// Type is a resource type.
+	Type string `json:"type"`
+	// Change is a planned change of the resource.
+	Change struct {
+		// Actions is a list of actions such as `create` and `delete`.
+		Actions []string `json:"actions"`
+		// Before is attributes before the change.
+		Before map[string]interface{} `json:"before"`
+		// After is attributes after the change.
+		// Note that unknown values are omitted.
+		After map[string]interface{} `json:"after"`
+	} `json:"change"`
+}
+
+// isDelete returns true if the resource is planned to be destroyed.
+func (r *resourceChange) isDelete() bool {
+	return r.Mode == "managed" && reflect.DeepEqual(r.Change.Actions, []string{"delete"})
+}
+
+// isCreate returns true if the resource is planned to be created.
+func (r *resourceChange) isCreate() bool {
+	return r.Mode == "managed" && reflect.DeepEqual(r.Change.Actions, []string{"create"})
+}
+
+// parseResourceChanges parses the JSON output of terraform show for a plan
+// file and returns a list of resource changes.
+func parseResourceChanges(b []byte) ([]resourceChange, error) {
+	var plan struct {
+		ResourceChanges []resourceChange `json:"resource_changes"`
+	}
+	if err := json.Unmarshal(b, &plan); err != nil {
+		return nil, fmt.Errorf("failed to parse plan json: %s", err)
+	}
+	return plan.ResourceChanges, nil
+}
+
+// suggestLogContext returns a context for logging in a given dir and workspace.
+func suggestLogContext(ctx context.Context, dir string, workspace string) context.Context {
+	return logging.With(ctx, "component", "suggest", "dir", dir, "workspace", workspace)
+}
+
+// planResourceChanges runs terraform plan in a given working directory and
+// returns a list of resource changes in the plan.
+func planResourceChanges(ctx context.Context, tf tfexec.TerraformCLI, workspace string) ([]resourceChange, error) {
+	ctx = suggestLogContext(ctx, tf.Dir(), workspace)
+	if err := initWorkDir(ctx, tf, workspace); err != nil {
+		return nil, err
+	}
+
+	slog.InfoContext(ctx, "plan changes")
+	plan, err := tf.Plan(ctx, nil, "-input=false", "-no-color")
+	if err != nil {
+		return nil, err
+	}
+
+	out, err := tf.Show(ctx, plan, "-json", "-no-color")
+	if err != nil {
+		return nil, err
+	}
+
+	return parseResourceChanges([]byte(out))
+}
+
+// moveSuggestion is a suggested move of a resource.
+type moveSuggestion struct {
+	// source is an address of resource planned to be destroyed.
+	source string
+	// destination is an address of resource planned to be created.
+	destination string
+	// score is a similarity score between the source and the destination.
+	score float64
+	// attributeMatched is true if any attribute of the source and the
+	// destination matches.
+	attributeMatched bool
+	// alternatives is a list of other candidates with the same score.
+	alternatives []string
+	// xmv is true if the source and the destination contain a wildcard and a
+	// placeholder for an xmv action.
+	xmv bool
+}
+
+// suggestion is a result of matching destroyed and created resources.
+type suggestion struct {
+	// moves is a list of suggested moves.
+	moves []*moveSuggestion
+	// unmatchedDeleted is a list of addresses planned to be destroyed, but not matched.
+	unmatchedDeleted []string
+	// unmatchedCreated is a list of addresses planned to be created, but not matched.
+	unmatchedCreated []string
+}
+
+// identityAttributes is a list of attribute names which likely identify a real
+// resource. If they are equal, it's a strong signal of the same resource.
+var identityAttributes = []string{"id", "arn", "name", "self_link", "bucket"}
+
+// Weights for computing a similarity score of resources.
+const (
+	identityAttributeWeight = 10.0
+	attributeRatioWeight    = 5.0
+	addressSimilarityWeight = 1.0
+)
+
+// scoreResourceChange returns a similarity score between a resource planned to
+// be destroyed and a resource planned to be created. The second return value is
+// false if they cannot be matched. The third return value is true if any
+// attribute matches.
+func scoreResourceChange(d *resourceChange, c *resourceChange) (float64, bool, bool) {
+	if d.Type != c.Type {
+		return 0, false, false
+	}
+
+	score := 0.0
+	before := d.Change.Before
+	after := c.Change.After
+
+	for _, k := range identityAttributes {
+		bv, ok1 := before[k]
+		av, ok2 := after[k]
+		if ok1 && ok2 && bv != nil && bv != "" && reflect.DeepEqual(bv, av) {
+			score += identityAttributeWeight
+		}
+	}
+
+	comparable, equal := 0, 0
+	for k, bv := range before {
+		av, ok := after[k]
+		if !ok || bv == nil || av == nil {
+			continue
+		}
+		comparable++
+		if reflect.DeepEqual(bv, av) {
+			equal++
+		}
+	}
+	if comparable > 0 {
+		score += attributeRatioWeight * float64(equal) / float64(comparable)
+	}
+
+	score += addressSimilarityWeight * addressSimilarity(d.Address, c.Address)
+
+	return score, true, equal > 0
+}
+
+// addressSimilarity returns a similarity of two addresses between 0 and 1
+// based on the Levenshtein distance.
+func addressSimilarity(a string, b string) float64 {
+	maxLen := len(a)
+	if len(b) > maxLen {
+		maxLen = len(b)
+	}
+	if maxLen == 0 {
+		return 1
+	}
+	return 1 - float64(levenshtein(a, b))/float64(maxLen)
+}
+
+// levenshtein returns the Levenshtein distance between two strings.
+func levenshtein(a string, b string) int {
+	prev := make([]int, len(b)+1)
+	curr := make([]int, len(b)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		curr[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			curr[j] = min(prev[j]+1, curr[j-1]+1, prev[j-1]+cost)
+		}
+		prev, curr = curr, prev
+	}
+	return prev[len(b)]
+}
+
+// matchResourceChanges pairs resources planned to be destroyed with resources
+// planned to be created of the same type. It greedily picks pairs in the order
+// of the similarity score. If other candidates have the same score as a picked
+// pair, they are recorded as alternatives for the pair.
+func matchResourceChanges(deleted []resourceChange, created []resourceChange) *suggestion {
+	type candidate struct {
+		d, c             int
+		score            float64
+		attributeMatched bool
+	}
+
+	candidates := []candidate{}
+	for i := range deleted {
+		for j := range created {
+			score, ok, attributeMatched := scoreResourceChange(&deleted[i], &created[j])
+			if ok {
+				candidates = append(candidates, candidate{d: i, c: j, score: score, attributeMatched: attributeMatched})
+			}
+		}
+	}
+
+	// sort by score in descending order.
+	// For stable outputs, sort ties by the order of addresses in the plan.
+	sort.SliceStable(candidates, func(x, y int) bool {
+		if candidates[x].score != candidates[y].score {
+			return candidates[x].score > candidates[y].score
+		}
+		if candidates[x].d != candidates[y].d {
+			return candidates[x].d < candidates[y].d
+		}
+		return candidates[x].c < candidates[y].c
+	})
+
+	usedDeleted := make(map[int]bool)
+	usedCreated := make(map[int]bool)
+	moves := []*moveSuggestion{}
+	for _, picked := range candidates {
+		if usedDeleted[picked.d] || usedCreated[picked.c] {
+			continue
+		}
+
+		alternatives := []string{}
+		for _, other := range candidates {
+			if math.Abs(other.score-picked.score) > 1e-9 || (other.d == picked.d && other.c == picked.c) {
+				continue
+			}
+			if other.d == picked.d && !usedCreated[other.c] {
+				alternatives = append(alternatives, created[other.c].Address)
+			}
+			if other.c == picked.c && !usedDeleted[other.d] {
+				alternatives = append(alternatives, deleted[other.d].Address)
+			}
+		}
+
+		usedDeleted[picked.d] = true
+		usedCreated[picked.c] = true
+		moves = append(moves, &moveSuggestion{
+			source:           deleted[picked.d].Address,
+			destination:      created[picked.c].Address,
+			score:            picked.score,
+			attributeMatched: picked.attributeMatched,
+			alternatives:     alternatives,
+		})
+	}
+
+	// sort moves by the order of source addresses in the plan.
+	order := make(map[string]int)
+	for i, d := range deleted {
+		order[d.Address] = i
+	}
+	sort.SliceStable(moves, func(x, y int) bool {
+		return order[moves[x].source] < order[moves[y].source]
+	})
+
+	s := &suggestion{moves: moves}
+	for i, d := range deleted {
+		if !usedDeleted[i] {
+			s.unmatchedDeleted = append(s.unmatchedDeleted, d.Address)
+		}
+	}
+	for j, c := range created {
+		if !usedCreated[j] {
+			s.unmatchedCreated = append(s.unmatchedCreated, c.Address)
+		}
+	}
+	return s
+}
+
+// filterResourceChanges returns resource changes which satisfy a given condition.
+func filterResourceChanges(changes []resourceChange, f func(*resourceChange) bool) []resourceChange {
+	filtered := []resourceChange{}
+	for i := range changes {
+		if f(&changes[i]) {
+			filtered = append(filtered, changes[i])
+		}
+	}
+	return filtered
+}
+
+// SuggestStateMigration runs terraform plan in a given working directory with
+// a given option and suggests a state migration which moves resources planned
+// to be destroyed to resources planned to be created of the same type.
+// It returns a draft migration file in HCL. Ambiguous or unmatched resources
+// are written as comments, so please review it before applying.
+func SuggestStateMigration(ctx context.Context, o *MigratorOption, dir string, workspace string, name string) ([]byte, error) {
+	tf := newTerraformCLI(o, dir, os.Environ())
+	changes, err := planResourceChanges(ctx, tf, workspace)
+	if err != nil {
+		return nil, err
+	}
+
+	deleted := filterResourceChanges(changes, (*resourceChange).isDelete)
+	created := filterResourceChanges(changes, (*resourceChange).isCreate)
+	slog.InfoContext(suggestLogContext(ctx, tf.Dir(), workspace), "found resources to destroy and create", "destroy", len(deleted), "create", len(created))
+
+	s := matchResourceChanges(deleted, created)
+
+	attrs := []migrationAttribute{{name: "dir", value: hclString(tf.Dir())}}
+	if workspace != "default" {
+		attrs = append(attrs, migrationAttribute{name: "workspace", value: hclString(workspace)})
+	}
+	return renderSuggestedMigration("state", name, attrs, s), nil
+}
+
+// SuggestMultiStateMigration runs terraform plan in given working directories
+// with a given option and suggests a multi state migration which moves
+// resources planned to be destroyed in the from dir to resources planned to be
+// created in the to dir of the same type. If all resources in a module are
+// moved with the same relative addresses, they are collapsed into an xmv action.
+// It returns a draft migration file in HCL. Ambiguous or unmatched resources
+// are written as comments, so please review it before applying.
+func SuggestMultiStateMigration(ctx context.Context, o *MigratorOption, fromDir string, toDir string, fromWorkspace string, toWorkspace string, name string) ([]byte, error) {
+	fromTf := newTerraformCLI(o, fromDir, os.Environ())
+	toTf := newTerraformCLI(o, toDir, os.Environ())
+	fromChanges, err := planResourceChanges(ctx, fromTf, fromWorkspace)
+	if err != nil {
+		return nil, err
+	}
+	toChanges, err := planResourceChanges(ctx, toTf, toWorkspace)
+	if err != nil {
+		return nil, err
+	}
+
+	deleted := filterResourceChanges(fromChanges, (*resourceChange).isDelete)
+	created := filterResourceChanges(toChanges, (*resourceChange).isCreate)
+	slog.InfoContext(suggestLogContext(ctx, fromTf.Dir(), fromWorkspace), "found resources to destroy", "destroy", len(deleted))
+	slog.InfoContext(suggestLogContext(ctx, toTf.Dir(), toWorkspace), "found resources to create", "create", len(created))
+
+	s := matchResourceChanges(deleted, created)
+
+	addresses := []string{}
+	for _, c := range fromChanges {
+		addresses = append(addresses, c.Address)
+	}
+	s.moves = collapseModuleMoves(s.moves, addresses)
+
+	attrs := []migrationAttribute{
+		{name: "from_dir", value: hclString(fromTf.Dir())},
+		{name: "to_dir", value: hclString(toTf.Dir())},
+	}
+	if fromWorkspace != "default" {
+		attrs = append(attrs, migrationAttribute{name: "from_workspace", value: hclString(fromWorkspace)})
+	}
+	if toWorkspace != "default" {
+		attrs = append(attrs, migrationAttribute{name: "to_workspace", value: hclString(toWorkspace)})
+	}
+	return renderSuggestedMigration("multi_state", name, attrs, s), nil
+}
+
+// modulePathRe matches a module path prefix of an address such as module.foo.module.bar[0].
+var modulePathRe = regexp.MustCompile(`^(module\.[a-zA-Z0-9_-]+(\[[^\]]*\])?\.)+`)
+
+// collapseModuleMoves collapses moves of resources in the same module into an
+// xmv action. Moves are grouped by the module path of the source and the
+// corresponding prefix of the destination. A group is collapsed only if it
+// moves every address in the from state which matches the wildcard, because
+// the wildcard is expanded against the whole state at migration time.
+// Ambiguous or low-confidence moves are never collapsed to keep their comments.
+// The addresses is a list of all addresses in the from state.
+func collapseModuleMoves(moves []*moveSuggestion, addresses []string) []*moveSuggestion {
+	type group struct {
+		sourcePrefix      string
+		destinationPrefix string
+		members           map[string]bool
+	}
+
+	groups := make(map[string]*group)
+	keys := make(map[*moveSuggestion]string)
+	for _, m := range moves {
+		if len(m.alternatives) > 0 || !m.attributeMatched {
+			continue
+		}
+		sourcePrefix := modulePathRe.FindString(m.source)
+		if sourcePrefix == "" {
+			// A resource in the root module can't be collapsed, because a
+			// wildcard without a module path matches every address.
+			continue
+		}
+		suffix := m.source[len(sourcePrefix):]
+		if !strings.HasSuffix(m.destination, suffix) {
+			continue
+		}
+		destinationPrefix := strings.TrimSuffix(m.destination, suffix)
+		if destinationPrefix != "" && modulePathRe.FindString(destinationPrefix) != destinationPrefix {
+			continue
+		}
+
+		key := sourcePrefix + "\x00" + destinationPrefix
+		g, ok := groups[key]
+		if !ok {
+			g = &group{sourcePrefix: sourcePrefix, destinationPrefix: destinationPrefix, members: make(map[string]bool)}
+			groups[key] = g
+		}
+		g.members[m.source] = true
+		keys[m] = key
+	}
+
+	collapsible := make(map[string]bool)
+	for key, g := range groups {
+		if len(g.members) < 2 {
+			continue
+		}
+		// Check membership with the same matcher as the xmv expander, because
+		// it's not anchored and also matches the prefix in a nested module.
+		re, err := makeSrcRegex(g.sourcePrefix + wildcardChar)
+		if err != nil {
+			continue
+		}
+		ok := true
+		for _, addr := range addresses {
+			if re.MatchString(addr) && !g.members[addr] {
+				ok = false
+				break
+			}
+		}
+		collapsible[key] = ok
+	}
+
+	collapsed := []*moveSuggestion{}
+	done := make(map[string]bool)
+	for _, m := range moves {
+		key, ok := keys[m]
+		if !ok || !collapsible[key] {
+			collapsed = append(collapsed, m)
+			continue
+		}
+		if done[key] {
+			continue
+		}
+		done[key] = true
+		g := groups[key]
+		collapsed = append(collapsed, &moveSuggestion{
+			source:           g.sourcePrefix + wildcardChar,
+			destination:      g.destinationPrefix + "$1",
+			score:            m.score,
+			attributeMatched: true,
+			xmv:              true,
+		})
+	}
+	return collapsed
+}
+
+// migrationAttribute is an attribute of a migration block.
+type migrationAttribute struct {
+	name string
+	// value is an expression in HCL.
+	value string
+}
+
+// renderSuggestedMigration renders a draft migration file with a given suggestion.
+func renderSuggestedMigration(migrationType string, name string, attrs []migrationAttribute, s *suggestion) []byte {
+	var b bytes.Buffer
+	fmt.Fprintf(&b, "migration %s %s {\n", hclString(migrationType), hclString(name))
+	for _, attr := range attrs {
+		fmt.Fprintf(&b, "  %s = %s\n", attr.name, attr.value)
+	}
+
+	b.WriteString("  actions = [\n")
+	for _, m := range s.moves {
+		if len(m.alternatives) > 0 {
+			fmt.Fprintf(&b, "    # ambiguous: other candidates with the same score: %s\n", strings.Join(m.alternatives, ", "))
+		}
+		if !m.attributeMatched {
+			b.WriteString("    # low confidence: no attributes matched\n")
+		}
+		cmd := "mv"
+		if m.xmv {
+			cmd = "xmv"
+		}
+		action := cmd + " " + quoteAddress(m.source) + " " + quoteAddress(m.destination)
+		fmt.Fprintf(&b, "    %s,\n", hclString(action))
+	}
+	b.WriteString("  ]\n")
+
+	if len(s.unmatchedDeleted) > 0 {
+		b.WriteString("  # unmatched: the following resources are planned to be destroyed:\n")
+		for _, addr := range s.unmatchedDeleted {
+			fmt.Fprintf(&b, "  # - %s\n", addr)
+		}
+	}
+	if len(s.unmatchedCreated) > 0 {
+		b.WriteString("  # unmatched: the following resources are planned to be created:\n")
+		for _, addr := range s.unmatchedCreated {
+			fmt.Fprintf(&b, "  # - %s\n", addr)
+		}
+	}
+	b.WriteString("}\n")
+
+	return b.Bytes()
+}
+
+// hclString returns a quoted string literal in HCL.
+func hclString(s string) string {
+	return string(hclwrite.TokensForValue(cty.StringVal(s)).Bytes())
+}
+
+// quoteAddress quotes a given address for an action string if needed.
+// An action string is split like a shell, so an address which contains quotes
+// or spaces, such as a for_each key, must be quoted.
+// Note that environment variables are not expanded in action strings.
+func quoteAddress(addr string) string {
+	if !strings.ContainsAny(addr, "\"' \\") {
+		return addr
+	}
+	if !strings.Contains(addr, "'") {
+		return "'" + addr + "'"
+	}
+	r := strings.NewReplacer(`\`, `\\`, `"`, `\"`)
+	return `"` + r.Replace(addr) + `"`
+}
@@ -0,0 +1,334 @@
+package tfmigrate
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/minamijoyo/tfmigrate/tfexec"
+)
+
+func TestMatchResourceChanges(t *testing.T) {
+	cases := []struct {
+		desc             string
+		planJSON         string
+		moves            [][2]string
+		ambiguous        []string
+		unmatchedDeleted []string
+		unmatchedCreated []string
+	}{
+		{
+			desc: "simple rename",
+			planJSON: `{"resource_changes": [
+  {"address": "aws_s3_bucket.foo", "mode": "managed", "type": "aws_s3_bucket", "change": {"actions": ["delete"], "before": {"bucket": "foo", "id": "foo"}, "after": null}},
+  {"address": "aws_s3_bucket.bar", "mode": "managed", "type": "aws_s3_bucket", "change": {"actions": ["create"], "before": null, "after": {"bucket": "foo"}}}
+]}`,
+			moves: [][2]string{{"aws_s3_bucket.foo", "aws_s3_bucket.bar"}},
+		},
+		{
+			desc: "match by attributes rather than addresses",
+			planJSON: `{"resource_changes": [
+  {"address": "aws_iam_user.foo", "mode": "managed", "type": "aws_iam_user", "change": {"actions": ["delete"], "before": {"name": "alice", "path": "/"}, "after": null}},
+  {"address": "aws_iam_user.bar", "mode": "managed", "type": "aws_iam_user", "change": {"actions": ["delete"], "before": {"name": "bob", "path": "/"}, "after": null}},
+  {"address": "module.users.aws_iam_user.foo", "mode": "managed", "type": "aws_iam_user", "change": {"actions": ["create"], "before": null, "after": {"name": "bob", "path": "/"}}},
+  {"address": "module.users.aws_iam_user.bar", "mode": "managed", "type": "aws_iam_user", "change": {"actions": ["create"], "before": null, "after": {"name": "alice", "path": "/"}}}
+]}`,
+			moves: [][2]string{
+				{"aws_iam_user.foo", "module.users.aws_iam_user.bar"},
+				{"aws_iam_user.bar", "module.users.aws_iam_user.foo"},
+			},
+		},
+		{
+			desc: "different types and unmatched",
+			planJSON: `{"resource_changes": [
+  {"address": "null_resource.foo", "mode": "managed", "type": "null_resource", "change": {"actions": ["delete"], "before": {"id": "123"}, "after": null}},
+  {"address": "time_static.foo", "mode": "managed", "type": "time_static", "change": {"actions": ["create"], "before": null, "after": {}}},
+  {"address": "data.null_data_source.foo", "mode": "data", "type": "null_data_source", "change": {"actions": ["read"], "before": null, "after": {}}}
+]}`,
+			moves:            [][2]string{},
+			unmatchedDeleted: []string{"null_resource.foo"},
+			unmatchedCreated: []string{"time_static.foo"},
+		},
+		{
+			desc: "ignore replace",
+			planJSON: `{"resource_changes": [
+  {"address": "null_resource.foo", "mode": "managed", "type": "null_resource", "change": {"actions": ["delete", "create"], "before": {"id": "123"}, "after": {}}},
+  {"address": "null_resource.bar", "mode": "managed", "type": "null_resource", "change": {"actions": ["create"], "before": null, "after": {}}}
+]}`,
+			moves:            [][2]string{},
+			unmatchedCreated: []string{"null_resource.bar"},
+		},
+		{
+			desc: "ambiguous",
+			planJSON: `{"resource_changes": [
+  {"address": "null_resource.foo", "mode": "managed", "type": "null_resource", "change": {"actions": ["delete"], "before": {"id": "123"}, "after": null}},
+  {"address": "null_resource.bar", "mode": "managed", "type": "null_resource", "change": {"actions": ["create"], "before": null, "after": {}}},
+  {"address": "null_resource.baz", "mode": "managed", "type": "null_resource", "change": {"actions": ["create"], "before": null, "after": {}}}
+]}`,
+			moves:            [][2]string{{"null_resource.foo", "null_resource.bar"}},
+			unmatchedCreated: []string{"null_resource.baz"},
+			ambiguous:        []string{"null_resource.foo"},
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.desc, func(t *testing.T) {
+			changes, err := parseResourceChanges([]byte(tc.planJSON))
+			if err != nil {
+				t.Fatalf("unexpected err: %s", err)
+			}
+			deleted := filterResourceChanges(changes, (*resourceChange).isDelete)
+			created := filterResourceChanges(changes, (*resourceChange).isCreate)
+
+			s := matchResourceChanges(deleted, created)
+
+			moves := [][2]string{}
+			ambiguous := []string{}
+			for _, m := range s.moves {
+				moves = append(moves, [2]string{m.source, m.destination})
+				if len(m.alternatives) > 0 {
+					ambiguous = append(ambiguous, m.source)
+				}
+			}
+			if diff := cmp.Diff(moves, tc.moves); diff != "" {
+				t.Errorf("got moves: %v, want = %v, diff = %s", moves, tc.moves, diff)
+			}
+			if tc.ambiguous == nil {
+				tc.ambiguous = []string{}
+			}
+			if diff := cmp.Diff(ambiguous, tc.ambiguous); diff != "" {
+				t.Errorf("got ambiguous: %v, want = %v, diff = %s", ambiguous, tc.ambiguous, diff)
+			}
+			if diff := cmp.Diff(s.unmatchedDeleted, tc.unmatchedDeleted); diff != "" {
+				t.Errorf("got unmatchedDeleted: %v, want = %v, diff = %s", s.unmatchedDeleted, tc.unmatchedDeleted, diff)
+			}
+			if diff := cmp.Diff(s.unmatchedCreated, tc.unmatchedCreated); diff != "" {
+				t.Errorf("got unmatchedCreated: %v, want = %v, diff = %s", s.unmatchedCreated, tc.unmatchedCreated, diff)
+			}
+		})
+	}
+}
+
+func TestRenderSuggestedMigration(t *testing.T) {
+	s := &suggestion{
+		moves: []*moveSuggestion{
+			{source: "null_resource.foo", destination: "null_resource.bar", attributeMatched: true},
+			{source: `null_resource.baz["a b"]`, destination: `null_resource.qux["a b"]`, alternatives: []string{`null_resource.qux["c"]`}},
+		},
+		unmatchedDeleted: []string{"null_resource.d"},
+		unmatchedCreated: []string{"null_resource.c"},
+	}
+	attrs := []migrationAttribute{{name: "dir", value: `"dir1"`}}
+
+	got := string(renderSuggestedMigration("state", "test", attrs, s))
+	want := `migration "state" "test" {
+  dir = "dir1"
+  actions = [
+    "mv null_resource.foo null_resource.bar",
+    # ambiguous: other candidates with the same score: null_resource.qux["c"]
+    # low confidence: no attributes matched
+    "mv 'null_resource.baz[\"a b\"]' 'null_resource.qux[\"a b\"]'",
+  ]
+  # unmatched: the following resources are planned to be destroyed:
+  # - null_resource.d
+  # unmatched: the following resources are planned to be created:
+  # - null_resource.c
+}
+`
+	if got != want {
+		t.Errorf("got:\n%s\nwant:\n%s", got, want)
+	}
+
+	// The rendered action must be parsed back to the original addresses.
+	action, err := NewStateActionFromString(`mv 'null_resource.baz["a b"]' 'null_resource.qux["a b"]'`)
+	if err != nil {
+		t.Fatalf("failed to parse action: %s", err)
+	}
+	mv := action.(*StateMvAction)
+	if mv.source != `null_resource.baz["a b"]` || mv.destination != `null_resource.qux["a b"]` {
+		t.Errorf("unexpected action: %#v", mv)
+	}
+}
+
+func TestCollapseModuleMoves(t *testing.T) {
+	cases := []struct {
+		desc      string
+		moves     []*moveSuggestion
+		addresses []string
+		want      [][2]string
+	}{
+		{
+			desc: "module to root",
+			moves: []*moveSuggestion{
+				{source: "module.foo.null_resource.a", destination: "null_resource.a", attributeMatched: true},
+				{source: "module.foo.null_resource.b", destination: "null_resource.b", attributeMatched: true},
+				{source: "null_resource.c", destination: "null_resource.c", attributeMatched: true},
+			},
+			addresses: []string{"module.foo.null_resource.a", "module.foo.null_resource.b", "null_resource.c", "null_resource.d"},
+			want: [][2]string{
+				{"xmv module.foo.*", "$1"},
+				{"mv null_resource.c", "null_resource.c"},
+			},
+		},
+		{
+			desc: "module to module",
+			moves: []*moveSuggestion{
+				{source: `module.foo["x"].null_resource.a`, destination: "module.bar.null_resource.a", attributeMatched: true},
+				{source: `module.foo["x"].null_resource.b[0]`, destination: "module.bar.null_resource.b[0]", attributeMatched: true},
+			},
+			addresses: []string{`module.foo["x"].null_resource.a`, `module.foo["x"].null_resource.b[0]`, `module.foo["y"].null_resource.a`},
+			want: [][2]string{
+				{`xmv module.foo["x"].*`, "module.bar.$1"},
+			},
+		},
+		{
+			desc: "root module",
+			moves: []*moveSuggestion{
+				{source: "null_resource.a", destination: "null_resource.a", attributeMatched: true},
+				{source: "null_resource.b", destination: "null_resource.b", attributeMatched: true},
+			},
+			addresses: []string{"null_resource.a", "null_resource.b"},
+			want: [][2]string{
+				{"mv null_resource.a", "null_resource.a"},
+				{"mv null_resource.b", "null_resource.b"},
+			},
+		},
+		{
+			desc: "nested module with the same name",
+			moves: []*moveSuggestion{
+				{source: "module.foo.null_resource.a", destination: "null_resource.a", attributeMatched: true},
+				{source: "module.foo.null_resource.b", destination: "null_resource.b", attributeMatched: true},
+			},
+			addresses: []string{"module.foo.null_resource.a", "module.foo.null_resource.b", "module.bar.module.foo.null_resource.c"},
+			want: [][2]string{
+				{"mv module.foo.null_resource.a", "null_resource.a"},
+				{"mv module.foo.null_resource.b", "null_resource.b"},
+			},
+		},
+		{
+			desc: "partial module",
+			moves: []*moveSuggestion{
+				{source: "module.foo.null_resource.a", destination: "null_resource.a", attributeMatched: true},
+				{source: "module.foo.null_resource.b", destination: "null_resource.b", attributeMatched: true},
+			},
+			addresses: []string{"module.foo.null_resource.a", "module.foo.null_resource.b", "module.foo.null_resource.c"},
+			want: [][2]string{
+				{"mv module.foo.null_resource.a", "null_resource.a"},
+				{"mv module.foo.null_resource.b", "null_resource.b"},
+			},
+		},
+		{
+			desc: "renamed or low confidence",
+			moves: []*moveSuggestion{
+				{source: "module.foo.null_resource.a", destination: "null_resource.a2", attributeMatched: true},
+				{source: "module.foo.null_resource.b", destination: "null_resource.b"},
+			},
+			addresses: []string{"module.foo.null_resource.a", "module.foo.null_resource.b"},
+			want: [][2]string{
+				{"mv module.foo.null_resource.a", "null_resource.a2"},
+				{"mv module.foo.null_resource.b", "null_resource.b"},
+			},
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.desc, func(t *testing.T) {
+			got := [][2]string{}
+			for _, m := range collapseModuleMoves(tc.moves, tc.addresses) {
+				cmd := "mv "
+				if m.xmv {
+					cmd = "xmv "
+				}
+				got = append(got, [2]string{cmd + m.source, m.destination})
+			}
+			if diff := cmp.Diff(got, tc.want); diff != "" {
+				t.Errorf("got: %v, want = %v, diff = %s", got, tc.want, diff)
+			}
+		})
+	}
+}
+
+func TestAccSuggestStateMigration(t *testing.T) {
+	tfexec.SkipUnlessAcceptanceTestEnabled(t)
+
+	backend := tfexec.GetTestAccBackendS3Config(t.Name())
+
+	source := `
+resource "null_resource" "foo" {}
+resource "null_resource" "bar" {}
+`
+
+	workspace := "default"
+	tf := tfexec.SetupTestAccWithApply(t, workspace, backend+source)
+	ctx := context.Background()
+
+	updatedSource := `
+resource "null_resource" "foo2" {}
+resource "null_resource" "baz" {}
+`
+
+	tfexec.UpdateTestAccSource(t, tf, backend+updatedSource)
+
+	got, err := SuggestStateMigration(ctx, &MigratorOption{}, tf.Dir(), workspace, "test")
+	if err != nil {
+		t.Fatalf("failed to run SuggestStateMigration: %s", err)
+	}
+
+	for _, want := range []string{
+		`"mv null_resource.foo null_resource.foo2"`,
+		`"mv null_resource.bar null_resource.baz"`,
+	} {
+		if !strings.Contains(string(got), want) {
+			t.Errorf("expected to contain %s, but got:\n%s", want, string(got))
+		}
+	}
+}
+
+func TestAccSuggestMultiStateMigration(t *testing.T) {
+	tfexec.SkipUnlessAcceptanceTestEnabled(t)
+
+	fromBackend := tfexec.GetTestAccBackendS3Config(t.Name() + "/fromDir")
+	toBackend := tfexec.GetTestAccBackendS3Config(t.Name() + "/toDir")
+
+	fromSource := `
+resource "null_resource" "foo" {}
+resource "null_resource" "bar" {}
+resource "null_resource" "baz" {}
+`
+	toSource := `
+resource "null_resource" "qux" {}
+`
+
+	workspace := "default"
+	fromTf := tfexec.SetupTestAccWithApply(t, workspace, fromBackend+fromSource)
+	toTf := tfexec.SetupTestAccWithApply(t, workspace, toBackend+toSource)
+	ctx := context.Background()
+
+	fromUpdatedSource := `
+resource "null_resource" "baz" {}
+`
+	toUpdatedSource := `
+resource "null_resource" "foo" {}
+resource "null_resource" "bar2" {}
+resource "null_resource" "qux" {}
+`
+
+	tfexec.UpdateTestAccSource(t, fromTf, fromBackend+fromUpdatedSource)
+	tfexec.UpdateTestAccSource(t, toTf, toBackend+toUpdatedSource)
+
+	got, err := SuggestMultiStateMigration(ctx, &MigratorOption{}, fromTf.Dir(), toTf.Dir(), workspace, workspace, "test")
+	if err != nil {
+		t.Fatalf("failed to run SuggestMultiStateMigration: %s", err)
+	}
+
+	for _, want := range []string{
+		`migration "multi_state" "test"`,
+		`"mv null_resource.foo null_resource.foo"`,
+		`"mv null_resource.bar null_resource.bar2"`,
+	} {
+		if !strings.Contains(string(got), want) {
+			t.Errorf("expected to contain %s, but got:\n%s", want, string(got))
+		}
+	}
+}
@@ -0,0 +1,202 @@
+package tfmigrate
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/hashicorp/hcl/v2"
+	"github.com/hashicorp/hcl/v2/hclsyntax"
+	"github.com/zclconf/go-cty/cty"
+)
+
+// addressKind is a kind of address referenced by a state action.
+type addressKind int
+
+const (
+	// moduleAddress is an address of module such as module.foo.
+	moduleAddress addressKind = iota
+	// resourceAddress is an address of resource such as aws_instance.foo.
+	resourceAddress
+)
+
+// ValidateStateAction checks a given state action statically without running
+// terraform. In addition to the checks done by NewStateActionFromString, it
+// validates the syntax of resource addresses.
+func ValidateStateAction(cmdStr string) error {
+	action, err := NewStateActionFromString(cmdStr)
+	if err != nil {
+		return err
+	}
+
+	switch a := action.(type) {
+	case *StateMvAction:
+		return validateMvAddresses(a.source, a.destination)
+
+	case *StateXmvAction:
+		return validateXmvAddresses(a.source, a.destination)
+
+	case *StateRmAction:
+		for _, addr := range a.addresses {
+			if _, err := parseAddress(addr); err != nil {
+				return err
+			}
+		}
+		return nil
+
+	case *StateImportAction:
+		kind, err := parseAddress(a.address)
+		if err != nil {
+			return err
+		}
+		if kind != resourceAddress {
+			return fmt.Errorf("import address must be a resource: %s", a.address)
+		}
+		return nil
+
+	case *StateReplaceProviderAction:
+		if err := validateProviderAddress(a.source); err != nil {
+			return err
+		}
+		return validateProviderAddress(a.destination)
+
+	default:
+		return nil
+	}
+}
+
+// ValidateMultiStateAction checks a given multi state action statically
+// without running terraform. In addition to the checks done by
+// NewMultiStateActionFromString, it validates the syntax of resource addresses.
+func ValidateMultiStateAction(cmdStr string) error {
+	action, err := NewMultiStateActionFromString(cmdStr)
+	if err != nil {
+		return err
+	}
+
+	switch a := action.(type) {
+	case *MultiStateMvAction:
+		return validateMvAddresses(a.source, a.destination)
+
+	case *MultiStateXmvAction:
+		return validateXmvAddresses(a.source, a.destination)
+
+	default:
+		return nil
+	}
+}
+
+// validateMvAddresses checks that both addresses are valid and the same kind.
+func validateMvAddresses(source string, destination string) error {
+	srcKind, err := parseAddress(source)
+	if err != nil {
+		return err
+	}
+	dstKind, err := parseAddress(destination)
+	if err != nil {
+		return err
+	}
+	if srcKind != dstKind {
+		return fmt.Errorf("cannot move between a module and a resource: %s => %s", source, destination)
+	}
+	return nil
+}
+
+// xmvPlaceholderRe matches wildcards in a source and placeholders in a
+// destination of xmv action.
+var xmvPlaceholderRe = regexp.MustCompile(`\*|\$[0-9]+`)
+
+// xmvDestinationPlaceholderRe matches placeholders in a destination of xmv action.
+var xmvDestinationPlaceholderRe = regexp.MustCompile(`\$([0-9]+)`)
+
+// validateXmvAddresses checks that both addresses of xmv are syntactically valid.
+// Since a wildcard can match any part of an address, we can only check its
+// syntax roughly by replacing wildcards and placeholders with a dummy name.
+func validateXmvAddresses(source string, destination string) error {
+	for _, addr := range []string{source, destination} {
+		dummy := xmvPlaceholderRe.ReplaceAllString(addr, "x")
+		// An index key must be a literal, so we replace it with a number.
+		dummy = strings.ReplaceAll(dummy, "[x]", "[0]")
+		if _, diags := hclsyntax.ParseTraversalAbs([]byte(dummy), "", hcl.Pos{Line: 1, Column: 1}); diags.HasErrors() {
+			return fmt.Errorf("invalid address: %s", addr)
+		}
+	}
+
+	nrOfWildcards := strings.Count(source, wildcardChar)
+	for _, p := range xmvDestinationPlaceholderRe.FindAllStringSubmatch(destination, -1) {
+		n, err := strconv.Atoi(p[1])
+		if err != nil || n < 1 || n > nrOfWildcards {
+			return fmt.Errorf("placeholder %s in destination does not match any wildcard in source: %s", p[0], source)
+		}
+	}
+	return nil
+}
+
+// addressStep is a name in an address optionally followed by an index key.
+type addressStep struct {
+	name   string
+	hasKey bool
+}
+
+// parseAddress parses a given address of resource or module and returns its kind.
+// It accepts the following forms:
+// module.NAME[KEY]...
+// module.NAME[KEY]...TYPE.NAME[KEY]
+// module.NAME[KEY]...data.TYPE.NAME[KEY]
+// where module calls and index keys are optional.
+func parseAddress(addr string) (addressKind, error) {
+	traversal, diags := hclsyntax.ParseTraversalAbs([]byte(addr), "", hcl.Pos{Line: 1, Column: 1})
+	if diags.HasErrors() {
+		return 0, fmt.Errorf("invalid address: %s", addr)
+	}
+
+	steps := []addressStep{}
+	for _, t := range traversal {
+		switch s := t.(type) {
+		case hcl.TraverseRoot:
+			steps = append(steps, addressStep{name: s.Name})
+		case hcl.TraverseAttr:
+			steps = append(steps, addressStep{name: s.Name})
+		case hcl.TraverseIndex:
+			last := &steps[len(steps)-1]
+			if last.hasKey || (s.Key.Type() != cty.String && s.Key.Type() != cty.Number) {
+				return 0, fmt.Errorf("invalid index in address: %s", addr)
+			}
+			last.hasKey = true
+		default:
+			return 0, fmt.Errorf("invalid address: %s", addr)
+		}
+	}
+
+	i := 0
+	for i < len(steps) && steps[i].name == "module" {
+		if steps[i].hasKey || i+1 >= len(steps) {
+			return 0, fmt.Errorf("invalid module address: %s", addr)
+		}
+		i += 2
+	}
+	if i == len(steps) {
+		return moduleAddress, nil
+	}
+
+	if steps[i].name == "data" && !steps[i].hasKey {
+		i++
+	}
+	if len(steps)-i != 2 || steps[i].hasKey {
+		return 0, fmt.Errorf("invalid resource address: %s", addr)
+	}
+	return resourceAddress, nil
+}
+
+// providerAddressRe is a pattern of provider source address.
+// e.g.) registry.terraform.io/hashicorp/null, hashicorp/null, -/null
+var providerAddressRe = regexp.MustCompile(`^([a-zA-Z0-9.-]+(:[0-9]+)?/)?[a-zA-Z0-9_-]+/[a-zA-Z0-9_-]+$`)
+
+// validateProviderAddress checks a syntax of a given provider address.
+func validateProviderAddress(addr string) error {
+	if !providerAddressRe.MatchString(addr) {
+		return fmt.Errorf("invalid provider address: %s", addr)
+	}
+	return nil
+}
@@ -0,0 +1,170 @@
+package tfmigrate
+
+import "testing"
+
+func TestValidateStateAction(t *testing.T) {
+	cases := []struct {
+		desc   string
+		cmdStr string
+		ok     bool
+	}{
+		{
+			desc:   "mv resource",
+			cmdStr: "mv aws_security_group.foo aws_security_group.foo2",
+			ok:     true,
+		},
+		{
+			desc:   "mv resource in module with index",
+			cmdStr: `mv module.foo[0].aws_security_group.foo 'module.bar["baz"].aws_security_group.foo'`,
+			ok:     true,
+		},
+		{
+			desc:   "mv data resource",
+			cmdStr: "mv data.aws_ami.foo data.aws_ami.bar",
+			ok:     true,
+		},
+		{
+			desc:   "mv module",
+			cmdStr: "mv module.foo module.bar",
+			ok:     true,
+		},
+		{
+			desc:   "mv module to resource",
+			cmdStr: "mv module.foo aws_security_group.foo",
+			ok:     false,
+		},
+		{
+			desc:   "mv invalid syntax",
+			cmdStr: "mv aws_security_group.foo! aws_security_group.foo2",
+			ok:     false,
+		},
+		{
+			desc:   "mv missing resource name",
+			cmdStr: "mv aws_security_group aws_security_group.foo2",
+			ok:     false,
+		},
+		{
+			desc:   "mv too many names",
+			cmdStr: "mv aws_security_group.foo.bar aws_security_group.foo2",
+			ok:     false,
+		},
+		{
+			desc:   "mv index on resource type",
+			cmdStr: "mv aws_security_group[0].foo aws_security_group.foo2",
+			ok:     false,
+		},
+		{
+			desc:   "mv wrong arity",
+			cmdStr: "mv aws_security_group.foo",
+			ok:     false,
+		},
+		{
+			desc:   "mv unbalanced quote",
+			cmdStr: "mv aws_security_group.foo 'aws_security_group.foo2",
+			ok:     false,
+		},
+		{
+			desc:   "xmv with wildcards",
+			cmdStr: "xmv aws_security_group.* aws_security_group.$1_new",
+			ok:     true,
+		},
+		{
+			desc:   "xmv with wildcard index",
+			cmdStr: "xmv aws_security_group.foo[*] module.bar.aws_security_group.foo[$1]",
+			ok:     true,
+		},
+		{
+			desc:   "xmv placeholder out of range",
+			cmdStr: "xmv aws_security_group.* aws_security_group.$2",
+			ok:     false,
+		},
+		{
+			desc:   "rm",
+			cmdStr: "rm aws_security_group.foo module.bar",
+			ok:     true,
+		},
+		{
+			desc:   "rm invalid",
+			cmdStr: "rm aws_security_group.foo module",
+			ok:     false,
+		},
+		{
+			desc:   "import",
+			cmdStr: "import aws_security_group.foo sg-1234",
+			ok:     true,
+		},
+		{
+			desc:   "import module",
+			cmdStr: "import module.foo sg-1234",
+			ok:     false,
+		},
+		{
+			desc:   "replace-provider",
+			cmdStr: "replace-provider registry.terraform.io/-/null registry.terraform.io/hashicorp/null",
+			ok:     true,
+		},
+		{
+			desc:   "replace-provider invalid",
+			cmdStr: "replace-provider null hashicorp/null",
+			ok:     false,
+		},
+		{
+			desc:   "unknown type",
+			cmdStr: "foo aws_security_group.foo",
+			ok:     false,
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.desc, func(t *testing.T) {
+			err := ValidateStateAction(tc.cmdStr)
+			if tc.ok && err != nil {
+				t.Fatalf("unexpected err: %s", err)
+			}
+			if !tc.ok && err == nil {
+				t.Fatalf("expected to return an error, but no error: %s", tc.cmdStr)
+			}
+		})
+	}
+}
+
+func TestValidateMultiStateAction(t *testing.T) {
+	cases := []struct {
+		desc   string
+		cmdStr string
+		ok     bool
+	}{
+		{
+			desc:   "mv",
+			cmdStr: "mv aws_security_group.foo aws_security_group.foo2",
+			ok:     true,
+		},
+		{
+			desc:   "mv invalid",
+			cmdStr: "mv aws_security_group.foo module.foo",
+			ok:     false,
+		},
+		{
+			desc:   "xmv",
+			cmdStr: "xmv module.foo.* $1",
+			ok:     true,
+		},
+		{
+			desc:   "rm is not supported",
+			cmdStr: "rm aws_security_group.foo",
+			ok:     false,
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.desc, func(t *testing.T) {
+			err := ValidateMultiStateAction(tc.cmdStr)
+			if tc.ok && err != nil {
+				t.Fatalf("unexpected err: %s", err)
+			}
+			if !tc.ok && err == nil {
+				t.Fatalf("expected to return an error, but no error: %s", tc.cmdStr)
+			}
+		})
+	}
+}
@@ -1,9 +1,13 @@
 package tfmigrate
 
 import (
+	"context"
 	"fmt"
 	"regexp"
 	"strings"
+
+	"github.com/minamijoyo/tfmigrate/tracing"
+	"go.opentelemetry.io/otel/trace"
 )
 
 // xmvExpander is a helper object for implementing wildcard expansion for xmv actions.
@@ -19,6 +23,21 @@ func newXmvExpander(action *StateXmvAction) *xmvExpander {
 	}
 }
 
+// startXmvSpan starts a span for expanding an xmv action, because listing
+// resources in a large state and matching them can take time.
+func startXmvSpan(ctx context.Context, source string, destination string) (context.Context, trace.Span) {
+	return tracing.Start(ctx, "xmv expansion",
+		tracing.AttrXmvSource.String(source),
+		tracing.AttrXmvDestination.String(destination),
+	)
+}
+
+// endXmvSpan records the number of expanded mv actions and ends a span.
+func endXmvSpan(span trace.Span, n int, err error) {
+	span.SetAttributes(tracing.AttrXmvActions.Int(n))
+	tracing.End(span, err)
+}
+
 // A wildcardChar will greedy match with any character in the resource path.
 const matchWildcardRegex = "(.*)"
 const wildcardChar = "*"
@@ -0,0 +1,163 @@
+// Package tracing provides OpenTelemetry tracing for tfmigrate.
+// Spans are created for migrations, their phases and terraform commands, so
+// that we can find out which step of a slow migration takes time.
+// If tracing is not configured, spans are no-op.
+package tracing
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.21.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// instrumentationName is a name of the tracer.
+const instrumentationName = "github.com/minamijoyo/tfmigrate"
+
+// Config is a config for tracing.
+type Config struct {
+	// OTLP exports spans via OTLP over HTTP if true. The endpoint and other
+	// options are configured by the standard environment variables such as
+	// OTEL_EXPORTER_OTLP_ENDPOINT.
+	OTLP bool
+	// File is a path to a file which spans are appended to as JSON.
+	// If empty, spans are not written to a file.
+	File string
+}
+
+// NewConfigFromEnv returns a new Config from environment variables.
+// OTLP is enabled if an OTLP endpoint for traces is set.
+func NewConfigFromEnv() Config {
+	return Config{
+		OTLP: len(os.Getenv("OTEL_EXPORTER_OTLP_ENDPOINT")) > 0 ||
+			len(os.Getenv("OTEL_EXPORTER_OTLP_TRACES_ENDPOINT")) > 0,
+		File: os.Getenv("TFMIGRATE_TRACE_FILE"),
+	}
+}
+
+// Enabled returns true if any exporter is configured.
+func (c Config) Enabled() bool {
+	return c.OTLP || len(c.File) > 0
+}
+
+// Setup sets up the global tracer provider with exporters in a given config.
+// It returns a function to flush remaining spans and shut down the exporters,
+// which must be called before exit. If no exporter is configured, it does
+// nothing and the global tracer provider remains no-op.
+func Setup(ctx context.Context, c Config, version string) (func(context.Context) error, error) {
+	if !c.Enabled() {
+		return func(context.Context) error { return nil }, nil
+	}
+
+	closers := []func() error{}
+	closeAll := func() error {
+		var errs []error
+		for _, f := range closers {
+			errs = append(errs, f())
+		}
+		return errors.Join(errs...)
+	}
+
+	opts := []sdktrace.TracerProviderOption{}
+	if c.OTLP {
+		exporter, err := otlptracehttp.New(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create OTLP exporter: %s", err)
+		}
+		opts = append(opts, sdktrace.WithBatcher(exporter))
+	}
+
+	if len(c.File) > 0 {
+		f, err := os.OpenFile(c.File, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0600)
+		if err != nil {
+			return nil, fmt.Errorf("failed to open trace file: %s", err)
+		}
+		closers = append(closers, f.Close)
+		exporter, err := stdouttrace.New(stdouttrace.WithWriter(f))
+		if err != nil {
+			return nil, errors.Join(fmt.Errorf("failed to create file exporter: %s", err), closeAll())
+		}
+		// A file is written synchronously, so that no span is lost even if
+		// tfmigrate exits unexpectedly.
+		opts = append(opts, sdktrace.WithSyncer(exporter))
+	}
+
+	res, err := resource.Merge(
+		resource.Default(),
+		resource.NewSchemaless(
+			semconv.ServiceName("tfmigrate"),
+			semconv.ServiceVersion(version),
+		),
+	)
+	if err != nil {
+		return nil, errors.Join(fmt.Errorf("failed to create resource: %s", err), closeAll())
+	}
+	opts = append(opts, sdktrace.WithResource(res))
+
+	tp := sdktrace.NewTracerProvider(opts...)
+	otel.SetTracerProvider(tp)
+
+	shutdown := func(ctx context.Context) error {
+		// flush spans before closing the file.
+		return errors.Join(tp.Shutdown(ctx), closeAll())
+	}
+	return shutdown, nil
+}
+
+// Start starts a new span with given attributes as a child of a span in a
+// given context if any. It returns a context which contains the new span.
+func Start(ctx context.Context, name string, attrs ...attribute.KeyValue) (context.Context, trace.Span) {
+	return otel.Tracer(instrumentationName).Start(ctx, name, trace.WithAttributes(attrs...))
+}
+
+// End records a given error in a span if any and ends it.
+// It's intended to be deferred with a named error return value.
+func End(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
+
+// Attribute keys of spans.
+const (
+	// AttrMigration is a migration file name.
+	AttrMigration = attribute.Key("tfmigrate.migration")
+	// AttrType is a migration type such as state and multi_state.
+	AttrType = attribute.Key("tfmigrate.type")
+	// AttrDir is a working directory.
+	AttrDir = attribute.Key("tfmigrate.dir")
+	// AttrWorkspace is a terraform workspace.
+	AttrWorkspace = attribute.Key("tfmigrate.workspace")
+	// AttrPhase is a phase of a migration, which is plan or apply.
+	AttrPhase = attribute.Key("tfmigrate.phase")
+	// AttrXmvSource is a source address of an xmv action with wildcards.
+	AttrXmvSource = attribute.Key("tfmigrate.xmv.source")
+	// AttrXmvDestination is a destination address of an xmv action.
+	AttrXmvDestination = attribute.Key("tfmigrate.xmv.destination")
+	// AttrXmvActions is the number of mv actions expanded from an xmv action.
+	AttrXmvActions = attribute.Key("tfmigrate.xmv.actions")
+	// AttrSubcommand is a terraform subcommand such as "state pull".
+	AttrSubcommand = attribute.Key("terraform.subcommand")
+	// AttrArgs is arguments of a terraform command.
+	AttrArgs = attribute.Key("terraform.args")
+	// AttrWorkDir is a directory where a terraform command runs, which is a
+	// temporary one in isolated mode.
+	AttrWorkDir = attribute.Key("terraform.work_dir")
+	// AttrExitCode is an exit code of a terraform command.
+	AttrExitCode = attribute.Key("terraform.exit_code")
+	// AttrAttempts is the number of attempts of a terraform command
+	// including retries.
+	AttrAttempts = attribute.Key("terraform.attempts")
+)
@@ -0,0 +1,121 @@
+package tracing
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"go.opentelemetry.io/otel"
+)
+
+func TestNewConfigFromEnv(t *testing.T) {
+	cases := []struct {
+		desc string
+		env  map[string]string
+		want Config
+	}{
+		{
+			desc: "not configured",
+			env:  map[string]string{},
+			want: Config{},
+		},
+		{
+			desc: "otlp endpoint",
+			env:  map[string]string{"OTEL_EXPORTER_OTLP_ENDPOINT": "http://localhost:4318"},
+			want: Config{OTLP: true},
+		},
+		{
+			desc: "otlp traces endpoint",
+			env:  map[string]string{"OTEL_EXPORTER_OTLP_TRACES_ENDPOINT": "http://localhost:4318/v1/traces"},
+			want: Config{OTLP: true},
+		},
+		{
+			desc: "file",
+			env:  map[string]string{"TFMIGRATE_TRACE_FILE": "trace.json"},
+			want: Config{File: "trace.json"},
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.desc, func(t *testing.T) {
+			for _, k := range []string{"OTEL_EXPORTER_OTLP_ENDPOINT", "OTEL_EXPORTER_OTLP_TRACES_ENDPOINT", "TFMIGRATE_TRACE_FILE"} {
+				t.Setenv(k, tc.env[k])
+			}
+			got := NewConfigFromEnv()
+			if got != tc.want {
+				t.Errorf("got: %#v, want: %#v", got, tc.want)
+			}
+			if got.Enabled() != (tc.want != Config{}) {
+				t.Errorf("got enabled = %t", got.Enabled())
+			}
+		})
+	}
+}
+
+func TestSetupFile(t *testing.T) {
+	orig := otel.GetTracerProvider()
+	t.Cleanup(func() { otel.SetTracerProvider(orig) })
+
+	path := filepath.Join(t.TempDir(), "trace.json")
+	shutdown, err := Setup(context.Background(), Config{File: path}, "0.0.1")
+	if err != nil {
+		t.Fatalf("failed to set up: %s", err)
+	}
+
+	ctx, parent := Start(context.Background(), "parent", AttrMigration.String("mig1.hcl"))
+	_, child := Start(ctx, "child")
+	End(child, errors.New("failed"))
+	End(parent, nil)
+
+	if err := shutdown(context.Background()); err != nil {
+		t.Fatalf("failed to shut down: %s", err)
+	}
+
+	b, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("failed to read trace file: %s", err)
+	}
+
+	type span struct {
+		Name        string
+		SpanContext struct{ TraceID string }
+		Status      struct{ Code string }
+	}
+	var spans []span
+	dec := json.NewDecoder(bytes.NewReader(b))
+	for dec.More() {
+		var s span
+		if err := dec.Decode(&s); err != nil {
+			t.Fatalf("failed to decode a span: %s", err)
+		}
+		spans = append(spans, s)
+	}
+
+	if len(spans) != 2 {
+		t.Fatalf("got %d spans, want 2: %s", len(spans), string(b))
+	}
+	// spans are written in order of end.
+	if spans[0].Name != "child" || spans[1].Name != "parent" {
+		t.Errorf("got names = %s, %s", spans[0].Name, spans[1].Name)
+	}
+	if spans[0].SpanContext.TraceID != spans[1].SpanContext.TraceID {
+		t.Errorf("spans should be in the same trace: %s, %s", spans[0].SpanContext.TraceID, spans[1].SpanContext.TraceID)
+	}
+	if spans[0].Status.Code != "Error" || spans[1].Status.Code != "Unset" {
+		t.Errorf("got status = %s, %s", spans[0].Status.Code, spans[1].Status.Code)
+	}
+}
+
+func TestSetupDisabled(t *testing.T) {
+	shutdown, err := Setup(context.Background(), Config{}, "0.0.1")
+	if err != nil {
+		t.Fatalf("failed to set up: %s", err)
+	}
+	if err := shutdown(context.Background()); err != nil {
+		t.Fatalf("failed to shut down: %s", err)
+	}
+}